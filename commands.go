@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/blocklink/hxscanner/src/api"
+	"github.com/blocklink/hxscanner/src/config"
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/nodeservice"
+	"github.com/blocklink/hxscanner/src/plugins"
+)
+
+// 不扫描区块, 只执行一次的管理命令, 用法: ./hxscanner [flags] <command> [args...]
+func runCommand(args []string) error {
+	switch args[0] {
+	case "watch":
+		return runWatchCommand(args[1:])
+	case "backfill":
+		return runBackfillCommand(args[1:])
+	case "metadata":
+		return runMetadataCommand(args[1:])
+	case "serve":
+		// json-rpc代理需要把没有扫描到的请求转发给节点, 连不上节点时只从数据库返回
+		err := nodeservice.ConnectHxNode(context.Background(), config.SystemConfig.NodeApiUrl)
+		if err != nil {
+			fmt.Println("connect hx_node error " + err.Error() + ", rpc proxy will only answer from db")
+		} else {
+			defer nodeservice.CloseHxNodeConn()
+		}
+		return api.Serve(config.SystemConfig.HttpListenAddr)
+	default:
+		return errors.New("unknown command " + args[0])
+	}
+}
+
+// watch add <addr> [label] | watch remove <addr> | watch list
+func runWatchCommand(args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: watch add <addr> [label] | watch remove <addr> | watch list")
+	}
+	switch args[0] {
+	case "add":
+		if len(args) < 2 || len(args[1]) < 1 {
+			return errors.New("usage: watch add <addr> [label]")
+		}
+		addr := args[1]
+		old, err := db.FindWatchedAddress(addr)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			return errors.New("address " + addr + " already watched")
+		}
+		item := &db.WatchedAddressEntity{Addr: addr}
+		if len(args) > 2 {
+			item.Label = &args[2]
+		}
+		err = db.SaveWatchedAddress(item)
+		if err != nil {
+			return err
+		}
+		fmt.Println("watching " + addr)
+	case "remove":
+		if len(args) < 2 {
+			return errors.New("usage: watch remove <addr>")
+		}
+		err := db.DeleteWatchedAddress(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println("stop watching " + args[1])
+	case "list":
+		items, err := db.ListWatchedAddresses()
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			label := ""
+			if item.Label != nil {
+				label = *item.Label
+			}
+			fmt.Println(item.Addr + "\t" + label)
+		}
+	default:
+		return errors.New("unknown watch command " + args[0])
+	}
+	return nil
+}
+
+const backfillBatchSize = 500
+
+// backfill <table>, 从已经扫描的数据生成新增的表, 可以中断后重新执行
+func runBackfillCommand(args []string) error {
+	if len(args) < 1 {
+		return errors.New("usage: backfill address_operations|token_balance_changes|contracts|contract_calls|lock_balances|crosschain_transfers|coldhot_transfers")
+	}
+	switch args[0] {
+	case "address_operations":
+		count, err := plugins.BackfillAddressOperations(backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backfilled address operations of " + strconv.Itoa(count) + " operations")
+	case "token_balance_changes":
+		count, err := plugins.BackfillTokenBalanceChanges(backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backfilled token balance changes of " + strconv.Itoa(count) + " transfer events")
+	case "contracts":
+		count, err := plugins.BackfillContracts(backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backfilled " + strconv.Itoa(count) + " contracts")
+	case "contract_calls":
+		count, err := plugins.BackfillContractCalls(backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backfilled " + strconv.Itoa(count) + " contract calls")
+	case "lock_balances":
+		count, err := plugins.BackfillLockBalances(backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backfilled " + strconv.Itoa(count) + " lock balance operations")
+	case "crosschain_transfers":
+		count, err := plugins.BackfillCrosschainTransfers(backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backfilled " + strconv.Itoa(count) + " crosschain operations")
+	case "coldhot_transfers":
+		count, err := plugins.BackfillColdhotTransfers(backfillBatchSize)
+		if err != nil {
+			return err
+		}
+		fmt.Println("backfilled " + strconv.Itoa(count) + " coldhot transfer operations")
+	default:
+		return errors.New("unknown backfill target " + args[0])
+	}
+	return nil
+}
+
+// metadata keygen | metadata sign <private_key_file> <metadata_file> | metadata import <signed_file>
+func runMetadataCommand(args []string) error {
+	usage := errors.New("usage: metadata keygen | metadata sign <private_key_file> <metadata_file> | metadata import <signed_file>")
+	if len(args) < 1 {
+		return usage
+	}
+	switch args[0] {
+	case "keygen":
+		publicKey, privateKey, err := plugins.GenerateMetadataSigningKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println("public key: " + publicKey)
+		fmt.Println("private key: " + privateKey)
+	case "sign":
+		if len(args) < 3 {
+			return usage
+		}
+		privateKeyBytes, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		metadataBytes, err := ioutil.ReadFile(args[2])
+		if err != nil {
+			return err
+		}
+		signed, err := plugins.SignContractMetadata(string(privateKeyBytes), metadataBytes)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(signed))
+	case "import":
+		if len(args) < 2 {
+			return usage
+		}
+		fileBytes, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		count, err := plugins.ImportContractMetadata(fileBytes, config.SystemConfig.MetadataSigners)
+		if err != nil {
+			return err
+		}
+		fmt.Println("imported metadata of " + strconv.Itoa(count) + " token contracts")
+	default:
+		return usage
+	}
+	return nil
+}
@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 
 	"github.com/blocklink/hxscanner/src/config"
 	"github.com/blocklink/hxscanner/src/db"
 	"github.com/blocklink/hxscanner/src/nodeservice"
 	"github.com/blocklink/hxscanner/src/scanner"
+	"github.com/blocklink/hxscanner/src/sink"
+	"github.com/blocklink/hxscanner/src/subscription"
 	"github.com/blocklink/hxscanner/src/plugins"
 	"github.com/blocklink/hxscanner/src/log"
 )
@@ -34,15 +37,49 @@ func main() {
 	dbPassword := flag.String("db_pass", "", "postgresql database password")
 	dbName := flag.String("db_name", "hxscanner", "postgresql database for this application(=hxscanner)")
 	scanFromBlockNumberFlag := flag.Int("scan_from", -1, "scan from block number(default last scanned)")
+	depositConfirmations := flag.Int("deposit_confirmations", 30, "stop updating deposit confirmations after this count(=30)")
+	scriptsDir := flag.String("scripts_dir", "", "directory of lua script plugins(default no scripts)")
+	scriptTables := flag.String("script_tables", "", "comma separated tables lua scripts can insert into")
+	sinkSpecs := flag.String("sinks", "", "comma separated output sinks: ndjson:<dir>, stdout, tcp:<host:port>(default none)")
+	httpListenAddr := flag.String("http_addr", "127.0.0.1:8080", "listen address of serve command(=127.0.0.1:8080)")
+	wsListenAddr := flag.String("ws_addr", "", "listen address of websocket subscription server(default disabled)")
+	balanceReconcileInterval := flag.Int("balance_reconcile_interval", 1000, "reconcile balance ledger with node every this many blocks, 0 to disable(=1000)")
+	balanceReconcileAdjust := flag.Bool("balance_reconcile_adjust", false, "write ledger adjustments for balances mismatched with node(default false)")
+	blockInterval := flag.Int("block_interval", 5, "seconds between block slots, used to detect missed slots(=5)")
+	citizenCollectInterval := flag.Int("citizen_collect_interval", 100, "collect citizen missed blocks from node every this many blocks, 0 to disable(=100)")
+	coldhotUnsignedAlertBlocks := flag.Int("coldhot_unsigned_alert_blocks", 720, "alert when a coldhot transfer is still unsigned this many blocks after requested, 0 to disable(=720)")
+	metadataSigners := flag.String("metadata_signers", "", "comma separated hex ed25519 public keys trusted to sign token metadata files")
+	webhooksConfigPath := flag.String("webhooks_config", "", "webhook endpoints json config file(default no webhooks)")
 	flag.Parse()
 
 	config.SystemConfig = new(config.Config)
 	config.SystemConfig.NodeApiUrl = *nodeApiUrl
 	config.SystemConfig.CallerPubKeyString = *callerPubKey
 	config.SystemConfig.DbConnectionString = fmt.Sprintf("user=%s password=%s dbname=%s sslmode=%s host=%s port=%d", *dbUser, *dbPassword, *dbName, *dbSslMode, *dbHost, *dbPort)
+	config.SystemConfig.WebhooksConfigPath = *webhooksConfigPath
+	config.SystemConfig.ScriptsDir = *scriptsDir
+	config.SystemConfig.HttpListenAddr = *httpListenAddr
+	config.SystemConfig.WsListenAddr = *wsListenAddr
+	config.SystemConfig.BlockInterval = uint32(*blockInterval)
+	config.SystemConfig.SinkSpecs = make([]string, 0)
+	for _, spec := range strings.Split(*sinkSpecs, ",") {
+		if len(strings.TrimSpace(spec)) > 0 {
+			config.SystemConfig.SinkSpecs = append(config.SystemConfig.SinkSpecs, strings.TrimSpace(spec))
+		}
+	}
+	config.SystemConfig.MetadataSigners = make([]string, 0)
+	for _, signer := range strings.Split(*metadataSigners, ",") {
+		if len(strings.TrimSpace(signer)) > 0 {
+			config.SystemConfig.MetadataSigners = append(config.SystemConfig.MetadataSigners, strings.ToLower(strings.TrimSpace(signer)))
+		}
+	}
+	config.SystemConfig.ScriptAllowedTables = make([]string, 0)
+	for _, tableName := range strings.Split(*scriptTables, ",") {
+		if len(strings.TrimSpace(tableName)) > 0 {
+			config.SystemConfig.ScriptAllowedTables = append(config.SystemConfig.ScriptAllowedTables, strings.TrimSpace(tableName))
+		}
+	}
 
-	nodeservice.ConnectHxNode(ctx, config.SystemConfig.NodeApiUrl)
-	defer nodeservice.CloseHxNodeConn()
 	err := db.OpenDb(config.SystemConfig.DbConnectionString)
 	if err != nil {
 		logger.Fatal("open db connection error " + err.Error())
@@ -50,11 +87,76 @@ func main() {
 	}
 	defer db.CloseDb()
 
-	scanner.AddScanPlugin(new(plugins.TransferPlugin))
+	if flag.NArg() > 0 {
+		err = runCommand(flag.Args())
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		return
+	}
+
+	nodeservice.ConnectHxNode(ctx, config.SystemConfig.NodeApiUrl)
+	defer nodeservice.CloseHxNodeConn()
+
 	scanner.AddScanPlugin(new(plugins.AccountRegisterPlugin))
-	scanner.AddScanPlugin(new(plugins.AssetMaybeChangePlugin))
+	scanner.AddScanPlugin(new(plugins.ContractRegistryPlugin))
 	scanner.AddScanPlugin(new(plugins.TokenContractCreateScanPlugin))
+	scanner.AddScanPlugin(new(plugins.ContractUpgradePlugin))
+	scanner.AddScanPlugin(new(plugins.ContractStoragePlugin))
+	scanner.AddScanPlugin(new(plugins.ContractCallPlugin))
+	scanner.AddScanPlugin(new(plugins.ContractBalancePlugin))
 	scanner.AddScanPlugin(new(plugins.TokenContractInvokeScanPlugin))
+	scanner.AddScanPlugin(new(plugins.AddressActivityPlugin))
+	scanner.AddScanPlugin(new(plugins.FeeLedgerPlugin))
+	scanner.AddScanPlugin(new(plugins.LockBalancePlugin))
+	scanner.AddScanPlugin(new(plugins.CrosschainTransferPlugin))
+	scanner.AddScanPlugin(&plugins.ColdhotTransferPlugin{UnsignedAlertBlocks: uint32(*coldhotUnsignedAlertBlocks)})
+	scanner.AddScanPlugin(&plugins.CitizenPlugin{BlockInterval: uint32(*blockInterval),
+		CollectInterval: uint32(*citizenCollectInterval)})
+	scanner.AddScanPlugin(&plugins.BalanceLedgerPlugin{ReconcileInterval: uint32(*balanceReconcileInterval),
+		AdjustOnReconcile: *balanceReconcileAdjust})
+	scanner.AddScanPlugin(&plugins.DepositPlugin{MaxConfirmations: uint32(*depositConfirmations)})
+
+	if len(config.SystemConfig.ScriptsDir) > 0 {
+		scriptPlugins, err := plugins.LoadScriptPlugins(config.SystemConfig.ScriptsDir, config.SystemConfig.ScriptAllowedTables)
+		if err != nil {
+			logger.Fatal("load script plugins error " + err.Error())
+			return
+		}
+		for _, scriptPlugin := range scriptPlugins {
+			scanner.AddScanPlugin(scriptPlugin)
+		}
+	}
+	if len(config.SystemConfig.WebhooksConfigPath) > 0 {
+		webhookEndpoints, err := plugins.LoadWebhookEndpoints(config.SystemConfig.WebhooksConfigPath)
+		if err != nil {
+			logger.Fatal("load webhooks config error " + err.Error())
+			return
+		}
+		scanner.AddScanPlugin(&plugins.WebhookPlugin{Endpoints: webhookEndpoints})
+		go plugins.StartWebhookDelivery(ctx, webhookEndpoints)
+	}
+
+	for _, spec := range config.SystemConfig.SinkSpecs {
+		s, err := sink.NewSinkFromSpec(spec)
+		if err != nil {
+			logger.Fatal("create sink " + spec + " error " + err.Error())
+			return
+		}
+		sink.AddSink(s)
+	}
+	defer sink.CloseSinks()
+
+	if len(config.SystemConfig.WsListenAddr) > 0 {
+		broker := subscription.NewBroker()
+		sink.AddBlockListener(broker.PublishBlock)
+		go func() {
+			err := subscription.Serve(config.SystemConfig.WsListenAddr, broker)
+			if err != nil {
+				logger.Fatal("subscription server error " + err.Error())
+			}
+		}()
+	}
 
 	go func() {
 		lastScannedBlockNum, err := db.GetLastScannedBlockNumber()
@@ -65,6 +167,16 @@ func main() {
 		if *scanFromBlockNumberFlag >= 0 {
 			lastScannedBlockNum = uint32(*scanFromBlockNumberFlag)
 		}
+		// sink落后时从sink的cursor之后重新扫描, 保证sink收到所有记录. 重放的块只执行输出sink记录的插件
+		minSinkCursor, err := sink.InitSinkCursors(lastScannedBlockNum)
+		if err != nil {
+			logger.Fatal("read sink cursors error " + err.Error())
+			return
+		}
+		if minSinkCursor < lastScannedBlockNum {
+			scanner.SetSinkReplayUntil(int(lastScannedBlockNum))
+			lastScannedBlockNum = minSinkCursor
+		}
 		scanner.ScanBlocksFrom(ctx, int(lastScannedBlockNum)+1)
 		signal.Stop(stop)
 	}()
@@ -10,3 +10,5 @@ go get github.com/sirupsen/logrus
 go get github.com/lestrrat-go/file-rotatelogs
 go get github.com/rifflock/lfshook
 go get github.com/shopspring/decimal
+go get github.com/yuin/gopher-lua
+go get github.com/graphql-go/graphql
@@ -0,0 +1,6 @@
+-- add indexes used by the REST API to databases created by older versions
+
+CREATE INDEX IF NOT EXISTS operations_addr_idx ON operations (addr);
+CREATE INDEX IF NOT EXISTS blocks_block_id_idx ON blocks (block_id);
+CREATE INDEX IF NOT EXISTS operations_id_idx ON operations (id);
+CREATE INDEX IF NOT EXISTS contract_operation_receipt_event_trxid_op_num_idx ON contract_operation_receipt_event (trxid, op_num);
@@ -0,0 +1,534 @@
+-- upgrade tables of databases created by older versions, safe to run again
+
+-- token amounts, balances and total supplies are integers of arbitrary size in the token's smallest unit
+ALTER TABLE token_contract ALTER COLUMN total_supply TYPE numeric(78,0) USING NULLIF(total_supply::text, '')::numeric(78,0);
+ALTER TABLE token_balance ALTER COLUMN amount TYPE numeric(78,0) USING amount::numeric(78,0);
+ALTER TABLE token_contract_transfer_history ALTER COLUMN amount TYPE numeric(78,0) USING amount::numeric(78,0);
+
+-- token_contract_transfer_history keeps every Transfer event of an operation, keyed by (txid, op_num, event_index).
+-- Older versions only saved the first Transfer event of each operation, its index is recomputed from the saved events;
+-- the missing events are added by `backfill token_balance_changes`.
+ALTER TABLE token_contract_transfer_history ADD COLUMN IF NOT EXISTS event_index integer NOT NULL DEFAULT -1;
+UPDATE token_contract_transfer_history h SET event_index = e.event_index
+  FROM (SELECT trxid, op_num, contract_address, min(event_index) AS event_index
+          FROM (SELECT trxid, op_num, contract_address, event_name,
+                       row_number() OVER (PARTITION BY trxid, op_num ORDER BY id) - 1 AS event_index
+                  FROM contract_operation_receipt_event) ranked
+          WHERE event_name = 'Transfer'
+          GROUP BY trxid, op_num, contract_address) e
+  WHERE h.event_index = -1 AND h.txid = e.trxid AND h.op_num = e.op_num AND h.contract_addr = e.contract_address;
+ALTER TABLE token_contract_transfer_history ALTER COLUMN event_index DROP DEFAULT;
+CREATE UNIQUE INDEX IF NOT EXISTS token_contract_transfer_history_txid_op_num_event_index_idx ON token_contract_transfer_history (txid, op_num, event_index);
+
+-- tables added by newer versions
+
+CREATE TABLE IF NOT EXISTS "webhook_outbox" (
+  id serial NOT NULL,
+  endpoint_name varchar(100) NOT NULL,
+  url text NOT NULL,
+  kind varchar(50) NOT NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  event_index integer NOT NULL,
+  payload text NOT NULL,
+  status varchar(20) NOT NULL,
+  attempts integer NOT NULL,
+  last_error text NULL,
+  next_attempt_at bigint NOT NULL,
+  delivered_at bigint NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_webhook_outbox" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_outbox_status_next_attempt_at_idx ON webhook_outbox (status, next_attempt_at);
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_outbox_endpoint_name_txid_op_num_event_index_idx ON webhook_outbox (endpoint_name, txid, op_num, event_index);
+
+CREATE TABLE IF NOT EXISTS "watched_addresses" (
+  id serial NOT NULL,
+  addr varchar(100) NOT NULL,
+  label varchar(255) NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_watched_addresses" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS watched_addresses_addr_idx ON watched_addresses (addr);
+
+CREATE TABLE IF NOT EXISTS "deposits" (
+  id serial NOT NULL,
+  addr varchar(100) NOT NULL,
+  deposit_type varchar(50) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  contract_addr varchar(100) NOT NULL,
+  from_addr varchar(100) NOT NULL,
+  amount numeric(78, 0) NOT NULL,
+  precision integer NOT NULL,
+  block_num integer NOT NULL,
+  block_time varchar(100) NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  event_index integer NOT NULL,
+  confirmations integer NOT NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_deposits" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS deposits_addr_idx ON deposits (addr);
+CREATE INDEX IF NOT EXISTS deposits_confirmations_idx ON deposits (confirmations);
+CREATE UNIQUE INDEX IF NOT EXISTS deposits_txid_op_num_deposit_type_event_index_idx ON deposits (txid, op_num, deposit_type, event_index);
+
+CREATE TABLE IF NOT EXISTS "script_events" (
+  id serial NOT NULL,
+  script_name varchar(255) NOT NULL,
+  event_name varchar(255) NOT NULL,
+  data text NOT NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_script_events" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS script_events_script_name_event_name_idx ON script_events (script_name, event_name);
+CREATE INDEX IF NOT EXISTS script_events_txid_op_num_idx ON script_events (txid, op_num);
+
+CREATE TABLE IF NOT EXISTS "raw_blocks" (
+  block_num bigint NOT NULL,
+  block_json text NOT NULL,
+  CONSTRAINT "pk_raw_blocks" PRIMARY KEY (block_num)
+);
+
+CREATE TABLE IF NOT EXISTS "address_operations" (
+  id serial NOT NULL,
+  addr varchar(100) NOT NULL,
+  role varchar(50) NOT NULL,
+  operation_id text NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  event_index integer NOT NULL,
+  block_num integer NOT NULL,
+  operation_type_name varchar(255) NOT NULL,
+  CONSTRAINT "pk_address_operations" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS address_operations_addr_block_num_id_idx ON address_operations (addr, block_num, id);
+CREATE UNIQUE INDEX IF NOT EXISTS address_operations_txid_op_num_addr_role_event_index_idx ON address_operations (txid, op_num, addr, role, event_index);
+
+CREATE TABLE IF NOT EXISTS "balance_changes" (
+  id serial NOT NULL,
+  addr varchar(100) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  amount numeric(40,0) NOT NULL,
+  change_type varchar(50) NOT NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  change_index integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_balance_changes" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS balance_changes_addr_asset_id_block_num_idx ON balance_changes (addr, asset_id, block_num);
+CREATE INDEX IF NOT EXISTS balance_changes_block_num_idx ON balance_changes (block_num);
+CREATE UNIQUE INDEX IF NOT EXISTS balance_changes_txid_op_num_addr_asset_change_idx ON balance_changes (txid, op_num, addr, asset_id, change_type, change_index);
+
+CREATE TABLE IF NOT EXISTS "balance_reconciliations" (
+  id serial NOT NULL,
+  addr varchar(100) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  block_num integer NOT NULL,
+  ledger_amount numeric(40,0) NOT NULL,
+  node_amount numeric(40,0) NOT NULL,
+  adjusted bool NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_balance_reconciliations" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS balance_reconciliations_addr_idx ON balance_reconciliations (addr);
+
+CREATE TABLE IF NOT EXISTS "account_bindings" (
+  id serial NOT NULL,
+  addr varchar(100) NOT NULL,
+  crosschain_type varchar(20) NOT NULL,
+  tunnel_address varchar(200) NOT NULL,
+  bind_block_num integer NOT NULL,
+  bind_txid varchar(100) NOT NULL,
+  unbind_block_num integer NOT NULL,
+  unbind_txid varchar(100) NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_account_bindings" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS account_bindings_bind_txid_addr_crosschain_type_idx ON account_bindings (bind_txid, addr, crosschain_type);
+CREATE INDEX IF NOT EXISTS account_bindings_tunnel_address_idx ON account_bindings (tunnel_address, crosschain_type);
+
+CREATE TABLE IF NOT EXISTS "token_balance_changes" (
+  id serial NOT NULL,
+  contract_addr varchar(100) NOT NULL,
+  owner_addr varchar(100) NOT NULL,
+  amount numeric(78,0) NOT NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  event_index integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_token_balance_changes" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS token_balance_changes_contract_addr_owner_addr_block_num_idx ON token_balance_changes (contract_addr, owner_addr, block_num);
+CREATE INDEX IF NOT EXISTS token_balance_changes_contract_addr_block_num_idx ON token_balance_changes (contract_addr, block_num);
+CREATE UNIQUE INDEX IF NOT EXISTS token_balance_changes_txid_op_num_event_index_owner_addr_idx ON token_balance_changes (txid, op_num, event_index, owner_addr);
+
+CREATE TABLE IF NOT EXISTS "token_allowance_changes" (
+  id serial NOT NULL,
+  contract_addr varchar(100) NOT NULL,
+  owner_addr varchar(100) NOT NULL,
+  spender_addr varchar(100) NOT NULL,
+  change_type varchar(50) NOT NULL,
+  amount numeric(78,0) NOT NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  event_index integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_token_allowance_changes" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS token_allowance_changes_owner_addr_contract_addr_idx ON token_allowance_changes (owner_addr, contract_addr);
+CREATE UNIQUE INDEX IF NOT EXISTS token_allowance_changes_txid_op_num_event_index_idx ON token_allowance_changes (txid, op_num, event_index);
+
+CREATE TABLE IF NOT EXISTS "token_allowances" (
+  id serial NOT NULL,
+  contract_addr varchar(100) NOT NULL,
+  owner_addr varchar(100) NOT NULL,
+  spender_addr varchar(100) NOT NULL,
+  amount numeric(78,0) NOT NULL,
+  block_num integer NOT NULL,
+  created_at bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_token_allowances" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS token_allowances_contract_addr_owner_addr_spender_addr_idx ON token_allowances (contract_addr, owner_addr, spender_addr);
+CREATE INDEX IF NOT EXISTS token_allowances_owner_addr_idx ON token_allowances (owner_addr);
+CREATE INDEX IF NOT EXISTS token_allowances_spender_addr_idx ON token_allowances (spender_addr);
+
+CREATE INDEX IF NOT EXISTS contract_operation_receipt_event_contract_address_idx ON contract_operation_receipt_event (contract_address, id);
+CREATE INDEX IF NOT EXISTS contract_operation_receipt_event_trxid_op_num_idx ON contract_operation_receipt_event (trxid, op_num);
+
+CREATE TABLE IF NOT EXISTS "contracts" (
+  id serial NOT NULL,
+  contract_id varchar(100) NOT NULL,
+  contract_type varchar(20) NOT NULL,
+  native_contract_key varchar(100) NOT NULL,
+  owner_addr varchar(100) NOT NULL,
+  owner_pubkey varchar(200) NOT NULL,
+  inherit_from varchar(100) NOT NULL,
+  abi jsonb NOT NULL,
+  offline_abi jsonb NOT NULL,
+  events jsonb NOT NULL,
+  storage_properties jsonb NOT NULL,
+  code_hash varchar(100) NOT NULL,
+  name varchar(255) NOT NULL,
+  description text NOT NULL,
+  gas_price bigint NOT NULL,
+  gas_limit bigint NOT NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  register_time varchar(100) NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_contracts" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS contracts_contract_id_idx ON contracts (contract_id);
+CREATE INDEX IF NOT EXISTS contracts_owner_addr_idx ON contracts (owner_addr);
+CREATE INDEX IF NOT EXISTS contracts_contract_type_native_contract_key_idx ON contracts (contract_type, native_contract_key);
+CREATE INDEX IF NOT EXISTS contracts_abi_idx ON contracts USING gin (abi);
+CREATE INDEX IF NOT EXISTS contracts_offline_abi_idx ON contracts USING gin (offline_abi);
+
+CREATE TABLE IF NOT EXISTS "contract_metadata_changes" (
+  id serial NOT NULL,
+  contract_id varchar(100) NOT NULL,
+  source varchar(20) NOT NULL,
+  name varchar(255) NULL,
+  description text NULL,
+  logo varchar(255) NULL,
+  url varchar(255) NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  signer varchar(100) NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_contract_metadata_changes" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS contract_metadata_changes_contract_id_idx ON contract_metadata_changes (contract_id, id);
+CREATE INDEX IF NOT EXISTS contract_metadata_changes_txid_idx ON contract_metadata_changes (txid);
+
+CREATE TABLE IF NOT EXISTS "contract_storage_changes" (
+  id serial NOT NULL,
+  contract_id varchar(100) NOT NULL,
+  property_name varchar(255) NOT NULL,
+  storage_key text NOT NULL,
+  value_before text NOT NULL,
+  value_after text NOT NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_contract_storage_changes" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS contract_storage_changes_contract_id_property_name_storage_key_block_num_idx ON contract_storage_changes (contract_id, property_name, storage_key, block_num);
+CREATE UNIQUE INDEX IF NOT EXISTS contract_storage_changes_txid_op_num_contract_id_property_name_storage_key_idx ON contract_storage_changes (txid, op_num, contract_id, property_name, storage_key);
+
+CREATE TABLE IF NOT EXISTS "contract_storages" (
+  id serial NOT NULL,
+  contract_id varchar(100) NOT NULL,
+  property_name varchar(255) NOT NULL,
+  storage_key text NOT NULL,
+  value text NOT NULL,
+  block_num integer NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_contract_storages" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS contract_storages_contract_id_property_name_storage_key_idx ON contract_storages (contract_id, property_name, storage_key);
+
+CREATE TABLE IF NOT EXISTS "contract_calls" (
+  id serial NOT NULL,
+  contract_id varchar(100) NOT NULL,
+  contract_api varchar(255) NOT NULL,
+  contract_arg text NOT NULL,
+  caller_addr varchar(100) NOT NULL,
+  gas_limit bigint NOT NULL,
+  gas_price bigint NOT NULL,
+  actual_fee bigint NOT NULL,
+  exec_succeed bool NOT NULL,
+  api_result text NOT NULL,
+  block_num integer NOT NULL,
+  block_time bigint NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_contract_calls" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS contract_calls_txid_op_num_idx ON contract_calls (txid, op_num);
+CREATE INDEX IF NOT EXISTS contract_calls_contract_id_block_time_idx ON contract_calls (contract_id, block_time);
+CREATE INDEX IF NOT EXISTS contract_calls_caller_addr_id_idx ON contract_calls (caller_addr, id);
+
+CREATE TABLE IF NOT EXISTS "contract_balance_changes" (
+  id serial NOT NULL,
+  contract_id varchar(100) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  amount numeric(40,0) NOT NULL,
+  change_type varchar(50) NOT NULL,
+  block_num integer NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  change_index integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_contract_balance_changes" PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS contract_balance_changes_contract_id_asset_id_id_idx ON contract_balance_changes (contract_id, asset_id, id);
+CREATE UNIQUE INDEX IF NOT EXISTS contract_balance_changes_txid_op_num_contract_asset_change_idx ON contract_balance_changes (txid, op_num, contract_id, asset_id, change_type, change_index);
+
+CREATE TABLE IF NOT EXISTS "contract_balances" (
+  id serial NOT NULL,
+  contract_id varchar(100) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  amount numeric(40,0) NOT NULL,
+  block_num integer NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_contract_balances" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS contract_balances_contract_id_asset_id_idx ON contract_balances (contract_id, asset_id);
+CREATE INDEX IF NOT EXISTS contract_balances_asset_id_amount_idx ON contract_balances (asset_id, amount);
+
+CREATE TABLE IF NOT EXISTS "fee_records" (
+  id serial NOT NULL,
+  payer_addr varchar(100) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  amount numeric(40,0) NOT NULL,
+  fee_type varchar(50) NOT NULL,
+  op_type integer NOT NULL,
+  op_type_name varchar(100) NOT NULL,
+  block_num integer NOT NULL,
+  block_time bigint NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  fee_index integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_fee_records" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS fee_records_txid_op_num_fee_type_fee_index_idx ON fee_records (txid, op_num, fee_type, fee_index);
+CREATE INDEX IF NOT EXISTS fee_records_payer_addr_block_time_idx ON fee_records (payer_addr, block_time);
+CREATE INDEX IF NOT EXISTS fee_records_block_time_idx ON fee_records (block_time);
+CREATE INDEX IF NOT EXISTS fee_records_block_num_idx ON fee_records (block_num);
+
+CREATE TABLE IF NOT EXISTS "fee_reconciliations" (
+  id serial NOT NULL,
+  block_num integer NOT NULL,
+  block_trxfee bigint NOT NULL,
+  ledger_fee numeric(40,0) NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_fee_reconciliations" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS fee_reconciliations_block_num_idx ON fee_reconciliations (block_num);
+
+CREATE INDEX IF NOT EXISTS blocks_miner_number_idx ON blocks (miner, number);
+CREATE INDEX IF NOT EXISTS citizen_infos_citizen_id_idx ON citizen_infos (citizen_id);
+CREATE INDEX IF NOT EXISTS citizen_infos_account_id_idx ON citizen_infos (account_id);
+
+CREATE TABLE IF NOT EXISTS "citizen_block_misses" (
+  id serial NOT NULL,
+  citizen_id varchar(20) NOT NULL,
+  missed_count bigint NOT NULL,
+  source varchar(20) NOT NULL,
+  block_num integer NOT NULL,
+  block_time bigint NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_citizen_block_misses" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS citizen_block_misses_block_num_citizen_id_source_idx ON citizen_block_misses (block_num, citizen_id, source);
+CREATE INDEX IF NOT EXISTS citizen_block_misses_citizen_id_block_num_idx ON citizen_block_misses (citizen_id, block_num);
+
+CREATE TABLE IF NOT EXISTS "lock_balance_events" (
+  id serial NOT NULL,
+  event_type varchar(20) NOT NULL,
+  lock_type varchar(20) NOT NULL,
+  owner_addr varchar(100) NOT NULL,
+  owner_account varchar(20) NOT NULL,
+  target_id varchar(20) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  amount numeric(40,0) NOT NULL,
+  block_num integer NOT NULL,
+  block_time bigint NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_lock_balance_events" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS lock_balance_events_txid_op_num_idx ON lock_balance_events (txid, op_num);
+CREATE INDEX IF NOT EXISTS lock_balance_events_owner_addr_id_idx ON lock_balance_events (owner_addr, id);
+CREATE INDEX IF NOT EXISTS lock_balance_events_target_id_id_idx ON lock_balance_events (target_id, id);
+
+CREATE TABLE IF NOT EXISTS "locked_balances" (
+  id serial NOT NULL,
+  lock_type varchar(20) NOT NULL,
+  owner_addr varchar(100) NOT NULL,
+  target_id varchar(20) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  amount numeric(40,0) NOT NULL,
+  first_locked_block_num integer NOT NULL,
+  first_locked_at bigint NOT NULL,
+  block_num integer NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_locked_balances" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS locked_balances_lock_type_owner_addr_target_id_asset_id_idx ON locked_balances (lock_type, owner_addr, target_id, asset_id);
+CREATE INDEX IF NOT EXISTS locked_balances_target_id_idx ON locked_balances (target_id);
+
+CREATE TABLE IF NOT EXISTS "crosschain_transfers" (
+  id serial NOT NULL,
+  direction varchar(20) NOT NULL,
+  state varchar(20) NOT NULL,
+  request_txid varchar(100) NOT NULL,
+  hx_addr varchar(100) NOT NULL,
+  crosschain_addr varchar(200) NOT NULL,
+  asset_symbol varchar(20) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  amount varchar(50) NOT NULL,
+  without_sign_txid varchar(100) NOT NULL,
+  signature_count integer NOT NULL,
+  combine_txid varchar(100) NOT NULL,
+  crosschain_trx_id varchar(200) NOT NULL,
+  finish_txid varchar(100) NOT NULL,
+  request_block_num integer NOT NULL,
+  request_time bigint NOT NULL,
+  last_block_num integer NOT NULL,
+  last_block_time bigint NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_crosschain_transfers" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS crosschain_transfers_request_txid_idx ON crosschain_transfers (request_txid);
+CREATE INDEX IF NOT EXISTS crosschain_transfers_without_sign_txid_idx ON crosschain_transfers (without_sign_txid);
+CREATE INDEX IF NOT EXISTS crosschain_transfers_combine_txid_idx ON crosschain_transfers (combine_txid);
+CREATE INDEX IF NOT EXISTS crosschain_transfers_crosschain_trx_id_idx ON crosschain_transfers (crosschain_trx_id);
+CREATE INDEX IF NOT EXISTS crosschain_transfers_hx_addr_id_idx ON crosschain_transfers (hx_addr, id);
+CREATE INDEX IF NOT EXISTS crosschain_transfers_state_last_block_time_idx ON crosschain_transfers (state, last_block_time);
+
+CREATE TABLE IF NOT EXISTS "crosschain_transfer_events" (
+  id serial NOT NULL,
+  op_type_name varchar(100) NOT NULL,
+  link_id varchar(200) NOT NULL,
+  state varchar(20) NOT NULL,
+  block_num integer NOT NULL,
+  block_time bigint NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_crosschain_transfer_events" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS crosschain_transfer_events_txid_op_num_idx ON crosschain_transfer_events (txid, op_num);
+CREATE INDEX IF NOT EXISTS crosschain_transfer_events_link_id_idx ON crosschain_transfer_events (link_id);
+
+CREATE TABLE IF NOT EXISTS "coldhot_transfers" (
+  id serial NOT NULL,
+  state varchar(20) NOT NULL,
+  request_txid varchar(100) NOT NULL,
+  from_addr varchar(200) NOT NULL,
+  to_addr varchar(200) NOT NULL,
+  asset_symbol varchar(20) NOT NULL,
+  asset_id varchar(10) NOT NULL,
+  amount varchar(50) NOT NULL,
+  without_sign_txid varchar(100) NOT NULL,
+  signature_count integer NOT NULL,
+  combine_txid varchar(100) NOT NULL,
+  crosschain_trx_id varchar(200) NOT NULL,
+  finish_txid varchar(100) NOT NULL,
+  request_block_num integer NOT NULL,
+  request_time bigint NOT NULL,
+  last_block_num integer NOT NULL,
+  last_block_time bigint NOT NULL,
+  unsigned_alert_block_num integer NOT NULL,
+  updated_at bigint NOT NULL,
+  CONSTRAINT "pk_coldhot_transfers" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS coldhot_transfers_request_txid_idx ON coldhot_transfers (request_txid);
+CREATE INDEX IF NOT EXISTS coldhot_transfers_without_sign_txid_idx ON coldhot_transfers (without_sign_txid);
+CREATE INDEX IF NOT EXISTS coldhot_transfers_combine_txid_idx ON coldhot_transfers (combine_txid);
+CREATE INDEX IF NOT EXISTS coldhot_transfers_crosschain_trx_id_idx ON coldhot_transfers (crosschain_trx_id);
+CREATE INDEX IF NOT EXISTS coldhot_transfers_state_request_block_num_idx ON coldhot_transfers (state, request_block_num);
+CREATE INDEX IF NOT EXISTS coldhot_transfers_unsigned_alert_block_num_idx ON coldhot_transfers (unsigned_alert_block_num);
+
+CREATE TABLE IF NOT EXISTS "coldhot_transfer_events" (
+  id serial NOT NULL,
+  op_type_name varchar(100) NOT NULL,
+  link_id varchar(200) NOT NULL,
+  state varchar(20) NOT NULL,
+  guard_id varchar(20) NOT NULL,
+  guard_addr varchar(100) NOT NULL,
+  block_num integer NOT NULL,
+  block_time bigint NOT NULL,
+  txid varchar(100) NOT NULL,
+  op_num integer NOT NULL,
+  created_at bigint NOT NULL,
+  CONSTRAINT "pk_coldhot_transfer_events" PRIMARY KEY (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS coldhot_transfer_events_txid_op_num_idx ON coldhot_transfer_events (txid, op_num);
+CREATE INDEX IF NOT EXISTS coldhot_transfer_events_link_id_idx ON coldhot_transfer_events (link_id);
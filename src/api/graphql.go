@@ -0,0 +1,444 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/shopspring/decimal"
+)
+
+// graphql字段名和rest接口的json字段名保持一致
+
+func resolveTimeField(getter func(source interface{}) time.Time) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		return getter(p.Source).UTC().Format(time.RFC3339), nil
+	}
+}
+
+func bigIntToString(value *big.Int) interface{} {
+	if value == nil {
+		return nil
+	}
+	return value.String()
+}
+
+// receipt里非结构化的字段以json字符串输出
+func jsonStringOf(value interface{}) (interface{}, error) {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return string(bytes), nil
+}
+
+func intArg(args map[string]interface{}, name string, defaultValue int) int {
+	if value, ok := args[name].(int); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func pageLimitArg(args map[string]interface{}) int {
+	limit := intArg(args, "first", defaultPageLimit)
+	if limit < 1 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	return limit
+}
+
+var graphqlEventType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Event",
+	Fields: graphql.Fields{
+		"block_num":        &graphql.Field{Type: graphql.Int},
+		"op_num":           &graphql.Field{Type: graphql.Int},
+		"trx_id":           &graphql.Field{Type: graphql.String},
+		"caller_addr":      &graphql.Field{Type: graphql.String},
+		"contract_address": &graphql.Field{Type: graphql.String},
+		"event_name":       &graphql.Field{Type: graphql.String},
+		"event_arg":        &graphql.Field{Type: graphql.String},
+	},
+})
+
+func receiptJSONField(getter func(receipt *types.HxContractOpReceipt) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: graphql.String,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return jsonStringOf(getter(p.Source.(*types.HxContractOpReceipt)))
+		},
+	}
+}
+
+var graphqlReceiptType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Receipt",
+	Fields: graphql.Fields{
+		"id":                &graphql.Field{Type: graphql.String},
+		"trx_id":            &graphql.Field{Type: graphql.String},
+		"block_num":         &graphql.Field{Type: graphql.Int},
+		"op_num":            &graphql.Field{Type: graphql.Int},
+		"api_result":        &graphql.Field{Type: graphql.String},
+		"exec_succeed":      &graphql.Field{Type: graphql.Boolean},
+		"acctual_fee":       &graphql.Field{Type: graphql.String},
+		"invoker":           &graphql.Field{Type: graphql.String},
+		"contract_registed": &graphql.Field{Type: graphql.String},
+		"events":            &graphql.Field{Type: graphql.NewList(graphqlEventType)},
+		"contract_withdraw": receiptJSONField(func(receipt *types.HxContractOpReceipt) interface{} {
+			return receipt.ContractWithdrawInfo
+		}),
+		"contract_balances": receiptJSONField(func(receipt *types.HxContractOpReceipt) interface{} {
+			return receipt.ContractBalanceChanges
+		}),
+		"deposit_to_address": receiptJSONField(func(receipt *types.HxContractOpReceipt) interface{} {
+			return receipt.DepositToAddressChanges
+		}),
+		"deposit_contract": receiptJSONField(func(receipt *types.HxContractOpReceipt) interface{} {
+			return receipt.DepositToContractChanges
+		}),
+		"transfer_fees": receiptJSONField(func(receipt *types.HxContractOpReceipt) interface{} {
+			return receipt.TransferFees
+		}),
+	},
+})
+
+var graphqlOperationType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Operation",
+	Fields: graphql.Fields{
+		"serial_id":           &graphql.Field{Type: graphql.Int},
+		"id":                  &graphql.Field{Type: graphql.String},
+		"txid":                &graphql.Field{Type: graphql.String},
+		"block_num":           &graphql.Field{Type: graphql.Int},
+		"tx_index_in_block":   &graphql.Field{Type: graphql.Int},
+		"operation_type":      &graphql.Field{Type: graphql.Int},
+		"operation_type_name": &graphql.Field{Type: graphql.String},
+		"operation_json":      &graphql.Field{Type: graphql.String},
+		"addr":                &graphql.Field{Type: graphql.String},
+	},
+})
+
+var graphqlAddressBalanceType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "AddressBalance",
+	Fields: graphql.Fields{
+		"id":         &graphql.Field{Type: graphql.Int},
+		"owner_addr": &graphql.Field{Type: graphql.String},
+		"asset_id":   &graphql.Field{Type: graphql.String},
+		"amount":     &graphql.Field{Type: graphql.String},
+		"created_at": &graphql.Field{Type: graphql.String, Resolve: resolveTimeField(func(source interface{}) time.Time {
+			return source.(*db.AddressBalanceEntity).CreatedAt
+		})},
+		"updated_at": &graphql.Field{Type: graphql.String, Resolve: resolveTimeField(func(source interface{}) time.Time {
+			return source.(*db.AddressBalanceEntity).UpdatedAt
+		})},
+	},
+})
+
+var graphqlTokenContractType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TokenContract",
+	Fields: graphql.Fields{
+		"id":            &graphql.Field{Type: graphql.Int},
+		"block_num":     &graphql.Field{Type: graphql.Int},
+		"block_time":    &graphql.Field{Type: graphql.String},
+		"txid":          &graphql.Field{Type: graphql.String},
+		"contract_id":   &graphql.Field{Type: graphql.String},
+		"contract_type": &graphql.Field{Type: graphql.String},
+		"owner_pubkey":  &graphql.Field{Type: graphql.String},
+		"owner_addr":    &graphql.Field{Type: graphql.String},
+		"register_time": &graphql.Field{Type: graphql.String},
+		"inherit_from":  &graphql.Field{Type: graphql.String},
+		"gas_price":     &graphql.Field{Type: graphql.String},
+		"gas_limit":     &graphql.Field{Type: graphql.String},
+		"state":         &graphql.Field{Type: graphql.String},
+		"total_supply": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return bigIntToString(p.Source.(*db.TokenContractEntity).TotalSupply), nil
+		}},
+		"display_total_supply": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			contract := p.Source.(*db.TokenContractEntity)
+			if contract.TotalSupply == nil {
+				return nil, nil
+			}
+			return contract.DisplayAmount(decimal.NewFromBigInt(contract.TotalSupply, 0)).String(), nil
+		}},
+		"precision":    &graphql.Field{Type: graphql.Int},
+		"token_symbol": &graphql.Field{Type: graphql.String},
+		"token_name":   &graphql.Field{Type: graphql.String},
+		"logo":         &graphql.Field{Type: graphql.String},
+		"url":          &graphql.Field{Type: graphql.String},
+		"description":  &graphql.Field{Type: graphql.String},
+	},
+})
+
+var graphqlTokenBalanceType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "TokenBalance",
+	Fields: graphql.Fields{
+		"id":            &graphql.Field{Type: graphql.Int},
+		"contract_addr": &graphql.Field{Type: graphql.String},
+		"owner_addr":    &graphql.Field{Type: graphql.String},
+		"amount":        &graphql.Field{Type: graphql.String},
+		"display_amount": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			balance := p.Source.(*db.TokenBalanceEntity)
+			loadContract := loadersFromContext(p.Context).tokenContractsById.load(balance.ContractAddr)
+			return func() (interface{}, error) {
+				value, err := loadContract()
+				if err != nil {
+					return nil, err
+				}
+				contract, _ := value.(*db.TokenContractEntity)
+				if contract == nil {
+					return balance.Amount.String(), nil
+				}
+				return contract.DisplayAmount(balance.Amount).String(), nil
+			}, nil
+		}},
+		"created_at": &graphql.Field{Type: graphql.String, Resolve: resolveTimeField(func(source interface{}) time.Time {
+			return source.(*db.TokenBalanceEntity).CreatedAt
+		})},
+		"updated_at": &graphql.Field{Type: graphql.String, Resolve: resolveTimeField(func(source interface{}) time.Time {
+			return source.(*db.TokenBalanceEntity).UpdatedAt
+		})},
+		"token_contract": &graphql.Field{Type: graphqlTokenContractType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			balance := p.Source.(*db.TokenBalanceEntity)
+			return loadersFromContext(p.Context).tokenContractsById.load(balance.ContractAddr), nil
+		}},
+	},
+})
+
+var graphqlTransactionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Transaction",
+	Fields: graphql.Fields{
+		"serial_id":            &graphql.Field{Type: graphql.Int},
+		"block_number":         &graphql.Field{Type: graphql.Int},
+		"id":                   &graphql.Field{Type: graphql.String},
+		"ref_block_num":        &graphql.Field{Type: graphql.Int},
+		"ref_block_prefix":     &graphql.Field{Type: graphql.String},
+		"expiration":           &graphql.Field{Type: graphql.String},
+		"operations_count":     &graphql.Field{Type: graphql.Int},
+		"index_in_block":       &graphql.Field{Type: graphql.Int},
+		"first_operation_type": &graphql.Field{Type: graphql.Int},
+		"txid":                 &graphql.Field{Type: graphql.String},
+		"operations": &graphql.Field{Type: graphql.NewList(graphqlOperationType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			tx := p.Source.(*db.TransactionEntity)
+			return loadersFromContext(p.Context).txOperations.load(tx.Txid), nil
+		}},
+		"receipts": &graphql.Field{Type: graphql.NewList(graphqlReceiptType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			tx := p.Source.(*db.TransactionEntity)
+			return loadersFromContext(p.Context).txReceipts.load(tx.Txid), nil
+		}},
+	},
+})
+
+var graphqlBlockType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Block",
+	Fields: graphql.Fields{
+		"id":                      &graphql.Field{Type: graphql.Int},
+		"number":                  &graphql.Field{Type: graphql.Int},
+		"previous":                &graphql.Field{Type: graphql.String},
+		"timestamp":               &graphql.Field{Type: graphql.String},
+		"trxfee":                  &graphql.Field{Type: graphql.String},
+		"miner":                   &graphql.Field{Type: graphql.String},
+		"transaction_merkle_root": &graphql.Field{Type: graphql.String},
+		"next_secret_hash":        &graphql.Field{Type: graphql.String},
+		"block_id":                &graphql.Field{Type: graphql.String},
+		"reward":                  &graphql.Field{Type: graphql.String},
+		"txs_count":               &graphql.Field{Type: graphql.Int},
+		"transactions": &graphql.Field{Type: graphql.NewList(graphqlTransactionType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			block := p.Source.(*db.BlockEntity)
+			return loadersFromContext(p.Context).blockTransactions.load(strconv.Itoa(int(block.Number))), nil
+		}},
+	},
+})
+
+func init() {
+	// 互相引用的字段在类型都定义后再加
+	graphqlTransactionType.AddFieldConfig("block", &graphql.Field{Type: graphqlBlockType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+		tx := p.Source.(*db.TransactionEntity)
+		return loadersFromContext(p.Context).blocks.load(strconv.Itoa(int(tx.BlockNumber))), nil
+	}})
+	graphqlTokenContractType.AddFieldConfig("balances", &graphql.Field{
+		Type: graphql.NewList(graphqlTokenBalanceType),
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{Type: graphql.Int},
+			"after": &graphql.ArgumentConfig{Type: graphql.Int},
+		},
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			contract := p.Source.(*db.TokenContractEntity)
+			return db.ListTokenBalancesByContractAddr(contract.ContractId, int64(intArg(p.Args, "after", 0)), pageLimitArg(p.Args))
+		},
+	})
+}
+
+var graphqlQueryType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Query",
+	Fields: graphql.Fields{
+		"block": &graphql.Field{
+			Type: graphqlBlockType,
+			Args: graphql.FieldConfigArgument{
+				"number":   &graphql.ArgumentConfig{Type: graphql.Int},
+				"block_id": &graphql.ArgumentConfig{Type: graphql.String},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				var block *db.BlockEntity
+				var err error
+				if blockId, ok := p.Args["block_id"].(string); ok {
+					block, err = db.FindBlockByBlockId(blockId)
+				} else if number, ok := p.Args["number"].(int); ok {
+					block, err = db.FindBlock(number)
+				} else {
+					return nil, errors.New("number or block_id required")
+				}
+				if err != nil || block == nil {
+					return nil, err
+				}
+				return block, nil
+			},
+		},
+		"transaction": &graphql.Field{
+			Type: graphqlTransactionType,
+			Args: graphql.FieldConfigArgument{
+				"txid": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				tx, err := db.FindTransaction(p.Args["txid"].(string))
+				if err != nil || tx == nil {
+					return nil, err
+				}
+				return tx, nil
+			},
+		},
+		"address_operations": &graphql.Field{
+			Type: graphql.NewList(graphqlOperationType),
+			Args: graphql.FieldConfigArgument{
+				"addr":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+				"first":  &graphql.ArgumentConfig{Type: graphql.Int},
+				"before": &graphql.ArgumentConfig{Type: graphql.Int},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return db.ListBaseOperationsByAddr(p.Args["addr"].(string), int64(intArg(p.Args, "before", 0)), pageLimitArg(p.Args))
+			},
+		},
+		"address_balances": &graphql.Field{
+			Type: graphql.NewList(graphqlAddressBalanceType),
+			Args: graphql.FieldConfigArgument{
+				"addr": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return db.ListAddressBalancesByOwnerAddr(p.Args["addr"].(string))
+			},
+		},
+		"token_balances": &graphql.Field{
+			Type: graphql.NewList(graphqlTokenBalanceType),
+			Args: graphql.FieldConfigArgument{
+				"owner_addr": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return db.ListTokenBalancesByOwnerAddr(p.Args["owner_addr"].(string))
+			},
+		},
+		"token_contract": &graphql.Field{
+			Type: graphqlTokenContractType,
+			Args: graphql.FieldConfigArgument{
+				"contract_id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return loadersFromContext(p.Context).tokenContractsById.load(p.Args["contract_id"].(string)), nil
+			},
+		},
+		"token_contracts": &graphql.Field{
+			Type: graphql.NewList(graphqlTokenContractType),
+			Args: graphql.FieldConfigArgument{
+				"first": &graphql.ArgumentConfig{Type: graphql.Int},
+				"after": &graphql.ArgumentConfig{Type: graphql.Int},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return db.ListTokenContracts(int64(intArg(p.Args, "after", 0)), pageLimitArg(p.Args))
+			},
+		},
+	},
+})
+
+var graphqlSchema graphql.Schema
+
+func init() {
+	var err error
+	graphqlSchema, err = graphql.NewSchema(graphql.SchemaConfig{Query: graphqlQueryType})
+	if err != nil {
+		panic("invalid graphql schema " + err.Error())
+	}
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+func graphqlErrorResult(err error) *graphql.Result {
+	return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}
+}
+
+func executeGraphql(ctx context.Context, req *graphqlRequest) *graphql.Result {
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return graphqlErrorResult(err)
+	}
+	validation := graphql.ValidateDocument(&graphqlSchema, document, nil)
+	if !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}
+	}
+	complexity := queryComplexity(document, req.OperationName, req.Variables)
+	if complexity > maxQueryComplexity {
+		return graphqlErrorResult(errors.New("query complexity " + strconv.Itoa(complexity) +
+			" exceeds limit " + strconv.Itoa(maxQueryComplexity)))
+	}
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        graphqlSchema,
+		AST:           document,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       context.WithValue(ctx, graphqlLoadersKey, newGraphqlLoaders()),
+	})
+}
+
+// POST json {query, variables, operationName}, 或者 GET ?query=
+func handleGraphql(w http.ResponseWriter, r *http.Request) {
+	req := new(graphqlRequest)
+	switch r.Method {
+	case "GET":
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if variablesStr := r.URL.Query().Get("variables"); len(variablesStr) > 0 {
+			if err := json.Unmarshal([]byte(variablesStr), &req.Variables); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid variables")
+				return
+			}
+		}
+	case "POST":
+		err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphqlRequestBytes)).Decode(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid graphql request")
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if len(req.Query) < 1 {
+		writeError(w, http.StatusBadRequest, "query required")
+		return
+	}
+	writeJSON(w, http.StatusOK, executeGraphql(r.Context(), req))
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const maxQueryComplexity = 5000
+const maxGraphqlRequestBytes = 1 << 20
+
+// 返回列表的字段, 子字段的复杂度要乘以列表长度
+var graphqlListFields = map[string]bool{
+	"transactions":       true,
+	"operations":         true,
+	"receipts":           true,
+	"events":             true,
+	"balances":           true,
+	"address_operations": true,
+	"address_balances":   true,
+	"token_balances":     true,
+	"token_contracts":    true,
+}
+
+// 查询复杂度: 每个字段记1, 列表字段的子字段乘以first参数(没有时按默认分页大小)
+func queryComplexity(document *ast.Document, operationName string, variables map[string]interface{}) int {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	operations := make([]*ast.OperationDefinition, 0)
+	for _, definition := range document.Definitions {
+		switch item := definition.(type) {
+		case *ast.FragmentDefinition:
+			fragments[item.Name.Value] = item
+		case *ast.OperationDefinition:
+			if len(operationName) < 1 || (item.Name != nil && item.Name.Value == operationName) {
+				operations = append(operations, item)
+			}
+		}
+	}
+	total := 0
+	for _, operation := range operations {
+		total += selectionSetComplexity(operation.SelectionSet, fragments, variables, make(map[string]bool))
+	}
+	return total
+}
+
+func selectionSetComplexity(selectionSet *ast.SelectionSet, fragments map[string]*ast.FragmentDefinition,
+	variables map[string]interface{}, visitingFragments map[string]bool) int {
+	if selectionSet == nil {
+		return 0
+	}
+	total := 0
+	for _, selection := range selectionSet.Selections {
+		switch item := selection.(type) {
+		case *ast.Field:
+			childComplexity := selectionSetComplexity(item.SelectionSet, fragments, variables, visitingFragments)
+			if graphqlListFields[item.Name.Value] {
+				childComplexity *= listSizeOfField(item, variables)
+			}
+			total += 1 + childComplexity
+		case *ast.InlineFragment:
+			total += selectionSetComplexity(item.SelectionSet, fragments, variables, visitingFragments)
+		case *ast.FragmentSpread:
+			name := item.Name.Value
+			fragment, ok := fragments[name]
+			if !ok || visitingFragments[name] {
+				continue
+			}
+			visitingFragments[name] = true
+			total += selectionSetComplexity(fragment.SelectionSet, fragments, variables, visitingFragments)
+			delete(visitingFragments, name)
+		}
+	}
+	return total
+}
+
+func listSizeOfField(field *ast.Field, variables map[string]interface{}) int {
+	size := defaultPageLimit
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil {
+				size = n
+			}
+		case *ast.Variable:
+			if n, ok := variables[value.Name.Value].(float64); ok {
+				size = int(n)
+			}
+		}
+	}
+	if size < 1 {
+		size = defaultPageLimit
+	}
+	if size > maxPageLimit {
+		size = maxPageLimit
+	}
+	return size
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+func TestQueryComplexity(t *testing.T) {
+	tests := []struct {
+		query         string
+		operationName string
+		variables     map[string]interface{}
+		want          int
+	}{
+		{`{ block(number: 1) { number miner } }`, "", nil, 3},
+		{`{ token_contracts(first: 10) { contract_id } }`, "", nil, 11},
+		// 没有first时按默认分页大小, 超过最大分页大小时按最大的算
+		{`{ token_contracts { contract_id } }`, "", nil, 1 + defaultPageLimit},
+		{`{ token_contracts(first: 100000) { contract_id } }`, "", nil, 1 + maxPageLimit},
+		{`query q($n: Int) { token_contracts(first: $n) { contract_id token_symbol } }`, "",
+			map[string]interface{}{"n": float64(5)}, 11},
+		{`{ block(number: 1) { transactions(first: 2) { operations(first: 3) { id } } } }`, "", nil, 1 + 1 + 2*(1+3)},
+		{`{ block(number: 1) { ...F } } fragment F on Block { number miner }`, "", nil, 3},
+		// 引用自己的fragment不会无限展开
+		{`{ block(number: 1) { ...F } } fragment F on Block { number ...F }`, "", nil, 2},
+		{`query a { block(number: 1) { number } } query b { token_contracts(first: 2) { contract_id } }`, "b", nil, 3},
+	}
+	for _, test := range tests {
+		document, err := parser.Parse(parser.ParseParams{Source: test.query})
+		if err != nil {
+			t.Fatalf("parse %s error: %s", test.query, err.Error())
+		}
+		if got := queryComplexity(document, test.operationName, test.variables); got != test.want {
+			t.Errorf("queryComplexity(%s) = %d, want %d", test.query, got, test.want)
+		}
+	}
+}
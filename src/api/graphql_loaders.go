@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+// dataloader式的批量加载. resolver只登记key并返回thunk, graphql执行器会在同一层的resolver都执行完后
+// 才调用thunk, 第一次调用时把登记的所有key用一次sql查出来
+type batchLoader struct {
+	mutex   sync.Mutex
+	fetch   func(keys []string) (map[string]interface{}, error)
+	pending []string
+	loaded  map[string]bool
+	results map[string]interface{}
+	errs    map[string]error
+}
+
+func newBatchLoader(fetch func(keys []string) (map[string]interface{}, error)) *batchLoader {
+	return &batchLoader{
+		fetch:   fetch,
+		pending: make([]string, 0),
+		loaded:  make(map[string]bool),
+		results: make(map[string]interface{}),
+		errs:    make(map[string]error),
+	}
+}
+
+func (loader *batchLoader) load(key string) func() (interface{}, error) {
+	loader.mutex.Lock()
+	if !loader.loaded[key] {
+		loader.loaded[key] = true
+		loader.pending = append(loader.pending, key)
+	}
+	loader.mutex.Unlock()
+	return func() (interface{}, error) {
+		loader.mutex.Lock()
+		defer loader.mutex.Unlock()
+		if len(loader.pending) > 0 {
+			keys := loader.pending
+			loader.pending = make([]string, 0)
+			values, err := loader.fetch(keys)
+			for _, k := range keys {
+				if err != nil {
+					loader.errs[k] = err
+				} else {
+					loader.results[k] = values[k]
+				}
+			}
+		}
+		return loader.results[key], loader.errs[key]
+	}
+}
+
+// 每个graphql请求一组loader, 缓存只在一次请求内有效
+type graphqlLoaders struct {
+	blocks             *batchLoader
+	blockTransactions  *batchLoader
+	txOperations       *batchLoader
+	txReceipts         *batchLoader
+	tokenContractsById *batchLoader
+}
+
+type graphqlLoadersKeyType struct{}
+
+var graphqlLoadersKey = graphqlLoadersKeyType{}
+
+func blockNumbersOfKeys(keys []string) []uint32 {
+	result := make([]uint32, 0, len(keys))
+	for _, key := range keys {
+		blockNumber, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			continue
+		}
+		result = append(result, uint32(blockNumber))
+	}
+	return result
+}
+
+func newGraphqlLoaders() *graphqlLoaders {
+	return &graphqlLoaders{
+		blocks: newBatchLoader(func(keys []string) (map[string]interface{}, error) {
+			blocks, err := db.ListBlocksByNumbers(blockNumbersOfKeys(keys))
+			if err != nil {
+				return nil, err
+			}
+			result := make(map[string]interface{})
+			for _, block := range blocks {
+				result[strconv.Itoa(int(block.Number))] = block
+			}
+			return result, nil
+		}),
+		blockTransactions: newBatchLoader(func(keys []string) (map[string]interface{}, error) {
+			txs, err := db.ListTransactionsByBlockNumbers(blockNumbersOfKeys(keys))
+			if err != nil {
+				return nil, err
+			}
+			grouped := make(map[string][]*db.TransactionEntity)
+			for _, tx := range txs {
+				key := strconv.Itoa(int(tx.BlockNumber))
+				grouped[key] = append(grouped[key], tx)
+			}
+			result := make(map[string]interface{})
+			for _, key := range keys {
+				if grouped[key] == nil {
+					grouped[key] = make([]*db.TransactionEntity, 0)
+				}
+				result[key] = grouped[key]
+			}
+			return result, nil
+		}),
+		txOperations: newBatchLoader(func(keys []string) (map[string]interface{}, error) {
+			ops, err := db.ListBaseOperationsByTxids(keys)
+			if err != nil {
+				return nil, err
+			}
+			grouped := make(map[string][]*db.BaseOperationEntity)
+			for _, op := range ops {
+				grouped[op.Trxid] = append(grouped[op.Trxid], op)
+			}
+			result := make(map[string]interface{})
+			for _, key := range keys {
+				if grouped[key] == nil {
+					grouped[key] = make([]*db.BaseOperationEntity, 0)
+				}
+				result[key] = grouped[key]
+			}
+			return result, nil
+		}),
+		txReceipts: newBatchLoader(func(keys []string) (map[string]interface{}, error) {
+			receipts, err := db.ListContractOpReceiptsByTxids(keys)
+			if err != nil {
+				return nil, err
+			}
+			grouped := make(map[string][]*types.HxContractOpReceipt)
+			for _, receipt := range receipts {
+				grouped[receipt.Trxid] = append(grouped[receipt.Trxid], receipt)
+			}
+			result := make(map[string]interface{})
+			for _, key := range keys {
+				if grouped[key] == nil {
+					grouped[key] = make([]*types.HxContractOpReceipt, 0)
+				}
+				result[key] = grouped[key]
+			}
+			return result, nil
+		}),
+		tokenContractsById: newBatchLoader(func(keys []string) (map[string]interface{}, error) {
+			contracts, err := db.ListTokenContractsByContractIds(keys)
+			if err != nil {
+				return nil, err
+			}
+			result := make(map[string]interface{})
+			for _, contract := range contracts {
+				result[contract.ContractId] = contract
+			}
+			return result, nil
+		}),
+	}
+}
+
+func loadersFromContext(ctx context.Context) *graphqlLoaders {
+	loaders, ok := ctx.Value(graphqlLoadersKey).(*graphqlLoaders)
+	if !ok {
+		return newGraphqlLoaders()
+	}
+	return loaders
+}
@@ -0,0 +1,1186 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/config"
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+	"github.com/shopspring/decimal"
+)
+
+// operation_json在接口中直接输出为json对象
+type operationView struct {
+	*db.BaseOperationEntity
+	OperationJSON json.RawMessage `json:"operation_json"`
+}
+
+func newOperationView(op *db.BaseOperationEntity) *operationView {
+	view := &operationView{BaseOperationEntity: op, OperationJSON: json.RawMessage("null")}
+	if json.Valid([]byte(op.OperationJSON)) {
+		view.OperationJSON = json.RawMessage(op.OperationJSON)
+	}
+	return view
+}
+
+func newOperationViews(ops []*db.BaseOperationEntity) []*operationView {
+	result := make([]*operationView, 0, len(ops))
+	for _, op := range ops {
+		result = append(result, newOperationView(op))
+	}
+	return result
+}
+
+type blockView struct {
+	*db.BlockEntity
+	Transactions []*db.TransactionEntity `json:"transactions"`
+}
+
+type transactionView struct {
+	*db.TransactionEntity
+	Operations []*operationView             `json:"operations"`
+	Receipts   []*types.HxContractOpReceipt `json:"receipts"`
+}
+
+// /api/blocks/:numberOrId, 参数是纯数字时按块号查询, 否则按block_id查询
+func handleGetBlock(w http.ResponseWriter, r *http.Request, params []string) {
+	var block *db.BlockEntity
+	var err error
+	if blockNumber, parseErr := strconv.ParseUint(params[0], 10, 32); parseErr == nil {
+		block, err = db.FindBlock(int(blockNumber))
+	} else {
+		block, err = db.FindBlockByBlockId(params[0])
+	}
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if block == nil {
+		writeNotFound(w)
+		return
+	}
+	txs, err := db.ListTransactionsByBlockNumber(block.Number)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, &blockView{BlockEntity: block, Transactions: txs}, "")
+}
+
+func handleGetTransaction(w http.ResponseWriter, r *http.Request, params []string) {
+	tx, err := db.FindTransaction(params[0])
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if tx == nil {
+		writeNotFound(w)
+		return
+	}
+	ops, err := db.ListBaseOperationsByTxid(tx.Txid)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	receipts, err := db.ListContractOpReceiptsByTxid(tx.Txid)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, &transactionView{TransactionEntity: tx, Operations: newOperationViews(ops), Receipts: receipts}, "")
+}
+
+func handleListAddressOperations(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	ops, err := db.ListBaseOperationsByAddr(params[0], page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(ops), func(i int) int64 { return ops[i].SerialId })
+	ops = ops[:count]
+	writeData(w, newOperationViews(ops), nextCursor)
+}
+
+type addressHistoryView struct {
+	*db.AddressOperationEntity
+	Operation *operationView `json:"operation"`
+}
+
+// 地址作为任意角色参与的operation, 可以用?role=只查某个角色
+func handleListAddressHistory(w http.ResponseWriter, r *http.Request, params []string) {
+	cursor, limit, ok := parseBlockPageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	items, err := db.ListAddressOperationHistory(params[0], r.URL.Query().Get("role"), cursor.BlockNum, cursor.Id, limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := trimBlockPage(len(items), limit, func(i int) blockCursor {
+		return blockCursor{BlockNum: items[i].BlockNum, Id: items[i].Id}
+	})
+	items = items[:count]
+	views := make([]*addressHistoryView, 0, len(items))
+	for _, item := range items {
+		view := &addressHistoryView{AddressOperationEntity: item}
+		if item.Operation != nil {
+			view.Operation = newOperationView(item.Operation)
+		}
+		views = append(views, view)
+	}
+	writeData(w, views, nextCursor)
+}
+
+func handleListAddressBalances(w http.ResponseWriter, r *http.Request, params []string) {
+	balances, err := db.ListAddressBalancesByOwnerAddr(params[0])
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, balances, "")
+}
+
+func handleListAddressTokenBalances(w http.ResponseWriter, r *http.Request, params []string) {
+	balances, err := db.ListTokenBalancesByOwnerAddr(params[0])
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	views, err := newTokenBalanceViews(balances)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, views, "")
+}
+
+func handleListTokenContracts(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	contracts, err := db.ListTokenContracts(page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(contracts), func(i int) int64 { return contracts[i].Id })
+	contracts = contracts[:count]
+	views := make([]*tokenContractView, 0, len(contracts))
+	for _, contract := range contracts {
+		views = append(views, newTokenContractView(contract))
+	}
+	writeData(w, views, nextCursor)
+}
+
+func handleGetTokenContract(w http.ResponseWriter, r *http.Request, params []string) {
+	contract, err := db.FindTokenContractByContractId(params[0])
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if contract == nil {
+		writeNotFound(w)
+		return
+	}
+	writeData(w, newTokenContractView(contract), "")
+}
+
+func handleListTokenContractBalances(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	balances, err := db.ListTokenBalancesByContractAddr(params[0], page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(balances), func(i int) int64 { return balances[i].Id })
+	balances = balances[:count]
+	views, err := newTokenBalanceViews(balances)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, views, nextCursor)
+}
+
+// 可以用?addr=只查某个地址的转入转出
+func handleListTokenContractTransfers(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	transfers, err := db.ListTokenContractTransferHistory(params[0], r.URL.Query().Get("addr"), page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(transfers), func(i int) int64 { return transfers[i].Id })
+	transfers = transfers[:count]
+	views, err := newTokenTransferViews(transfers)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, views, nextCursor)
+}
+
+// ?asset_id=只查某个资产的变化
+func handleListAddressBalanceChanges(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	changes, err := db.ListBalanceChanges(params[0], r.URL.Query().Get("asset_id"), page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(changes), func(i int) int64 { return changes[i].Id })
+	changes = changes[:count]
+	writeData(w, changes, nextCursor)
+}
+
+// amount是最小单位的整数, display_amount按资产精度换算
+type balanceAtBlockView struct {
+	AssetId       string   `json:"asset_id"`
+	Symbol        string   `json:"symbol"`
+	Amount        *big.Int `json:"amount"`
+	DisplayAmount string   `json:"display_amount"`
+}
+
+func handleListAddressBalancesAtBlock(w http.ResponseWriter, r *http.Request, params []string) {
+	blockNum, err := strconv.ParseUint(params[1], 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid block number")
+		return
+	}
+	balances, err := db.SumAddressBalancesAtBlock(params[0], uint32(blockNum))
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	views := make([]*balanceAtBlockView, 0, len(balances))
+	for assetId, amount := range balances {
+		view := &balanceAtBlockView{AssetId: assetId, Amount: amount, DisplayAmount: amount.String()}
+		asset, err := db.FindAsset(assetId)
+		if err != nil {
+			writeServerError(w, err)
+			return
+		}
+		if asset != nil {
+			view.Symbol = asset.Symbol
+			view.DisplayAmount = decimal.NewFromBigInt(amount, -int32(asset.Precision)).String()
+		}
+		views = append(views, view)
+	}
+	sort.Slice(views, func(i, j int) bool {
+		return views[i].AssetId < views[j].AssetId
+	})
+	writeData(w, views, "")
+}
+
+func handleListAddressBalanceReconciliations(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	items, err := db.ListBalanceReconciliations(params[0], page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(items), func(i int) int64 { return items[i].Id })
+	items = items[:count]
+	writeData(w, items, nextCursor)
+}
+
+// ?contract=只查某个token合约的变化
+func handleListAddressTokenBalanceChanges(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	changes, err := db.ListTokenBalanceChanges(params[0], r.URL.Query().Get("contract"), page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(changes), func(i int) int64 { return changes[i].Id })
+	changes = changes[:count]
+	views, err := newTokenBalanceChangeViews(changes)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, views, nextCursor)
+}
+
+type tokenBalanceAtBlockView struct {
+	ContractAddr  string   `json:"contract_addr"`
+	OwnerAddr     string   `json:"owner_addr"`
+	BlockNum      uint32   `json:"block_num"`
+	Amount        *big.Int `json:"amount"`
+	DisplayAmount string   `json:"display_amount"`
+}
+
+func handleGetTokenBalanceAtBlock(w http.ResponseWriter, r *http.Request, params []string) {
+	blockNum, err := strconv.ParseUint(params[1], 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid block number")
+		return
+	}
+	amount, err := db.SumTokenBalanceAtBlock(params[0], params[2], uint32(blockNum))
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	displayAmount, err := newTokenContractLookup().displayAmount(params[0], decimal.NewFromBigInt(amount, 0))
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, &tokenBalanceAtBlockView{ContractAddr: params[0], OwnerAddr: params[2], BlockNum: uint32(blockNum),
+		Amount: amount, DisplayAmount: displayAmount}, "")
+}
+
+// 合约在某个块时所有持有人的余额. 默认按地址分页(cursor是上一页最后的地址), ?format=csv时导出全部
+func handleListTokenHoldersAtBlock(w http.ResponseWriter, r *http.Request, params []string) {
+	blockNum, err := strconv.ParseUint(params[1], 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid block number")
+		return
+	}
+	query := r.URL.Query()
+	if query.Get("format") == "csv" {
+		writeTokenHoldersCsv(w, params[0], uint32(blockNum))
+		return
+	}
+	// cursor是地址, 只解析limit
+	limit, ok := parseLimitParam(query)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	holders, err := db.ListTokenHoldersAtBlock(params[0], uint32(blockNum), query.Get("cursor"), limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	nextCursor := ""
+	if len(holders) > limit {
+		holders = holders[:limit]
+		nextCursor = holders[len(holders)-1].OwnerAddr
+	}
+	lookup := newTokenContractLookup()
+	views := make([]*tokenHolderView, 0, len(holders))
+	for _, holder := range holders {
+		view := &tokenHolderView{TokenHolderBalance: holder}
+		view.DisplayAmount, err = lookup.displayAmount(params[0], decimal.NewFromBigInt(holder.Amount, 0))
+		if err != nil {
+			writeServerError(w, err)
+			return
+		}
+		views = append(views, view)
+	}
+	writeData(w, views, nextCursor)
+}
+
+type tokenHolderView struct {
+	*db.TokenHolderBalance
+	DisplayAmount string `json:"display_amount"`
+}
+
+const tokenHoldersCsvBatchSize = 1000
+
+func writeTokenHoldersCsv(w http.ResponseWriter, contractAddr string, blockNum uint32) {
+	// 先查第一批, 出错时还能返回json错误
+	holders, err := db.ListTokenHoldersAtBlock(contractAddr, blockNum, "", tokenHoldersCsvBatchSize)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	lookup := newTokenContractLookup()
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+contractAddr+"_"+strconv.Itoa(int(blockNum))+".csv\"")
+	writer := csv.NewWriter(w)
+	err = writer.Write([]string{"owner_addr", "amount", "display_amount"})
+	for err == nil && len(holders) > 0 {
+		for _, holder := range holders {
+			var displayAmount string
+			displayAmount, err = lookup.displayAmount(contractAddr, decimal.NewFromBigInt(holder.Amount, 0))
+			if err != nil {
+				break
+			}
+			err = writer.Write([]string{holder.OwnerAddr, holder.Amount.String(), displayAmount})
+			if err != nil {
+				break
+			}
+		}
+		if err != nil || len(holders) < tokenHoldersCsvBatchSize {
+			break
+		}
+		holders, err = db.ListTokenHoldersAtBlock(contractAddr, blockNum, holders[len(holders)-1].OwnerAddr, tokenHoldersCsvBatchSize)
+	}
+	writer.Flush()
+	if err == nil {
+		err = writer.Error()
+	}
+	if err != nil {
+		logger.Println("write token holders csv error " + err.Error())
+	}
+}
+
+// 默认查询地址授权给别人的额度, ?role=spender查询别人授权给地址的额度, ?contract=只查某个token合约
+func handleListAddressTokenAllowances(w http.ResponseWriter, r *http.Request, params []string) {
+	query := r.URL.Query()
+	role := query.Get("role")
+	if len(role) > 0 && role != "owner" && role != "spender" {
+		writeError(w, http.StatusBadRequest, "role must be owner or spender")
+		return
+	}
+	allowances, err := db.ListTokenAllowances(params[0], role == "spender", query.Get("contract"))
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	views, err := newTokenAllowanceViews(allowances)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, views, "")
+}
+
+func handleListAddressTokenAllowanceChanges(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	changes, err := db.ListTokenAllowanceChanges(params[0], r.URL.Query().Get("contract"), page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(changes), func(i int) int64 { return changes[i].Id })
+	changes = changes[:count]
+	views, err := newTokenAllowanceChangeViews(changes)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, views, nextCursor)
+}
+
+// ?event_name=只查某种事件
+func handleListContractEvents(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	events, err := db.ListContractEvents(params[0], r.URL.Query().Get("event_name"), page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(events), func(i int) int64 { return events[i].Id })
+	events = events[:count]
+	writeData(w, events, nextCursor)
+}
+
+// ?type=lua|native和?native_key=按合约类型过滤(比如原生token合约), ?owner=按owner地址过滤,
+// ?methods=a,b只返回abi或offline_abi中包含所有这些api的合约
+func handleListContracts(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	query := r.URL.Query()
+	methods := make([]string, 0)
+	for _, method := range strings.Split(query.Get("methods"), ",") {
+		method = strings.TrimSpace(method)
+		if len(method) > 0 {
+			methods = append(methods, method)
+		}
+	}
+	contracts, err := db.ListContracts(query.Get("type"), query.Get("native_key"), query.Get("owner"), methods, page.Cursor,
+		page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(contracts), func(i int) int64 { return contracts[i].Id })
+	contracts = contracts[:count]
+	writeData(w, contracts, nextCursor)
+}
+
+func handleGetContract(w http.ResponseWriter, r *http.Request, params []string) {
+	contract, err := db.FindContract(params[0])
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if contract == nil {
+		writeNotFound(w)
+		return
+	}
+	writeData(w, contract, "")
+}
+
+func handleListContractMetadataChanges(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	changes, err := db.ListContractMetadataChanges(params[0], page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(changes), func(i int) int64 { return changes[i].Id })
+	changes = changes[:count]
+	writeData(w, changes, nextCursor)
+}
+
+// ?property=只返回这个属性的storage
+func handleListContractStorages(w http.ResponseWriter, r *http.Request, params []string) {
+	storages, err := db.ListContractStorages(params[0], r.URL.Query().Get("property"))
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, storages, "")
+}
+
+// 合约在块blockNum执行后的storage, ?property=只返回这个属性
+func handleListContractStoragesAtBlock(w http.ResponseWriter, r *http.Request, params []string) {
+	blockNum, err := strconv.ParseUint(params[1], 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid block number")
+		return
+	}
+	storages, err := db.ListContractStoragesAtBlock(params[0], r.URL.Query().Get("property"), uint32(blockNum))
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, storages, "")
+}
+
+// ?property=&key=只返回这个storage的变化, map以外的属性key为空
+func handleListContractStorageChanges(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	query := r.URL.Query()
+	changes, err := db.ListContractStorageChanges(params[0], query.Get("property"), query.Get("key"), page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(changes), func(i int) int64 { return changes[i].Id })
+	changes = changes[:count]
+	writeData(w, changes, nextCursor)
+}
+
+// ?api=&caller=过滤调用的api和调用者
+func handleListContractCalls(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	query := r.URL.Query()
+	calls, err := db.ListContractCalls(params[0], query.Get("api"), query.Get("caller"), page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(calls), func(i int) int64 { return calls[i].Id })
+	calls = calls[:count]
+	writeData(w, calls, nextCursor)
+}
+
+type contractCallStatsView struct {
+	From  string                       `json:"from"`
+	To    string                       `json:"to"`
+	Total *db.ContractCallStatEntity   `json:"total"`
+	Apis  []*db.ContractCallStatEntity `json:"apis"`
+	Daily []*db.ContractCallStatEntity `json:"daily"`
+}
+
+// ?from=YYYY-MM-DD&to=YYYY-MM-DD(包含), 默认最近30天(UTC)
+func handleGetContractCallStats(w http.ResponseWriter, r *http.Request, params []string) {
+	from, to, ok := parseDayRangeParams(w, r)
+	if !ok {
+		return
+	}
+	end := to.AddDate(0, 0, 1)
+	total, err := db.GetContractCallTotalStats(params[0], from, end)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	apis, err := db.ListContractCallApiStats(params[0], from, end)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	daily, err := db.ListContractCallDailyStats(params[0], from, end)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, &contractCallStatsView{
+		From:  from.Format("2006-01-02"),
+		To:    to.Format("2006-01-02"),
+		Total: total,
+		Apis:  apis,
+		Daily: daily,
+	}, "")
+}
+
+type contractBalanceView struct {
+	*db.ContractBalanceEntity
+	Symbol        string `json:"symbol"`
+	DisplayAmount string `json:"display_amount"`
+}
+
+func newContractBalanceViews(balances []*db.ContractBalanceEntity) (result []*contractBalanceView, err error) {
+	assets := make(map[string]*db.AssetEntity)
+	result = make([]*contractBalanceView, 0, len(balances))
+	for _, balance := range balances {
+		asset, ok := assets[balance.AssetId]
+		if !ok {
+			asset, err = db.FindAsset(balance.AssetId)
+			if err != nil {
+				return
+			}
+			assets[balance.AssetId] = asset
+		}
+		view := &contractBalanceView{ContractBalanceEntity: balance, DisplayAmount: balance.Amount.String()}
+		if asset != nil {
+			view.Symbol = asset.Symbol
+			view.DisplayAmount = decimal.NewFromBigInt(balance.Amount, -int32(asset.Precision)).String()
+		}
+		result = append(result, view)
+	}
+	return
+}
+
+func handleListContractBalances(w http.ResponseWriter, r *http.Request, params []string) {
+	balances, err := db.ListContractBalances(params[0])
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	views, err := newContractBalanceViews(balances)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, views, "")
+}
+
+// ?asset_id=只返回这个资产的记录
+func handleListContractBalanceChanges(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	changes, err := db.ListContractBalanceChanges(params[0], r.URL.Query().Get("asset_id"), page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(changes), func(i int) int64 { return changes[i].Id })
+	changes = changes[:count]
+	writeData(w, changes, nextCursor)
+}
+
+// ?asset_id=(默认1.3.0)持有这个资产最多的合约, cursor是已经返回的记录数
+func handleListTopContractBalances(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	assetId := r.URL.Query().Get("asset_id")
+	if len(assetId) < 1 {
+		assetId = "1.3.0"
+	}
+	balances, err := db.ListTopContractBalancesOfAsset(assetId, int(page.Cursor), page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	// cursor是偏移量
+	count, nextCursor := page.trim(len(balances), func(int) int64 { return page.Cursor + int64(page.Limit) })
+	balances = balances[:count]
+	views, err := newContractBalanceViews(balances)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, views, nextCursor)
+}
+
+func handleListAddressFees(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	records, err := db.ListFeeRecordsOfPayer(params[0], page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(records), func(i int) int64 { return records[i].Id })
+	records = records[:count]
+	writeData(w, records, nextCursor)
+}
+
+const topFeePayersLimit = 20
+
+type feeStatsView struct {
+	From      string              `json:"from"`
+	To        string              `json:"to"`
+	Daily     []*db.FeeStatEntity `json:"daily"`
+	ByOpType  []*db.FeeStatEntity `json:"by_op_type"`
+	TopPayers []*db.FeeStatEntity `json:"top_payers,omitempty"`
+}
+
+// payerAddr为空时统计所有地址, 并返回支付assetId手续费最多的地址
+func writeFeeStats(w http.ResponseWriter, r *http.Request, payerAddr string) {
+	from, to, ok := parseDayRangeParams(w, r)
+	if !ok {
+		return
+	}
+	end := to.AddDate(0, 0, 1)
+	view := &feeStatsView{From: from.Format("2006-01-02"), To: to.Format("2006-01-02")}
+	var err error
+	view.Daily, err = db.ListDailyFeeStats(payerAddr, from, end)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	view.ByOpType, err = db.ListFeeStatsByOpType(payerAddr, from, end)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if len(payerAddr) < 1 {
+		assetId := r.URL.Query().Get("asset_id")
+		if len(assetId) < 1 {
+			assetId = "1.3.0"
+		}
+		view.TopPayers, err = db.ListTopFeePayers(assetId, from, end, topFeePayersLimit)
+		if err != nil {
+			writeServerError(w, err)
+			return
+		}
+	}
+	writeData(w, view, "")
+}
+
+// ?from=YYYY-MM-DD&to=YYYY-MM-DD
+func handleGetAddressFeeStats(w http.ResponseWriter, r *http.Request, params []string) {
+	writeFeeStats(w, r, params[0])
+}
+
+// ?from=YYYY-MM-DD&to=YYYY-MM-DD&asset_id=(top_payers的资产, 默认1.3.0)
+func handleGetFeeStats(w http.ResponseWriter, r *http.Request, params []string) {
+	writeFeeStats(w, r, "")
+}
+
+func handleListFeeReconciliations(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	items, err := db.ListFeeReconciliations(page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(items), func(i int) int64 { return items[i].Id })
+	items = items[:count]
+	writeData(w, items, nextCursor)
+}
+
+func handleListCitizens(w http.ResponseWriter, r *http.Request, params []string) {
+	citizens, err := db.ListCitizenInfos()
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, citizens, "")
+}
+
+func handleGetCitizen(w http.ResponseWriter, r *http.Request, params []string) {
+	citizen, err := db.FindCitizenInfoByCitizenId(params[0])
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if citizen == nil {
+		writeNotFound(w)
+		return
+	}
+	writeData(w, citizen, "")
+}
+
+type citizenUptimeView struct {
+	CitizenId          string   `json:"citizen_id"`
+	FromBlock          uint32   `json:"from_block"`
+	ToBlock            uint32   `json:"to_block"`
+	ProducedBlocks     int64    `json:"produced_blocks"`
+	MissedBlocks       int64    `json:"missed_blocks"`
+	CollectedFromBlock uint32   `json:"collected_from_block"`
+	CollectedToBlock   uint32   `json:"collected_to_block"`
+	Uptime             *float64 `json:"uptime"`
+	NetworkMissedSlots int64    `json:"network_missed_slots"`
+}
+
+func parseBlockNumParam(query url.Values, name string, defaultValue uint32) (result uint32, ok bool) {
+	valueStr := query.Get(name)
+	if len(valueStr) < 1 {
+		return defaultValue, true
+	}
+	value, err := strconv.ParseUint(valueStr, 10, 32)
+	if err != nil {
+		return
+	}
+	return uint32(value), true
+}
+
+// ?from_block=&to_block=(包含), 默认最近一天的块
+func handleGetCitizenUptime(w http.ResponseWriter, r *http.Request, params []string) {
+	lastScannedBlockNum, err := db.GetLastScannedBlockNumber()
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	query := r.URL.Query()
+	toBlock, ok := parseBlockNumParam(query, "to_block", lastScannedBlockNum)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid to_block")
+		return
+	}
+	dayBlocks := uint32(86400 / 5)
+	if config.SystemConfig.BlockInterval > 0 {
+		dayBlocks = 86400 / config.SystemConfig.BlockInterval
+	}
+	defaultFromBlock := uint32(1)
+	if toBlock > dayBlocks {
+		defaultFromBlock = toBlock - dayBlocks + 1
+	}
+	fromBlock, ok := parseBlockNumParam(query, "from_block", defaultFromBlock)
+	if !ok || fromBlock > toBlock {
+		writeError(w, http.StatusBadRequest, "invalid from_block")
+		return
+	}
+	view := &citizenUptimeView{CitizenId: params[0], FromBlock: fromBlock, ToBlock: toBlock}
+	view.ProducedBlocks, err = db.CountBlocksOfMiner(params[0], fromBlock, toBlock)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	view.NetworkMissedSlots, err = db.SumCitizenMissedBlocks("", db.CitizenMissSourceSlotGap, fromBlock, toBlock)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	// 漏块只在从节点收集时记录, 区间内没有收集过时不知道漏块数, uptime为null
+	view.CollectedToBlock, err = db.FindLastCitizenBlockMissBlockNum(params[0], db.CitizenMissSourceNode, fromBlock, toBlock)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if view.CollectedToBlock < 1 {
+		writeData(w, view, "")
+		return
+	}
+	// 每条收集记录是上一次收集之后到这个块的漏块数, uptime的区间从区间前的最后一次收集之后开始.
+	// 区间前没有收集记录时不知道第一条记录从哪个块开始, 从第一条记录之后开始
+	var prevCollectedBlock uint32
+	if fromBlock > 1 {
+		prevCollectedBlock, err = db.FindLastCitizenBlockMissBlockNum(params[0], db.CitizenMissSourceNode, 1, fromBlock-1)
+		if err != nil {
+			writeServerError(w, err)
+			return
+		}
+	}
+	if prevCollectedBlock < 1 {
+		prevCollectedBlock, err = db.FindFirstCitizenBlockMissBlockNum(params[0], db.CitizenMissSourceNode, fromBlock, toBlock)
+		if err != nil {
+			writeServerError(w, err)
+			return
+		}
+	}
+	if prevCollectedBlock >= view.CollectedToBlock {
+		view.CollectedToBlock = 0
+		writeData(w, view, "")
+		return
+	}
+	view.CollectedFromBlock = prevCollectedBlock + 1
+	view.MissedBlocks, err = db.SumCitizenMissedBlocks(params[0], db.CitizenMissSourceNode, view.CollectedFromBlock,
+		view.CollectedToBlock)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	// uptime只计算收集过漏块的区间
+	collectedProducedBlocks, err := db.CountBlocksOfMiner(params[0], view.CollectedFromBlock, view.CollectedToBlock)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if collectedProducedBlocks+view.MissedBlocks > 0 {
+		uptime := float64(collectedProducedBlocks) / float64(collectedProducedBlocks+view.MissedBlocks)
+		view.Uptime = &uptime
+	}
+	writeData(w, view, "")
+}
+
+func handleListAddressLockedBalances(w http.ResponseWriter, r *http.Request, params []string) {
+	positions, err := db.ListLockedBalances(params[0], "")
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, positions, "")
+}
+
+func handleListAddressLockBalanceEvents(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	events, err := db.ListLockBalanceEvents(params[0], "", page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(events), func(i int) int64 { return events[i].Id })
+	events = events[:count]
+	writeData(w, events, nextCursor)
+}
+
+// 锁仓给citizen的所有地址
+func handleListCitizenPledges(w http.ResponseWriter, r *http.Request, params []string) {
+	positions, err := db.ListLockedBalances("", params[0])
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, positions, "")
+}
+
+// ?lock_type=citizen|guard
+func handleListPledgeTotals(w http.ResponseWriter, r *http.Request, params []string) {
+	lockType := r.URL.Query().Get("lock_type")
+	if len(lockType) > 0 && lockType != db.LockTypeCitizen && lockType != db.LockTypeGuard {
+		writeError(w, http.StatusBadRequest, "lock_type must be citizen or guard")
+		return
+	}
+	totals, err := db.ListPledgeTotals(lockType)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, totals, "")
+}
+
+// ?direction=deposit|withdraw&state=&hx_addr=
+func handleListCrosschainTransfers(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	query := r.URL.Query()
+	transfers, err := db.ListCrosschainTransfers(query.Get("direction"), query.Get("state"), query.Get("hx_addr"),
+		page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(transfers), func(i int) int64 { return transfers[i].Id })
+	transfers = transfers[:count]
+	writeData(w, transfers, nextCursor)
+}
+
+type crosschainTransferView struct {
+	*db.CrosschainTransferEntity
+	Events []*db.CrosschainTransferEventEntity `json:"events"`
+}
+
+func handleGetCrosschainTransfer(w http.ResponseWriter, r *http.Request, params []string) {
+	id, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	transfer, err := db.FindCrosschainTransfer(id)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if transfer == nil {
+		writeNotFound(w)
+		return
+	}
+	linkIds := make([]string, 0)
+	for _, linkId := range []string{transfer.RequestTxid, transfer.WithoutSignTxid, transfer.CombineTxid, transfer.CrosschainTrxId} {
+		if len(linkId) > 0 {
+			linkIds = append(linkIds, linkId)
+		}
+	}
+	events, err := db.ListCrosschainTransferEventsOfLinks(linkIds)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, &crosschainTransferView{CrosschainTransferEntity: transfer, Events: events}, "")
+}
+
+// 没有结束并且最后一次进展比最新扫描的块早older_than秒(默认3600)以上的提现
+func handleListStuckCrosschainWithdrawals(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	olderThan := int64(3600)
+	if olderThanStr := r.URL.Query().Get("older_than"); len(olderThanStr) > 0 {
+		value, err := strconv.ParseInt(olderThanStr, 10, 64)
+		if err != nil || value < 0 {
+			writeError(w, http.StatusBadRequest, "invalid older_than")
+			return
+		}
+		olderThan = value
+	}
+	lastScannedBlockNum, err := db.GetLastScannedBlockNumber()
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	lastBlock, err := db.FindBlock(int(lastScannedBlockNum))
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if lastBlock == nil {
+		writeData(w, make([]*db.CrosschainTransferEntity, 0), "")
+		return
+	}
+	lastBlockTime, err := time.Parse("2006-01-02T15:04:05", lastBlock.Timestamp)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	transfers, err := db.ListStuckCrosschainTransfers(db.CrosschainDirectionWithdraw,
+		lastBlockTime.Add(-time.Duration(olderThan)*time.Second),
+		db.CrosschainFinishedStates, page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(transfers), func(i int) int64 { return transfers[i].Id })
+	transfers = transfers[:count]
+	writeData(w, transfers, nextCursor)
+}
+
+// ?state=&alerted=true
+func handleListColdhotTransfers(w http.ResponseWriter, r *http.Request, params []string) {
+	page, ok := parsePageParams(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid cursor or limit")
+		return
+	}
+	query := r.URL.Query()
+	transfers, err := db.ListColdhotTransfers(query.Get("state"), query.Get("alerted") == "true", page.Cursor, page.Limit+1)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	count, nextCursor := page.trim(len(transfers), func(i int) int64 { return transfers[i].Id })
+	transfers = transfers[:count]
+	writeData(w, transfers, nextCursor)
+}
+
+type coldhotTransferView struct {
+	*db.ColdhotTransferEntity
+	SigningGuards []string                         `json:"signing_guards"`
+	Events        []*db.ColdhotTransferEventEntity `json:"events"`
+}
+
+func handleGetColdhotTransfer(w http.ResponseWriter, r *http.Request, params []string) {
+	id, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	transfer, err := db.FindColdhotTransfer(id)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	if transfer == nil {
+		writeNotFound(w)
+		return
+	}
+	linkIds := make([]string, 0)
+	for _, linkId := range []string{transfer.RequestTxid, transfer.WithoutSignTxid, transfer.CombineTxid, transfer.CrosschainTrxId} {
+		if len(linkId) > 0 {
+			linkIds = append(linkIds, linkId)
+		}
+	}
+	events, err := db.ListColdhotTransferEventsOfLinks(linkIds)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	view := &coldhotTransferView{ColdhotTransferEntity: transfer, SigningGuards: make([]string, 0), Events: events}
+	for _, event := range events {
+		if !db.IsColdhotSignOpType(event.OpTypeName) || len(event.GuardId) < 1 {
+			continue
+		}
+		view.SigningGuards = append(view.SigningGuards, event.GuardId)
+	}
+	writeData(w, view, "")
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/rpc"
+	"strconv"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/nodeservice"
+	"github.com/blocklink/hxscanner/wsjsonrpc/jsonrpc"
+	"golang.org/x/net/websocket"
+)
+
+// 兼容hx_node的websocket json-rpc接口, 已经扫描过的数据从数据库返回, 否则转发给hx_node
+
+type rpcProxyMethod func(param json.RawMessage) (result interface{}, found bool, err error)
+
+var rpcProxyMethods = map[string]rpcProxyMethod{
+	"get_block":                  proxyGetBlock,
+	"get_transaction_by_id":      proxyGetTransactionById,
+	"get_contract_invoke_object": proxyGetContractInvokeObject,
+}
+
+func rawBlockOf(blockNum uint32) (result map[string]json.RawMessage, found bool, err error) {
+	blockJSON, err := db.FindRawBlockJSON(blockNum)
+	if err != nil || blockJSON == nil {
+		return
+	}
+	err = json.Unmarshal([]byte(*blockJSON), &result)
+	if err != nil {
+		return
+	}
+	found = true
+	return
+}
+
+func proxyGetBlock(param json.RawMessage) (result interface{}, found bool, err error) {
+	var blockNumStr string
+	var blockNum uint64
+	if json.Unmarshal(param, &blockNumStr) == nil {
+		blockNum, err = strconv.ParseUint(blockNumStr, 10, 32)
+	} else {
+		err = json.Unmarshal(param, &blockNum)
+	}
+	if err != nil {
+		err = errors.New("invalid block number")
+		return
+	}
+	blockJSON, err := db.FindRawBlockJSON(uint32(blockNum))
+	if err != nil || blockJSON == nil {
+		return
+	}
+	result = json.RawMessage(*blockJSON)
+	found = true
+	return
+}
+
+// 交易从它所在块的原始json中取出
+func proxyGetTransactionById(param json.RawMessage) (result interface{}, found bool, err error) {
+	var txid string
+	err = json.Unmarshal(param, &txid)
+	if err != nil {
+		err = errors.New("invalid txid")
+		return
+	}
+	tx, err := db.FindTransaction(txid)
+	if err != nil || tx == nil {
+		return
+	}
+	block, found, err := rawBlockOf(tx.BlockNumber)
+	if err != nil || !found {
+		return
+	}
+	found = false
+	var txs []json.RawMessage
+	err = json.Unmarshal(block["transactions"], &txs)
+	if err != nil || tx.IndexInBlock >= len(txs) {
+		return
+	}
+	result = txs[tx.IndexInBlock]
+	found = true
+	return
+}
+
+// 只保存了合约交易的receipt, 其他交易转发给节点
+func proxyGetContractInvokeObject(param json.RawMessage) (result interface{}, found bool, err error) {
+	var txid string
+	err = json.Unmarshal(param, &txid)
+	if err != nil {
+		err = errors.New("invalid txid")
+		return
+	}
+	receipts, err := db.ListContractOpReceiptsByTxid(txid)
+	if err != nil || len(receipts) < 1 {
+		return
+	}
+	result = receipts
+	found = true
+	return
+}
+
+func handleRpcProxyRequest(codec rpc.ServerCodec, req *rpc.Request) (result interface{}, err error) {
+	var param json.RawMessage
+	err = codec.ReadRequestBody(&param)
+	if err != nil {
+		return
+	}
+	method, ok := rpcProxyMethods[req.ServiceMethod]
+	if !ok {
+		err = errors.New("method " + req.ServiceMethod + " not supported by hxscanner")
+		return
+	}
+	result, found, err := method(param)
+	if err != nil || found {
+		return
+	}
+	reply, found, err := nodeservice.CallNodeRaw(req.ServiceMethod, param)
+	if err != nil || !found {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func serveRpcProxyConn(conn *websocket.Conn) {
+	codec := jsonrpc.NewServerCodec(conn)
+	defer codec.Close()
+	for {
+		req := new(rpc.Request)
+		err := codec.ReadRequestHeader(req)
+		if err != nil {
+			return
+		}
+		result, err := handleRpcProxyRequest(codec, req)
+		resp := &rpc.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq}
+		if err != nil {
+			logger.Println("rpc proxy " + req.ServiceMethod + " error " + err.Error())
+			resp.Error = err.Error()
+			result = nil
+		}
+		err = codec.WriteResponse(resp, result)
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const (
+	SearchTypeBlock         = "block"
+	SearchTypeTransaction   = "transaction"
+	SearchTypeAddress       = "address"
+	SearchTypePubKey        = "public_key"
+	SearchTypeAccount       = "account"
+	SearchTypeTokenContract = "token_contract"
+	SearchTypeContract      = "contract"
+	SearchTypeAsset         = "asset"
+)
+
+// 完全匹配的分数, 前缀匹配的分数按多出的字符数递减
+const (
+	searchScoreExact       = 100
+	searchScoreFormatOnly  = 90
+	searchScoreNameExact   = 80
+	searchScorePrefixMax   = 60
+	searchScorePrefixMin   = 10
+	searchPrefixMatchLimit = 10
+	maxSearchResults       = 20
+)
+
+var hexIdPattern = regexp.MustCompile(`^[0-9a-fA-F]{40}$|^[0-9a-fA-F]{64}$`)
+var assetIdPattern = regexp.MustCompile(`^1\.3\.[0-9]+$`)
+var namePrefixPattern = regexp.MustCompile(`^[0-9A-Za-z._-]+$`)
+
+// Key是前端跳转用的值(块号, txid, 地址, 合约id, 资产id), Label是显示的名字
+type SearchResult struct {
+	Type  string `json:"type"`
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Score int    `json:"score"`
+}
+
+func prefixMatchScore(name string, query string) int {
+	if strings.EqualFold(name, query) {
+		return searchScoreNameExact
+	}
+	score := searchScorePrefixMax - (len(name) - len(query))
+	if score < searchScorePrefixMin {
+		score = searchScorePrefixMin
+	}
+	return score
+}
+
+// 根据输入的格式查询可能的类型, 结果按分数从高到低排列
+func Search(query string) (result []*SearchResult, err error) {
+	result = make([]*SearchResult, 0)
+	add := func(searchType string, key string, label string, score int) {
+		result = append(result, &SearchResult{Type: searchType, Key: key, Label: label, Score: score})
+	}
+	if blockNumber, parseErr := strconv.ParseUint(query, 10, 32); parseErr == nil {
+		block, err := db.FindBlock(int(blockNumber))
+		if err != nil {
+			return nil, err
+		}
+		if block != nil {
+			add(SearchTypeBlock, strconv.Itoa(int(block.Number)), "block #"+strconv.Itoa(int(block.Number)), searchScoreExact)
+		}
+	}
+	if hexIdPattern.MatchString(query) {
+		block, err := db.FindBlockByBlockId(query)
+		if err != nil {
+			return nil, err
+		}
+		if block != nil {
+			add(SearchTypeBlock, strconv.Itoa(int(block.Number)), "block #"+strconv.Itoa(int(block.Number)), searchScoreExact)
+		}
+		tx, err := db.FindTransaction(query)
+		if err != nil {
+			return nil, err
+		}
+		if tx != nil {
+			add(SearchTypeTransaction, tx.Txid, "transaction in block #"+strconv.Itoa(int(tx.BlockNumber)), searchScoreExact)
+		}
+	}
+	if assetIdPattern.MatchString(query) {
+		asset, err := db.FindAsset(query)
+		if err != nil {
+			return nil, err
+		}
+		if asset != nil {
+			add(SearchTypeAsset, asset.AssetId, asset.Symbol, searchScoreExact)
+		}
+	}
+	if types.IsHxContractAddress(query) {
+		contract, err := db.FindTokenContractByContractId(query)
+		if err != nil {
+			return nil, err
+		}
+		if contract != nil {
+			label := query
+			if contract.TokenSymbol != nil {
+				label = *contract.TokenSymbol
+			}
+			add(SearchTypeTokenContract, query, label, searchScoreExact)
+		} else {
+			add(SearchTypeContract, query, query, searchScoreFormatOnly)
+		}
+	} else if types.IsHxAddress(query) {
+		account, err := db.FindAccountByOwnerAddr(query)
+		if err != nil {
+			return nil, err
+		}
+		if account != nil {
+			add(SearchTypeAddress, query, account.AccountName, searchScoreExact)
+		} else {
+			add(SearchTypeAddress, query, query, searchScoreFormatOnly)
+		}
+	}
+	if types.IsHxPubKey(query) {
+		add(SearchTypePubKey, query, query, searchScoreFormatOnly)
+	}
+	if namePrefixPattern.MatchString(query) {
+		accounts, err := db.ListAccountsByNamePrefix(query, searchPrefixMatchLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			add(SearchTypeAccount, account.OwnerAddr, account.AccountName, prefixMatchScore(account.AccountName, query))
+		}
+		contracts, err := db.ListTokenContractsBySymbolPrefix(query, searchPrefixMatchLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, contract := range contracts {
+			add(SearchTypeTokenContract, contract.ContractId, *contract.TokenSymbol, prefixMatchScore(*contract.TokenSymbol, query))
+		}
+		assets, err := db.ListAssetsBySymbolPrefix(query, searchPrefixMatchLimit)
+		if err != nil {
+			return nil, err
+		}
+		for _, asset := range assets {
+			add(SearchTypeAsset, asset.AssetId, asset.Symbol, prefixMatchScore(asset.Symbol, query))
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Score > result[j].Score
+	})
+	if len(result) > maxSearchResults {
+		result = result[:maxSearchResults]
+	}
+	return
+}
+
+// /api/search?q=
+func handleSearch(w http.ResponseWriter, r *http.Request, params []string) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if len(query) < 1 {
+		writeError(w, http.StatusBadRequest, "q required")
+		return
+	}
+	results, err := Search(query)
+	if err != nil {
+		writeServerError(w, err)
+		return
+	}
+	writeData(w, results, "")
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/log"
+	"golang.org/x/net/websocket"
+)
+
+var logger = log.GetLogger()
+
+const defaultPageLimit = 20
+const maxPageLimit = 200
+
+type apiResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+type apiErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		logger.Println("write api response error " + err.Error())
+	}
+}
+
+func writeData(w http.ResponseWriter, data interface{}, nextCursor string) {
+	writeJSON(w, http.StatusOK, &apiResponse{Data: data, NextCursor: nextCursor})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, &apiErrorResponse{Error: message})
+}
+
+func writeNotFound(w http.ResponseWriter) {
+	writeError(w, http.StatusNotFound, "not found")
+}
+
+func writeServerError(w http.ResponseWriter, err error) {
+	logger.Println("api error " + err.Error())
+	writeError(w, http.StatusInternalServerError, "internal error")
+}
+
+// 分页参数: cursor是上一页返回的next_cursor(记录id), limit默认20, 最大200.
+// 查询时多取一条, 有多余的记录说明还有下一页
+type pageParams struct {
+	Cursor int64
+	Limit  int
+}
+
+func parsePageParams(r *http.Request) (result pageParams, ok bool) {
+	query := r.URL.Query()
+	if cursorStr := query.Get("cursor"); len(cursorStr) > 0 {
+		cursor, err := strconv.ParseInt(cursorStr, 10, 64)
+		if err != nil || cursor < 0 {
+			return
+		}
+		result.Cursor = cursor
+	}
+	result.Limit, ok = parseLimitParam(query)
+	return
+}
+
+func parseLimitParam(query url.Values) (limit int, ok bool) {
+	limit = defaultPageLimit
+	if limitStr := query.Get("limit"); len(limitStr) > 0 {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 {
+			return
+		}
+		if limit > maxPageLimit {
+			limit = maxPageLimit
+		}
+	}
+	ok = true
+	return
+}
+
+// 列表查询时多取了一条用来判断是否有下一页. 返回这一页的条数, 有下一页时nextCursor是这一页最后一条的id
+func (page pageParams) trim(count int, idAt func(i int) int64) (pageCount int, nextCursor string) {
+	if count <= page.Limit {
+		return count, ""
+	}
+	return page.Limit, strconv.FormatInt(idAt(page.Limit-1), 10)
+}
+
+// 按块号排序的列表用"块号:id"做cursor, 同一个块内再按id排序
+type blockCursor struct {
+	BlockNum uint32
+	Id       int64
+}
+
+// ?cursor=块号:id&limit=, 没有cursor时BlockNum是0
+func parseBlockPageParams(r *http.Request) (cursor blockCursor, limit int, ok bool) {
+	query := r.URL.Query()
+	if cursorStr := query.Get("cursor"); len(cursorStr) > 0 {
+		parts := strings.Split(cursorStr, ":")
+		if len(parts) != 2 {
+			return
+		}
+		blockNum, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil || blockNum < 1 {
+			return
+		}
+		id, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil || id < 0 {
+			return
+		}
+		cursor = blockCursor{BlockNum: uint32(blockNum), Id: id}
+	}
+	limit, ok = parseLimitParam(query)
+	return
+}
+
+// 同pageParams.trim, nextCursor是这一页最后一条的"块号:id"
+func trimBlockPage(count int, limit int, cursorAt func(i int) blockCursor) (pageCount int, nextCursor string) {
+	if count <= limit {
+		return count, ""
+	}
+	last := cursorAt(limit - 1)
+	return limit, strconv.FormatUint(uint64(last.BlockNum), 10) + ":" + strconv.FormatInt(last.Id, 10)
+}
+
+const defaultStatsDays = 30
+
+const maxStatsDays = 366
+
+// 统计接口的日期参数 ?from=YYYY-MM-DD&to=YYYY-MM-DD(包含, UTC), 默认最近30天. 参数错误时已经返回错误
+func parseDayRangeParams(w http.ResponseWriter, r *http.Request) (from time.Time, to time.Time, ok bool) {
+	query := r.URL.Query()
+	to = time.Now().UTC().Truncate(24 * time.Hour)
+	var err error
+	if toStr := query.Get("to"); len(toStr) > 0 {
+		to, err = time.Parse("2006-01-02", toStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to date")
+			return
+		}
+	}
+	from = to.AddDate(0, 0, 1-defaultStatsDays)
+	if fromStr := query.Get("from"); len(fromStr) > 0 {
+		from, err = time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from date")
+			return
+		}
+	}
+	if from.After(to) || to.Sub(from) >= maxStatsDays*24*time.Hour {
+		writeError(w, http.StatusBadRequest, "from must not be after to and at most "+strconv.Itoa(maxStatsDays)+
+			" days before it")
+		return
+	}
+	ok = true
+	return
+}
+
+type routeHandler func(w http.ResponseWriter, r *http.Request, params []string)
+
+type route struct {
+	pattern []string // 以":"开头的段是参数
+	handler routeHandler
+}
+
+// 只支持GET的简单路由, /api/ 之后的路径按段匹配
+type router struct {
+	routes []*route
+}
+
+func (rt *router) get(pattern string, handler routeHandler) {
+	rt.routes = append(rt.routes, &route{pattern: strings.Split(strings.Trim(pattern, "/"), "/"), handler: handler})
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for _, item := range rt.routes {
+		if len(item.pattern) != len(segments) {
+			continue
+		}
+		params := make([]string, 0)
+		matched := true
+		for i, patternSegment := range item.pattern {
+			if strings.HasPrefix(patternSegment, ":") {
+				params = append(params, segments[i])
+			} else if patternSegment != segments[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			item.handler(w, r, params)
+			return
+		}
+	}
+	writeNotFound(w)
+}
+
+func newRestRouter() *router {
+	rt := new(router)
+	rt.get("/api/search", handleSearch)
+	rt.get("/api/blocks/:numberOrId", handleGetBlock)
+	rt.get("/api/transactions/:txid", handleGetTransaction)
+	rt.get("/api/addresses/:addr/operations", handleListAddressOperations)
+	rt.get("/api/addresses/:addr/history", handleListAddressHistory)
+	rt.get("/api/addresses/:addr/balances", handleListAddressBalances)
+	rt.get("/api/addresses/:addr/token_balances", handleListAddressTokenBalances)
+	rt.get("/api/addresses/:addr/balance_changes", handleListAddressBalanceChanges)
+	rt.get("/api/addresses/:addr/balances_at/:blockNum", handleListAddressBalancesAtBlock)
+	rt.get("/api/addresses/:addr/balance_reconciliations", handleListAddressBalanceReconciliations)
+	rt.get("/api/addresses/:addr/token_balance_changes", handleListAddressTokenBalanceChanges)
+	rt.get("/api/addresses/:addr/token_allowances", handleListAddressTokenAllowances)
+	rt.get("/api/addresses/:addr/token_allowance_changes", handleListAddressTokenAllowanceChanges)
+	rt.get("/api/addresses/:addr/fees", handleListAddressFees)
+	rt.get("/api/addresses/:addr/fee_stats", handleGetAddressFeeStats)
+	rt.get("/api/addresses/:addr/locked_balances", handleListAddressLockedBalances)
+	rt.get("/api/addresses/:addr/lock_balance_events", handleListAddressLockBalanceEvents)
+	rt.get("/api/token_contracts", handleListTokenContracts)
+	rt.get("/api/token_contracts/:contractId", handleGetTokenContract)
+	rt.get("/api/token_contracts/:contractId/balances", handleListTokenContractBalances)
+	rt.get("/api/token_contracts/:contractId/transfers", handleListTokenContractTransfers)
+	rt.get("/api/token_contracts/:contractId/balances_at/:blockNum", handleListTokenHoldersAtBlock)
+	rt.get("/api/token_contracts/:contractId/balances_at/:blockNum/:addr", handleGetTokenBalanceAtBlock)
+	rt.get("/api/contracts", handleListContracts)
+	rt.get("/api/contracts/:contractId", handleGetContract)
+	rt.get("/api/contracts/:contractId/events", handleListContractEvents)
+	rt.get("/api/contracts/:contractId/metadata_changes", handleListContractMetadataChanges)
+	rt.get("/api/contracts/:contractId/storage", handleListContractStorages)
+	rt.get("/api/contracts/:contractId/storage_at/:blockNum", handleListContractStoragesAtBlock)
+	rt.get("/api/contracts/:contractId/storage_changes", handleListContractStorageChanges)
+	rt.get("/api/contracts/:contractId/calls", handleListContractCalls)
+	rt.get("/api/contracts/:contractId/call_stats", handleGetContractCallStats)
+	rt.get("/api/contracts/:contractId/balances", handleListContractBalances)
+	rt.get("/api/contracts/:contractId/balance_changes", handleListContractBalanceChanges)
+	rt.get("/api/contract_balances", handleListTopContractBalances)
+	rt.get("/api/fee_stats", handleGetFeeStats)
+	rt.get("/api/fee_reconciliations", handleListFeeReconciliations)
+	rt.get("/api/citizens", handleListCitizens)
+	rt.get("/api/citizens/:citizenId", handleGetCitizen)
+	rt.get("/api/citizens/:citizenId/uptime", handleGetCitizenUptime)
+	rt.get("/api/citizens/:citizenId/pledges", handleListCitizenPledges)
+	rt.get("/api/pledge_totals", handleListPledgeTotals)
+	rt.get("/api/crosschain_transfers", handleListCrosschainTransfers)
+	rt.get("/api/crosschain_transfers/stuck", handleListStuckCrosschainWithdrawals)
+	rt.get("/api/crosschain_transfers/:id", handleGetCrosschainTransfer)
+	rt.get("/api/coldhot_transfers", handleListColdhotTransfers)
+	rt.get("/api/coldhot_transfers/:id", handleGetColdhotTransfer)
+	return rt
+}
+
+// 启动http查询接口, 阻塞直到出错
+func Serve(listenAddr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/api/", newRestRouter())
+	mux.HandleFunc("/graphql", handleGraphql)
+	// 其他路径是兼容hx_node的websocket json-rpc代理, 工具只需要改节点地址
+	mux.Handle("/", websocket.Server{Handler: serveRpcProxyConn})
+	logger.Println("hxscanner api listening on " + listenAddr)
+	return http.ListenAndServe(listenAddr, mux)
+}
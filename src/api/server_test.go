@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseBlockPageParams(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantOk     bool
+		wantCursor blockCursor
+		wantLimit  int
+	}{
+		{"", true, blockCursor{}, defaultPageLimit},
+		{"?cursor=120:35&limit=5", true, blockCursor{BlockNum: 120, Id: 35}, 5},
+		{"?cursor=120:0", true, blockCursor{BlockNum: 120, Id: 0}, defaultPageLimit},
+		{"?cursor=35", false, blockCursor{}, 0},
+		{"?cursor=0:35", false, blockCursor{}, 0},
+		{"?cursor=120:-1", false, blockCursor{}, 0},
+		{"?cursor=a:1", false, blockCursor{}, 0},
+		{"?cursor=120:35&limit=0", false, blockCursor{}, 0},
+	}
+	for _, test := range tests {
+		cursor, limit, ok := parseBlockPageParams(httptest.NewRequest("GET", "/api/addresses/HX1/history"+test.query, nil))
+		if ok != test.wantOk {
+			t.Errorf("%s: ok = %v, want %v", test.query, ok, test.wantOk)
+			continue
+		}
+		if ok && (cursor != test.wantCursor || limit != test.wantLimit) {
+			t.Errorf("%s: got %+v limit %d, want %+v limit %d", test.query, cursor, limit, test.wantCursor, test.wantLimit)
+		}
+	}
+}
+
+func TestTrimBlockPage(t *testing.T) {
+	cursors := []blockCursor{{BlockNum: 30, Id: 7}, {BlockNum: 30, Id: 2}, {BlockNum: 10, Id: 9}}
+	cursorAt := func(i int) blockCursor { return cursors[i] }
+	if count, next := trimBlockPage(3, 3, cursorAt); count != 3 || next != "" {
+		t.Errorf("full page: got %d %q", count, next)
+	}
+	if count, next := trimBlockPage(3, 2, cursorAt); count != 2 || next != "30:2" {
+		t.Errorf("more pages: got %d %q, want 2 \"30:2\"", count, next)
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/shopspring/decimal"
+)
+
+// 一次请求中按合约缓存token精度, 用于计算display_amount
+type tokenContractLookup struct {
+	contracts map[string]*db.TokenContractEntity
+}
+
+func newTokenContractLookup() *tokenContractLookup {
+	return &tokenContractLookup{contracts: make(map[string]*db.TokenContractEntity)}
+}
+
+// 合约不存在或没有精度时返回原始金额
+func (lookup *tokenContractLookup) displayAmount(contractAddr string, amount decimal.Decimal) (result string, err error) {
+	contract, ok := lookup.contracts[contractAddr]
+	if !ok {
+		contract, err = db.FindTokenContractByContractId(contractAddr)
+		if err != nil {
+			return
+		}
+		lookup.contracts[contractAddr] = contract
+	}
+	if contract == nil {
+		return amount.String(), nil
+	}
+	return contract.DisplayAmount(amount).String(), nil
+}
+
+type tokenContractView struct {
+	*db.TokenContractEntity
+	DisplayTotalSupply *string `json:"display_total_supply"`
+}
+
+func newTokenContractView(contract *db.TokenContractEntity) *tokenContractView {
+	view := &tokenContractView{TokenContractEntity: contract}
+	if contract.TotalSupply != nil {
+		displayTotalSupply := contract.DisplayAmount(decimal.NewFromBigInt(contract.TotalSupply, 0)).String()
+		view.DisplayTotalSupply = &displayTotalSupply
+	}
+	return view
+}
+
+type tokenBalanceView struct {
+	*db.TokenBalanceEntity
+	DisplayAmount string `json:"display_amount"`
+}
+
+func newTokenBalanceViews(balances []*db.TokenBalanceEntity) (result []*tokenBalanceView, err error) {
+	lookup := newTokenContractLookup()
+	result = make([]*tokenBalanceView, 0, len(balances))
+	for _, balance := range balances {
+		view := &tokenBalanceView{TokenBalanceEntity: balance}
+		view.DisplayAmount, err = lookup.displayAmount(balance.ContractAddr, balance.Amount)
+		if err != nil {
+			return
+		}
+		result = append(result, view)
+	}
+	return
+}
+
+type tokenTransferView struct {
+	*db.TokenContractTransferHistoryEntity
+	DisplayAmount string `json:"display_amount"`
+}
+
+func newTokenTransferViews(transfers []*db.TokenContractTransferHistoryEntity) (result []*tokenTransferView, err error) {
+	lookup := newTokenContractLookup()
+	result = make([]*tokenTransferView, 0, len(transfers))
+	for _, transfer := range transfers {
+		view := &tokenTransferView{TokenContractTransferHistoryEntity: transfer}
+		view.DisplayAmount, err = lookup.displayAmount(transfer.ContractAddr, transfer.Amount)
+		if err != nil {
+			return
+		}
+		result = append(result, view)
+	}
+	return
+}
+
+type tokenBalanceChangeView struct {
+	*db.TokenBalanceChangeEntity
+	DisplayAmount string `json:"display_amount"`
+}
+
+func newTokenBalanceChangeViews(changes []*db.TokenBalanceChangeEntity) (result []*tokenBalanceChangeView, err error) {
+	lookup := newTokenContractLookup()
+	result = make([]*tokenBalanceChangeView, 0, len(changes))
+	for _, change := range changes {
+		view := &tokenBalanceChangeView{TokenBalanceChangeEntity: change}
+		view.DisplayAmount, err = lookup.displayAmount(change.ContractAddr, decimal.NewFromBigInt(change.Amount, 0))
+		if err != nil {
+			return
+		}
+		result = append(result, view)
+	}
+	return
+}
+
+type tokenAllowanceView struct {
+	*db.TokenAllowanceEntity
+	DisplayAmount string `json:"display_amount"`
+}
+
+func newTokenAllowanceViews(allowances []*db.TokenAllowanceEntity) (result []*tokenAllowanceView, err error) {
+	lookup := newTokenContractLookup()
+	result = make([]*tokenAllowanceView, 0, len(allowances))
+	for _, allowance := range allowances {
+		view := &tokenAllowanceView{TokenAllowanceEntity: allowance}
+		view.DisplayAmount, err = lookup.displayAmount(allowance.ContractAddr, decimal.NewFromBigInt(allowance.Amount, 0))
+		if err != nil {
+			return
+		}
+		result = append(result, view)
+	}
+	return
+}
+
+type tokenAllowanceChangeView struct {
+	*db.TokenAllowanceChangeEntity
+	DisplayAmount string `json:"display_amount"`
+}
+
+func newTokenAllowanceChangeViews(changes []*db.TokenAllowanceChangeEntity) (result []*tokenAllowanceChangeView, err error) {
+	lookup := newTokenContractLookup()
+	result = make([]*tokenAllowanceChangeView, 0, len(changes))
+	for _, change := range changes {
+		view := &tokenAllowanceChangeView{TokenAllowanceChangeEntity: change}
+		view.DisplayAmount, err = lookup.displayAmount(change.ContractAddr, decimal.NewFromBigInt(change.Amount, 0))
+		if err != nil {
+			return
+		}
+		result = append(result, view)
+	}
+	return
+}
@@ -4,6 +4,14 @@ type Config struct {
 	NodeApiUrl string
 	DbConnectionString string
 	CallerPubKeyString string
+	WebhooksConfigPath string
+	ScriptsDir string
+	ScriptAllowedTables []string
+	SinkSpecs []string
+	HttpListenAddr string
+	WsListenAddr string
+	MetadataSigners []string
+	BlockInterval uint32
 }
 
 var SystemConfig *Config
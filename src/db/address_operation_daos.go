@@ -0,0 +1,98 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+func FindAddressOperation(txid string, opNum int, addr string, role string, eventIndex int) (result *AddressOperationEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, addr, role, operation_id, txid, op_num, event_index, block_num, operation_type_name"+
+		" FROM public.address_operations where txid=$1 and op_num=$2 and addr=$3 and role=$4 and event_index=$5",
+		txid, opNum, addr, role, eventIndex)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result = new(AddressOperationEntity)
+		err = rows.Scan(&result.Id, &result.Addr, &result.Role, &result.OperationId, &result.Txid, &result.OpNum,
+			&result.EventIndex, &result.BlockNum, &result.OperationTypeName)
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+func SaveAddressOperation(item *AddressOperationEntity) error {
+	stmt, err := dbConn.Prepare("INSERT INTO public.address_operations (addr, role, operation_id, txid, op_num," +
+		" event_index, block_num, operation_type_name) VALUES (($1),($2),($3),($4),($5),($6),($7),($8))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.Addr, item.Role, item.OperationId, item.Txid, item.OpNum, item.EventIndex, item.BlockNum,
+		item.OperationTypeName)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 地址的历史记录, 按(块号, id)从新到旧, 带上对应的operation. 回填的旧operation的id比新扫描的大, 所以不能只按id排序.
+// role为空时不按角色过滤, beforeBlockNum为0时从最新的开始
+func ListAddressOperationHistory(addr string, role string, beforeBlockNum uint32, beforeId int64, limit int) (result []*AddressOperationEntity, err error) {
+	sqlStr := "SELECT ao.id, ao.addr, ao.role, ao.operation_id, ao.txid, ao.op_num, ao.event_index, ao.block_num," +
+		" ao.operation_type_name, o.serial_id, o.id, o.txid, o.tx_block_number, o.tx_index_in_block, o.operation_type," +
+		" o.operation_type_name, o.operation_json, o.addr FROM public.address_operations ao" +
+		" LEFT JOIN public.operations o on o.id=ao.operation_id where ao.addr=$1"
+	args := []interface{}{addr}
+	if len(role) > 0 {
+		args = append(args, role)
+		sqlStr += " and ao.role=$2"
+	}
+	if beforeBlockNum > 0 {
+		args = append(args, beforeBlockNum, beforeId)
+		sqlStr += " and (ao.block_num, ao.id)<($" + strconv.Itoa(len(args)-1) + ", $" + strconv.Itoa(len(args)) + ")"
+	}
+	args = append(args, limit)
+	sqlStr += " order by ao.block_num desc, ao.id desc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*AddressOperationEntity, 0)
+	for rows.Next() {
+		item := new(AddressOperationEntity)
+		var opSerialId sql.NullInt64
+		var opId, opTxid, opTypeName, opJSON, opAddr sql.NullString
+		var opBlockNum, opTxIndex, opType sql.NullInt64
+		err = rows.Scan(&item.Id, &item.Addr, &item.Role, &item.OperationId, &item.Txid, &item.OpNum, &item.EventIndex,
+			&item.BlockNum, &item.OperationTypeName, &opSerialId, &opId, &opTxid, &opBlockNum, &opTxIndex, &opType,
+			&opTypeName, &opJSON, &opAddr)
+		if err != nil {
+			return
+		}
+		if opSerialId.Valid {
+			item.Operation = &BaseOperationEntity{SerialId: opSerialId.Int64, Id: opId.String, Trxid: opTxid.String,
+				BlockNum: int(opBlockNum.Int64), TxIndexInBlock: int(opTxIndex.Int64), OperationType: int(opType.Int64),
+				OperationTypeName: opTypeName.String, OperationJSON: opJSON.String, Addr: opAddr.String}
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+// 按serial_id顺序遍历operations, 用于回填
+func ListBaseOperationsAfterSerialId(afterSerialId int64, limit int) (result []*BaseOperationEntity, err error) {
+	rows, err := dbConn.Query("SELECT serial_id, id, txid, tx_block_number, tx_index_in_block, operation_type,"+
+		" operation_type_name, operation_json, addr FROM public.operations where serial_id>$1"+
+		" order by serial_id asc limit $2", afterSerialId, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanBaseOperations(rows)
+}
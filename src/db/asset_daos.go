@@ -113,4 +113,25 @@ func FindAddressBalanceByOwnerAddrAndAssetId(ownerAddr string, assetId string) (
 		return
 	}
 	return
-}
\ No newline at end of file
+}
+
+func FindAssetBySymbol(symbol string) (result *AssetEntity, err error) {
+	rows, err := dbConn.Query("SELECT asset_id, symbol, precision, created_at, updated_at FROM public.asset where symbol=$1", symbol)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result = new(AssetEntity)
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&result.AssetId, &result.Symbol, &result.Precision, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		result.CreatedAt = time.Unix(createdAtUnix, 0)
+		result.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		return
+	}
+	err = rows.Err()
+	return
+}
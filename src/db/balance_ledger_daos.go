@@ -0,0 +1,343 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func parseBigIntColumn(value string) (result *big.Int, err error) {
+	result, ok := new(big.Int).SetString(value, 10)
+	if !ok {
+		err = errors.New("invalid integer amount " + value)
+	}
+	return
+}
+
+func balanceChangeFieldsSql() string {
+	return "id, addr, asset_id, amount, change_type, block_num, txid, op_num, change_index, created_at"
+}
+
+func scanBalanceChanges(rows *sql.Rows) (result []*BalanceChangeEntity, err error) {
+	result = make([]*BalanceChangeEntity, 0)
+	for rows.Next() {
+		item := new(BalanceChangeEntity)
+		var amountStr string
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.Addr, &item.AssetId, &amountStr, &item.ChangeType, &item.BlockNum, &item.Txid,
+			&item.OpNum, &item.ChangeIndex, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindBalanceChange(txid string, opNum int, addr string, assetId string, changeType string, changeIndex int) (result *BalanceChangeEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+balanceChangeFieldsSql()+" FROM public.balance_changes where txid=$1 and op_num=$2"+
+		" and addr=$3 and asset_id=$4 and change_type=$5 and change_index=$6", txid, opNum, addr, assetId, changeType, changeIndex)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	items, err := scanBalanceChanges(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveBalanceChange(item *BalanceChangeEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.balance_changes (addr, asset_id, amount, change_type, block_num," +
+		" txid, op_num, change_index, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.Addr, item.AssetId, item.Amount.String(), item.ChangeType, item.BlockNum, item.Txid,
+		item.OpNum, item.ChangeIndex, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 地址的余额变化记录, 按id从新到旧. assetId为空时查询所有资产
+func ListBalanceChanges(addr string, assetId string, beforeId int64, limit int) (result []*BalanceChangeEntity, err error) {
+	var rows *sql.Rows
+	if beforeId <= 0 {
+		beforeId = 1<<63 - 1
+	}
+	if len(assetId) > 0 {
+		rows, err = dbConn.Query("SELECT "+balanceChangeFieldsSql()+" FROM public.balance_changes where addr=$1 and asset_id=$2"+
+			" and id<$3 order by id desc limit $4", addr, assetId, beforeId, limit)
+	} else {
+		rows, err = dbConn.Query("SELECT "+balanceChangeFieldsSql()+" FROM public.balance_changes where addr=$1"+
+			" and id<$2 order by id desc limit $3", addr, beforeId, limit)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanBalanceChanges(rows)
+}
+
+// 地址截止到块blockNum(含)的各资产余额 assetId => amount
+func SumAddressBalancesAtBlock(addr string, blockNum uint32) (result map[string]*big.Int, err error) {
+	rows, err := dbConn.Query("SELECT asset_id, SUM(amount) FROM public.balance_changes where addr=$1 and block_num<=$2"+
+		" group by asset_id", addr, blockNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make(map[string]*big.Int)
+	for rows.Next() {
+		var assetId, amountStr string
+		err = rows.Scan(&assetId, &amountStr)
+		if err != nil {
+			return
+		}
+		result[assetId], err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// 一个operation产生的余额变化, 按保存顺序
+func ListBalanceChangesOfOperation(txid string, opNum int) (result []*BalanceChangeEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+balanceChangeFieldsSql()+" FROM public.balance_changes where txid=$1 and op_num=$2"+
+		" order by id asc", txid, opNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanBalanceChanges(rows)
+}
+
+// 地址的一个资产到change(含)为止的余额, 同一个块中按id排序
+func SumAddressAssetBalanceUntilChange(change *BalanceChangeEntity) (result *big.Int, err error) {
+	rows, err := dbConn.Query("SELECT COALESCE(SUM(amount), 0) FROM public.balance_changes where addr=$1 and asset_id=$2"+
+		" and (block_num<$3 or (block_num=$3 and id<=$4))", change.Addr, change.AssetId, change.BlockNum, change.Id)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = big.NewInt(0)
+	if rows.Next() {
+		var amountStr string
+		err = rows.Scan(&amountStr)
+		if err != nil {
+			return
+		}
+		return parseBigIntColumn(amountStr)
+	}
+	err = rows.Err()
+	return
+}
+
+// 地址当前的各资产余额, 从账本汇总并按资产精度换算, 不包括余额为0的资产. created_at和updated_at是第一条和最后一条变化的时间
+func ListAddressBalancesByOwnerAddr(ownerAddr string) (result []*AddressBalanceEntity, err error) {
+	rows, err := dbConn.Query("SELECT bc.asset_id, SUM(bc.amount), COALESCE(MAX(a.precision), 0), MIN(bc.created_at),"+
+		" MAX(bc.created_at) FROM public.balance_changes bc LEFT JOIN public.asset a on a.asset_id=bc.asset_id"+
+		" where bc.addr=$1 group by bc.asset_id having SUM(bc.amount)<>0 order by bc.asset_id asc", ownerAddr)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*AddressBalanceEntity, 0)
+	for rows.Next() {
+		item := &AddressBalanceEntity{OwnerAddr: ownerAddr}
+		var amountStr string
+		var precision int32
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&item.AssetId, &amountStr, &precision, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		var amount *big.Int
+		amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.Amount = decimal.NewFromBigInt(amount, -precision)
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+// (fromBlockNum, toBlockNum]之间余额有变化的地址, 按地址排序, 从afterAddr之后开始
+func ListAddrsWithBalanceChangesBetween(fromBlockNum uint32, toBlockNum uint32, afterAddr string, limit int) (result []string, err error) {
+	rows, err := dbConn.Query("SELECT DISTINCT addr FROM public.balance_changes where block_num>$1 and block_num<=$2"+
+		" and addr>$3 order by addr limit $4", fromBlockNum, toBlockNum, afterAddr, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]string, 0)
+	for rows.Next() {
+		var addr string
+		err = rows.Scan(&addr)
+		if err != nil {
+			return
+		}
+		result = append(result, addr)
+	}
+	err = rows.Err()
+	return
+}
+
+func SaveBalanceReconciliation(item *BalanceReconciliationEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.balance_reconciliations (addr, asset_id, block_num, ledger_amount," +
+		" node_amount, adjusted, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.Addr, item.AssetId, item.BlockNum, item.LedgerAmount.String(), item.NodeAmount.String(),
+		item.Adjusted, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func ListBalanceReconciliations(addr string, beforeId int64, limit int) (result []*BalanceReconciliationEntity, err error) {
+	if beforeId <= 0 {
+		beforeId = 1<<63 - 1
+	}
+	rows, err := dbConn.Query("SELECT id, addr, asset_id, block_num, ledger_amount, node_amount, adjusted, created_at"+
+		" FROM public.balance_reconciliations where addr=$1 and id<$2 order by id desc limit $3", addr, beforeId, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*BalanceReconciliationEntity, 0)
+	for rows.Next() {
+		item := new(BalanceReconciliationEntity)
+		var ledgerAmountStr, nodeAmountStr string
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.Addr, &item.AssetId, &item.BlockNum, &ledgerAmountStr, &nodeAmountStr,
+			&item.Adjusted, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.LedgerAmount, err = parseBigIntColumn(ledgerAmountStr)
+		if err != nil {
+			return
+		}
+		item.NodeAmount, err = parseBigIntColumn(nodeAmountStr)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func accountBindingFieldsSql() string {
+	return "id, addr, crosschain_type, tunnel_address, bind_block_num, bind_txid, unbind_block_num, unbind_txid, created_at"
+}
+
+func scanAccountBindings(rows *sql.Rows) (result []*AccountBindingEntity, err error) {
+	defer rows.Close()
+	result = make([]*AccountBindingEntity, 0)
+	for rows.Next() {
+		item := new(AccountBindingEntity)
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.Addr, &item.CrosschainType, &item.TunnelAddress, &item.BindBlockNum, &item.BindTxid,
+			&item.UnbindBlockNum, &item.UnbindTxid, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindAccountBinding(bindTxid string, addr string, crosschainType string) (result *AccountBindingEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+accountBindingFieldsSql()+" FROM public.account_bindings where bind_txid=$1"+
+		" and addr=$2 and crosschain_type=$3", bindTxid, addr, crosschainType)
+	if err != nil {
+		return
+	}
+	items, err := scanAccountBindings(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+// 块blockNum时绑定了这个链外地址的记录, 没有时返回nil
+func FindAccountBindingOfTunnelAtBlock(tunnelAddress string, crosschainType string, blockNum uint32) (result *AccountBindingEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+accountBindingFieldsSql()+" FROM public.account_bindings where tunnel_address=$1"+
+		" and crosschain_type=$2 and bind_block_num<=$3 and (unbind_block_num=0 or unbind_block_num>$3)"+
+		" order by bind_block_num desc, id desc limit 1", tunnelAddress, crosschainType, blockNum)
+	if err != nil {
+		return
+	}
+	items, err := scanAccountBindings(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveAccountBinding(item *AccountBindingEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.account_bindings (addr, crosschain_type, tunnel_address, bind_block_num," +
+		" bind_txid, unbind_block_num, unbind_txid, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.Addr, item.CrosschainType, item.TunnelAddress, item.BindBlockNum, item.BindTxid,
+		item.UnbindBlockNum, item.UnbindTxid, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// account_unbind_operation解绑addr还没有解绑的绑定
+func UnbindAccountBinding(addr string, crosschainType string, tunnelAddress string, blockNum uint32, txid string) error {
+	stmt, err := dbConn.Prepare("UPDATE public.account_bindings SET unbind_block_num=$1, unbind_txid=$2 WHERE addr=$3" +
+		" and crosschain_type=$4 and tunnel_address=$5 and unbind_block_num=0 and bind_block_num<=$1")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(blockNum, txid, addr, crosschainType, tunnelAddress)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+func citizenInfoFieldsSql() string {
+	return "id, citizen_id, account_id, last_citizen_fee, last_mined_block_num, last_mined_block_id, last_collect_miss_time," +
+		" last_collect_miss_count, last_collect_produced_count, created_at, updated_at"
+}
+
+func nullIfEmpty(value string) interface{} {
+	if len(value) < 1 {
+		return nil
+	}
+	return value
+}
+
+func listCitizenInfos(whereSql string, args ...interface{}) (result []*CitizenInfoEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+citizenInfoFieldsSql()+" FROM public.citizen_infos where "+whereSql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*CitizenInfoEntity, 0)
+	for rows.Next() {
+		item := new(CitizenInfoEntity)
+		var citizenId, accountId, lastMinedBlockId sql.NullString
+		err = rows.Scan(&item.Id, &citizenId, &accountId, &item.LastCitizenFee, &item.LastMinedBlockNum, &lastMinedBlockId,
+			&item.LastCollectMissTime, &item.LastCollectMissCount, &item.LastCollectProducedCount, &item.CreatedAt,
+			&item.UpdatedAt)
+		if err != nil {
+			return
+		}
+		item.CitizenId = citizenId.String
+		item.AccountId = accountId.String
+		item.LastMinedBlockId = lastMinedBlockId.String
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindCitizenInfoByCitizenId(citizenId string) (result *CitizenInfoEntity, err error) {
+	items, err := listCitizenInfos("citizen_id=$1 order by id limit 1", citizenId)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func FindCitizenInfoByAccountId(accountId string) (result *CitizenInfoEntity, err error) {
+	items, err := listCitizenInfos("account_id=$1 order by id limit 1", accountId)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+// 所有citizen, 包括还没有出块的
+func ListCitizenInfos() (result []*CitizenInfoEntity, err error) {
+	return listCitizenInfos("true order by id")
+}
+
+func SaveCitizenInfo(item *CitizenInfoEntity) error {
+	now := time.Now().UTC()
+	stmt, err := dbConn.Prepare("INSERT INTO public.citizen_infos (citizen_id, account_id, last_citizen_fee," +
+		" last_mined_block_num, last_mined_block_id, last_collect_miss_time, last_collect_miss_count," +
+		" last_collect_produced_count, created_at, updated_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(nullIfEmpty(item.CitizenId), nullIfEmpty(item.AccountId), item.LastCitizenFee,
+		item.LastMinedBlockNum, nullIfEmpty(item.LastMinedBlockId), item.LastCollectMissTime.UTC(),
+		item.LastCollectMissCount, item.LastCollectProducedCount, now, now)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateCitizenInfo(item *CitizenInfoEntity) error {
+	stmt, err := dbConn.Prepare("UPDATE public.citizen_infos SET citizen_id=$1, account_id=$2, last_citizen_fee=$3," +
+		" last_mined_block_num=$4, last_mined_block_id=$5, last_collect_miss_time=$6, last_collect_miss_count=$7," +
+		" last_collect_produced_count=$8, updated_at=$9 WHERE id=$10")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(nullIfEmpty(item.CitizenId), nullIfEmpty(item.AccountId), item.LastCitizenFee,
+		item.LastMinedBlockNum, nullIfEmpty(item.LastMinedBlockId), item.LastCollectMissTime.UTC(),
+		item.LastCollectMissCount, item.LastCollectProducedCount, time.Now().UTC(), item.Id)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func FindCitizenBlockMiss(blockNum uint32, citizenId string, source string) (result *CitizenBlockMissEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, citizen_id, missed_count, source, block_num, block_time, created_at"+
+		" FROM public.citizen_block_misses where block_num=$1 and citizen_id=$2 and source=$3", blockNum, citizenId, source)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result = new(CitizenBlockMissEntity)
+		var blockTimeUnix, createdAtUnix int64
+		err = rows.Scan(&result.Id, &result.CitizenId, &result.MissedCount, &result.Source, &result.BlockNum,
+			&blockTimeUnix, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		result.BlockTime = time.Unix(blockTimeUnix, 0).UTC()
+		result.CreatedAt = time.Unix(createdAtUnix, 0)
+	}
+	err = rows.Err()
+	return
+}
+
+func SaveCitizenBlockMiss(item *CitizenBlockMissEntity) error {
+	stmt, err := dbConn.Prepare("INSERT INTO public.citizen_block_misses (citizen_id, missed_count, source, block_num," +
+		" block_time, created_at) VALUES (($1),($2),($3),($4),($5),($6))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.CitizenId, item.MissedCount, item.Source, item.BlockNum, item.BlockTime.Unix(),
+		time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 块[fromBlockNum, toBlockNum]中citizenId漏块的合计
+func SumCitizenMissedBlocks(citizenId string, source string, fromBlockNum uint32, toBlockNum uint32) (result int64, err error) {
+	rows, err := dbConn.Query("SELECT COALESCE(SUM(missed_count), 0) FROM public.citizen_block_misses where citizen_id=$1"+
+		" and source=$2 and block_num>=$3 and block_num<=$4", citizenId, source, fromBlockNum, toBlockNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&result)
+		if err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// 块[fromBlockNum, toBlockNum]中最后一条citizenId漏块记录的块号, 没有记录时返回0
+func FindLastCitizenBlockMissBlockNum(citizenId string, source string, fromBlockNum uint32, toBlockNum uint32) (result uint32, err error) {
+	rows, err := dbConn.Query("SELECT COALESCE(MAX(block_num), 0) FROM public.citizen_block_misses where citizen_id=$1"+
+		" and source=$2 and block_num>=$3 and block_num<=$4", citizenId, source, fromBlockNum, toBlockNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&result)
+		if err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// 块[fromBlockNum, toBlockNum]中第一条citizenId漏块记录的块号, 没有记录时返回0
+func FindFirstCitizenBlockMissBlockNum(citizenId string, source string, fromBlockNum uint32, toBlockNum uint32) (result uint32, err error) {
+	rows, err := dbConn.Query("SELECT COALESCE(MIN(block_num), 0) FROM public.citizen_block_misses where citizen_id=$1"+
+		" and source=$2 and block_num>=$3 and block_num<=$4", citizenId, source, fromBlockNum, toBlockNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&result)
+		if err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// 块[fromBlockNum, toBlockNum]中miner出块的数量
+func CountBlocksOfMiner(miner string, fromBlockNum uint32, toBlockNum uint32) (result int64, err error) {
+	rows, err := dbConn.Query("SELECT count(*) FROM public.blocks where miner=$1 and number>=$2 and number<=$3",
+		miner, fromBlockNum, toBlockNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		err = rows.Scan(&result)
+		if err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
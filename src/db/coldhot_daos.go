@@ -0,0 +1,211 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+func coldhotTransferFieldsSql() string {
+	return "id, state, request_txid, from_addr, to_addr, asset_symbol, asset_id, amount, without_sign_txid, signature_count," +
+		" combine_txid, crosschain_trx_id, finish_txid, request_block_num, request_time, last_block_num, last_block_time," +
+		" unsigned_alert_block_num, updated_at"
+}
+
+func scanColdhotTransfers(rows *sql.Rows) (result []*ColdhotTransferEntity, err error) {
+	defer rows.Close()
+	result = make([]*ColdhotTransferEntity, 0)
+	for rows.Next() {
+		item := new(ColdhotTransferEntity)
+		var requestTimeUnix, lastBlockTimeUnix, updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.State, &item.RequestTxid, &item.FromAddr, &item.ToAddr, &item.AssetSymbol,
+			&item.AssetId, &item.Amount, &item.WithoutSignTxid, &item.SignatureCount, &item.CombineTxid,
+			&item.CrosschainTrxId, &item.FinishTxid, &item.RequestBlockNum, &requestTimeUnix, &item.LastBlockNum,
+			&lastBlockTimeUnix, &item.UnsignedAlertBlockNum, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.RequestTime = time.Unix(requestTimeUnix, 0).UTC()
+		item.LastBlockTime = time.Unix(lastBlockTimeUnix, 0).UTC()
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindColdhotTransfer(id int64) (result *ColdhotTransferEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+coldhotTransferFieldsSql()+" FROM public.coldhot_transfers where id=$1", id)
+	if err != nil {
+		return
+	}
+	items, err := scanColdhotTransfers(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+// 发起交易, without_sign交易, combine交易或者链外交易的id是linkId的冷热转账
+func ListColdhotTransfersOfLink(linkId string) (result []*ColdhotTransferEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+coldhotTransferFieldsSql()+" FROM public.coldhot_transfers where request_txid=$1"+
+		" or without_sign_txid=$1 or combine_txid=$1 or crosschain_trx_id=$1 order by id", linkId)
+	if err != nil {
+		return
+	}
+	return scanColdhotTransfers(rows)
+}
+
+func SaveColdhotTransfer(exec Executor, item *ColdhotTransferEntity) error {
+	stmt, err := exec.Prepare("INSERT INTO public.coldhot_transfers (state, request_txid, from_addr, to_addr, asset_symbol," +
+		" asset_id, amount, without_sign_txid, signature_count, combine_txid, crosschain_trx_id, finish_txid, request_block_num," +
+		" request_time, last_block_num, last_block_time, unsigned_alert_block_num, updated_at)" +
+		" VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10),($11),($12),($13),($14),($15),($16),($17),($18))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.State, item.RequestTxid, item.FromAddr, item.ToAddr, item.AssetSymbol, item.AssetId,
+		item.Amount, item.WithoutSignTxid, item.SignatureCount, item.CombineTxid, item.CrosschainTrxId, item.FinishTxid,
+		item.RequestBlockNum, item.RequestTime.Unix(), item.LastBlockNum, item.LastBlockTime.Unix(),
+		item.UnsignedAlertBlockNum, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateColdhotTransfer(exec Executor, item *ColdhotTransferEntity) error {
+	stmt, err := exec.Prepare("UPDATE public.coldhot_transfers SET state=$1, without_sign_txid=$2, signature_count=$3," +
+		" combine_txid=$4, crosschain_trx_id=$5, finish_txid=$6, last_block_num=$7, last_block_time=$8," +
+		" unsigned_alert_block_num=$9, updated_at=$10 WHERE id=$11")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.State, item.WithoutSignTxid, item.SignatureCount, item.CombineTxid, item.CrosschainTrxId,
+		item.FinishTxid, item.LastBlockNum, item.LastBlockTime.Unix(), item.UnsignedAlertBlockNum, time.Now().Unix(), item.Id)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 按id从新到旧, state为空时不过滤, onlyAlerted时只返回有未签名告警的
+func ListColdhotTransfers(state string, onlyAlerted bool, beforeId int64, limit int) (result []*ColdhotTransferEntity, err error) {
+	sqlStr := "SELECT " + coldhotTransferFieldsSql() + " FROM public.coldhot_transfers where true"
+	args := make([]interface{}, 0)
+	if len(state) > 0 {
+		args = append(args, state)
+		sqlStr += " and state=$" + strconv.Itoa(len(args))
+	}
+	if onlyAlerted {
+		sqlStr += " and unsigned_alert_block_num>0"
+	}
+	if beforeId > 0 {
+		args = append(args, beforeId)
+		sqlStr += " and id<$" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	sqlStr += " order by id desc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	return scanColdhotTransfers(rows)
+}
+
+// 处于states中, 在requestBlockNumBefore之前(包含)发起并且还没有告警的冷热转账
+func ListColdhotTransfersToAlert(states []string, requestBlockNumBefore uint32) (result []*ColdhotTransferEntity, err error) {
+	if len(states) < 1 {
+		return make([]*ColdhotTransferEntity, 0), nil
+	}
+	args := stringsToArgs(states)
+	args = append(args, requestBlockNumBefore)
+	rows, err := dbConn.Query("SELECT "+coldhotTransferFieldsSql()+" FROM public.coldhot_transfers where state in "+
+		inPlaceholdersSql(len(states), 1)+" and request_block_num<=$"+strconv.Itoa(len(args))+
+		" and unsigned_alert_block_num=0 order by id", args...)
+	if err != nil {
+		return
+	}
+	return scanColdhotTransfers(rows)
+}
+
+// 在块blockNum告警的冷热转账
+func ListColdhotTransfersAlertedAt(blockNum uint32) (result []*ColdhotTransferEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+coldhotTransferFieldsSql()+" FROM public.coldhot_transfers"+
+		" where unsigned_alert_block_num=$1 order by id", blockNum)
+	if err != nil {
+		return
+	}
+	return scanColdhotTransfers(rows)
+}
+
+func coldhotTransferEventFieldsSql() string {
+	return "id, op_type_name, link_id, state, guard_id, guard_addr, block_num, block_time, txid, op_num, created_at"
+}
+
+func scanColdhotTransferEvents(rows *sql.Rows) (result []*ColdhotTransferEventEntity, err error) {
+	defer rows.Close()
+	result = make([]*ColdhotTransferEventEntity, 0)
+	for rows.Next() {
+		item := new(ColdhotTransferEventEntity)
+		var blockTimeUnix, createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.OpTypeName, &item.LinkId, &item.State, &item.GuardId, &item.GuardAddr,
+			&item.BlockNum, &blockTimeUnix, &item.Txid, &item.OpNum, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.BlockTime = time.Unix(blockTimeUnix, 0).UTC()
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindColdhotTransferEvent(txid string, opNum int) (result *ColdhotTransferEventEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+coldhotTransferEventFieldsSql()+" FROM public.coldhot_transfer_events"+
+		" where txid=$1 and op_num=$2", txid, opNum)
+	if err != nil {
+		return
+	}
+	items, err := scanColdhotTransferEvents(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveColdhotTransferEvent(exec Executor, item *ColdhotTransferEventEntity) error {
+	stmt, err := exec.Prepare("INSERT INTO public.coldhot_transfer_events (op_type_name, link_id, state, guard_id, guard_addr," +
+		" block_num, block_time, txid, op_num, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.OpTypeName, item.LinkId, item.State, item.GuardId, item.GuardAddr, item.BlockNum,
+		item.BlockTime.Unix(), item.Txid, item.OpNum, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 关联到任意一个linkIds的冷热转账operation, 按块的顺序
+func ListColdhotTransferEventsOfLinks(linkIds []string) (result []*ColdhotTransferEventEntity, err error) {
+	if len(linkIds) < 1 {
+		return make([]*ColdhotTransferEventEntity, 0), nil
+	}
+	rows, err := dbConn.Query("SELECT "+coldhotTransferEventFieldsSql()+" FROM public.coldhot_transfer_events"+
+		" where link_id in "+inPlaceholdersSql(len(linkIds), 1)+" order by block_num asc, id asc", stringsToArgs(linkIds)...)
+	if err != nil {
+		return
+	}
+	return scanColdhotTransferEvents(rows)
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+func contractBalanceChangeFieldsSql() string {
+	return "id, contract_id, asset_id, amount, change_type, block_num, txid, op_num, change_index, created_at"
+}
+
+func scanContractBalanceChanges(rows *sql.Rows) (result []*ContractBalanceChangeEntity, err error) {
+	defer rows.Close()
+	result = make([]*ContractBalanceChangeEntity, 0)
+	for rows.Next() {
+		item := new(ContractBalanceChangeEntity)
+		var amountStr string
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractId, &item.AssetId, &amountStr, &item.ChangeType, &item.BlockNum, &item.Txid,
+			&item.OpNum, &item.ChangeIndex, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindContractBalanceChange(txid string, opNum int, contractId string, assetId string, changeType string, changeIndex int) (result *ContractBalanceChangeEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+contractBalanceChangeFieldsSql()+" FROM public.contract_balance_changes where txid=$1"+
+		" and op_num=$2 and contract_id=$3 and asset_id=$4 and change_type=$5 and change_index=$6",
+		txid, opNum, contractId, assetId, changeType, changeIndex)
+	if err != nil {
+		return
+	}
+	items, err := scanContractBalanceChanges(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveContractBalanceChange(exec Executor, item *ContractBalanceChangeEntity) error {
+	now := time.Now()
+	stmt, err := exec.Prepare("INSERT INTO public.contract_balance_changes (contract_id, asset_id, amount, change_type," +
+		" block_num, txid, op_num, change_index, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractId, item.AssetId, item.Amount.String(), item.ChangeType, item.BlockNum, item.Txid,
+		item.OpNum, item.ChangeIndex, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 合约余额相关的记录, 按id从新到旧. assetId为空时查询所有资产
+func ListContractBalanceChanges(contractId string, assetId string, beforeId int64, limit int) (result []*ContractBalanceChangeEntity, err error) {
+	sqlStr := "SELECT " + contractBalanceChangeFieldsSql() + " FROM public.contract_balance_changes where contract_id=$1"
+	args := []interface{}{contractId}
+	if len(assetId) > 0 {
+		args = append(args, assetId)
+		sqlStr += " and asset_id=$" + strconv.Itoa(len(args))
+	}
+	if beforeId > 0 {
+		args = append(args, beforeId)
+		sqlStr += " and id<$" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	sqlStr += " order by id desc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	return scanContractBalanceChanges(rows)
+}
+
+func contractBalanceFieldsSql() string {
+	return "id, contract_id, asset_id, amount, block_num, updated_at"
+}
+
+func scanContractBalances(rows *sql.Rows) (result []*ContractBalanceEntity, err error) {
+	defer rows.Close()
+	result = make([]*ContractBalanceEntity, 0)
+	for rows.Next() {
+		item := new(ContractBalanceEntity)
+		var amountStr string
+		var updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractId, &item.AssetId, &amountStr, &item.BlockNum, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindContractBalance(contractId string, assetId string) (result *ContractBalanceEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+contractBalanceFieldsSql()+" FROM public.contract_balances where contract_id=$1"+
+		" and asset_id=$2", contractId, assetId)
+	if err != nil {
+		return
+	}
+	items, err := scanContractBalances(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveContractBalance(exec Executor, item *ContractBalanceEntity) error {
+	stmt, err := exec.Prepare("INSERT INTO public.contract_balances (contract_id, asset_id, amount, block_num, updated_at)" +
+		" VALUES (($1),($2),($3),($4),($5))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractId, item.AssetId, item.Amount.String(), item.BlockNum, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateContractBalance(exec Executor, item *ContractBalanceEntity) error {
+	stmt, err := exec.Prepare("UPDATE public.contract_balances SET amount=$1, block_num=$2, updated_at=$3 WHERE id=$4")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.Amount.String(), item.BlockNum, time.Now().Unix(), item.Id)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 合约持有的各资产余额(不包括0)
+func ListContractBalances(contractId string) (result []*ContractBalanceEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+contractBalanceFieldsSql()+" FROM public.contract_balances where contract_id=$1"+
+		" and amount<>0 order by asset_id", contractId)
+	if err != nil {
+		return
+	}
+	return scanContractBalances(rows)
+}
+
+// 持有资产assetId最多的合约, 按余额从大到小
+func ListTopContractBalancesOfAsset(assetId string, offset int, limit int) (result []*ContractBalanceEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+contractBalanceFieldsSql()+" FROM public.contract_balances where asset_id=$1"+
+		" and amount>0 order by amount desc, id asc offset $2 limit $3", assetId, offset, limit)
+	if err != nil {
+		return
+	}
+	return scanContractBalances(rows)
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+func contractCallFieldsSql() string {
+	return "id, contract_id, contract_api, contract_arg, caller_addr, gas_limit, gas_price, actual_fee, exec_succeed," +
+		" api_result, block_num, block_time, txid, op_num, created_at"
+}
+
+func scanContractCalls(rows *sql.Rows) (result []*ContractCallEntity, err error) {
+	defer rows.Close()
+	result = make([]*ContractCallEntity, 0)
+	for rows.Next() {
+		item := new(ContractCallEntity)
+		var blockTimeUnix, createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractId, &item.ContractApi, &item.ContractArg, &item.CallerAddr, &item.GasLimit,
+			&item.GasPrice, &item.ActualFee, &item.ExecSucceed, &item.ApiResult, &item.BlockNum, &blockTimeUnix,
+			&item.Txid, &item.OpNum, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.BlockTime = time.Unix(blockTimeUnix, 0).UTC()
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindContractCall(txid string, opNum int) (result *ContractCallEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+contractCallFieldsSql()+" FROM public.contract_calls where txid=$1 and op_num=$2",
+		txid, opNum)
+	if err != nil {
+		return
+	}
+	items, err := scanContractCalls(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveContractCall(item *ContractCallEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.contract_calls (contract_id, contract_api, contract_arg, caller_addr," +
+		" gas_limit, gas_price, actual_fee, exec_succeed, api_result, block_num, block_time, txid, op_num, created_at)" +
+		" VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10),($11),($12),($13),($14))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractId, item.ContractApi, item.ContractArg, item.CallerAddr, item.GasLimit, item.GasPrice,
+		item.ActualFee, item.ExecSucceed, item.ApiResult, item.BlockNum, item.BlockTime.Unix(), item.Txid, item.OpNum, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 合约的调用记录, 按id从新到旧, contractApi和callerAddr为空时不过滤
+func ListContractCalls(contractId string, contractApi string, callerAddr string, beforeId int64, limit int) (result []*ContractCallEntity, err error) {
+	sqlStr := "SELECT " + contractCallFieldsSql() + " FROM public.contract_calls where contract_id=$1"
+	args := []interface{}{contractId}
+	if len(contractApi) > 0 {
+		args = append(args, contractApi)
+		sqlStr += " and contract_api=$" + strconv.Itoa(len(args))
+	}
+	if len(callerAddr) > 0 {
+		args = append(args, callerAddr)
+		sqlStr += " and caller_addr=$" + strconv.Itoa(len(args))
+	}
+	if beforeId > 0 {
+		args = append(args, beforeId)
+		sqlStr += " and id<$" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	sqlStr += " order by id desc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	return scanContractCalls(rows)
+}
+
+func scanContractCallStats(withDay bool, sqlStr string, args ...interface{}) (result []*ContractCallStatEntity, err error) {
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*ContractCallStatEntity, 0)
+	for rows.Next() {
+		item := new(ContractCallStatEntity)
+		if withDay {
+			err = rows.Scan(&item.Day, &item.ContractApi, &item.Calls, &item.FailedCalls, &item.TotalFee, &item.UniqueCallers)
+		} else {
+			err = rows.Scan(&item.ContractApi, &item.Calls, &item.FailedCalls, &item.TotalFee, &item.UniqueCallers)
+		}
+		if err != nil {
+			return
+		}
+		if item.Calls > 0 {
+			item.FailureRate = float64(item.FailedCalls) / float64(item.Calls)
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+const contractCallStatColumnsSql = "contract_api, count(*), count(*) filter (where not exec_succeed)," +
+	" coalesce(sum(actual_fee), 0), count(distinct caller_addr)"
+
+// 合约在[from, to)期间每天(UTC)每个api的调用统计
+func ListContractCallDailyStats(contractId string, from time.Time, to time.Time) (result []*ContractCallStatEntity, err error) {
+	return scanContractCallStats(true, "SELECT to_char(to_timestamp(block_time) at time zone 'UTC', 'YYYY-MM-DD') as day, "+contractCallStatColumnsSql+
+		" FROM public.contract_calls where contract_id=$1 and block_time>=$2 and block_time<$3"+
+		" group by day, contract_api order by day, contract_api", contractId, from.Unix(), to.Unix())
+}
+
+// 合约在[from, to)期间每个api的调用统计
+func ListContractCallApiStats(contractId string, from time.Time, to time.Time) (result []*ContractCallStatEntity, err error) {
+	return scanContractCallStats(false, "SELECT "+contractCallStatColumnsSql+
+		" FROM public.contract_calls where contract_id=$1 and block_time>=$2 and block_time<$3"+
+		" group by contract_api order by contract_api", contractId, from.Unix(), to.Unix())
+}
+
+// 合约在[from, to)期间所有api的汇总统计, 调用者不重复计算
+func GetContractCallTotalStats(contractId string, from time.Time, to time.Time) (result *ContractCallStatEntity, err error) {
+	items, err := scanContractCallStats(false, "SELECT '', count(*), count(*) filter (where not exec_succeed),"+
+		" coalesce(sum(actual_fee), 0), count(distinct caller_addr)"+
+		" FROM public.contract_calls where contract_id=$1 and block_time>=$2 and block_time<$3", contractId, from.Unix(), to.Unix())
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
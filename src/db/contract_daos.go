@@ -0,0 +1,173 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+func contractFieldsSql() string {
+	return "id, contract_id, contract_type, native_contract_key, owner_addr, owner_pubkey, inherit_from, abi, offline_abi," +
+		" events, storage_properties, code_hash, name, description, gas_price, gas_limit, block_num, txid, register_time, created_at"
+}
+
+func scanContracts(rows *sql.Rows) (result []*ContractEntity, err error) {
+	result = make([]*ContractEntity, 0)
+	for rows.Next() {
+		item := new(ContractEntity)
+		var abiJSON, offlineAbiJSON, eventsJSON, storagePropertiesJSON string
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractId, &item.ContractType, &item.NativeContractKey, &item.OwnerAddr,
+			&item.OwnerPubkey, &item.InheritFrom, &abiJSON, &offlineAbiJSON, &eventsJSON, &storagePropertiesJSON,
+			&item.CodeHash, &item.Name, &item.Description, &item.GasPrice, &item.GasLimit, &item.BlockNum, &item.Txid, &item.RegisterTime, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal([]byte(abiJSON), &item.Abi)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal([]byte(offlineAbiJSON), &item.OfflineAbi)
+		if err != nil {
+			return
+		}
+		err = json.Unmarshal([]byte(eventsJSON), &item.Events)
+		if err != nil {
+			return
+		}
+		item.StorageProperties = json.RawMessage(storagePropertiesJSON)
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindContract(contractId string) (result *ContractEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+contractFieldsSql()+" FROM public.contracts where contract_id=$1", contractId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	items, err := scanContracts(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func stringArrayToJSON(items []string) (string, error) {
+	if items == nil {
+		items = make([]string, 0)
+	}
+	itemsBytes, err := json.Marshal(items)
+	return string(itemsBytes), err
+}
+
+func SaveContract(item *ContractEntity) error {
+	abiJSON, err := stringArrayToJSON(item.Abi)
+	if err != nil {
+		return err
+	}
+	offlineAbiJSON, err := stringArrayToJSON(item.OfflineAbi)
+	if err != nil {
+		return err
+	}
+	eventsJSON, err := stringArrayToJSON(item.Events)
+	if err != nil {
+		return err
+	}
+	storagePropertiesJSON := "[]"
+	if len(item.StorageProperties) > 0 {
+		storagePropertiesJSON = string(item.StorageProperties)
+	}
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.contracts (contract_id, contract_type, native_contract_key, owner_addr," +
+		" owner_pubkey, inherit_from, abi, offline_abi, events, storage_properties, code_hash, name, description, gas_price," +
+		" gas_limit, block_num, txid, register_time, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7::jsonb),($8::jsonb)," +
+		"($9::jsonb),($10::jsonb),($11),($12),($13),($14),($15),($16),($17),($18),($19))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractId, item.ContractType, item.NativeContractKey, item.OwnerAddr, item.OwnerPubkey,
+		item.InheritFrom, abiJSON, offlineAbiJSON, eventsJSON, storagePropertiesJSON, item.CodeHash, item.Name, item.Description, item.GasPrice,
+		item.GasLimit, item.BlockNum, item.Txid, item.RegisterTime, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateContractNameAndDescription(exec Executor, contractId string, name string, description string) error {
+	stmt, err := exec.Prepare("UPDATE public.contracts SET name=$1, description=$2 WHERE contract_id=$3")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(name, description, contractId)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 按合约类型, owner和合约提供的api(每个method在abi或offline_abi中)查询合约, 条件为空时不过滤
+func ListContracts(contractType string, nativeContractKey string, ownerAddr string, methods []string, afterId int64,
+	limit int) (result []*ContractEntity, err error) {
+	sqlStr := "SELECT " + contractFieldsSql() + " FROM public.contracts where id>$1"
+	args := []interface{}{afterId}
+	if len(contractType) > 0 {
+		args = append(args, contractType)
+		sqlStr += " and contract_type=$" + strconv.Itoa(len(args))
+	}
+	if len(nativeContractKey) > 0 {
+		args = append(args, nativeContractKey)
+		sqlStr += " and native_contract_key=$" + strconv.Itoa(len(args))
+	}
+	if len(ownerAddr) > 0 {
+		args = append(args, ownerAddr)
+		sqlStr += " and owner_addr=$" + strconv.Itoa(len(args))
+	}
+	// 分别对abi和offline_abi用@>才能用上gin索引
+	for _, method := range methods {
+		var methodJSON string
+		methodJSON, err = stringArrayToJSON([]string{method})
+		if err != nil {
+			return
+		}
+		args = append(args, methodJSON)
+		placeholder := "$" + strconv.Itoa(len(args)) + "::jsonb"
+		sqlStr += " and (abi @> " + placeholder + " or offline_abi @> " + placeholder + ")"
+	}
+	args = append(args, limit)
+	sqlStr += " order by id asc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanContracts(rows)
+}
+
+// 按serial_id顺序遍历某些类型的operations, 用于回填
+func ListBaseOperationsOfTypesAfterSerialId(operationTypeNames []string, afterSerialId int64, limit int) (result []*BaseOperationEntity, err error) {
+	if len(operationTypeNames) < 1 {
+		return make([]*BaseOperationEntity, 0), nil
+	}
+	args := []interface{}{afterSerialId}
+	args = append(args, stringsToArgs(operationTypeNames)...)
+	args = append(args, limit)
+	rows, err := dbConn.Query("SELECT serial_id, id, txid, tx_block_number, tx_index_in_block, operation_type,"+
+		" operation_type_name, operation_json, addr FROM public.operations where serial_id>$1 and operation_type_name in "+
+		inPlaceholdersSql(len(operationTypeNames), 2)+" order by serial_id asc limit $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanBaseOperations(rows)
+}
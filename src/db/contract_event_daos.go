@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+)
+
+func scanContractEvents(rows *sql.Rows) (result []*ContractEventEntity, err error) {
+	result = make([]*ContractEventEntity, 0)
+	for rows.Next() {
+		item := new(ContractEventEntity)
+		err = rows.Scan(&item.Id, &item.Trxid, &item.BlockNum, &item.OpNum, &item.CallerAddr, &item.ContractAddress,
+			&item.EventName, &item.EventArg)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+// 合约的事件, 按id从新到旧. eventName为空时查询所有事件
+func ListContractEvents(contractAddress string, eventName string, beforeId int64, limit int) (result []*ContractEventEntity, err error) {
+	sqlStr := "SELECT id, trxid, block_num, op_num, caller_addr, contract_address, event_name, event_arg" +
+		" FROM public.contract_operation_receipt_event where contract_address=$1"
+	args := []interface{}{contractAddress}
+	if len(eventName) > 0 {
+		args = append(args, eventName)
+		sqlStr += " and event_name=$2"
+	}
+	if beforeId > 0 {
+		args = append(args, beforeId)
+		sqlStr += " and id<$" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	sqlStr += " order by id desc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanContractEvents(rows)
+}
+
+// id在afterId之后的名为eventName的事件, 按id从旧到新
+func ListContractEventsByNameAfterId(eventName string, afterId int64, limit int) (result []*ContractEventEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, trxid, block_num, op_num, caller_addr, contract_address, event_name, event_arg"+
+		" FROM public.contract_operation_receipt_event where event_name=$1 and id>$2 order by id asc limit $3",
+		eventName, afterId, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanContractEvents(rows)
+}
+
+// 一个operation的所有事件, 按回执中的顺序
+func ListContractEventsOfOperation(trxid string, opNum int) (result []*ContractEventEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, trxid, block_num, op_num, caller_addr, contract_address, event_name, event_arg"+
+		" FROM public.contract_operation_receipt_event where trxid=$1 and op_num=$2 order by id asc", trxid, opNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanContractEvents(rows)
+}
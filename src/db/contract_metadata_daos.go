@@ -0,0 +1,62 @@
+package db
+
+import (
+	"time"
+)
+
+func FindContractMetadataChangeByTxid(txid string, contractId string) (result *ContractMetadataChangeEntity, err error) {
+	items, err := listContractMetadataChanges("txid=$1 and contract_id=$2 order by id asc limit 1", txid, contractId)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+// 合约元数据的变化历史, 按id从新到旧
+func ListContractMetadataChanges(contractId string, beforeId int64, limit int) (result []*ContractMetadataChangeEntity, err error) {
+	if beforeId <= 0 {
+		beforeId = 1<<63 - 1
+	}
+	return listContractMetadataChanges("contract_id=$1 and id<$2 order by id desc limit $3", contractId, beforeId, limit)
+}
+
+func listContractMetadataChanges(whereSql string, args ...interface{}) (result []*ContractMetadataChangeEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, contract_id, source, name, description, logo, url, block_num, txid, signer,"+
+		" created_at FROM public.contract_metadata_changes where "+whereSql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*ContractMetadataChangeEntity, 0)
+	for rows.Next() {
+		item := new(ContractMetadataChangeEntity)
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractId, &item.Source, &item.Name, &item.Description, &item.Logo, &item.Url,
+			&item.BlockNum, &item.Txid, &item.Signer, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func SaveContractMetadataChange(exec Executor, item *ContractMetadataChangeEntity) error {
+	now := time.Now()
+	stmt, err := exec.Prepare("INSERT INTO public.contract_metadata_changes (contract_id, source, name, description," +
+		" logo, url, block_num, txid, signer, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractId, item.Source, item.Name, item.Description, item.Logo, item.Url, item.BlockNum,
+		item.Txid, item.Signer, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
@@ -0,0 +1,160 @@
+package db
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+func FindContractStorageChange(txid string, opNum int, contractId string, propertyName string, storageKey string) (result *ContractStorageChangeEntity, err error) {
+	items, err := listContractStorageChanges("txid=$1 and op_num=$2 and contract_id=$3 and property_name=$4 and storage_key=$5",
+		txid, opNum, contractId, propertyName, storageKey)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+// 合约storage的变化历史, 按id从新到旧. propertyName为空时查询所有属性
+func ListContractStorageChanges(contractId string, propertyName string, storageKey string, beforeId int64, limit int) (result []*ContractStorageChangeEntity, err error) {
+	whereSql := "contract_id=$1"
+	args := []interface{}{contractId}
+	if len(propertyName) > 0 {
+		args = append(args, propertyName)
+		whereSql += " and property_name=$" + strconv.Itoa(len(args))
+		args = append(args, storageKey)
+		whereSql += " and storage_key=$" + strconv.Itoa(len(args))
+	}
+	if beforeId > 0 {
+		args = append(args, beforeId)
+		whereSql += " and id<$" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	return listContractStorageChanges(whereSql+" order by id desc limit $"+strconv.Itoa(len(args)), args...)
+}
+
+func listContractStorageChanges(whereSql string, args ...interface{}) (result []*ContractStorageChangeEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, contract_id, property_name, storage_key, value_before, value_after, block_num,"+
+		" txid, op_num, created_at FROM public.contract_storage_changes where "+whereSql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*ContractStorageChangeEntity, 0)
+	for rows.Next() {
+		item := new(ContractStorageChangeEntity)
+		var valueBefore, valueAfter string
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractId, &item.PropertyName, &item.StorageKey, &valueBefore, &valueAfter,
+			&item.BlockNum, &item.Txid, &item.OpNum, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.ValueBefore = json.RawMessage(valueBefore)
+		item.ValueAfter = json.RawMessage(valueAfter)
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func SaveContractStorageChange(item *ContractStorageChangeEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.contract_storage_changes (contract_id, property_name, storage_key," +
+		" value_before, value_after, block_num, txid, op_num, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractId, item.PropertyName, item.StorageKey, string(item.ValueBefore),
+		string(item.ValueAfter), item.BlockNum, item.Txid, item.OpNum, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func scanContractStorages(rowsQuery string, args ...interface{}) (result []*ContractStorageEntity, err error) {
+	rows, err := dbConn.Query(rowsQuery, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*ContractStorageEntity, 0)
+	for rows.Next() {
+		item := new(ContractStorageEntity)
+		var value string
+		err = rows.Scan(&item.Id, &item.ContractId, &item.PropertyName, &item.StorageKey, &value, &item.BlockNum)
+		if err != nil {
+			return
+		}
+		item.Value = json.RawMessage(value)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindContractStorage(contractId string, propertyName string, storageKey string) (result *ContractStorageEntity, err error) {
+	items, err := scanContractStorages("SELECT id, contract_id, property_name, storage_key, value, block_num"+
+		" FROM public.contract_storages where contract_id=$1 and property_name=$2 and storage_key=$3 limit 1",
+		contractId, propertyName, storageKey)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveContractStorage(item *ContractStorageEntity) error {
+	stmt, err := dbConn.Prepare("INSERT INTO public.contract_storages (contract_id, property_name, storage_key, value," +
+		" block_num, updated_at) VALUES (($1),($2),($3),($4),($5),($6))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractId, item.PropertyName, item.StorageKey, string(item.Value), item.BlockNum,
+		time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateContractStorage(item *ContractStorageEntity) error {
+	stmt, err := dbConn.Prepare("UPDATE public.contract_storages SET value=$1, block_num=$2, updated_at=$3 WHERE id=$4")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(string(item.Value), item.BlockNum, time.Now().Unix(), item.Id)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 合约storage的最新值. propertyName为空时查询所有属性
+func ListContractStorages(contractId string, propertyName string) (result []*ContractStorageEntity, err error) {
+	sqlStr := "SELECT id, contract_id, property_name, storage_key, value, block_num FROM public.contract_storages where contract_id=$1"
+	if len(propertyName) > 0 {
+		return scanContractStorages(sqlStr+" and property_name=$2 order by property_name, storage_key", contractId, propertyName)
+	}
+	return scanContractStorages(sqlStr+" order by property_name, storage_key", contractId)
+}
+
+// 合约在块blockNum(含)时的storage, 每个(属性, key)取这个块之前最后一次变化后的值
+func ListContractStoragesAtBlock(contractId string, propertyName string, blockNum uint32) (result []*ContractStorageEntity, err error) {
+	sqlStr := "SELECT DISTINCT ON (property_name, storage_key) id, contract_id, property_name, storage_key, value_after, block_num" +
+		" FROM public.contract_storage_changes where contract_id=$1 and block_num<=$2"
+	if len(propertyName) > 0 {
+		return scanContractStorages(sqlStr+" and property_name=$3 order by property_name, storage_key, block_num desc, id desc",
+			contractId, blockNum, propertyName)
+	}
+	return scanContractStorages(sqlStr+" order by property_name, storage_key, block_num desc, id desc", contractId, blockNum)
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+func crosschainTransferFieldsSql() string {
+	return "id, direction, state, request_txid, hx_addr, crosschain_addr, asset_symbol, asset_id, amount, without_sign_txid," +
+		" signature_count, combine_txid, crosschain_trx_id, finish_txid, request_block_num, request_time, last_block_num," +
+		" last_block_time, updated_at"
+}
+
+func scanCrosschainTransfers(rows *sql.Rows) (result []*CrosschainTransferEntity, err error) {
+	defer rows.Close()
+	result = make([]*CrosschainTransferEntity, 0)
+	for rows.Next() {
+		item := new(CrosschainTransferEntity)
+		var requestTimeUnix, lastBlockTimeUnix, updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.Direction, &item.State, &item.RequestTxid, &item.HxAddr, &item.CrosschainAddr,
+			&item.AssetSymbol, &item.AssetId, &item.Amount, &item.WithoutSignTxid, &item.SignatureCount, &item.CombineTxid,
+			&item.CrosschainTrxId, &item.FinishTxid, &item.RequestBlockNum, &requestTimeUnix, &item.LastBlockNum,
+			&lastBlockTimeUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.RequestTime = time.Unix(requestTimeUnix, 0).UTC()
+		item.LastBlockTime = time.Unix(lastBlockTimeUnix, 0).UTC()
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindCrosschainTransfer(id int64) (result *CrosschainTransferEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+crosschainTransferFieldsSql()+" FROM public.crosschain_transfers where id=$1", id)
+	if err != nil {
+		return
+	}
+	items, err := scanCrosschainTransfers(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func FindCrosschainTransferByRequestTxid(requestTxid string) (result *CrosschainTransferEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+crosschainTransferFieldsSql()+" FROM public.crosschain_transfers where request_txid=$1",
+		requestTxid)
+	if err != nil {
+		return
+	}
+	items, err := scanCrosschainTransfers(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+// 多个提现请求可能合并在同一个without_sign交易中
+func ListCrosschainTransfersByWithoutSignTxid(withoutSignTxid string) (result []*CrosschainTransferEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+crosschainTransferFieldsSql()+" FROM public.crosschain_transfers"+
+		" where without_sign_txid=$1 order by id", withoutSignTxid)
+	if err != nil {
+		return
+	}
+	return scanCrosschainTransfers(rows)
+}
+
+func ListCrosschainTransfersByCombineTxid(combineTxid string) (result []*CrosschainTransferEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+crosschainTransferFieldsSql()+" FROM public.crosschain_transfers"+
+		" where combine_txid=$1 order by id", combineTxid)
+	if err != nil {
+		return
+	}
+	return scanCrosschainTransfers(rows)
+}
+
+func ListCrosschainTransfersByCrosschainTrxId(crosschainTrxId string) (result []*CrosschainTransferEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+crosschainTransferFieldsSql()+" FROM public.crosschain_transfers"+
+		" where crosschain_trx_id=$1 order by id", crosschainTrxId)
+	if err != nil {
+		return
+	}
+	return scanCrosschainTransfers(rows)
+}
+
+func SaveCrosschainTransfer(exec Executor, item *CrosschainTransferEntity) error {
+	stmt, err := exec.Prepare("INSERT INTO public.crosschain_transfers (direction, state, request_txid, hx_addr," +
+		" crosschain_addr, asset_symbol, asset_id, amount, without_sign_txid, signature_count, combine_txid, crosschain_trx_id," +
+		" finish_txid, request_block_num, request_time, last_block_num, last_block_time, updated_at)" +
+		" VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10),($11),($12),($13),($14),($15),($16),($17),($18))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.Direction, item.State, item.RequestTxid, item.HxAddr, item.CrosschainAddr, item.AssetSymbol,
+		item.AssetId, item.Amount, item.WithoutSignTxid, item.SignatureCount, item.CombineTxid, item.CrosschainTrxId,
+		item.FinishTxid, item.RequestBlockNum, item.RequestTime.Unix(), item.LastBlockNum, item.LastBlockTime.Unix(),
+		time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateCrosschainTransfer(exec Executor, item *CrosschainTransferEntity) error {
+	stmt, err := exec.Prepare("UPDATE public.crosschain_transfers SET state=$1, without_sign_txid=$2, signature_count=$3," +
+		" combine_txid=$4, crosschain_trx_id=$5, finish_txid=$6, last_block_num=$7, last_block_time=$8, updated_at=$9" +
+		" WHERE id=$10")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.State, item.WithoutSignTxid, item.SignatureCount, item.CombineTxid, item.CrosschainTrxId,
+		item.FinishTxid, item.LastBlockNum, item.LastBlockTime.Unix(), time.Now().Unix(), item.Id)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 按id从新到旧, 参数为空时不过滤
+func ListCrosschainTransfers(direction string, state string, hxAddr string, beforeId int64, limit int) (result []*CrosschainTransferEntity, err error) {
+	sqlStr := "SELECT " + crosschainTransferFieldsSql() + " FROM public.crosschain_transfers where true"
+	args := make([]interface{}, 0)
+	if len(direction) > 0 {
+		args = append(args, direction)
+		sqlStr += " and direction=$" + strconv.Itoa(len(args))
+	}
+	if len(state) > 0 {
+		args = append(args, state)
+		sqlStr += " and state=$" + strconv.Itoa(len(args))
+	}
+	if len(hxAddr) > 0 {
+		args = append(args, hxAddr)
+		sqlStr += " and hx_addr=$" + strconv.Itoa(len(args))
+	}
+	if beforeId > 0 {
+		args = append(args, beforeId)
+		sqlStr += " and id<$" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	sqlStr += " order by id desc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	return scanCrosschainTransfers(rows)
+}
+
+// 没有结束并且在lastBlockTimeBefore之后没有进展的跨链转账, 最久的在前. afterId大于0时从这条记录之后开始
+func ListStuckCrosschainTransfers(direction string, lastBlockTimeBefore time.Time, finishedStates []string, afterId int64,
+	limit int) (result []*CrosschainTransferEntity, err error) {
+	args := []interface{}{direction, lastBlockTimeBefore.Unix()}
+	args = append(args, stringsToArgs(finishedStates)...)
+	sqlStr := "SELECT " + crosschainTransferFieldsSql() + " FROM public.crosschain_transfers" +
+		" where direction=$1 and last_block_time<$2 and state not in " + inPlaceholdersSql(len(finishedStates), 3)
+	if afterId > 0 {
+		args = append(args, afterId)
+		sqlStr += " and (last_block_time, id)>(SELECT last_block_time, id FROM public.crosschain_transfers where id=$" +
+			strconv.Itoa(len(args)) + ")"
+	}
+	args = append(args, limit)
+	rows, err := dbConn.Query(sqlStr+" order by last_block_time asc, id asc limit $"+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return
+	}
+	return scanCrosschainTransfers(rows)
+}
+
+func crosschainTransferEventFieldsSql() string {
+	return "id, op_type_name, link_id, state, block_num, block_time, txid, op_num, created_at"
+}
+
+func scanCrosschainTransferEvents(rows *sql.Rows) (result []*CrosschainTransferEventEntity, err error) {
+	defer rows.Close()
+	result = make([]*CrosschainTransferEventEntity, 0)
+	for rows.Next() {
+		item := new(CrosschainTransferEventEntity)
+		var blockTimeUnix, createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.OpTypeName, &item.LinkId, &item.State, &item.BlockNum, &blockTimeUnix, &item.Txid,
+			&item.OpNum, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.BlockTime = time.Unix(blockTimeUnix, 0).UTC()
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindCrosschainTransferEvent(txid string, opNum int) (result *CrosschainTransferEventEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+crosschainTransferEventFieldsSql()+" FROM public.crosschain_transfer_events"+
+		" where txid=$1 and op_num=$2", txid, opNum)
+	if err != nil {
+		return
+	}
+	items, err := scanCrosschainTransferEvents(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveCrosschainTransferEvent(exec Executor, item *CrosschainTransferEventEntity) error {
+	stmt, err := exec.Prepare("INSERT INTO public.crosschain_transfer_events (op_type_name, link_id, state, block_num," +
+		" block_time, txid, op_num, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.OpTypeName, item.LinkId, item.State, item.BlockNum, item.BlockTime.Unix(), item.Txid,
+		item.OpNum, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 关联到任意一个linkIds的跨链operation, 按块的顺序
+func ListCrosschainTransferEventsOfLinks(linkIds []string) (result []*CrosschainTransferEventEntity, err error) {
+	if len(linkIds) < 1 {
+		return make([]*CrosschainTransferEventEntity, 0), nil
+	}
+	rows, err := dbConn.Query("SELECT "+crosschainTransferEventFieldsSql()+" FROM public.crosschain_transfer_events"+
+		" where link_id in "+inPlaceholdersSql(len(linkIds), 1)+" order by block_num asc, id asc", stringsToArgs(linkIds)...)
+	if err != nil {
+		return
+	}
+	return scanCrosschainTransferEvents(rows)
+}
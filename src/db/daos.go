@@ -1,6 +1,7 @@
 package db
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -36,18 +37,21 @@ func GetLastScannedBlockNumber() (uint32, error) {
 }
 
 func UpdateLastScannedBlockNumber(newVal int) error {
-	newValStr := strconv.Itoa(newVal)
-	configEntity, err := FindScanConfig(config.LastScannedBlockNumberConfigKey)
+	return SetScanConfig(config.LastScannedBlockNumberConfigKey, strconv.Itoa(newVal))
+}
+
+func SetScanConfig(configKey string, configValue string) error {
+	configEntity, err := FindScanConfig(configKey)
 	if err != nil {
 		return err
 	}
 	if configEntity == nil {
-		return SaveConfig(config.LastScannedBlockNumberConfigKey, newValStr)
+		return SaveConfig(configKey, configValue)
 	}
-	if configEntity.ConfigValue == newValStr {
+	if configEntity.ConfigValue == configValue {
 		return nil
 	}
-	configEntity.ConfigValue = newValStr
+	configEntity.ConfigValue = configValue
 	return UpdateConfig(configEntity)
 }
 
@@ -76,60 +80,69 @@ func FindScanConfig(configKey string) (result *ScanConfigEntity, err error) {
 	return
 }
 
-func FindContractOpReceipt(trxid string, opNum int) (result *types.HxContractOpReceipt, err error) {
-	rows, err := dbConn.Query("SELECT id, trxid, block_num, op_num, api_result, events, exec_succeed," +
+func contractOpReceiptFieldsSql() string {
+	return "id, trxid, block_num, op_num, api_result, events, exec_succeed," +
 		" actual_fee, invoker, contract_registered, contract_withdraw_info, contract_balance_changes," +
-		" deposit_to_address_changes, deposit_to_contract_changes, transfer_fees" +
-		" FROM public.contract_operation_receipt where trxid=$1 and op_num=$2", trxid, opNum)
+		" deposit_to_address_changes, deposit_to_contract_changes, transfer_fees"
+}
+
+func scanContractOpReceipt(rows *sql.Rows) (result *types.HxContractOpReceipt, err error) {
+	result = types.NewHxContractOpReceipt()
+	var eventsStr, contractWithdrawInfoStr, contractBalancesChangesStr, depositToAddressChangesStr, depositToContractChangesStr, transferFeesStr string
+	err = rows.Scan(&result.Id, &result.Trxid, &result.BlockNum, &result.OpNum, &result.ApiResult, &eventsStr,
+		&result.ExecSucceed, &result.ActualFee, &result.Invoker, &result.ContractRegistered, &contractWithdrawInfoStr,
+		&contractBalancesChangesStr, &depositToAddressChangesStr, &depositToContractChangesStr, &transferFeesStr)
 	if err != nil {
 		return
 	}
-	defer rows.Close()
-	if rows.Next() {
-		result = types.NewHxContractOpReceipt()
-		var eventsStr, contractWithdrawInfoStr, contractBalancesChangesStr, depositToAddressChangesStr, depositToContractChangesStr, transferFeesStr string
-		err = rows.Scan(&result.Id, &result.Trxid, &result.BlockNum, &result.OpNum, &result.ApiResult, &eventsStr,
-			&result.ExecSucceed, &result.ActualFee, &result.Invoker, &result.ContractRegistered, &contractWithdrawInfoStr,
-			&contractBalancesChangesStr, &depositToAddressChangesStr, &depositToContractChangesStr, &transferFeesStr)
+	if len(eventsStr) > 0 {
+		err = json.Unmarshal([]byte(eventsStr), &result.Events)
 		if err != nil {
 			return
 		}
-		if len(eventsStr) > 0 {
-			err = json.Unmarshal([]byte(eventsStr), &result.Events)
-			if err != nil {
-				return
-			}
-		}
-		if len(contractWithdrawInfoStr) > 0 {
-			err = json.Unmarshal([]byte(contractWithdrawInfoStr), &result.ContractWithdrawInfo)
-			if err != nil {
-				return
-			}
+	}
+	if len(contractWithdrawInfoStr) > 0 {
+		err = json.Unmarshal([]byte(contractWithdrawInfoStr), &result.ContractWithdrawInfo)
+		if err != nil {
+			return
 		}
-		if len(contractBalancesChangesStr) > 0 {
-			err = json.Unmarshal([]byte(contractBalancesChangesStr), &result.ContractBalanceChanges)
-			if err != nil {
-				return
-			}
+	}
+	if len(contractBalancesChangesStr) > 0 {
+		err = json.Unmarshal([]byte(contractBalancesChangesStr), &result.ContractBalanceChanges)
+		if err != nil {
+			return
 		}
-		if len(depositToAddressChangesStr) > 0 {
-			err = json.Unmarshal([]byte(depositToAddressChangesStr), &result.DepositToAddressChanges)
-			if err != nil {
-				return
-			}
+	}
+	if len(depositToAddressChangesStr) > 0 {
+		err = json.Unmarshal([]byte(depositToAddressChangesStr), &result.DepositToAddressChanges)
+		if err != nil {
+			return
 		}
-		if len(depositToContractChangesStr) > 0 {
-			err = json.Unmarshal([]byte(depositToContractChangesStr), &result.DepositToContractChanges)
-			if err != nil {
-				return
-			}
+	}
+	if len(depositToContractChangesStr) > 0 {
+		err = json.Unmarshal([]byte(depositToContractChangesStr), &result.DepositToContractChanges)
+		if err != nil {
+			return
 		}
-		if len(transferFeesStr) > 0 {
-			err = json.Unmarshal([]byte(transferFeesStr), &result.TransferFees)
-			if err != nil {
-				return
-			}
+	}
+	if len(transferFeesStr) > 0 {
+		err = json.Unmarshal([]byte(transferFeesStr), &result.TransferFees)
+		if err != nil {
+			return
 		}
+	}
+	return
+}
+
+func FindContractOpReceipt(trxid string, opNum int) (result *types.HxContractOpReceipt, err error) {
+	rows, err := dbConn.Query("SELECT " + contractOpReceiptFieldsSql() +
+		" FROM public.contract_operation_receipt where trxid=$1 and op_num=$2", trxid, opNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result, err = scanContractOpReceipt(rows)
 		return
 	} else {
 		result = nil
@@ -372,7 +385,11 @@ func FindTokenContractByContractId(contractId string) (result *TokenContractEnti
 }
 
 func UpdateTokenContract(tokenContract *TokenContractEntity) error {
-	stmt, err := dbConn.Prepare("UPDATE public.token_contract SET block_num= $1 , block_time= $2 , txid= $3 ," +
+	return UpdateTokenContractInTx(dbConn, tokenContract)
+}
+
+func UpdateTokenContractInTx(exec Executor, tokenContract *TokenContractEntity) error {
+	stmt, err := exec.Prepare("UPDATE public.token_contract SET block_num= $1 , block_time= $2 , txid= $3 ," +
 		" contract_id = $4, contract_type = $5, owner_pubkey = $6, owner_addr = $7, register_time = $8," +
 		" inherit_from = $9, gas_price = $10," +
 		" gas_limit = $11, state = $12, total_supply = $13, precision = $14, token_symbol = $15," +
@@ -580,6 +597,11 @@ func CreateTable(tableName string, columnDefinitions []string, extraSql string)
 }
 
 func InsertDynamicOperation(tableName string, tableSchema *PgTableSchema, opJson map[string]interface{}) error {
+	return InsertDynamicRow(dbConn, tableName, tableSchema, opJson)
+}
+
+// 把opJson中表里有的列插入到tableName
+func InsertDynamicRow(exec Executor, tableName string, tableSchema *PgTableSchema, opJson map[string]interface{}) error {
 	opTableColumnNameSqls := make([]string, 0)
 	prepareValueSqls := make([]string, 0)
 	opValuesForSql := make([]interface{}, 0)
@@ -607,7 +629,7 @@ func InsertDynamicOperation(tableName string, tableSchema *PgTableSchema, opJson
 	}
 	columnsSql := strings.Join(opTableColumnNameSqls, ",")
 	sql := fmt.Sprintf("INSERT INTO public.%s (%s) VALUES (%s)", tableName, columnsSql, strings.Join(prepareValueSqls, ","))
-	stmt, err := dbConn.Prepare(sql)
+	stmt, err := exec.Prepare(sql)
 	if err != nil {
 		logger.Println("insert sql " + sql)
 		return err
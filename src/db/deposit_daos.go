@@ -0,0 +1,151 @@
+package db
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func SaveWatchedAddress(watchedAddress *WatchedAddressEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.watched_addresses (addr, label, created_at, updated_at)" +
+		" VALUES (($1),($2),($3),($4))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(watchedAddress.Addr, watchedAddress.Label, now.Unix(), now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func DeleteWatchedAddress(addr string) error {
+	stmt, err := dbConn.Prepare("DELETE FROM public.watched_addresses WHERE addr=$1")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(addr)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func FindWatchedAddress(addr string) (result *WatchedAddressEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, addr, label, created_at, updated_at FROM public.watched_addresses where addr=$1", addr)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result = new(WatchedAddressEntity)
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&result.Id, &result.Addr, &result.Label, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		result.CreatedAt = time.Unix(createdAtUnix, 0)
+		result.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+func ListWatchedAddresses() (result []*WatchedAddressEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, addr, label, created_at, updated_at FROM public.watched_addresses order by id asc")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*WatchedAddressEntity, 0)
+	for rows.Next() {
+		item := new(WatchedAddressEntity)
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.Addr, &item.Label, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func depositMainFieldsSql() string {
+	return "addr, deposit_type, asset_id, contract_addr, from_addr, amount, precision, block_num, block_time," +
+		" txid, op_num, event_index, confirmations, created_at, updated_at"
+}
+
+func SaveDeposit(deposit *DepositEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.deposits (" + depositMainFieldsSql() + ")" +
+		" VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10),($11),($12),($13),($14),($15))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(deposit.Addr, deposit.DepositType, deposit.AssetId, deposit.ContractAddr, deposit.FromAddr,
+		deposit.Amount.String(), deposit.Precision, deposit.BlockNum, deposit.BlockTime, deposit.Txid, deposit.OpNum,
+		deposit.EventIndex, deposit.Confirmations, now.Unix(), now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func FindDeposit(txid string, opNum int, depositType string, eventIndex int) (result *DepositEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, "+depositMainFieldsSql()+" FROM public.deposits"+
+		" where txid=$1 and op_num=$2 and deposit_type=$3 and event_index=$4", txid, opNum, depositType, eventIndex)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result = new(DepositEntity)
+		var amountStr string
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&result.Id, &result.Addr, &result.DepositType, &result.AssetId, &result.ContractAddr,
+			&result.FromAddr, &amountStr, &result.Precision, &result.BlockNum, &result.BlockTime, &result.Txid,
+			&result.OpNum, &result.EventIndex, &result.Confirmations, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		var ok bool
+		result.Amount, ok = new(big.Int).SetString(amountStr, 10)
+		if !ok {
+			err = errors.New("invalid deposit amount " + amountStr)
+			return
+		}
+		result.CreatedAt = time.Unix(createdAtUnix, 0)
+		result.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+// 扫描到新块后更新未达到maxConfirmations的充值的确认数
+func UpdateDepositConfirmations(headBlockNum uint32, maxConfirmations uint32) error {
+	stmt, err := dbConn.Prepare("UPDATE public.deposits SET confirmations = LEAST($1 - block_num + 1, $2), updated_at = $3" +
+		" WHERE confirmations < $2 AND block_num <= $1")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(headBlockNum, maxConfirmations, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
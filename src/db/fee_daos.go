@@ -0,0 +1,233 @@
+package db
+
+import (
+	"database/sql"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+func feeRecordFieldsSql() string {
+	return "id, payer_addr, asset_id, amount, fee_type, op_type, op_type_name, block_num, block_time, txid, op_num," +
+		" fee_index, created_at"
+}
+
+func scanFeeRecords(rows *sql.Rows) (result []*FeeRecordEntity, err error) {
+	defer rows.Close()
+	result = make([]*FeeRecordEntity, 0)
+	for rows.Next() {
+		item := new(FeeRecordEntity)
+		var amountStr string
+		var blockTimeUnix, createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.PayerAddr, &item.AssetId, &amountStr, &item.FeeType, &item.OpType, &item.OpTypeName,
+			&item.BlockNum, &blockTimeUnix, &item.Txid, &item.OpNum, &item.FeeIndex, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.BlockTime = time.Unix(blockTimeUnix, 0).UTC()
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindFeeRecord(txid string, opNum int, feeType string, feeIndex int) (result *FeeRecordEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+feeRecordFieldsSql()+" FROM public.fee_records where txid=$1 and op_num=$2"+
+		" and fee_type=$3 and fee_index=$4", txid, opNum, feeType, feeIndex)
+	if err != nil {
+		return
+	}
+	items, err := scanFeeRecords(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveFeeRecord(item *FeeRecordEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.fee_records (payer_addr, asset_id, amount, fee_type, op_type," +
+		" op_type_name, block_num, block_time, txid, op_num, fee_index, created_at)" +
+		" VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10),($11),($12))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.PayerAddr, item.AssetId, item.Amount.String(), item.FeeType, item.OpType, item.OpTypeName,
+		item.BlockNum, item.BlockTime.Unix(), item.Txid, item.OpNum, item.FeeIndex, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 地址支付的手续费, 按id从新到旧
+func ListFeeRecordsOfPayer(payerAddr string, beforeId int64, limit int) (result []*FeeRecordEntity, err error) {
+	if beforeId <= 0 {
+		beforeId = 1<<63 - 1
+	}
+	rows, err := dbConn.Query("SELECT "+feeRecordFieldsSql()+" FROM public.fee_records where payer_addr=$1 and id<$2"+
+		" order by id desc limit $3", payerAddr, beforeId, limit)
+	if err != nil {
+		return
+	}
+	return scanFeeRecords(rows)
+}
+
+// 块中资产assetId的手续费合计, 只包括feeTypes中的类型
+func SumBlockFees(blockNum uint32, assetId string, feeTypes []string) (result *big.Int, err error) {
+	rows, err := dbConn.Query("SELECT COALESCE(SUM(amount), 0) FROM public.fee_records where block_num=$1 and asset_id=$2"+
+		" and fee_type in "+inPlaceholdersSql(len(feeTypes), 3), append([]interface{}{blockNum, assetId}, stringsToArgs(feeTypes)...)...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = big.NewInt(0)
+	if rows.Next() {
+		var sumStr string
+		err = rows.Scan(&sumStr)
+		if err != nil {
+			return
+		}
+		result, err = parseBigIntColumn(sumStr)
+		if err != nil {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+func scanFeeStats(sqlStr string, scanDay bool, scanPayer bool, scanOpType bool, args ...interface{}) (result []*FeeStatEntity, err error) {
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*FeeStatEntity, 0)
+	for rows.Next() {
+		item := new(FeeStatEntity)
+		var amountStr string
+		dest := make([]interface{}, 0, 5)
+		if scanDay {
+			dest = append(dest, &item.Day)
+		}
+		if scanPayer {
+			dest = append(dest, &item.PayerAddr)
+		}
+		if scanOpType {
+			dest = append(dest, &item.OpTypeName)
+		}
+		dest = append(dest, &item.AssetId, &item.Count, &amountStr)
+		err = rows.Scan(dest...)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+const feeRecordDaySql = "to_char(to_timestamp(block_time) at time zone 'UTC', 'YYYY-MM-DD')"
+
+// [from, to)期间每天(UTC)每种资产的手续费, payerAddr为空时统计所有地址
+func ListDailyFeeStats(payerAddr string, from time.Time, to time.Time) (result []*FeeStatEntity, err error) {
+	sqlStr := "SELECT " + feeRecordDaySql + " as day, asset_id, count(*), SUM(amount) FROM public.fee_records" +
+		" where block_time>=$1 and block_time<$2"
+	args := []interface{}{from.Unix(), to.Unix()}
+	if len(payerAddr) > 0 {
+		args = append(args, payerAddr)
+		sqlStr += " and payer_addr=$" + strconv.Itoa(len(args))
+	}
+	return scanFeeStats(sqlStr+" group by day, asset_id order by day, asset_id", true, false, false, args...)
+}
+
+// [from, to)期间每种operation每种资产的手续费, payerAddr为空时统计所有地址
+func ListFeeStatsByOpType(payerAddr string, from time.Time, to time.Time) (result []*FeeStatEntity, err error) {
+	sqlStr := "SELECT op_type_name, asset_id, count(*), SUM(amount) FROM public.fee_records" +
+		" where block_time>=$1 and block_time<$2"
+	args := []interface{}{from.Unix(), to.Unix()}
+	if len(payerAddr) > 0 {
+		args = append(args, payerAddr)
+		sqlStr += " and payer_addr=$" + strconv.Itoa(len(args))
+	}
+	return scanFeeStats(sqlStr+" group by op_type_name, asset_id order by op_type_name, asset_id", false, false, true, args...)
+}
+
+// [from, to)期间支付资产assetId手续费最多的地址
+func ListTopFeePayers(assetId string, from time.Time, to time.Time, limit int) (result []*FeeStatEntity, err error) {
+	return scanFeeStats("SELECT payer_addr, asset_id, count(*), SUM(amount) as total FROM public.fee_records"+
+		" where block_time>=$1 and block_time<$2 and asset_id=$3 group by payer_addr, asset_id"+
+		" order by total desc, payer_addr limit $4", false, true, false, from.Unix(), to.Unix(), assetId, limit)
+}
+
+func FindFeeReconciliation(blockNum uint32) (result *FeeReconciliationEntity, err error) {
+	items, err := listFeeReconciliations("block_num=$1", blockNum)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func listFeeReconciliations(whereSql string, args ...interface{}) (result []*FeeReconciliationEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, block_num, block_trxfee, ledger_fee, created_at FROM public.fee_reconciliations"+
+		" where "+whereSql, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*FeeReconciliationEntity, 0)
+	for rows.Next() {
+		item := new(FeeReconciliationEntity)
+		var ledgerFeeStr string
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.BlockNum, &item.BlockTrxfee, &ledgerFeeStr, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.LedgerFee, err = parseBigIntColumn(ledgerFeeStr)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func SaveFeeReconciliation(item *FeeReconciliationEntity) error {
+	stmt, err := dbConn.Prepare("INSERT INTO public.fee_reconciliations (block_num, block_trxfee, ledger_fee, created_at)" +
+		" VALUES (($1),($2),($3),($4))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.BlockNum, item.BlockTrxfee, item.LedgerFee.String(), time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 手续费不一致的块, 按id从新到旧
+func ListFeeReconciliations(beforeId int64, limit int) (result []*FeeReconciliationEntity, err error) {
+	if beforeId <= 0 {
+		beforeId = 1<<63 - 1
+	}
+	return listFeeReconciliations("id<$1 order by id desc limit $2", beforeId, limit)
+}
@@ -0,0 +1,218 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+func lockBalanceEventFieldsSql() string {
+	return "id, event_type, lock_type, owner_addr, owner_account, target_id, asset_id, amount, block_num, block_time, txid," +
+		" op_num, created_at"
+}
+
+func scanLockBalanceEvents(rows *sql.Rows) (result []*LockBalanceEventEntity, err error) {
+	defer rows.Close()
+	result = make([]*LockBalanceEventEntity, 0)
+	for rows.Next() {
+		item := new(LockBalanceEventEntity)
+		var amountStr string
+		var blockTimeUnix, createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.EventType, &item.LockType, &item.OwnerAddr, &item.OwnerAccount, &item.TargetId,
+			&item.AssetId, &amountStr, &item.BlockNum, &blockTimeUnix, &item.Txid, &item.OpNum, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.BlockTime = time.Unix(blockTimeUnix, 0).UTC()
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindLockBalanceEvent(txid string, opNum int) (result *LockBalanceEventEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+lockBalanceEventFieldsSql()+" FROM public.lock_balance_events where txid=$1"+
+		" and op_num=$2", txid, opNum)
+	if err != nil {
+		return
+	}
+	items, err := scanLockBalanceEvents(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveLockBalanceEvent(exec Executor, item *LockBalanceEventEntity) error {
+	now := time.Now()
+	stmt, err := exec.Prepare("INSERT INTO public.lock_balance_events (event_type, lock_type, owner_addr, owner_account," +
+		" target_id, asset_id, amount, block_num, block_time, txid, op_num, created_at)" +
+		" VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10),($11),($12))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.EventType, item.LockType, item.OwnerAddr, item.OwnerAccount, item.TargetId, item.AssetId,
+		item.Amount.String(), item.BlockNum, item.BlockTime.Unix(), item.Txid, item.OpNum, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 地址(ownerAddr)或者citizen/guard(targetId)的锁仓记录, 按id从新到旧
+func ListLockBalanceEvents(ownerAddr string, targetId string, beforeId int64, limit int) (result []*LockBalanceEventEntity, err error) {
+	sqlStr := "SELECT " + lockBalanceEventFieldsSql() + " FROM public.lock_balance_events where true"
+	args := make([]interface{}, 0)
+	if len(ownerAddr) > 0 {
+		args = append(args, ownerAddr)
+		sqlStr += " and owner_addr=$" + strconv.Itoa(len(args))
+	}
+	if len(targetId) > 0 {
+		args = append(args, targetId)
+		sqlStr += " and target_id=$" + strconv.Itoa(len(args))
+	}
+	if beforeId > 0 {
+		args = append(args, beforeId)
+		sqlStr += " and id<$" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	sqlStr += " order by id desc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	return scanLockBalanceEvents(rows)
+}
+
+func lockedBalanceFieldsSql() string {
+	return "id, lock_type, owner_addr, target_id, asset_id, amount, first_locked_block_num, first_locked_at, block_num, updated_at"
+}
+
+func scanLockedBalances(rows *sql.Rows) (result []*LockedBalanceEntity, err error) {
+	defer rows.Close()
+	result = make([]*LockedBalanceEntity, 0)
+	for rows.Next() {
+		item := new(LockedBalanceEntity)
+		var amountStr string
+		var firstLockedAtUnix, updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.LockType, &item.OwnerAddr, &item.TargetId, &item.AssetId, &amountStr,
+			&item.FirstLockedBlockNum, &firstLockedAtUnix, &item.BlockNum, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.FirstLockedAt = time.Unix(firstLockedAtUnix, 0).UTC()
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindLockedBalance(lockType string, ownerAddr string, targetId string, assetId string) (result *LockedBalanceEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+lockedBalanceFieldsSql()+" FROM public.locked_balances where lock_type=$1"+
+		" and owner_addr=$2 and target_id=$3 and asset_id=$4", lockType, ownerAddr, targetId, assetId)
+	if err != nil {
+		return
+	}
+	items, err := scanLockedBalances(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveLockedBalance(exec Executor, item *LockedBalanceEntity) error {
+	stmt, err := exec.Prepare("INSERT INTO public.locked_balances (lock_type, owner_addr, target_id, asset_id, amount," +
+		" first_locked_block_num, first_locked_at, block_num, updated_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.LockType, item.OwnerAddr, item.TargetId, item.AssetId, item.Amount.String(),
+		item.FirstLockedBlockNum, item.FirstLockedAt.Unix(), item.BlockNum, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateLockedBalance(exec Executor, item *LockedBalanceEntity) error {
+	stmt, err := exec.Prepare("UPDATE public.locked_balances SET amount=$1, first_locked_block_num=$2, first_locked_at=$3," +
+		" block_num=$4, updated_at=$5 WHERE id=$6")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.Amount.String(), item.FirstLockedBlockNum, item.FirstLockedAt.Unix(), item.BlockNum,
+		time.Now().Unix(), item.Id)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 地址(ownerAddr)或者锁仓给citizen/guard(targetId)的当前锁仓, 不包括已经全部赎回的
+func ListLockedBalances(ownerAddr string, targetId string) (result []*LockedBalanceEntity, err error) {
+	sqlStr := "SELECT " + lockedBalanceFieldsSql() + " FROM public.locked_balances where amount>0"
+	args := make([]interface{}, 0)
+	if len(ownerAddr) > 0 {
+		args = append(args, ownerAddr)
+		sqlStr += " and owner_addr=$" + strconv.Itoa(len(args))
+	}
+	if len(targetId) > 0 {
+		args = append(args, targetId)
+		sqlStr += " and target_id=$" + strconv.Itoa(len(args))
+	}
+	rows, err := dbConn.Query(sqlStr+" order by amount desc, id", args...)
+	if err != nil {
+		return
+	}
+	return scanLockedBalances(rows)
+}
+
+// 每个citizen/guard每种资产的锁仓合计, lockType为空时包括所有类型
+func ListPledgeTotals(lockType string) (result []*PledgeTotalEntity, err error) {
+	sqlStr := "SELECT lock_type, target_id, asset_id, SUM(amount) as total, count(distinct owner_addr)" +
+		" FROM public.locked_balances where amount>0"
+	args := make([]interface{}, 0)
+	if len(lockType) > 0 {
+		args = append(args, lockType)
+		sqlStr += " and lock_type=$1"
+	}
+	rows, err := dbConn.Query(sqlStr+" group by lock_type, target_id, asset_id order by asset_id, total desc, target_id", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*PledgeTotalEntity, 0)
+	for rows.Next() {
+		item := new(PledgeTotalEntity)
+		var amountStr string
+		err = rows.Scan(&item.LockType, &item.TargetId, &item.AssetId, &amountStr, &item.LockerCount)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
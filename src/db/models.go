@@ -3,6 +3,7 @@ package db
 import (
 	_ "github.com/bmizerany/pq"
 	"database/sql"
+	"encoding/json"
 	"github.com/blocklink/hxscanner/src/log"
 	"math/big"
 	"github.com/shopspring/decimal"
@@ -29,42 +30,42 @@ func CloseDb() {
 }
 
 type BlockEntity struct {
-	Id int64
-	Number uint32
-	Previous string
-	Timestamp string
-	Trxfee uint64
-	Miner string
-	TransactionMerkleRoot string
-	NextSecretHash string
-	BlockId string // TODO: 扫描后塞入失败
-	Reward uint64
-	TxsCount int
+	Id int64 `json:"id"`
+	Number uint32 `json:"number"`
+	Previous string `json:"previous"`
+	Timestamp string `json:"timestamp"`
+	Trxfee uint64 `json:"trxfee"`
+	Miner string `json:"miner"`
+	TransactionMerkleRoot string `json:"transaction_merkle_root"`
+	NextSecretHash string `json:"next_secret_hash"`
+	BlockId string `json:"block_id"` // TODO: 扫描后塞入失败
+	Reward uint64 `json:"reward"`
+	TxsCount int `json:"txs_count"`
 }
 
 type TransactionEntity struct {
-	SerialId int64
-	BlockNumber uint32
-	Id string
-	RefBlockNum uint64
-	RefBlockPrefix uint64
-	Expiration string
-	OperationsCount int
-	IndexInBlock int
-	FirstOperationType int
-	Txid string
+	SerialId int64 `json:"serial_id"`
+	BlockNumber uint32 `json:"block_number"`
+	Id string `json:"id"`
+	RefBlockNum uint64 `json:"ref_block_num"`
+	RefBlockPrefix uint64 `json:"ref_block_prefix"`
+	Expiration string `json:"expiration"`
+	OperationsCount int `json:"operations_count"`
+	IndexInBlock int `json:"index_in_block"`
+	FirstOperationType int `json:"first_operation_type"`
+	Txid string `json:"txid"`
 }
 
 type BaseOperationEntity struct {
-	SerialId int64
-	Id string
-	Trxid string
-	BlockNum int
-	TxIndexInBlock int
-	OperationType int
-	OperationTypeName string
-	OperationJSON string
-	Addr string
+	SerialId int64 `json:"serial_id"`
+	Id string `json:"id"`
+	Trxid string `json:"txid"`
+	BlockNum int `json:"block_num"`
+	TxIndexInBlock int `json:"tx_index_in_block"`
+	OperationType int `json:"operation_type"`
+	OperationTypeName string `json:"operation_type_name"`
+	OperationJSON string `json:"operation_json"`
+	Addr string `json:"addr"`
 }
 
 type ScanConfigEntity struct {
@@ -92,75 +93,681 @@ func (schema *PgTableSchema) HasColumn(name string) bool {
 }
 
 type TokenContractEntity struct {
-	Id int64
-	BlockNum uint32
-	BlockTime string
-	Txid string
-	ContractId string
-	ContractType string
-	OwnerPubkey string
-	OwnerAddr string
-	RegisterTime string
-	InheritFrom string
-	GasPrice uint64
-	GasLimit uint64
-	State *string
-	TotalSupply *big.Int
-	Precision *uint32
-	TokenSymbol *string
-	TokenName *string
-	Logo *string
-	Url *string
-	Description *string
+	Id int64 `json:"id"`
+	BlockNum uint32 `json:"block_num"`
+	BlockTime string `json:"block_time"`
+	Txid string `json:"txid"`
+	ContractId string `json:"contract_id"`
+	ContractType string `json:"contract_type"`
+	OwnerPubkey string `json:"owner_pubkey"`
+	OwnerAddr string `json:"owner_addr"`
+	RegisterTime string `json:"register_time"`
+	InheritFrom string `json:"inherit_from"`
+	GasPrice uint64 `json:"gas_price"`
+	GasLimit uint64 `json:"gas_limit"`
+	State *string `json:"state"`
+	TotalSupply *big.Int `json:"total_supply"`
+	Precision *uint32 `json:"precision"`
+	TokenSymbol *string `json:"token_symbol"`
+	TokenName *string `json:"token_name"`
+	Logo *string `json:"logo"`
+	Url *string `json:"url"`
+	Description *string `json:"description"`
+}
+
+// token合约的precision是最小单位的倍数(1, 10, 100, ...), 换算成小数位数
+func TokenPrecisionDecimals(precision uint32) int32 {
+	var decimals int32 = 0
+	for precision >= 10 && precision%10 == 0 {
+		precision /= 10
+		decimals++
+	}
+	return decimals
+}
+
+// 按token精度换算后的金额
+func (contract *TokenContractEntity) DisplayAmount(amount decimal.Decimal) decimal.Decimal {
+	if contract.Precision == nil {
+		return amount
+	}
+	return amount.Shift(-TokenPrecisionDecimals(*contract.Precision))
 }
 
 // token合约各用户的余额
 type TokenBalanceEntity struct {
-	Id int64
-	ContractAddr string
-	OwnerAddr string
-	Amount decimal.Decimal
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	Id int64 `json:"id"`
+	ContractAddr string `json:"contract_addr"`
+	OwnerAddr string `json:"owner_addr"`
+	Amount decimal.Decimal `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type AssetEntity struct {
-	AssetId string
-	Symbol string
-	Precision uint32
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	AssetId string `json:"asset_id"`
+	Symbol string `json:"symbol"`
+	Precision uint32 `json:"precision"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type AddressBalanceEntity struct {
-	Id int64
-	OwnerAddr string
-	AssetId string
-	Amount decimal.Decimal
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	Id int64 `json:"id"`
+	OwnerAddr string `json:"owner_addr"`
+	AssetId string `json:"asset_id"`
+	Amount decimal.Decimal `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type AccountEntity struct {
-	Id int64
-	OwnerAddr string
-	AccountName string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	Id int64 `json:"id"`
+	OwnerAddr string `json:"owner_addr"`
+	AccountName string `json:"account_name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 // token合约的转账历史记录
 type TokenContractTransferHistoryEntity struct {
-	Id int64
-	ContractAddr string
-	FromAddr string
-	ToAddr string
-	Amount decimal.Decimal
-	BlockNum uint32
-	Txid string
-	OpNum uint32
-	EventName string
-	TxTime time.Time
+	Id int64 `json:"id"`
+	ContractAddr string `json:"contract_addr"`
+	FromAddr string `json:"from_addr"`
+	ToAddr string `json:"to_addr"`
+	Amount decimal.Decimal `json:"amount"`
+	BlockNum uint32 `json:"block_num"`
+	Txid string `json:"txid"`
+	OpNum uint32 `json:"op_num"`
+	EventIndex int `json:"event_index"` // 事件在回执中的序号
+	EventName string `json:"event_name"`
+	TxTime time.Time `json:"tx_time"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+const (
+	WebhookOutboxStatusPending   = "pending"
+	WebhookOutboxStatusDelivered = "delivered"
+	WebhookOutboxStatusFailed    = "failed"
+)
+
+// 待投递的webhook消息, 先落库再投递, 重启后不会丢失
+type WebhookOutboxEntity struct {
+	Id            int64
+	EndpointName  string
+	Url           string
+	Kind          string
+	BlockNum      uint32
+	Txid          string
+	OpNum         int
+	EventIndex    int
+	Payload       string
+	Status        string
+	Attempts      int
+	LastError     *string
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// 交易所等需要跟踪充值的地址
+type WatchedAddressEntity struct {
+	Id        int64
+	Addr      string
+	Label     *string
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+const (
+	DepositTypeTransfer         = "transfer"
+	DepositTypeTokenTransfer    = "token_transfer"
+	DepositTypeContractWithdraw = "deposit_to_address"
+)
+
+// 关注地址收到的充值, amount是没有除以精度的整数
+type DepositEntity struct {
+	Id            int64
+	Addr          string
+	DepositType   string
+	AssetId       string
+	ContractAddr  string
+	FromAddr      string
+	Amount        *big.Int
+	Precision     uint32
+	BlockNum      uint32
+	BlockTime     string
+	Txid          string
+	OpNum         int
+	EventIndex    int
+	Confirmations uint32
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// 按精度换算后的金额
+func (deposit *DepositEntity) DisplayAmount() decimal.Decimal {
+	return decimal.NewFromBigInt(deposit.Amount, -int32(deposit.Precision))
+}
+
+// 脚本插件通过hx.emit发出的事件
+type ScriptEventEntity struct {
+	Id         int64
+	ScriptName string
+	EventName  string
+	Data       string
+	BlockNum   uint32
+	Txid       string
+	OpNum      int
+	CreatedAt  time.Time
+}
+
+// 地址在operation或者合约回执中的角色
+const (
+	AddressRoleSender    = "sender"
+	AddressRoleReceiver  = "receiver"
+	AddressRoleCaller    = "caller"
+	AddressRolePayer     = "payer"
+	AddressRoleOwner     = "owner"
+	AddressRoleMiner     = "miner"
+	AddressRoleLocker    = "locker"
+	AddressRolePublisher = "publisher"
+	AddressRoleClaimer   = "claimer"
+	AddressRoleIssuer    = "issuer"
+	AddressRoleContract  = "contract"
+	AddressRoleRelated   = "related"
+)
+
+// operation涉及的每个地址, event_index是回执中事件的序号, 来自operation本身时是-1
+type AddressOperationEntity struct {
+	Id                int64                `json:"id"`
+	Addr              string               `json:"addr"`
+	Role              string               `json:"role"`
+	OperationId       string               `json:"operation_id"`
+	Txid              string               `json:"txid"`
+	OpNum             int                  `json:"op_num"`
+	EventIndex        int                  `json:"event_index"`
+	BlockNum          uint32               `json:"block_num"`
+	OperationTypeName string               `json:"operation_type_name"`
+	Operation         *BaseOperationEntity `json:"operation,omitempty"`
+}
+
+// balance_changes的类型
+const (
+	BalanceChangeTransferIn         = "transfer_in"
+	BalanceChangeTransferOut        = "transfer_out"
+	BalanceChangeFee                = "fee"
+	BalanceChangeTransferFee        = "transfer_fee"
+	BalanceChangeLock               = "lock"
+	BalanceChangeForeclose          = "foreclose"
+	BalanceChangeContractDeposit    = "contract_deposit"
+	BalanceChangeContractWithdraw   = "contract_withdraw"
+	BalanceChangeBonus              = "bonus"
+	BalanceChangePayBack            = "pay_back"
+	BalanceChangeCrosschainDeposit  = "crosschain_deposit"
+	BalanceChangeCrosschainWithdraw = "crosschain_withdraw"
+	BalanceChangeCrosschainRefund   = "crosschain_refund"
+	BalanceChangeReconcile          = "reconcile"
+)
+
+// 地址余额的变化量, amount是带符号的没有除以精度的整数
+type BalanceChangeEntity struct {
+	Id          int64     `json:"id"`
+	Addr        string    `json:"addr"`
+	AssetId     string    `json:"asset_id"`
+	Amount      *big.Int  `json:"amount"`
+	ChangeType  string    `json:"change_type"`
+	BlockNum    uint32    `json:"block_num"`
+	Txid        string    `json:"txid"`
+	OpNum       int       `json:"op_num"`
+	ChangeIndex int       `json:"change_index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// account_bind_operation绑定的链外地址, 跨链充值入账到绑定这个链外地址的地址. UnbindBlockNum为0表示还没有解绑
+type AccountBindingEntity struct {
+	Id             int64     `json:"id"`
+	Addr           string    `json:"addr"`
+	CrosschainType string    `json:"crosschain_type"`
+	TunnelAddress  string    `json:"tunnel_address"`
+	BindBlockNum   uint32    `json:"bind_block_num"`
+	BindTxid       string    `json:"bind_txid"`
+	UnbindBlockNum uint32    `json:"unbind_block_num"`
+	UnbindTxid     string    `json:"unbind_txid"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// 对账时账本余额和节点余额不一致的记录
+type BalanceReconciliationEntity struct {
+	Id           int64     `json:"id"`
+	Addr         string    `json:"addr"`
+	AssetId      string    `json:"asset_id"`
+	BlockNum     uint32    `json:"block_num"`
+	LedgerAmount *big.Int  `json:"ledger_amount"`
+	NodeAmount   *big.Int  `json:"node_amount"`
+	Adjusted     bool      `json:"adjusted"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// token合约Transfer事件产生的余额变化, 转出为负数. from为空(增发)或to为空(销毁)时只有一条
+type TokenBalanceChangeEntity struct {
+	Id           int64     `json:"id"`
+	ContractAddr string    `json:"contract_addr"`
+	OwnerAddr    string    `json:"owner_addr"`
+	Amount       *big.Int  `json:"amount"`
+	BlockNum     uint32    `json:"block_num"`
+	Txid         string    `json:"txid"`
+	OpNum        int       `json:"op_num"`
+	EventIndex   int       `json:"event_index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type TokenHolderBalance struct {
+	OwnerAddr string   `json:"owner_addr"`
+	Amount    *big.Int `json:"amount"`
+}
+
+const (
+	TokenAllowanceChangeApprove      = "approve"
+	TokenAllowanceChangeTransferFrom = "transfer_from"
+)
+
+// Approved事件设置的额度(amount为新额度), 或transferFrom使用的额度(amount为负数)
+type TokenAllowanceChangeEntity struct {
+	Id           int64     `json:"id"`
+	ContractAddr string    `json:"contract_addr"`
+	OwnerAddr    string    `json:"owner_addr"`
+	SpenderAddr  string    `json:"spender_addr"`
+	ChangeType   string    `json:"change_type"`
+	Amount       *big.Int  `json:"amount"`
+	BlockNum     uint32    `json:"block_num"`
+	Txid         string    `json:"txid"`
+	OpNum        int       `json:"op_num"`
+	EventIndex   int       `json:"event_index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// owner授权spender可以transferFrom的当前额度
+type TokenAllowanceEntity struct {
+	Id           int64     `json:"id"`
+	ContractAddr string    `json:"contract_addr"`
+	OwnerAddr    string    `json:"owner_addr"`
+	SpenderAddr  string    `json:"spender_addr"`
+	Amount       *big.Int  `json:"amount"`
+	BlockNum     uint32    `json:"block_num"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+const NativeContractKeyToken = "token"
+
+// contract_operation_receipt_event中的一条合约事件
+type ContractEventEntity struct {
+	Id              int64  `json:"id"`
+	Trxid           string `json:"trxid"`
+	BlockNum        uint32 `json:"block_num"`
+	OpNum           int    `json:"op_num"`
+	CallerAddr      string `json:"caller_addr"`
+	ContractAddress string `json:"contract_address"`
+	EventName       string `json:"event_name"`
+	EventArg        string `json:"event_arg"`
+}
+
+const (
+	ContractTypeLua    = "lua"
+	ContractTypeNative = "native"
+)
+
+// 所有注册的合约(lua合约和原生合约). 原生合约的注册operation中没有abi等信息, 这些字段为空.
+// Name和Description在合约升级(contract_upgrade_operation)后才有
+type ContractEntity struct {
+	Id                int64           `json:"id"`
+	ContractId        string          `json:"contract_id"`
+	ContractType      string          `json:"contract_type"`
+	NativeContractKey string          `json:"native_contract_key"`
+	OwnerAddr         string          `json:"owner_addr"`
+	OwnerPubkey       string          `json:"owner_pubkey"`
+	InheritFrom       string          `json:"inherit_from"`
+	Abi               []string        `json:"abi"`
+	OfflineAbi        []string        `json:"offline_abi"`
+	Events            []string        `json:"events"`
+	StorageProperties json.RawMessage `json:"storage_properties"`
+	CodeHash          string          `json:"code_hash"`
+	Name              string          `json:"name"`
+	Description       string          `json:"description"`
+	GasPrice          uint64          `json:"gas_price"`
+	GasLimit          uint64          `json:"gas_limit"`
+	BlockNum          uint32          `json:"block_num"`
+	Txid              string          `json:"txid"`
+	RegisterTime      string          `json:"register_time"`
+	CreatedAt         time.Time       `json:"created_at"`
+}
+
+const (
+	ContractMetadataSourceUpgrade = "upgrade"
+	ContractMetadataSourceCurated = "curated"
+)
+
+// 合约元数据的变化, 来自合约升级或者管理员导入的签名文件(Signer是签名公钥). 为nil的字段没有变化
+type ContractMetadataChangeEntity struct {
+	Id          int64     `json:"id"`
+	ContractId  string    `json:"contract_id"`
+	Source      string    `json:"source"`
+	Name        *string   `json:"name"`
+	Description *string   `json:"description"`
+	Logo        *string   `json:"logo"`
+	Url         *string   `json:"url"`
+	BlockNum    uint32    `json:"block_num"`
+	Txid        string    `json:"txid"`
+	Signer      string    `json:"signer"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// storage_operation中合约某个storage的变化. 值是json(uvm存储的数据), 不能解析为json时是hex字符串.
+// map类型属性的StorageKey是map的key, 其他属性为空
+type ContractStorageChangeEntity struct {
+	Id           int64           `json:"id"`
+	ContractId   string          `json:"contract_id"`
+	PropertyName string          `json:"property_name"`
+	StorageKey   string          `json:"storage_key"`
+	ValueBefore  json.RawMessage `json:"value_before"`
+	ValueAfter   json.RawMessage `json:"value_after"`
+	BlockNum     uint32          `json:"block_num"`
+	Txid         string          `json:"txid"`
+	OpNum        int             `json:"op_num"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// 合约storage的最新值(或者某个块时的值)
+type ContractStorageEntity struct {
+	Id           int64           `json:"-"`
+	ContractId   string          `json:"contract_id"`
+	PropertyName string          `json:"property_name"`
+	StorageKey   string          `json:"storage_key"`
+	Value        json.RawMessage `json:"value"`
+	BlockNum     uint32          `json:"block_num"`
+}
+
+// contract_invoke_operation和它的receipt. GasLimit和GasPrice来自operation的invoke_cost和gas_price, ActualFee是receipt中实际扣除的手续费
+type ContractCallEntity struct {
+	Id          int64     `json:"id"`
+	ContractId  string    `json:"contract_id"`
+	ContractApi string    `json:"contract_api"`
+	ContractArg string    `json:"contract_arg"`
+	CallerAddr  string    `json:"caller_addr"`
+	GasLimit    int64     `json:"gas_limit"`
+	GasPrice    int64     `json:"gas_price"`
+	ActualFee   int64     `json:"actual_fee"`
+	ExecSucceed bool      `json:"exec_succeed"`
+	ApiResult   string    `json:"api_result"`
+	BlockNum    uint32    `json:"block_num"`
+	BlockTime   time.Time `json:"block_time"`
+	Txid        string    `json:"txid"`
+	OpNum       int       `json:"op_num"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// 合约调用统计, 按天统计时Day是 YYYY-MM-DD, 按api汇总时为空
+type ContractCallStatEntity struct {
+	Day           string  `json:"day,omitempty"`
+	ContractApi   string  `json:"contract_api"`
+	Calls         int64   `json:"calls"`
+	FailedCalls   int64   `json:"failed_calls"`
+	FailureRate   float64 `json:"failure_rate"`
+	TotalFee      int64   `json:"total_fee"`
+	UniqueCallers int64   `json:"unique_callers"`
+}
+
+// receipt中合约余额相关的字段解析后的记录. withdraw(contract_withdraw, 负数)和deposit(deposit_contract)是变化量,
+// transfer_in是transfer_contract_operation转入的金额(receipt的deposit_contract中没有时才记录), balance(contract_balances)是执行后的余额
+type ContractBalanceChangeEntity struct {
+	Id          int64     `json:"id"`
+	ContractId  string    `json:"contract_id"`
+	AssetId     string    `json:"asset_id"`
+	Amount      *big.Int  `json:"amount"`
+	ChangeType  string    `json:"change_type"`
+	BlockNum    uint32    `json:"block_num"`
+	Txid        string    `json:"txid"`
+	OpNum       int       `json:"op_num"`
+	ChangeIndex int       `json:"change_index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	ContractBalanceChangeWithdraw   = "withdraw"
+	ContractBalanceChangeDeposit    = "deposit"
+	ContractBalanceChangeTransferIn = "transfer_in"
+	ContractBalanceChangeBalance    = "balance"
+)
+
+// 合约持有的链上资产
+type ContractBalanceEntity struct {
+	Id         int64     `json:"id"`
+	ContractId string    `json:"contract_id"`
+	AssetId    string    `json:"asset_id"`
+	Amount     *big.Int  `json:"amount"`
+	BlockNum   uint32    `json:"block_num"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// 每一笔手续费. operation类型来自operation的fee, contract来自合约回执的actual_fee(包含operation的fee), contract_transfer来自回执的transfer_fees
+type FeeRecordEntity struct {
+	Id         int64     `json:"id"`
+	PayerAddr  string    `json:"payer_addr"`
+	AssetId    string    `json:"asset_id"`
+	Amount     *big.Int  `json:"amount"`
+	FeeType    string    `json:"fee_type"`
+	OpType     int       `json:"op_type"`
+	OpTypeName string    `json:"op_type_name"`
+	BlockNum   uint32    `json:"block_num"`
+	BlockTime  time.Time `json:"block_time"`
+	Txid       string    `json:"txid"`
+	OpNum      int       `json:"op_num"`
+	FeeIndex   int       `json:"fee_index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+const (
+	FeeTypeOperation        = "operation"
+	FeeTypeContract         = "contract"
+	FeeTypeContractTransfer = "contract_transfer"
+)
+
+// 手续费统计, 按天统计时Day是 YYYY-MM-DD
+type FeeStatEntity struct {
+	Day        string   `json:"day,omitempty"`
+	PayerAddr  string   `json:"payer_addr,omitempty"`
+	OpTypeName string   `json:"op_type_name,omitempty"`
+	AssetId    string   `json:"asset_id"`
+	Count      int64    `json:"count"`
+	Amount     *big.Int `json:"amount"`
+}
+
+// 块的trxfee和账本中这个块的手续费合计不一致的记录
+type FeeReconciliationEntity struct {
+	Id          int64     `json:"id"`
+	BlockNum    uint32    `json:"block_num"`
+	BlockTrxfee int64     `json:"block_trxfee"`
+	LedgerFee   *big.Int  `json:"ledger_fee"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// citizen(出块节点)的信息, citizen_id是1.6.x, account_id是1.2.x. 刚创建还没有出块的citizen没有citizen_id.
+// last_collect_*是最近一次从节点收集的total_missed和两次收集之间出块的数量
+type CitizenInfoEntity struct {
+	Id                       int64     `json:"id"`
+	CitizenId                string    `json:"citizen_id"`
+	AccountId                string    `json:"account_id"`
+	LastCitizenFee           int       `json:"last_citizen_fee"`
+	LastMinedBlockNum        int64     `json:"last_mined_block_num"`
+	LastMinedBlockId         string    `json:"last_mined_block_id"`
+	LastCollectMissTime      time.Time `json:"last_collect_miss_time"`
+	LastCollectMissCount     int       `json:"last_collect_miss_count"`
+	LastCollectProducedCount int       `json:"last_collect_produced_count"`
+	CreatedAt                time.Time `json:"created_at"`
+	UpdatedAt                time.Time `json:"updated_at"`
+}
+
+// 漏块记录. node是从节点citizen对象total_missed的增加量得到的, slot_gap是相邻块时间间隔中没有出块的slot数(不知道是哪个citizen)
+type CitizenBlockMissEntity struct {
+	Id          int64     `json:"id"`
+	CitizenId   string    `json:"citizen_id"`
+	MissedCount int64     `json:"missed_count"`
+	Source      string    `json:"source"`
+	BlockNum    uint32    `json:"block_num"`
+	BlockTime   time.Time `json:"block_time"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+const (
+	CitizenMissSourceNode    = "node"
+	CitizenMissSourceSlotGap = "slot_gap"
+)
+
+// lockbalance_operation, foreclose_balance_operation和guard的锁仓/赎回. LockType是citizen(锁仓给citizen)或者guard(guard自己锁仓),
+// TargetId是citizen的1.6.x或者guard
+type LockBalanceEventEntity struct {
+	Id           int64     `json:"id"`
+	EventType    string    `json:"event_type"`
+	LockType     string    `json:"lock_type"`
+	OwnerAddr    string    `json:"owner_addr"`
+	OwnerAccount string    `json:"owner_account"`
+	TargetId     string    `json:"target_id"`
+	AssetId      string    `json:"asset_id"`
+	Amount       *big.Int  `json:"amount"`
+	BlockNum     uint32    `json:"block_num"`
+	BlockTime    time.Time `json:"block_time"`
+	Txid         string    `json:"txid"`
+	OpNum        int       `json:"op_num"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const (
+	LockBalanceEventLock      = "lock"
+	LockBalanceEventForeclose = "foreclose"
+
+	LockTypeCitizen = "citizen"
+	LockTypeGuard   = "guard"
+)
+
+// 当前的锁仓, amount是锁仓减去赎回的金额
+type LockedBalanceEntity struct {
+	Id                  int64     `json:"id"`
+	LockType            string    `json:"lock_type"`
+	OwnerAddr           string    `json:"owner_addr"`
+	TargetId            string    `json:"target_id"`
+	AssetId             string    `json:"asset_id"`
+	Amount              *big.Int  `json:"amount"`
+	FirstLockedBlockNum uint32    `json:"first_locked_block_num"`
+	FirstLockedAt       time.Time `json:"first_locked_at"`
+	BlockNum            uint32    `json:"block_num"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// 锁仓给某个citizen(或guard)的资产合计
+type PledgeTotalEntity struct {
+	LockType    string   `json:"lock_type"`
+	TargetId    string   `json:"target_id"`
+	AssetId     string   `json:"asset_id"`
+	Amount      *big.Int `json:"amount"`
+	LockerCount int64    `json:"locker_count"`
+}
+
+// 跨链充值和提现, 提现的各个阶段通过without_sign交易id, combine交易id和链外交易id关联到提现请求
+type CrosschainTransferEntity struct {
+	Id              int64     `json:"id"`
+	Direction       string    `json:"direction"`
+	State           string    `json:"state"`
+	RequestTxid     string    `json:"request_txid"`
+	HxAddr          string    `json:"hx_addr"`
+	CrosschainAddr  string    `json:"crosschain_addr"`
+	AssetSymbol     string    `json:"asset_symbol"`
+	AssetId         string    `json:"asset_id"`
+	Amount          string    `json:"amount"`
+	WithoutSignTxid string    `json:"without_sign_txid"`
+	SignatureCount  int       `json:"signature_count"`
+	CombineTxid     string    `json:"combine_txid"`
+	CrosschainTrxId string    `json:"crosschain_trx_id"`
+	FinishTxid      string    `json:"finish_txid"`
+	RequestBlockNum uint32    `json:"request_block_num"`
+	RequestTime     time.Time `json:"request_time"`
+	LastBlockNum    uint32    `json:"last_block_num"`
+	LastBlockTime   time.Time `json:"last_block_time"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+const (
+	CrosschainDirectionDeposit  = "deposit"
+	CrosschainDirectionWithdraw = "withdraw"
+
+	CrosschainStateRequested = "requested"
+	CrosschainStateSigned    = "signed"
+	CrosschainStateCombined  = "combined"
+	CrosschainStateBroadcast = "broadcast"
+	CrosschainStateConfirmed = "confirmed"
+	CrosschainStateFailed    = "failed"
+	CrosschainStateCancelled = "cancelled"
+)
+
+var CrosschainFinishedStates = []string{CrosschainStateConfirmed, CrosschainStateFailed, CrosschainStateCancelled}
+
+// 跨链operation, LinkId是它关联的交易id(提现请求, without_sign交易, combine交易或者链外交易)
+type CrosschainTransferEventEntity struct {
+	Id         int64     `json:"id"`
+	OpTypeName string    `json:"op_type_name"`
+	LinkId     string    `json:"link_id"`
+	State      string    `json:"state"`
+	BlockNum   uint32    `json:"block_num"`
+	BlockTime  time.Time `json:"block_time"`
+	Txid       string    `json:"txid"`
+	OpNum      int       `json:"op_num"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// 冷热钱包之间的转账, 状态和跨链提现相同. UnsignedAlertBlockNum是发出未签名告警的块, 0表示没有告警
+type ColdhotTransferEntity struct {
+	Id                    int64     `json:"id"`
+	State                 string    `json:"state"`
+	RequestTxid           string    `json:"request_txid"`
+	FromAddr              string    `json:"from_addr"`
+	ToAddr                string    `json:"to_addr"`
+	AssetSymbol           string    `json:"asset_symbol"`
+	AssetId               string    `json:"asset_id"`
+	Amount                string    `json:"amount"`
+	WithoutSignTxid       string    `json:"without_sign_txid"`
+	SignatureCount        int       `json:"signature_count"`
+	CombineTxid           string    `json:"combine_txid"`
+	CrosschainTrxId       string    `json:"crosschain_trx_id"`
+	FinishTxid            string    `json:"finish_txid"`
+	RequestBlockNum       uint32    `json:"request_block_num"`
+	RequestTime           time.Time `json:"request_time"`
+	LastBlockNum          uint32    `json:"last_block_num"`
+	LastBlockTime         time.Time `json:"last_block_time"`
+	UnsignedAlertBlockNum uint32    `json:"unsigned_alert_block_num"`
+	UpdatedAt             time.Time `json:"updated_at"`
+}
+
+// 冷热转账的operation, GuardId和GuardAddr是发起, 签名或者取消的guard(或者广播的citizen)
+type ColdhotTransferEventEntity struct {
+	Id         int64     `json:"id"`
+	OpTypeName string    `json:"op_type_name"`
+	LinkId     string    `json:"link_id"`
+	State      string    `json:"state"`
+	GuardId    string    `json:"guard_id"`
+	GuardAddr  string    `json:"guard_addr"`
+	BlockNum   uint32    `json:"block_num"`
+	BlockTime  time.Time `json:"block_time"`
+	Txid       string    `json:"txid"`
+	OpNum      int       `json:"op_num"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// guard签名冷热转账的operation, 它们的GuardId是签名的guard
+func IsColdhotSignOpType(opTypeName string) bool {
+	switch opTypeName {
+	case "coldhot_transfer_with_sign_operation", "eths_coldhot_guard_sign_final_operation":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,381 @@
+package db
+
+import (
+	"database/sql"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/types"
+	"github.com/shopspring/decimal"
+)
+
+// 查询接口使用的列表查询. 分页用上一页最后一条记录的id做cursor, cursor为0表示第一页
+
+func FindBlockByBlockId(blockId string) (result *BlockEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, number, previous, timestamp, trxfee, miner, transaction_merkle_root,"+
+		" next_secret_hash, block_id, reward, txs_count FROM public.blocks where block_id=$1", blockId)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result = new(BlockEntity)
+		err = rows.Scan(&result.Id, &result.Number, &result.Previous, &result.Timestamp, &result.Trxfee, &result.Miner,
+			&result.TransactionMerkleRoot, &result.NextSecretHash, &result.BlockId, &result.Reward, &result.TxsCount)
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+func ListTransactionsByBlockNumber(blockNumber uint32) (result []*TransactionEntity, err error) {
+	rows, err := dbConn.Query("SELECT serial_id, block_number, id, ref_block_num, ref_block_prefix, expiration, operations_count,"+
+		" index_in_block, first_operation_type, txid FROM public.transactions where block_number=$1 order by index_in_block asc", blockNumber)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*TransactionEntity, 0)
+	for rows.Next() {
+		item := new(TransactionEntity)
+		err = rows.Scan(&item.SerialId, &item.BlockNumber, &item.Id, &item.RefBlockNum, &item.RefBlockPrefix, &item.Expiration,
+			&item.OperationsCount, &item.IndexInBlock, &item.FirstOperationType, &item.Txid)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanBaseOperations(rows *sql.Rows) (result []*BaseOperationEntity, err error) {
+	result = make([]*BaseOperationEntity, 0)
+	for rows.Next() {
+		item := new(BaseOperationEntity)
+		err = rows.Scan(&item.SerialId, &item.Id, &item.Trxid, &item.BlockNum, &item.TxIndexInBlock, &item.OperationType,
+			&item.OperationTypeName, &item.OperationJSON, &item.Addr)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func ListBaseOperationsByTxid(txid string) (result []*BaseOperationEntity, err error) {
+	rows, err := dbConn.Query("SELECT serial_id, id, txid, tx_block_number, tx_index_in_block, operation_type,"+
+		" operation_type_name, operation_json, addr FROM public.operations where txid=$1 order by serial_id asc", txid)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanBaseOperations(rows)
+}
+
+// 地址相关的operation, 按serial_id从新到旧
+func ListBaseOperationsByAddr(addr string, beforeSerialId int64, limit int) (result []*BaseOperationEntity, err error) {
+	var rows *sql.Rows
+	if beforeSerialId > 0 {
+		rows, err = dbConn.Query("SELECT serial_id, id, txid, tx_block_number, tx_index_in_block, operation_type,"+
+			" operation_type_name, operation_json, addr FROM public.operations where addr=$1 and serial_id<$2"+
+			" order by serial_id desc limit $3", addr, beforeSerialId, limit)
+	} else {
+		rows, err = dbConn.Query("SELECT serial_id, id, txid, tx_block_number, tx_index_in_block, operation_type,"+
+			" operation_type_name, operation_json, addr FROM public.operations where addr=$1"+
+			" order by serial_id desc limit $2", addr, limit)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanBaseOperations(rows)
+}
+
+func ListContractOpReceiptsByTxid(txid string) (result []*types.HxContractOpReceipt, err error) {
+	rows, err := dbConn.Query("SELECT "+contractOpReceiptFieldsSql()+
+		" FROM public.contract_operation_receipt where trxid=$1 order by op_num asc", txid)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*types.HxContractOpReceipt, 0)
+	for rows.Next() {
+		var item *types.HxContractOpReceipt
+		item, err = scanContractOpReceipt(rows)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanTokenContract(rows *sql.Rows) (result *TokenContractEntity, err error) {
+	result = new(TokenContractEntity)
+	var totalSupplyString *string
+	err = rows.Scan(&result.Id, &result.BlockNum, &result.BlockTime, &result.Txid,
+		&result.ContractId, &result.ContractType, &result.OwnerPubkey, &result.OwnerAddr, &result.RegisterTime,
+		&result.InheritFrom, &result.GasPrice, &result.GasLimit, &result.State, &totalSupplyString, &result.Precision,
+		&result.TokenSymbol, &result.TokenName, &result.Logo, &result.Url, &result.Description)
+	if err != nil {
+		return
+	}
+	if totalSupplyString != nil {
+		result.TotalSupply, _ = new(big.Int).SetString(*totalSupplyString, 10)
+	}
+	return
+}
+
+func ListTokenContracts(afterId int64, limit int) (result []*TokenContractEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, "+tokenContractMainFieldsSql()+" FROM public.token_contract where id>$1"+
+		" order by id asc limit $2", afterId, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*TokenContractEntity, 0)
+	for rows.Next() {
+		var item *TokenContractEntity
+		item, err = scanTokenContract(rows)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func scanTokenBalances(rows *sql.Rows) (result []*TokenBalanceEntity, err error) {
+	result = make([]*TokenBalanceEntity, 0)
+	for rows.Next() {
+		item := new(TokenBalanceEntity)
+		var amountStr string
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractAddr, &item.OwnerAddr, &amountStr, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = decimal.NewFromString(amountStr)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func ListTokenBalancesByOwnerAddr(ownerAddr string) (result []*TokenBalanceEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, contract_addr, owner_addr, amount, created_at, updated_at FROM public.token_balance"+
+		" where owner_addr=$1 order by id asc", ownerAddr)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanTokenBalances(rows)
+}
+
+func ListTokenBalancesByContractAddr(contractAddr string, afterId int64, limit int) (result []*TokenBalanceEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, contract_addr, owner_addr, amount, created_at, updated_at FROM public.token_balance"+
+		" where contract_addr=$1 and id>$2 order by id asc limit $3", contractAddr, afterId, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanTokenBalances(rows)
+}
+
+// token转账历史, 按id从新到旧. addr不为空时只查这个地址转出或转入的记录
+func ListTokenContractTransferHistory(contractAddr string, addr string, beforeId int64, limit int) (result []*TokenContractTransferHistoryEntity, err error) {
+	query := "SELECT id, contract_addr, from_addr, to_addr, amount, block_num, txid, op_num, event_index, event_name, tx_time," +
+		" created_at, updated_at FROM public.token_contract_transfer_history where contract_addr=$1" +
+		" and ($2 = '' or from_addr=$2 or to_addr=$2) and ($3 <= 0 or id<$3) order by id desc limit $4"
+	rows, err := dbConn.Query(query, contractAddr, addr, beforeId, limit)
+	if err != nil {
+		return
+	}
+	return scanTokenContractTransferHistory(rows)
+}
+
+// 一个operation产生的token转账记录, 按事件顺序
+func ListTokenContractTransferHistoryOfOperation(txid string, opNum int) (result []*TokenContractTransferHistoryEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, contract_addr, from_addr, to_addr, amount, block_num, txid, op_num, event_index,"+
+		" event_name, tx_time, created_at, updated_at FROM public.token_contract_transfer_history where txid=$1 and op_num=$2"+
+		" order by event_index asc", txid, opNum)
+	if err != nil {
+		return
+	}
+	return scanTokenContractTransferHistory(rows)
+}
+
+func scanTokenContractTransferHistory(rows *sql.Rows) (result []*TokenContractTransferHistoryEntity, err error) {
+	defer rows.Close()
+	result = make([]*TokenContractTransferHistoryEntity, 0)
+	for rows.Next() {
+		item := new(TokenContractTransferHistoryEntity)
+		var amountStr string
+		var txTimeUnix, createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractAddr, &item.FromAddr, &item.ToAddr, &amountStr, &item.BlockNum,
+			&item.Txid, &item.OpNum, &item.EventIndex, &item.EventName, &txTimeUnix, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = decimal.NewFromString(amountStr)
+		if err != nil {
+			return
+		}
+		item.TxTime = time.Unix(txTimeUnix, 0)
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+// 生成 IN ($start, $start+1, ...) 的参数占位符
+func inPlaceholdersSql(count int, start int) string {
+	placeholders := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		placeholders = append(placeholders, "$"+strconv.Itoa(start+i))
+	}
+	return "(" + strings.Join(placeholders, ",") + ")"
+}
+
+func stringsToArgs(items []string) []interface{} {
+	args := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		args = append(args, item)
+	}
+	return args
+}
+
+// 以下批量查询给graphql的dataloader使用
+
+func ListBlocksByNumbers(blockNumbers []uint32) (result []*BlockEntity, err error) {
+	result = make([]*BlockEntity, 0)
+	if len(blockNumbers) < 1 {
+		return
+	}
+	args := make([]interface{}, 0, len(blockNumbers))
+	for _, blockNumber := range blockNumbers {
+		args = append(args, blockNumber)
+	}
+	rows, err := dbConn.Query("SELECT id, number, previous, timestamp, trxfee, miner, transaction_merkle_root,"+
+		" next_secret_hash, block_id, reward, txs_count FROM public.blocks where number in "+
+		inPlaceholdersSql(len(args), 1), args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := new(BlockEntity)
+		err = rows.Scan(&item.Id, &item.Number, &item.Previous, &item.Timestamp, &item.Trxfee, &item.Miner,
+			&item.TransactionMerkleRoot, &item.NextSecretHash, &item.BlockId, &item.Reward, &item.TxsCount)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func ListTransactionsByBlockNumbers(blockNumbers []uint32) (result []*TransactionEntity, err error) {
+	result = make([]*TransactionEntity, 0)
+	if len(blockNumbers) < 1 {
+		return
+	}
+	args := make([]interface{}, 0, len(blockNumbers))
+	for _, blockNumber := range blockNumbers {
+		args = append(args, blockNumber)
+	}
+	rows, err := dbConn.Query("SELECT serial_id, block_number, id, ref_block_num, ref_block_prefix, expiration, operations_count,"+
+		" index_in_block, first_operation_type, txid FROM public.transactions where block_number in "+
+		inPlaceholdersSql(len(args), 1)+" order by block_number asc, index_in_block asc", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		item := new(TransactionEntity)
+		err = rows.Scan(&item.SerialId, &item.BlockNumber, &item.Id, &item.RefBlockNum, &item.RefBlockPrefix, &item.Expiration,
+			&item.OperationsCount, &item.IndexInBlock, &item.FirstOperationType, &item.Txid)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func ListBaseOperationsByTxids(txids []string) (result []*BaseOperationEntity, err error) {
+	if len(txids) < 1 {
+		result = make([]*BaseOperationEntity, 0)
+		return
+	}
+	rows, err := dbConn.Query("SELECT serial_id, id, txid, tx_block_number, tx_index_in_block, operation_type,"+
+		" operation_type_name, operation_json, addr FROM public.operations where txid in "+
+		inPlaceholdersSql(len(txids), 1)+" order by serial_id asc", stringsToArgs(txids)...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanBaseOperations(rows)
+}
+
+func ListContractOpReceiptsByTxids(txids []string) (result []*types.HxContractOpReceipt, err error) {
+	result = make([]*types.HxContractOpReceipt, 0)
+	if len(txids) < 1 {
+		return
+	}
+	rows, err := dbConn.Query("SELECT "+contractOpReceiptFieldsSql()+
+		" FROM public.contract_operation_receipt where trxid in "+inPlaceholdersSql(len(txids), 1)+
+		" order by trxid asc, op_num asc", stringsToArgs(txids)...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item *types.HxContractOpReceipt
+		item, err = scanContractOpReceipt(rows)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func ListTokenContractsByContractIds(contractIds []string) (result []*TokenContractEntity, err error) {
+	result = make([]*TokenContractEntity, 0)
+	if len(contractIds) < 1 {
+		return
+	}
+	rows, err := dbConn.Query("SELECT id, "+tokenContractMainFieldsSql()+" FROM public.token_contract where contract_id in "+
+		inPlaceholdersSql(len(contractIds), 1), stringsToArgs(contractIds)...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item *TokenContractEntity
+		item, err = scanTokenContract(rows)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
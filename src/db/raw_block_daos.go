@@ -0,0 +1,36 @@
+package db
+
+// hx_node的get_block原始返回, 给json-rpc代理直接返回
+
+func FindRawBlockJSON(blockNum uint32) (result *string, err error) {
+	rows, err := dbConn.Query("SELECT block_json FROM public.raw_blocks where block_num=$1", blockNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var blockJSON string
+		err = rows.Scan(&blockJSON)
+		if err != nil {
+			return
+		}
+		result = &blockJSON
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+func SaveRawBlockJSON(blockNum uint32, blockJSON string) error {
+	stmt, err := dbConn.Prepare("INSERT INTO public.raw_blocks (block_num, block_json) VALUES (($1),($2))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(blockNum, blockJSON)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
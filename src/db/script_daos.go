@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"time"
+)
+
+func SaveScriptEvent(exec Executor, event *ScriptEventEntity) error {
+	now := time.Now()
+	stmt, err := exec.Prepare("INSERT INTO public.script_events (script_name, event_name, data, block_num," +
+		" txid, op_num, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(event.ScriptName, event.EventName, event.Data, event.BlockNum, event.Txid, event.OpNum, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 重复扫描时脚本会再次执行, 先删除这个operation之前发出的事件
+func DeleteScriptEventsOfOperation(exec Executor, scriptName string, txid string, opNum int) error {
+	stmt, err := exec.Prepare("DELETE FROM public.script_events WHERE script_name=$1 and txid=$2 and op_num=$3")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(scriptName, txid, opNum)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 重复扫描时删除脚本在这个operation插入到tableName的行, scriptName不为空时只删除这个脚本插入的
+func DeleteScriptRowsOfOperation(exec Executor, tableName string, scriptName string, txid string, opNum int) error {
+	sqlStr := fmt.Sprintf("DELETE FROM public.%s WHERE txid=$1 and op_num=$2", tableName)
+	args := []interface{}{txid, opNum}
+	if len(scriptName) > 0 {
+		sqlStr += " and script_name=$3"
+		args = append(args, scriptName)
+	}
+	stmt, err := exec.Prepare(sqlStr)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(args...)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"strings"
+	"time"
+)
+
+// 搜索用的前缀查询, 不区分大小写, 短的名字排在前面
+
+func escapeLikePattern(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
+
+func ListAccountsByNamePrefix(prefix string, limit int) (result []*AccountEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, owner_addr, account_name, created_at, updated_at FROM public.account"+
+		" where account_name ILIKE $1 order by length(account_name) asc, account_name asc limit $2",
+		escapeLikePattern(prefix)+"%", limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*AccountEntity, 0)
+	for rows.Next() {
+		item := new(AccountEntity)
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.OwnerAddr, &item.AccountName, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func ListTokenContractsBySymbolPrefix(prefix string, limit int) (result []*TokenContractEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, "+tokenContractMainFieldsSql()+" FROM public.token_contract"+
+		" where token_symbol ILIKE $1 order by length(token_symbol) asc, id asc limit $2",
+		escapeLikePattern(prefix)+"%", limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*TokenContractEntity, 0)
+	for rows.Next() {
+		var item *TokenContractEntity
+		item, err = scanTokenContract(rows)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func ListAssetsBySymbolPrefix(prefix string, limit int) (result []*AssetEntity, err error) {
+	rows, err := dbConn.Query("SELECT asset_id, symbol, precision, created_at, updated_at FROM public.asset"+
+		" where symbol ILIKE $1 order by length(symbol) asc, asset_id asc limit $2",
+		escapeLikePattern(prefix)+"%", limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*AssetEntity, 0)
+	for rows.Next() {
+		item := new(AssetEntity)
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&item.AssetId, &item.Symbol, &item.Precision, &createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
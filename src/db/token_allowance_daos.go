@@ -0,0 +1,181 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+func tokenAllowanceChangeFieldsSql() string {
+	return "id, contract_addr, owner_addr, spender_addr, change_type, amount, block_num, txid, op_num, event_index, created_at"
+}
+
+func scanTokenAllowanceChanges(rows *sql.Rows) (result []*TokenAllowanceChangeEntity, err error) {
+	result = make([]*TokenAllowanceChangeEntity, 0)
+	for rows.Next() {
+		item := new(TokenAllowanceChangeEntity)
+		var amountStr string
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractAddr, &item.OwnerAddr, &item.SpenderAddr, &item.ChangeType, &amountStr,
+			&item.BlockNum, &item.Txid, &item.OpNum, &item.EventIndex, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindTokenAllowanceChange(txid string, opNum int, eventIndex int) (result *TokenAllowanceChangeEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+tokenAllowanceChangeFieldsSql()+" FROM public.token_allowance_changes where txid=$1"+
+		" and op_num=$2 and event_index=$3", txid, opNum, eventIndex)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	items, err := scanTokenAllowanceChanges(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveTokenAllowanceChange(exec Executor, item *TokenAllowanceChangeEntity) error {
+	now := time.Now()
+	stmt, err := exec.Prepare("INSERT INTO public.token_allowance_changes (contract_addr, owner_addr, spender_addr," +
+		" change_type, amount, block_num, txid, op_num, event_index, created_at)" +
+		" VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractAddr, item.OwnerAddr, item.SpenderAddr, item.ChangeType, item.Amount.String(),
+		item.BlockNum, item.Txid, item.OpNum, item.EventIndex, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// owner的授权变化历史, 按id从新到旧. contractAddr为空时查询所有token合约
+func ListTokenAllowanceChanges(ownerAddr string, contractAddr string, beforeId int64, limit int) (result []*TokenAllowanceChangeEntity, err error) {
+	sqlStr := "SELECT " + tokenAllowanceChangeFieldsSql() + " FROM public.token_allowance_changes where owner_addr=$1"
+	args := []interface{}{ownerAddr}
+	if len(contractAddr) > 0 {
+		args = append(args, contractAddr)
+		sqlStr += " and contract_addr=$2"
+	}
+	if beforeId > 0 {
+		args = append(args, beforeId)
+		sqlStr += " and id<$" + strconv.Itoa(len(args))
+	}
+	args = append(args, limit)
+	sqlStr += " order by id desc limit $" + strconv.Itoa(len(args))
+	rows, err := dbConn.Query(sqlStr, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanTokenAllowanceChanges(rows)
+}
+
+func tokenAllowanceFieldsSql() string {
+	return "id, contract_addr, owner_addr, spender_addr, amount, block_num, created_at, updated_at"
+}
+
+func scanTokenAllowances(rows *sql.Rows) (result []*TokenAllowanceEntity, err error) {
+	result = make([]*TokenAllowanceEntity, 0)
+	for rows.Next() {
+		item := new(TokenAllowanceEntity)
+		var amountStr string
+		var createdAtUnix, updatedAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractAddr, &item.OwnerAddr, &item.SpenderAddr, &amountStr, &item.BlockNum,
+			&createdAtUnix, &updatedAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		item.UpdatedAt = time.Unix(updatedAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindTokenAllowance(contractAddr string, ownerAddr string, spenderAddr string) (result *TokenAllowanceEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+tokenAllowanceFieldsSql()+" FROM public.token_allowances where contract_addr=$1"+
+		" and owner_addr=$2 and spender_addr=$3", contractAddr, ownerAddr, spenderAddr)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	items, err := scanTokenAllowances(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveTokenAllowance(exec Executor, item *TokenAllowanceEntity) error {
+	now := time.Now()
+	stmt, err := exec.Prepare("INSERT INTO public.token_allowances (contract_addr, owner_addr, spender_addr, amount," +
+		" block_num, created_at, updated_at) VALUES (($1),($2),($3),($4),($5),($6),($7))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractAddr, item.OwnerAddr, item.SpenderAddr, item.Amount.String(), item.BlockNum,
+		now.Unix(), now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateTokenAllowance(exec Executor, item *TokenAllowanceEntity) error {
+	stmt, err := exec.Prepare("UPDATE public.token_allowances SET amount=$1, block_num=$2, updated_at=$3 WHERE id=$4")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.Amount.String(), item.BlockNum, time.Now().Unix(), item.Id)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 地址作为owner(授权给别人)或spender(被授权)的非0额度. contractAddr为空时查询所有token合约
+func ListTokenAllowances(addr string, asSpender bool, contractAddr string) (result []*TokenAllowanceEntity, err error) {
+	addrColumn := "owner_addr"
+	if asSpender {
+		addrColumn = "spender_addr"
+	}
+	sqlStr := "SELECT " + tokenAllowanceFieldsSql() + " FROM public.token_allowances where " + addrColumn + "=$1 and amount>0"
+	args := []interface{}{addr}
+	if len(contractAddr) > 0 {
+		args = append(args, contractAddr)
+		sqlStr += " and contract_addr=$2"
+	}
+	rows, err := dbConn.Query(sqlStr+" order by id asc", args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanTokenAllowances(rows)
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"database/sql"
+	"math/big"
+	"time"
+)
+
+func tokenBalanceChangeFieldsSql() string {
+	return "id, contract_addr, owner_addr, amount, block_num, txid, op_num, event_index, created_at"
+}
+
+func scanTokenBalanceChanges(rows *sql.Rows) (result []*TokenBalanceChangeEntity, err error) {
+	result = make([]*TokenBalanceChangeEntity, 0)
+	for rows.Next() {
+		item := new(TokenBalanceChangeEntity)
+		var amountStr string
+		var createdAtUnix int64
+		err = rows.Scan(&item.Id, &item.ContractAddr, &item.OwnerAddr, &amountStr, &item.BlockNum, &item.Txid, &item.OpNum,
+			&item.EventIndex, &createdAtUnix)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		item.CreatedAt = time.Unix(createdAtUnix, 0)
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
+
+func FindTokenBalanceChange(txid string, opNum int, eventIndex int, ownerAddr string) (result *TokenBalanceChangeEntity, err error) {
+	rows, err := dbConn.Query("SELECT "+tokenBalanceChangeFieldsSql()+" FROM public.token_balance_changes where txid=$1"+
+		" and op_num=$2 and event_index=$3 and owner_addr=$4", txid, opNum, eventIndex, ownerAddr)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	items, err := scanTokenBalanceChanges(rows)
+	if err != nil || len(items) < 1 {
+		return
+	}
+	result = items[0]
+	return
+}
+
+func SaveTokenBalanceChange(item *TokenBalanceChangeEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.token_balance_changes (contract_addr, owner_addr, amount, block_num," +
+		" txid, op_num, event_index, created_at) VALUES (($1),($2),($3),($4),($5),($6),($7),($8))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	res, err := stmt.Exec(item.ContractAddr, item.OwnerAddr, item.Amount.String(), item.BlockNum, item.Txid, item.OpNum,
+		item.EventIndex, now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+// 地址的token余额变化, 按id从新到旧. contractAddr为空时查询所有token合约
+func ListTokenBalanceChanges(ownerAddr string, contractAddr string, beforeId int64, limit int) (result []*TokenBalanceChangeEntity, err error) {
+	var rows *sql.Rows
+	if beforeId <= 0 {
+		beforeId = 1<<63 - 1
+	}
+	if len(contractAddr) > 0 {
+		rows, err = dbConn.Query("SELECT "+tokenBalanceChangeFieldsSql()+" FROM public.token_balance_changes where owner_addr=$1"+
+			" and contract_addr=$2 and id<$3 order by id desc limit $4", ownerAddr, contractAddr, beforeId, limit)
+	} else {
+		rows, err = dbConn.Query("SELECT "+tokenBalanceChangeFieldsSql()+" FROM public.token_balance_changes where owner_addr=$1"+
+			" and id<$2 order by id desc limit $3", ownerAddr, beforeId, limit)
+	}
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	return scanTokenBalanceChanges(rows)
+}
+
+// 地址截止到块blockNum(含)的token余额
+func SumTokenBalanceAtBlock(contractAddr string, ownerAddr string, blockNum uint32) (result *big.Int, err error) {
+	rows, err := dbConn.Query("SELECT COALESCE(SUM(amount), 0) FROM public.token_balance_changes where contract_addr=$1"+
+		" and owner_addr=$2 and block_num<=$3", contractAddr, ownerAddr, blockNum)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = big.NewInt(0)
+	if rows.Next() {
+		var amountStr string
+		err = rows.Scan(&amountStr)
+		if err != nil {
+			return
+		}
+		return parseBigIntColumn(amountStr)
+	}
+	err = rows.Err()
+	return
+}
+
+// 块blockNum(含)时余额不为0的持有人, 按地址排序, afterOwnerAddr用于分页
+func ListTokenHoldersAtBlock(contractAddr string, blockNum uint32, afterOwnerAddr string, limit int) (result []*TokenHolderBalance, err error) {
+	rows, err := dbConn.Query("SELECT owner_addr, SUM(amount) FROM public.token_balance_changes where contract_addr=$1"+
+		" and block_num<=$2 and owner_addr>$3 group by owner_addr having SUM(amount)<>0 order by owner_addr asc limit $4",
+		contractAddr, blockNum, afterOwnerAddr, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*TokenHolderBalance, 0)
+	for rows.Next() {
+		item := new(TokenHolderBalance)
+		var amountStr string
+		err = rows.Scan(&item.OwnerAddr, &amountStr)
+		if err != nil {
+			return
+		}
+		item.Amount, err = parseBigIntColumn(amountStr)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
@@ -30,14 +30,14 @@ func SaveTokenBalance(tokenBalance *TokenBalanceEntity) error {
 func SaveTokenContractTransferHistory(record *TokenContractTransferHistoryEntity) error {
 	now := time.Now()
 	stmt, err := dbConn.Prepare("INSERT INTO public.token_contract_transfer_history (contract_addr, from_addr," +
-		" to_addr, amount, block_num, txid, op_num, event_name, tx_time, created_at, updated_at)" +
-		" VALUES (($1),($2),($3),($4),($5), $6, $7, $8, $9, $10, $11)")
+		" to_addr, amount, block_num, txid, op_num, event_index, event_name, tx_time, created_at, updated_at)" +
+		" VALUES (($1),($2),($3),($4),($5), $6, $7, $8, $9, $10, $11, $12)")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 	res, err := stmt.Exec(record.ContractAddr, record.FromAddr, record.ToAddr, record.Amount.String(), record.BlockNum,
-		record.Txid, record.OpNum, record.EventName, record.TxTime.Unix(), now.Unix(), now.Unix())
+		record.Txid, record.OpNum, record.EventIndex, record.EventName, record.TxTime.Unix(), now.Unix(), now.Unix())
 	if err != nil {
 		return err
 	}
@@ -67,14 +67,14 @@ func UpdateTokenBalance(tokenBalance *TokenBalanceEntity) error {
 
 func UpdateTokenContractTransferHistory(record *TokenContractTransferHistoryEntity) error {
 	stmt, err := dbConn.Prepare("UPDATE public.token_contract_transfer_history SET contract_addr = $1, from_addr = $2, to_addr = $3, amount = $4," +
-		"block_num = $5, txid = $6, op_num = $7, event_name = $8, tx_time = $9," +
-		"created_at = $10, updated_at = $11 WHERE id=$12")
+		"block_num = $5, txid = $6, op_num = $7, event_index = $8, event_name = $9, tx_time = $10," +
+		"created_at = $11, updated_at = $12 WHERE id=$13")
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 	res, err := stmt.Exec(record.ContractAddr, record.FromAddr, record.ToAddr, record.Amount.String(), record.BlockNum,
-		record.Txid, record.OpNum, record.EventName, record.TxTime.Unix(), record.CreatedAt.Unix(), record.UpdatedAt.Unix(), record.Id)
+		record.Txid, record.OpNum, record.EventIndex, record.EventName, record.TxTime.Unix(), record.CreatedAt.Unix(), record.UpdatedAt.Unix(), record.Id)
 	if err != nil {
 		return err
 	}
@@ -114,10 +114,10 @@ func FindTokenBalanceByContractAddrAndOwnerAddr(contractAddr string, ownerAddr s
 	return
 }
 
-func FindTokenContractTransferHistoryItemByTxIdAndOpNum(txid string, opNum int) (result *TokenContractTransferHistoryEntity, err error) {
+func FindTokenContractTransferHistoryItem(txid string, opNum int, eventIndex int) (result *TokenContractTransferHistoryEntity, err error) {
 	rows, err := dbConn.Query("SELECT id, contract_addr, from_addr," +
-		" to_addr, amount, block_num, txid, op_num, event_name, tx_time, created_at, updated_at" +
-		" FROM public.token_contract_transfer_history where txid=$1 and op_num=$2", txid, opNum)
+		" to_addr, amount, block_num, txid, op_num, event_index, event_name, tx_time, created_at, updated_at" +
+		" FROM public.token_contract_transfer_history where txid=$1 and op_num=$2 and event_index=$3", txid, opNum, eventIndex)
 	if err != nil {
 		return
 	}
@@ -127,7 +127,7 @@ func FindTokenContractTransferHistoryItemByTxIdAndOpNum(txid string, opNum int)
 		var amountStr string
 		var txTimeUnix, createdAtUnix, updatedAtUnix int64
 		err = rows.Scan(&result.Id, &result.ContractAddr, &result.FromAddr, &result.ToAddr, &amountStr, &result.BlockNum,
-			&result.Txid, &result.OpNum, &result.EventName, &txTimeUnix,
+			&result.Txid, &result.OpNum, &result.EventIndex, &result.EventName, &txTimeUnix,
 			&createdAtUnix, &updatedAtUnix)
 		if err != nil {
 			return
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// *sql.DB和*sql.Tx都实现了, 需要和其他写入在同一个事务中的DAO用它执行
+type Executor interface {
+	Prepare(query string) (*sql.Stmt, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// 在一个事务中执行fn, fn返回错误时回滚
+func RunInTx(fn func(exec Executor) error) (err error) {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		return
+	}
+	err = fn(tx)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			logger.Println("rollback error", rollbackErr)
+		}
+		return
+	}
+	return tx.Commit()
+}
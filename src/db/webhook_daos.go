@@ -0,0 +1,110 @@
+package db
+
+import "time"
+
+func webhookOutboxMainFieldsSql() string {
+	return "endpoint_name, url, kind, block_num, txid, op_num, event_index, payload, status, attempts," +
+		" last_error, next_attempt_at, delivered_at, created_at, updated_at"
+}
+
+func SaveWebhookOutboxItem(item *WebhookOutboxEntity) error {
+	now := time.Now()
+	stmt, err := dbConn.Prepare("INSERT INTO public.webhook_outbox (" + webhookOutboxMainFieldsSql() + ")" +
+		" VALUES (($1),($2),($3),($4),($5),($6),($7),($8),($9),($10),($11),($12),($13),($14),($15))")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	var deliveredAtUnix *int64 = nil
+	if item.DeliveredAt != nil {
+		deliveredAtUnix = new(int64)
+		*deliveredAtUnix = item.DeliveredAt.Unix()
+	}
+	res, err := stmt.Exec(item.EndpointName, item.Url, item.Kind, item.BlockNum, item.Txid, item.OpNum, item.EventIndex,
+		item.Payload, item.Status, item.Attempts, item.LastError, item.NextAttemptAt.Unix(), deliveredAtUnix,
+		now.Unix(), now.Unix())
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func UpdateWebhookOutboxItemDelivery(item *WebhookOutboxEntity) error {
+	stmt, err := dbConn.Prepare("UPDATE public.webhook_outbox SET status = $1, attempts = $2, last_error = $3," +
+		" next_attempt_at = $4, delivered_at = $5, updated_at = $6 WHERE id=$7")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	var deliveredAtUnix *int64 = nil
+	if item.DeliveredAt != nil {
+		deliveredAtUnix = new(int64)
+		*deliveredAtUnix = item.DeliveredAt.Unix()
+	}
+	res, err := stmt.Exec(item.Status, item.Attempts, item.LastError, item.NextAttemptAt.Unix(), deliveredAtUnix,
+		item.UpdatedAt.Unix(), item.Id)
+	if err != nil {
+		return err
+	}
+	_ = res
+	return nil
+}
+
+func scanWebhookOutboxItem(scanner interface {
+	Scan(dest ...interface{}) error
+}) (result *WebhookOutboxEntity, err error) {
+	result = new(WebhookOutboxEntity)
+	var nextAttemptAtUnix, createdAtUnix, updatedAtUnix int64
+	var deliveredAtUnix *int64
+	err = scanner.Scan(&result.Id, &result.EndpointName, &result.Url, &result.Kind, &result.BlockNum, &result.Txid,
+		&result.OpNum, &result.EventIndex, &result.Payload, &result.Status, &result.Attempts, &result.LastError,
+		&nextAttemptAtUnix, &deliveredAtUnix, &createdAtUnix, &updatedAtUnix)
+	if err != nil {
+		return
+	}
+	result.NextAttemptAt = time.Unix(nextAttemptAtUnix, 0)
+	if deliveredAtUnix != nil {
+		deliveredAt := time.Unix(*deliveredAtUnix, 0)
+		result.DeliveredAt = &deliveredAt
+	}
+	result.CreatedAt = time.Unix(createdAtUnix, 0)
+	result.UpdatedAt = time.Unix(updatedAtUnix, 0)
+	return
+}
+
+func FindWebhookOutboxItem(endpointName string, txid string, opNum int, eventIndex int) (result *WebhookOutboxEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, "+webhookOutboxMainFieldsSql()+" FROM public.webhook_outbox"+
+		" where endpoint_name=$1 and txid=$2 and op_num=$3 and event_index=$4", endpointName, txid, opNum, eventIndex)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		result, err = scanWebhookOutboxItem(rows)
+		return
+	}
+	err = rows.Err()
+	return
+}
+
+// 找出到期需要投递(或重试)的webhook消息
+func FindDueWebhookOutboxItems(now time.Time, limit int) (result []*WebhookOutboxEntity, err error) {
+	rows, err := dbConn.Query("SELECT id, "+webhookOutboxMainFieldsSql()+" FROM public.webhook_outbox"+
+		" where status=$1 and next_attempt_at<=$2 order by id asc limit $3", WebhookOutboxStatusPending, now.Unix(), limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	result = make([]*WebhookOutboxEntity, 0)
+	for rows.Next() {
+		var item *WebhookOutboxEntity
+		item, err = scanWebhookOutboxItem(rows)
+		if err != nil {
+			return
+		}
+		result = append(result, item)
+	}
+	err = rows.Err()
+	return
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"math/big"
 	netrpc "net/rpc"
 	"time"
 
@@ -79,7 +81,7 @@ func GetBlock(blockNum int) (block *types.HxBlock, err error) {
 		logger.Println("ws to hx_node disconnected")
 		return
 	}
-	var wrapperReply interface{}
+	var wrapperReply json.RawMessage
 	var reply = new(types.HxBlock)
 	c := _client
 	err = c.Call("get_block", blockNum, &wrapperReply)
@@ -100,6 +102,7 @@ func GetBlock(blockNum int) (block *types.HxBlock, err error) {
 	}
 	block = reply
 	block.BlockNumber = blockNum
+	block.RawJSON = replyJSONBytes
 	for i, tx := range block.Transactions {
 		tx.IndexInBlock = i
 	}
@@ -125,6 +128,24 @@ func GetBlock(blockNum int) (block *types.HxBlock, err error) {
 	return
 }
 
+// 直接转发一个单参数的调用到hx_node, 返回原始json结果. 节点返回null时found为false
+func CallNodeRaw(method string, arg interface{}) (reply json.RawMessage, found bool, err error) {
+	if !IsHxNodeConnected() {
+		err = errors.New("ws to hx_node disconnected")
+		return
+	}
+	c := _client
+	err = c.Call(method, arg, &reply)
+	if err != nil {
+		if err.Error() == "error <nil>" {
+			err = nil
+		}
+		return
+	}
+	found = true
+	return
+}
+
 func IsContractOpType(operationType int) bool {
 	return operationType >= 76 && operationType <= 81
 }
@@ -150,7 +171,8 @@ func InvokeContractOffline(callerPubKeyStr string, contractAddr, apiName string,
 		logger.Println("ws to hx_node disconnected")
 		return
 	}
-	var reply interface{}
+	// 保留原始json, 大整数结果不经过float64
+	var reply json.RawMessage
 	c := _client
 	args := []interface{}{callerPubKeyStr, contractAddr, apiName, apiArg}
 	err = c.Call("invoke_contract_offline", args, &reply)
@@ -158,11 +180,7 @@ func InvokeContractOffline(callerPubKeyStr string, contractAddr, apiName string,
 		//log.Println("InvokeContractOffline error", err)
 		return
 	}
-	b, err := json.Marshal(reply)
-	if err != nil {
-		return
-	}
-	result = string(b)
+	result = string(reply)
 	logger.Println("offline reply " + result)
 	return
 }
@@ -182,6 +200,25 @@ func InvokeContractOfflineWithIntResult(callerPubKeyStr string, contractAddr, ap
 	return
 }
 
+// token余额, totalSupply等可能超过int64的结果
+func InvokeContractOfflineWithBigIntResult(callerPubKeyStr string, contractAddr, apiName string, apiArg string) (result *big.Int, err error) {
+	strResult, err := InvokeContractOffline(callerPubKeyStr, contractAddr, apiName, apiArg)
+	if err != nil {
+		return
+	}
+	if len(strResult) >= 2 && strResult[0] == '"' {
+		err = json.Unmarshal([]byte(strResult), &strResult)
+		if err != nil {
+			return
+		}
+	}
+	result, ok := new(big.Int).SetString(strResult, 10)
+	if !ok {
+		err = errors.New("invalid integer result " + strResult + " of contract api " + apiName)
+	}
+	return
+}
+
 func ListAssets(offset, limit int) (result []*db.AssetEntity, err error) {
 	if !IsHxNodeConnected() {
 		logger.Println("ws to hx_node disconnected")
@@ -354,3 +391,47 @@ func FindHxTransactionByTxid(txid string) (state string) {
 	}
 	return
 }
+
+/**
+ * 用get_objects查询citizen(miner)对象
+ * @return {citizenId(1.6.x) => miner object}, 节点没有的id不在结果中
+ */
+func GetMinerObjects(citizenIds []string) (result map[string]*types.HxMinerObject, err error) {
+	if !IsHxNodeConnected() {
+		err = errors.New("ws to hx_node disconnected")
+		return
+	}
+	var reply []*types.HxMinerObject
+	c := _client
+	err = c.Call("get_objects", citizenIds, &reply)
+	if err != nil {
+		return
+	}
+	result = make(map[string]*types.HxMinerObject)
+	for _, item := range reply {
+		if item != nil && len(item.Id) > 0 {
+			result[item.Id] = item
+		}
+	}
+	return
+}
+
+/**
+ * 节点当前的最新块号(get_dynamic_global_properties的head_block_number)
+ */
+func GetHeadBlockNumber() (result uint32, err error) {
+	if !IsHxNodeConnected() {
+		err = errors.New("ws to hx_node disconnected")
+		return
+	}
+	var reply struct {
+		HeadBlockNumber uint32 `json:"head_block_number"`
+	}
+	c := _client
+	err = c.Call("get_dynamic_global_properties", []interface{}{}, &reply)
+	if err != nil {
+		return
+	}
+	result = reply.HeadBlockNumber
+	return
+}
@@ -0,0 +1,146 @@
+package plugins
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const addressOperationsBackfillCursorKey = "address_operations_backfill_cursor"
+
+// operation中地址属性对应的角色, 其他以addr/address结尾的属性记为related
+var operationAddrPropRoles = map[string]string{
+	"from_addr":          db.AddressRoleSender,
+	"to_addr":            db.AddressRoleReceiver,
+	"caller_addr":        db.AddressRoleCaller,
+	"addr":               db.AddressRoleOwner,
+	"owner_addr":         db.AddressRoleOwner,
+	"pay_back_owner":     db.AddressRoleOwner,
+	"bonus_owner":        db.AddressRoleOwner,
+	"miner_address":      db.AddressRoleMiner,
+	"payer":              db.AddressRolePayer,
+	"fee_paying_account": db.AddressRolePayer,
+	"fee_pay_address":    db.AddressRolePayer,
+	"lock_balance_addr":  db.AddressRoleLocker,
+	"publisher_addr":     db.AddressRolePublisher,
+	"addr_from_claim":    db.AddressRoleClaimer,
+	"issuer_addr":        db.AddressRoleIssuer,
+	"contract_id":        db.AddressRoleContract,
+}
+
+// operation和它的回执涉及的所有地址及角色
+func addressOperationsOf(blockNum uint32, txid string, opNum int, opTypeName string, opJSON map[string]interface{},
+	receipt *types.HxContractOpReceipt) []*db.AddressOperationEntity {
+	result := make([]*db.AddressOperationEntity, 0)
+	seen := make(map[string]bool)
+	add := func(addr string, role string, eventIndex int) {
+		if !types.IsHxAddress(addr) {
+			return
+		}
+		key := addr + "/" + role + "/" + strconv.Itoa(eventIndex)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		result = append(result, &db.AddressOperationEntity{
+			Addr:              addr,
+			Role:              role,
+			OperationId:       db.GetBaseOperationId(int(blockNum), txid, opNum),
+			Txid:              txid,
+			OpNum:             opNum,
+			EventIndex:        eventIndex,
+			BlockNum:          blockNum,
+			OperationTypeName: opTypeName,
+		})
+	}
+	for prop, value := range opJSON {
+		valueStr, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if role, ok := operationAddrPropRoles[prop]; ok {
+			add(valueStr, role, -1)
+		} else if strings.HasSuffix(prop, "addr") || strings.HasSuffix(prop, "address") {
+			add(valueStr, db.AddressRoleRelated, -1)
+		}
+	}
+	if receipt == nil {
+		return result
+	}
+	add(receipt.Invoker, db.AddressRoleCaller, -1)
+	if !receipt.ExecSucceed {
+		return result
+	}
+	for eventIndex, event := range receipt.Events {
+		if event.EventName != "Transfer" {
+			continue
+		}
+		eventArg, err := decodeJSONObjUseNumber(event.EventArg)
+		if err != nil {
+			continue
+		}
+		if fromAddr, ok := mapGetString(eventArg, "from"); ok {
+			add(fromAddr, db.AddressRoleSender, eventIndex)
+		}
+		if toAddr, ok := mapGetString(eventArg, "to"); ok {
+			add(toAddr, db.AddressRoleReceiver, eventIndex)
+		}
+	}
+	// deposit_to_address item: [[addr, assetId], amount]
+	for _, change := range receipt.DepositToAddressChanges {
+		changeItem, ok := change.([]interface{})
+		if !ok || len(changeItem) < 2 {
+			continue
+		}
+		addressAssetPair, ok := changeItem[0].([]interface{})
+		if !ok || len(addressAssetPair) < 1 {
+			continue
+		}
+		if addr, ok := addressAssetPair[0].(string); ok {
+			add(addr, db.AddressRoleReceiver, -1)
+		}
+	}
+	return result
+}
+
+func saveAddressOperationsIfNew(items []*db.AddressOperationEntity) (err error) {
+	for _, item := range items {
+		var old *db.AddressOperationEntity
+		old, err = db.FindAddressOperation(item.Txid, item.OpNum, item.Addr, item.Role, item.EventIndex)
+		if err != nil {
+			return
+		}
+		if old != nil {
+			continue
+		}
+		err = db.SaveAddressOperation(item)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 记录operation涉及的所有地址到address_operations
+type AddressActivityPlugin struct {
+}
+
+func (plugin *AddressActivityPlugin) PluginName() string {
+	return "AddressActivityPlugin"
+}
+
+func (plugin *AddressActivityPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	items := addressOperationsOf(uint32(block.BlockNumber), txid, opNum, opTypeName, opJSON, receipt)
+	return saveAddressOperationsIfNew(items)
+}
+
+// 从operations表中已经保存的operation_json(和合约回执)回填address_operations, 进度保存在scan_configs中, 可以中断后继续
+func BackfillAddressOperations(batchSize int) (count int, err error) {
+	return backfillOperations(addressOperationsBackfillCursorKey, nil, batchSize, func(op *backfillOperation) (bool, error) {
+		items := addressOperationsOf(uint32(op.BlockNum), op.Trxid, op.OpNum, op.OperationTypeName, op.OpJSON, op.Receipt)
+		return true, saveAddressOperationsIfNew(items)
+	})
+}
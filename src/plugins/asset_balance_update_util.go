@@ -3,10 +3,6 @@ package plugins
 import (
 	"github.com/blocklink/hxscanner/src/nodeservice"
 	"github.com/blocklink/hxscanner/src/db"
-	"time"
-	"github.com/shopspring/decimal"
-	"math"
-	"errors"
 )
 
 var assetsCache = make(map[string]*db.AssetEntity) // assetId => assetInfo
@@ -47,45 +43,3 @@ func findAssetFromCacheOrDb(assetId string) (result *db.AssetEntity, err error)
 	}
 	return
 }
-
-func updateAddressBalance(addr string, assetId string) (err error) {
-	addrBalances, err := nodeservice.GetAddressBalances(addr)
-	if err != nil {
-		return
-	}
-	newBalance, ok := addrBalances[assetId]
-	if !ok {
-		newBalance = 0
-	}
-	assetEntry, err := findAssetFromCacheOrDb(assetId)
-	if err != nil {
-		return
-	}
-	if assetEntry == nil {
-		err = errors.New("unknown asset id " + assetId)
-		return
-	}
-	precisonFull := int64(math.Pow10(int(assetEntry.Precision)))
-	newBalanceBn := decimal.New(int64(newBalance), 0).Div(decimal.New(precisonFull, 0))
-	// update addr balance to db
-	record, err := db.FindAddressBalanceByOwnerAddrAndAssetId(addr, assetId)
-	if err != nil {
-		return
-	}
-	now := time.Now()
-	if record == nil {
-		record = &db.AddressBalanceEntity{OwnerAddr:addr, AssetId:assetId, Amount: newBalanceBn, CreatedAt:now, UpdatedAt:now}
-		err = db.SaveAddressBalance(record)
-		if err != nil {
-			return
-		}
-	} else {
-		record.Amount = newBalanceBn
-		record.UpdatedAt = now
-		err = db.UpdateAddressBalance(record)
-		if err != nil {
-			return
-		}
-	}
-	return
-}
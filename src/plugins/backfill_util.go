@@ -0,0 +1,113 @@
+package plugins
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/nodeservice"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+// 回填时从operations表中取出的一条operation, 带上解析后的operation_json, 合约回执和所在块的时间
+type backfillOperation struct {
+	*db.BaseOperationEntity
+	OpNum          int
+	OpJSON         map[string]interface{}
+	Receipt        *types.HxContractOpReceipt // 只有合约operation有
+	BlockTimestamp string
+	BlockTime      time.Time
+}
+
+// 已经保存的块的时间, 块不存在时返回零值
+func blockTimeOf(blockNum uint32) (result time.Time, err error) {
+	block, err := db.FindBlock(int(blockNum))
+	if err != nil || block == nil {
+		return
+	}
+	return time.Parse("2006-01-02T15:04:05", block.Timestamp)
+}
+
+// 按serial_id顺序遍历operations表中已经保存的typeNames类型的operation(typeNames为nil时遍历所有operation)并调用fn回填,
+// 进度保存在scan_configs的cursorKey中, 可以中断后继续. 返回fn回填了(applied为true)的operation数
+func backfillOperations(cursorKey string, typeNames []string, batchSize int,
+	fn func(op *backfillOperation) (applied bool, err error)) (count int, err error) {
+	cursorStr, err := db.GetScanConfigOr(cursorKey, "0")
+	if err != nil {
+		return
+	}
+	cursor, err := strconv.ParseInt(cursorStr, 10, 64)
+	if err != nil {
+		return
+	}
+	// 同一个块的operation是连续的, 只缓存上一个块的时间
+	lastBlockNum := -1
+	lastBlockTimestamp := ""
+	var lastBlockTime time.Time
+	for {
+		var ops []*db.BaseOperationEntity
+		if typeNames == nil {
+			ops, err = db.ListBaseOperationsAfterSerialId(cursor, batchSize)
+		} else {
+			ops, err = db.ListBaseOperationsOfTypesAfterSerialId(typeNames, cursor, batchSize)
+		}
+		if err != nil {
+			return
+		}
+		if len(ops) < 1 {
+			return
+		}
+		for _, op := range ops {
+			cursor = op.SerialId
+			// operation id是 blockNum@txid@opNum
+			idParts := strings.Split(op.Id, "@")
+			var opNum int
+			opNum, err = strconv.Atoi(idParts[len(idParts)-1])
+			if err != nil {
+				return
+			}
+			if op.BlockNum != lastBlockNum {
+				var block *db.BlockEntity
+				block, err = db.FindBlock(op.BlockNum)
+				if err != nil {
+					return
+				}
+				if block == nil {
+					continue
+				}
+				lastBlockTime, err = time.Parse("2006-01-02T15:04:05", block.Timestamp)
+				if err != nil {
+					return
+				}
+				lastBlockNum = op.BlockNum
+				lastBlockTimestamp = block.Timestamp
+			}
+			item := &backfillOperation{BaseOperationEntity: op, OpNum: opNum, BlockTimestamp: lastBlockTimestamp,
+				BlockTime: lastBlockTime}
+			item.OpJSON, err = decodeJSONObjUseNumber(op.OperationJSON)
+			if err != nil {
+				return
+			}
+			if nodeservice.IsContractOpType(op.OperationType) {
+				item.Receipt, err = db.FindContractOpReceipt(op.Trxid, opNum)
+				if err != nil {
+					return
+				}
+			}
+			var applied bool
+			applied, err = fn(item)
+			if err != nil {
+				return
+			}
+			if applied {
+				count++
+			}
+		}
+		err = db.SetScanConfig(cursorKey, strconv.FormatInt(cursor, 10))
+		if err != nil {
+			return
+		}
+		logger.Println("backfilled to operation serial_id " + strconv.FormatInt(cursor, 10) + " (" + cursorKey + ")")
+	}
+}
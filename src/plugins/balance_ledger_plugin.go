@@ -0,0 +1,592 @@
+package plugins
+
+import (
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/nodeservice"
+	"github.com/blocklink/hxscanner/src/sink"
+	"github.com/blocklink/hxscanner/src/types"
+	"github.com/shopspring/decimal"
+)
+
+const baseAssetId = "1.3.0"
+
+// 已经对账完的块, 下一轮对账检查在这之后余额有变化的地址
+const balanceReconciledBlockNumConfigKey = "balance_reconciled_block_num"
+
+// 正在进行的一轮对账开始时的块和已经检查到的地址. 一轮对账可能跨多个对账块, 检查完所有地址后才推进balance_reconciled_block_num
+const (
+	balanceReconcileRoundBlockNumConfigKey = "balance_reconcile_round_block_num"
+	balanceReconcileAddrCursorConfigKey    = "balance_reconcile_addr_cursor"
+)
+
+// 对账时每次从数据库取的地址数
+const reconcileAddrsPageSize = 1000
+
+// 块时间和当前时间相差不超过这个值时认为已经接近最新块, 再检查节点的最新块是不是这个块
+const reconcileMaxBlockAge = 2 * time.Minute
+
+// 支付手续费的地址属性, 按顺序取第一个合法地址
+var feePayerAddrProps = []string{"fee_pay_address", "from_addr", "caller_addr", "lock_balance_addr", "foreclose_addr",
+	"addr", "owner_addr", "payer", "issuer_addr", "publisher_addr", "pay_back_owner", "bonus_owner", "miner_address"}
+
+// {"amount": 1000, "asset_id": "1.3.0"}
+func amountAndAssetOf(obj interface{}) (amount *big.Int, assetId string, ok bool) {
+	amountMap, ok := obj.(map[string]interface{})
+	if !ok {
+		return
+	}
+	assetId, ok = mapGetString(amountMap, "asset_id")
+	if !ok {
+		return
+	}
+	amount, ok = getBigIntPropFromJSONObj(amountMap, "amount")
+	return
+}
+
+// 合约回执的transfer_fees item: [assetId, amount] 或者 [[addr, assetId], amount], 只有assetId时由合约支付, payerAddr为空
+func transferFeeItemOf(obj interface{}) (payerAddr string, assetId string, amount *big.Int, ok bool) {
+	feeItem, ok := obj.([]interface{})
+	if !ok || len(feeItem) < 2 {
+		ok = false
+		return
+	}
+	amount, ok = objToBigInt(feeItem[1])
+	if !ok {
+		return
+	}
+	switch key := feeItem[0].(type) {
+	case string:
+		assetId = key
+	case []interface{}:
+		if len(key) < 2 {
+			ok = false
+			return
+		}
+		payerAddr, _ = key[0].(string)
+		assetId, _ = key[1].(string)
+	default:
+		ok = false
+	}
+	return
+}
+
+type balanceChangeCollector struct {
+	blockNum uint32
+	txid     string
+	opNum    int
+	changes  []*db.BalanceChangeEntity
+}
+
+func (collector *balanceChangeCollector) add(addr string, assetId string, amount *big.Int, changeType string, changeIndex int) {
+	if !types.IsHxAddress(addr) || len(assetId) < 1 || amount == nil || amount.Sign() == 0 {
+		return
+	}
+	collector.changes = append(collector.changes, &db.BalanceChangeEntity{
+		Addr:        addr,
+		AssetId:     assetId,
+		Amount:      amount,
+		ChangeType:  changeType,
+		BlockNum:    collector.blockNum,
+		Txid:        collector.txid,
+		OpNum:       collector.opNum,
+		ChangeIndex: changeIndex,
+	})
+}
+
+// 根据operation和回执计算各地址的余额变化
+func balanceChangesOf(blockNum uint32, txid string, opNum int, opType int, opTypeName string, opJSON map[string]interface{},
+	receipt *types.HxContractOpReceipt) []*db.BalanceChangeEntity {
+	collector := &balanceChangeCollector{blockNum: blockNum, txid: txid, opNum: opNum}
+	// 合约操作实际扣的手续费在回执中
+	if nodeservice.IsContractOpType(opType) && receipt != nil {
+		collector.add(receipt.Invoker, baseAssetId, new(big.Int).Neg(new(big.Int).SetUint64(receipt.ActualFee)), db.BalanceChangeFee, 0)
+		// 合约中转账的手续费, 由合约支付的不影响地址余额
+		for i, feeObj := range receipt.TransferFees {
+			payerAddr, assetId, amount, ok := transferFeeItemOf(feeObj)
+			if ok && len(payerAddr) > 0 {
+				collector.add(payerAddr, assetId, new(big.Int).Neg(amount), db.BalanceChangeTransferFee, i)
+			}
+		}
+	} else if fee, feeAssetId, ok := amountAndAssetOf(opJSON["fee"]); ok {
+		collector.add(feePayerOf(opJSON), feeAssetId, new(big.Int).Neg(fee), db.BalanceChangeFee, 0)
+	}
+	switch opTypeName {
+	case "transfer_operation":
+		amount, assetId, ok := amountAndAssetOf(opJSON["amount"])
+		if ok {
+			fromAddr, _ := mapGetString(opJSON, "from_addr")
+			toAddr, _ := mapGetString(opJSON, "to_addr")
+			collector.add(fromAddr, assetId, new(big.Int).Neg(amount), db.BalanceChangeTransferOut, 0)
+			collector.add(toAddr, assetId, amount, db.BalanceChangeTransferIn, 0)
+		}
+	case "lockbalance_operation":
+		addr, _ := mapGetString(opJSON, "lock_balance_addr")
+		assetId, _ := mapGetString(opJSON, "lock_asset_id")
+		amount, ok := getBigIntPropFromJSONObj(opJSON, "lock_asset_amount")
+		if ok {
+			collector.add(addr, assetId, new(big.Int).Neg(amount), db.BalanceChangeLock, 0)
+		}
+	case "foreclose_balance_operation":
+		addr, _ := mapGetString(opJSON, "foreclose_addr")
+		assetId, _ := mapGetString(opJSON, "foreclose_asset_id")
+		amount, ok := getBigIntPropFromJSONObj(opJSON, "foreclose_asset_amount")
+		if ok {
+			collector.add(addr, assetId, amount, db.BalanceChangeForeclose, 0)
+		}
+	case "transfer_contract_operation":
+		if receipt != nil && receipt.ExecSucceed {
+			amount, assetId, ok := amountAndAssetOf(opJSON["amount"])
+			if ok {
+				callerAddr, _ := mapGetString(opJSON, "caller_addr")
+				collector.add(callerAddr, assetId, new(big.Int).Neg(amount), db.BalanceChangeContractDeposit, 0)
+			}
+		}
+	case "bonus_operation":
+		// bonus: [[assetSymbol, amount], ...]
+		owner, _ := mapGetString(opJSON, "bonus_owner")
+		bonusItems, _ := opJSON["bonus"].([]interface{})
+		for i, bonusItemObj := range bonusItems {
+			bonusItem, ok := bonusItemObj.([]interface{})
+			if !ok || len(bonusItem) < 2 {
+				continue
+			}
+			symbol, ok := bonusItem[0].(string)
+			if !ok {
+				continue
+			}
+			amount, ok := objToBigInt(bonusItem[1])
+			if !ok {
+				continue
+			}
+			asset, err := db.FindAssetBySymbol(symbol)
+			if err != nil || asset == nil {
+				logger.Println("unknown bonus asset symbol " + symbol + " in tx " + txid)
+				continue
+			}
+			collector.add(owner, asset.AssetId, amount, db.BalanceChangeBonus, i)
+		}
+	case "pay_back_operation":
+		// pay_back_balance: [[citizenName, {amount, asset_id}], ...]
+		owner, _ := mapGetString(opJSON, "pay_back_owner")
+		payBackItems, _ := opJSON["pay_back_balance"].([]interface{})
+		for i, payBackItemObj := range payBackItems {
+			payBackItem, ok := payBackItemObj.([]interface{})
+			if !ok || len(payBackItem) < 2 {
+				continue
+			}
+			amount, assetId, ok := amountAndAssetOf(payBackItem[1])
+			if ok {
+				collector.add(owner, assetId, amount, db.BalanceChangePayBack, i)
+			}
+		}
+	}
+	if receipt != nil && receipt.ExecSucceed {
+		// deposit_to_address item: [[addr, assetId], amount]
+		for changeIndex, change := range receipt.DepositToAddressChanges {
+			changeItem, ok := change.([]interface{})
+			if !ok || len(changeItem) < 2 {
+				continue
+			}
+			addressAssetPair, ok := changeItem[0].([]interface{})
+			if !ok || len(addressAssetPair) < 2 {
+				continue
+			}
+			addr, _ := addressAssetPair[0].(string)
+			assetId, _ := addressAssetPair[1].(string)
+			amount, ok := objToBigInt(changeItem[1])
+			if ok {
+				collector.add(addr, assetId, amount, db.BalanceChangeContractWithdraw, changeIndex)
+			}
+		}
+	}
+	return collector.changes
+}
+
+// 跨链充值, 提现和退回的余额变化需要查询的数据
+type crosschainLedgerSource interface {
+	assetPrecision(assetId string) (precision uint32, found bool, err error)
+	// 块blockNum时绑定了这个链外地址的地址, 没有绑定时为空
+	bindingOwner(tunnelAddress string, crosschainType string, blockNum uint32) (addr string, err error)
+	// 被这个退回operation退回的提现请求
+	refundedWithdrawals(txid string, opTypeName string, linkId string) ([]*db.CrosschainTransferEntity, error)
+}
+
+type dbCrosschainLedgerSource struct{}
+
+func (source dbCrosschainLedgerSource) assetPrecision(assetId string) (precision uint32, found bool, err error) {
+	asset, err := db.FindAsset(assetId)
+	if err != nil || asset == nil {
+		return
+	}
+	return asset.Precision, true, nil
+}
+
+func (source dbCrosschainLedgerSource) bindingOwner(tunnelAddress string, crosschainType string, blockNum uint32) (addr string, err error) {
+	binding, err := db.FindAccountBindingOfTunnelAtBlock(tunnelAddress, crosschainType, blockNum)
+	if err != nil || binding == nil {
+		return
+	}
+	addr = binding.Addr
+	return
+}
+
+// CrosschainTransferPlugin在这之前处理同一个operation, 被退回的提现请求的finish_txid是这个交易
+func (source dbCrosschainLedgerSource) refundedWithdrawals(txid string, opTypeName string, linkId string) (result []*db.CrosschainTransferEntity, err error) {
+	transfers, err := listCrosschainTransfersOfLink(opTypeName, linkId)
+	if err != nil {
+		return
+	}
+	for _, transfer := range transfers {
+		if transfer.Direction == db.CrosschainDirectionWithdraw && transfer.FinishTxid == txid {
+			result = append(result, transfer)
+		}
+	}
+	return
+}
+
+// 跨链operation中的金额是按资产精度的小数, 转换成整数
+func crosschainAmountOf(source crosschainLedgerSource, assetId string, amountStr string) (amount *big.Int, ok bool, err error) {
+	precision, found, err := source.assetPrecision(assetId)
+	if err != nil || !found {
+		return
+	}
+	amountDecimal, decodeErr := decimal.NewFromString(amountStr)
+	if decodeErr != nil {
+		return
+	}
+	return amountDecimal.Shift(int32(precision)).Truncate(0).BigInt(), true, nil
+}
+
+// 跨链充值入账到绑定了充值来源地址的地址, 提现请求扣除提现金额, 签名不足或失败的提现退回给请求地址
+func crosschainBalanceChangesOf(blockNum uint32, txid string, opNum int, opTypeName string, opJSON map[string]interface{},
+	source crosschainLedgerSource) (result []*db.BalanceChangeEntity, err error) {
+	collector := &balanceChangeCollector{blockNum: blockNum, txid: txid, opNum: opNum}
+	switch opTypeName {
+	case "crosschain_record_operation":
+		trx, _ := opJSON["cross_chain_trx"].(map[string]interface{})
+		if trx == nil {
+			break
+		}
+		assetId, _ := mapGetString(opJSON, "asset_id")
+		assetSymbol := firstStringPropOf(opJSON, []string{"asset_symbol"})
+		if len(assetSymbol) < 1 {
+			assetSymbol, _ = mapGetString(trx, "asset_symbol")
+		}
+		fromAccount, _ := mapGetString(trx, "from_account")
+		var owner string
+		owner, err = source.bindingOwner(fromAccount, assetSymbol, blockNum)
+		if err != nil {
+			return
+		}
+		if len(owner) < 1 {
+			logger.Println("no address bound to " + assetSymbol + " address " + fromAccount + " for deposit in tx " + txid)
+			break
+		}
+		amount, ok, amountErr := crosschainAmountOf(source, assetId, crosschainStringOf(trx["amount"]))
+		if amountErr != nil {
+			err = amountErr
+			return
+		}
+		if ok {
+			collector.add(owner, assetId, amount, db.BalanceChangeCrosschainDeposit, 0)
+		}
+	case "crosschain_withdraw_operation":
+		addr, _ := mapGetString(opJSON, "withdraw_account")
+		assetId, _ := mapGetString(opJSON, "asset_id")
+		amount, ok, amountErr := crosschainAmountOf(source, assetId, crosschainStringOf(opJSON["amount"]))
+		if amountErr != nil {
+			err = amountErr
+			return
+		}
+		if ok {
+			collector.add(addr, assetId, new(big.Int).Neg(amount), db.BalanceChangeCrosschainWithdraw, 0)
+		}
+	case "guard_refund_crosschain_trx_operation", "eth_cancel_fail_crosschain_trx_operation":
+		linkId := crosschainOperationOf(blockNum, time.Time{}, txid, opNum, opTypeName, opJSON).Event.LinkId
+		if len(linkId) < 1 {
+			break
+		}
+		var transfers []*db.CrosschainTransferEntity
+		transfers, err = source.refundedWithdrawals(txid, opTypeName, linkId)
+		if err != nil {
+			return
+		}
+		for i, transfer := range transfers {
+			amount, ok, amountErr := crosschainAmountOf(source, transfer.AssetId, transfer.Amount)
+			if amountErr != nil {
+				err = amountErr
+				return
+			}
+			if ok {
+				collector.add(transfer.HxAddr, transfer.AssetId, amount, db.BalanceChangeCrosschainRefund, i)
+			}
+		}
+	}
+	result = collector.changes
+	return
+}
+
+// account_bind_operation和account_unbind_operation记录到account_bindings, 用来找到跨链充值入账的地址
+func applyAccountBinding(blockNum uint32, txid string, opTypeName string, opJSON map[string]interface{}) (err error) {
+	if opTypeName != "account_bind_operation" && opTypeName != "account_unbind_operation" {
+		return
+	}
+	addr, _ := mapGetString(opJSON, "addr")
+	crosschainType, _ := mapGetString(opJSON, "crosschain_type")
+	tunnelAddress, _ := mapGetString(opJSON, "tunnel_address")
+	if len(addr) < 1 || len(crosschainType) < 1 || len(tunnelAddress) < 1 {
+		return
+	}
+	if opTypeName == "account_unbind_operation" {
+		return db.UnbindAccountBinding(addr, crosschainType, tunnelAddress, blockNum, txid)
+	}
+	old, err := db.FindAccountBinding(txid, addr, crosschainType)
+	if err != nil || old != nil {
+		return
+	}
+	return db.SaveAccountBinding(&db.AccountBindingEntity{
+		Addr:           addr,
+		CrosschainType: crosschainType,
+		TunnelAddress:  tunnelAddress,
+		BindBlockNum:   blockNum,
+		BindTxid:       txid,
+	})
+}
+
+func saveBalanceChangeIfNew(change *db.BalanceChangeEntity) (err error) {
+	old, err := db.FindBalanceChange(change.Txid, change.OpNum, change.Addr, change.AssetId, change.ChangeType, change.ChangeIndex)
+	if err != nil || old != nil {
+		return
+	}
+	return db.SaveBalanceChange(change)
+}
+
+// 从operation计算余额变化写入balance_changes, 每ReconcileInterval个块和节点的get_addr_balances对账.
+// AdjustOnReconcile为true时把差额作为reconcile类型的变化写入账本(比如创世块分配的余额)
+type BalanceLedgerPlugin struct {
+	ReconcileInterval uint32
+	AdjustOnReconcile bool
+}
+
+func (plugin *BalanceLedgerPlugin) PluginName() string {
+	return "BalanceLedgerPlugin"
+}
+
+func (plugin *BalanceLedgerPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	blockNum := uint32(block.BlockNumber)
+	err = applyAccountBinding(blockNum, txid, opTypeName, opJSON)
+	if err != nil {
+		return
+	}
+	changes := balanceChangesOf(blockNum, txid, opNum, opType, opTypeName, opJSON, receipt)
+	crosschainChanges, err := crosschainBalanceChangesOf(blockNum, txid, opNum, opTypeName, opJSON, dbCrosschainLedgerSource{})
+	if err != nil {
+		return
+	}
+	changes = append(changes, crosschainChanges...)
+	for _, change := range changes {
+		err = saveBalanceChangeIfNew(change)
+		if err != nil {
+			return
+		}
+	}
+	if len(changes) < 1 {
+		return
+	}
+	return emitBalanceChangeRecords(blockNum, txid, opNum)
+}
+
+// sink落后时从balance_changes重新输出balance_change记录
+func (plugin *BalanceLedgerPlugin) ReplayOperationRecords(block *types.HxBlock, txid string, opNum int) (err error) {
+	return emitBalanceChangeRecords(uint32(block.BlockNumber), txid, opNum)
+}
+
+// 输出operation的每个余额变化和变化后的余额. 余额从账本计算, 所以重放时和第一次扫描时相同
+func emitBalanceChangeRecords(blockNum uint32, txid string, opNum int) (err error) {
+	if !sink.Enabled() {
+		return
+	}
+	changes, err := db.ListBalanceChangesOfOperation(txid, opNum)
+	if err != nil {
+		return
+	}
+	for _, change := range changes {
+		var balance *big.Int
+		balance, err = db.SumAddressAssetBalanceUntilChange(change)
+		if err != nil {
+			return
+		}
+		sink.Emit(&sink.Record{Kind: sink.RecordKindBalanceChange, BlockNum: blockNum, Txid: txid, OpNum: opNum,
+			Data: map[string]interface{}{"owner_addr": change.Addr, "asset_id": change.AssetId, "amount": balance.String(),
+				"change": change.Amount.String(), "change_type": change.ChangeType}})
+	}
+	return
+}
+
+func isRecentBlock(block *types.HxBlock) bool {
+	blockTime, err := time.Parse("2006-01-02T15:04:05", block.Timestamp)
+	if err != nil {
+		return false
+	}
+	return time.Since(blockTime) < reconcileMaxBlockAge
+}
+
+// 节点的余额是最新块的, 只有节点的最新块就是blockNum时才和账本对账. 节点的最新块变化后停止, 下一个对账块从检查到的地址继续
+func (plugin *BalanceLedgerPlugin) ApplyBlock(block *types.HxBlock) (err error) {
+	blockNum := uint32(block.BlockNumber)
+	if plugin.ReconcileInterval < 1 || blockNum%plugin.ReconcileInterval != 0 {
+		return
+	}
+	if !isRecentBlock(block) || !nodeservice.IsHxNodeConnected() {
+		return
+	}
+	isHead, err := isNodeHeadBlock(blockNum)
+	if err != nil || !isHead {
+		return
+	}
+	lastReconciled, err := getScanConfigUint32(balanceReconciledBlockNumConfigKey)
+	if err != nil {
+		return
+	}
+	roundBlockNum, err := getScanConfigUint32(balanceReconcileRoundBlockNumConfigKey)
+	if err != nil {
+		return
+	}
+	addrCursor, err := db.GetScanConfigOr(balanceReconcileAddrCursorConfigKey, "")
+	if err != nil {
+		return
+	}
+	if roundBlockNum == 0 {
+		// 开始新的一轮, 检查(lastReconciled, blockNum]之间有变化的地址
+		roundBlockNum = blockNum
+		addrCursor = ""
+		err = db.SetScanConfig(balanceReconcileRoundBlockNumConfigKey, strconv.Itoa(int(roundBlockNum)))
+		if err != nil {
+			return
+		}
+	}
+	for {
+		var addrs []string
+		addrs, err = db.ListAddrsWithBalanceChangesBetween(lastReconciled, roundBlockNum, addrCursor, reconcileAddrsPageSize)
+		if err != nil {
+			return
+		}
+		for _, addr := range addrs {
+			var checked bool
+			checked, err = plugin.reconcileAddress(addr, blockNum)
+			if err != nil {
+				return
+			}
+			if !checked {
+				return db.SetScanConfig(balanceReconcileAddrCursorConfigKey, addrCursor)
+			}
+			addrCursor = addr
+		}
+		if len(addrs) < reconcileAddrsPageSize {
+			break
+		}
+		err = db.SetScanConfig(balanceReconcileAddrCursorConfigKey, addrCursor)
+		if err != nil {
+			return
+		}
+	}
+	// 这一轮的地址都检查完了, 这一轮开始之后的变化由下一轮检查
+	err = db.SetScanConfig(balanceReconciledBlockNumConfigKey, strconv.Itoa(int(roundBlockNum)))
+	if err != nil {
+		return
+	}
+	err = db.SetScanConfig(balanceReconcileRoundBlockNumConfigKey, "0")
+	if err != nil {
+		return
+	}
+	return db.SetScanConfig(balanceReconcileAddrCursorConfigKey, "")
+}
+
+func isNodeHeadBlock(blockNum uint32) (result bool, err error) {
+	headBlockNum, err := nodeservice.GetHeadBlockNumber()
+	if err != nil {
+		return
+	}
+	result = headBlockNum == blockNum
+	return
+}
+
+func getScanConfigUint32(key string) (result uint32, err error) {
+	valueStr, err := db.GetScanConfigOr(key, "0")
+	if err != nil {
+		return
+	}
+	value, err := strconv.ParseUint(valueStr, 10, 32)
+	if err != nil {
+		return
+	}
+	result = uint32(value)
+	return
+}
+
+// 账本中截止到blockNum的余额和节点的余额对比. 取到节点余额后节点的最新块已经不是blockNum时不可比, checked为false
+func (plugin *BalanceLedgerPlugin) reconcileAddress(addr string, blockNum uint32) (checked bool, err error) {
+	ledgerBalances, err := db.SumAddressBalancesAtBlock(addr, blockNum)
+	if err != nil {
+		return
+	}
+	nodeBalances, err := nodeservice.GetAddressBalances(addr)
+	if err != nil {
+		return
+	}
+	checked, err = isNodeHeadBlock(blockNum)
+	if err != nil || !checked {
+		return
+	}
+	assetIds := make(map[string]bool)
+	for assetId := range ledgerBalances {
+		assetIds[assetId] = true
+	}
+	for assetId := range nodeBalances {
+		assetIds[assetId] = true
+	}
+	for assetId := range assetIds {
+		ledgerAmount, ok := ledgerBalances[assetId]
+		if !ok {
+			ledgerAmount = big.NewInt(0)
+		}
+		nodeAmount := big.NewInt(nodeBalances[assetId])
+		if ledgerAmount.Cmp(nodeAmount) == 0 {
+			continue
+		}
+		logger.Println("balance of " + addr + " asset " + assetId + " at block #" + strconv.Itoa(int(blockNum)) +
+			" in ledger " + ledgerAmount.String() + " but node has " + nodeAmount.String())
+		if plugin.AdjustOnReconcile {
+			err = saveBalanceChangeIfNew(&db.BalanceChangeEntity{
+				Addr:        addr,
+				AssetId:     assetId,
+				Amount:      new(big.Int).Sub(nodeAmount, ledgerAmount),
+				ChangeType:  db.BalanceChangeReconcile,
+				BlockNum:    blockNum,
+				Txid:        "",
+				OpNum:       -1,
+				ChangeIndex: int(blockNum),
+			})
+			if err != nil {
+				return
+			}
+		}
+		err = db.SaveBalanceReconciliation(&db.BalanceReconciliationEntity{
+			Addr:         addr,
+			AssetId:      assetId,
+			BlockNum:     blockNum,
+			LedgerAmount: ledgerAmount,
+			NodeAmount:   nodeAmount,
+			Adjusted:     plugin.AdjustOnReconcile,
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
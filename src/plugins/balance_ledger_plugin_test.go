@@ -0,0 +1,214 @@
+package plugins
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+// checksum正确的地址
+const (
+	testAddr1 = "HXNM7FJQG4fbMSdjFNj1Y3ymJRZb7re3CfLB"
+	testAddr2 = "HXNPwoXiK5LG9veVUQvnLyrimpEBj7E8VEqv"
+	testAddr3 = "HXNSnMm2N5zvxQfFhT8Z9uVEnbQWgPjfsgUf"
+)
+
+func mustDecodeOpJSON(t *testing.T, jsonStr string) map[string]interface{} {
+	opJSON, err := decodeJSONObjUseNumber(jsonStr)
+	if err != nil {
+		t.Fatalf("invalid json %s: %s", jsonStr, err.Error())
+	}
+	return opJSON
+}
+
+func mustDecodeReceipt(t *testing.T, jsonStr string) *types.HxContractOpReceipt {
+	receipt := types.NewHxContractOpReceipt()
+	err := json.Unmarshal([]byte(jsonStr), receipt)
+	if err != nil {
+		t.Fatalf("invalid receipt %s: %s", jsonStr, err.Error())
+	}
+	return receipt
+}
+
+func balanceChangeStrings(changes []*db.BalanceChangeEntity) []string {
+	result := make([]string, 0, len(changes))
+	for _, change := range changes {
+		result = append(result, change.Addr+" "+change.AssetId+" "+change.Amount.String()+" "+change.ChangeType+" "+
+			strconv.Itoa(change.ChangeIndex))
+	}
+	return result
+}
+
+func TestBalanceChangesOf(t *testing.T) {
+	tests := []struct {
+		name       string
+		opType     int
+		opTypeName string
+		opJSON     string
+		receipt    string
+		want       []string
+	}{
+		{
+			name:       "transfer",
+			opType:     0,
+			opTypeName: "transfer_operation",
+			opJSON: `{"fee": {"amount": 101000, "asset_id": "1.3.0"}, "from_addr": "` + testAddr1 + `", "to_addr": "` + testAddr2 +
+				`", "amount": {"amount": 123456789012345678, "asset_id": "1.3.1"}}`,
+			want: []string{
+				testAddr1 + " 1.3.0 -101000 fee 0",
+				testAddr1 + " 1.3.1 -123456789012345678 transfer_out 0",
+				testAddr2 + " 1.3.1 123456789012345678 transfer_in 0",
+			},
+		},
+		{
+			name:       "transfer to invalid address",
+			opType:     0,
+			opTypeName: "transfer_operation",
+			opJSON: `{"fee": {"amount": 100, "asset_id": "1.3.0"}, "from_addr": "` + testAddr1 +
+				`", "to_addr": "HXNbadaddress", "amount": {"amount": 5, "asset_id": "1.3.0"}}`,
+			want: []string{
+				testAddr1 + " 1.3.0 -100 fee 0",
+				testAddr1 + " 1.3.0 -5 transfer_out 0",
+			},
+		},
+		{
+			name:       "lock balance",
+			opType:     55,
+			opTypeName: "lockbalance_operation",
+			opJSON: `{"fee": {"amount": 0, "asset_id": "1.3.0"}, "lock_balance_addr": "` + testAddr1 +
+				`", "lock_asset_id": "1.3.0", "lock_asset_amount": 2000}`,
+			want: []string{
+				testAddr1 + " 1.3.0 -2000 lock 0",
+			},
+		},
+		{
+			name:       "invoke contract",
+			opType:     79,
+			opTypeName: "invoke_contract_operation",
+			opJSON: `{"fee": {"amount": 1, "asset_id": "1.3.0"}, "caller_addr": "` + testAddr1 +
+				`", "contract_id": "HXCcontract"}`,
+			receipt: `{"exec_succeed": true, "acctual_fee": 3000, "invoker": "` + testAddr1 + `",` +
+				` "transfer_fees": [[["` + testAddr2 + `", "1.3.0"], 20], ["1.3.0", 7]],` +
+				` "deposit_to_address": [[["` + testAddr3 + `", "1.3.0"], 500]]}`,
+			want: []string{
+				testAddr1 + " 1.3.0 -3000 fee 0",
+				testAddr2 + " 1.3.0 -20 transfer_fee 0",
+				testAddr3 + " 1.3.0 500 contract_withdraw 0",
+			},
+		},
+		{
+			name:       "failed contract call only pays fee",
+			opType:     79,
+			opTypeName: "invoke_contract_operation",
+			opJSON:     `{"caller_addr": "` + testAddr1 + `"}`,
+			receipt: `{"exec_succeed": false, "acctual_fee": 3000, "invoker": "` + testAddr1 + `",` +
+				` "deposit_to_address": [[["` + testAddr3 + `", "1.3.0"], 500]]}`,
+			want: []string{
+				testAddr1 + " 1.3.0 -3000 fee 0",
+			},
+		},
+	}
+	for _, test := range tests {
+		var receipt *types.HxContractOpReceipt
+		if len(test.receipt) > 0 {
+			receipt = mustDecodeReceipt(t, test.receipt)
+		}
+		changes := balanceChangesOf(100, "txid", 0, test.opType, test.opTypeName, mustDecodeOpJSON(t, test.opJSON), receipt)
+		if got := balanceChangeStrings(changes); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+type fakeCrosschainLedgerSource struct {
+	precisions map[string]uint32
+	bindings   map[string]string // 链外地址 => 地址
+	refunded   []*db.CrosschainTransferEntity
+}
+
+func (source *fakeCrosschainLedgerSource) assetPrecision(assetId string) (precision uint32, found bool, err error) {
+	precision, found = source.precisions[assetId]
+	return
+}
+
+func (source *fakeCrosschainLedgerSource) bindingOwner(tunnelAddress string, crosschainType string, blockNum uint32) (string, error) {
+	return source.bindings[tunnelAddress], nil
+}
+
+func (source *fakeCrosschainLedgerSource) refundedWithdrawals(txid string, opTypeName string, linkId string) ([]*db.CrosschainTransferEntity, error) {
+	return source.refunded, nil
+}
+
+func TestCrosschainBalanceChangesOf(t *testing.T) {
+	source := &fakeCrosschainLedgerSource{
+		precisions: map[string]uint32{"1.3.1": 8},
+		bindings:   map[string]string{"1btcaddr": testAddr1},
+		refunded: []*db.CrosschainTransferEntity{
+			{Direction: db.CrosschainDirectionWithdraw, HxAddr: testAddr2, AssetId: "1.3.1", Amount: "0.3"},
+			{Direction: db.CrosschainDirectionWithdraw, HxAddr: testAddr3, AssetId: "1.3.1", Amount: "1"},
+		},
+	}
+	tests := []struct {
+		name       string
+		opTypeName string
+		opJSON     string
+		want       []string
+	}{
+		{
+			name:       "deposit to bound address",
+			opTypeName: "crosschain_record_operation",
+			opJSON: `{"asset_symbol": "BTC", "asset_id": "1.3.1", "cross_chain_trx": {"trx_id": "btctx1",` +
+				` "from_account": "1btcaddr", "amount": "0.5"}}`,
+			want: []string{testAddr1 + " 1.3.1 50000000 crosschain_deposit 0"},
+		},
+		{
+			name:       "deposit from unbound address",
+			opTypeName: "crosschain_record_operation",
+			opJSON: `{"asset_symbol": "BTC", "asset_id": "1.3.1", "cross_chain_trx": {"trx_id": "btctx2",` +
+				` "from_account": "1other", "amount": "0.5"}}`,
+			want: []string{},
+		},
+		{
+			name:       "withdraw request",
+			opTypeName: "crosschain_withdraw_operation",
+			opJSON: `{"withdraw_account": "` + testAddr2 + `", "amount": "0.3", "asset_symbol": "BTC", "asset_id": "1.3.1",` +
+				` "crosschain_account": "1btcaddr2"}`,
+			want: []string{testAddr2 + " 1.3.1 -30000000 crosschain_withdraw 0"},
+		},
+		{
+			name:       "withdraw of unknown asset",
+			opTypeName: "crosschain_withdraw_operation",
+			opJSON:     `{"withdraw_account": "` + testAddr2 + `", "amount": "0.3", "asset_symbol": "XYZ", "asset_id": "1.3.9"}`,
+			want:       []string{},
+		},
+		{
+			name:       "refund not enough signatures",
+			opTypeName: "guard_refund_crosschain_trx_operation",
+			opJSON:     `{"not_enough_sign_trx_id": "unsigned1"}`,
+			want: []string{
+				testAddr2 + " 1.3.1 30000000 crosschain_refund 0",
+				testAddr3 + " 1.3.1 100000000 crosschain_refund 1",
+			},
+		},
+		{
+			name:       "refund without link",
+			opTypeName: "eth_cancel_fail_crosschain_trx_operation",
+			opJSON:     `{}`,
+			want:       []string{},
+		},
+	}
+	for _, test := range tests {
+		changes, err := crosschainBalanceChangesOf(100, "txid", 0, test.opTypeName, mustDecodeOpJSON(t, test.opJSON), source)
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+		if got := balanceChangeStrings(changes); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package plugins
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/nodeservice"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const citizenCollectedBlockNumConfigKey = "citizen_collected_block_num"
+
+// 维护citizen_infos: miner_create_operation创建citizen, account_update_operation的miner_pledge_pay_back更新citizen手续费比例,
+// 每个块更新出块citizen的最后出块记录. 相邻块时间间隔超过BlockInterval时记录没有出块的slot,
+// 扫描到最新块后每CollectInterval个块从节点收集各citizen的total_missed, 增加量记录为这个citizen的漏块.
+// 不和预期的出块顺序比较: 节点只提供当前的出块顺序, 扫描历史块时无法知道空slot应该由哪个citizen出块, 所以slot_gap不归属到citizen,
+// 没有扫描到最新块时(追块中)的区间也没有citizen的漏块记录
+type CitizenPlugin struct {
+	BlockInterval   uint32
+	CollectInterval uint32
+}
+
+func (plugin *CitizenPlugin) PluginName() string {
+	return "CitizenPlugin"
+}
+
+func (plugin *CitizenPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	switch opTypeName {
+	case "miner_create_operation":
+		accountId, ok := mapGetString(opJSON, "miner_account")
+		if !ok {
+			return
+		}
+		var citizen *db.CitizenInfoEntity
+		citizen, err = db.FindCitizenInfoByAccountId(accountId)
+		if err != nil || citizen != nil {
+			return
+		}
+		// citizen id在出块后才知道
+		return db.SaveCitizenInfo(&db.CitizenInfoEntity{AccountId: accountId, LastCollectMissTime: time.Unix(0, 0)})
+	case "account_update_operation":
+		accountId, _ := mapGetString(opJSON, "account")
+		newOptions, ok := opJSON["new_options"].(map[string]interface{})
+		if !ok || len(accountId) < 1 {
+			return
+		}
+		citizenFee, ok := getIntPropFromJSONObj(newOptions, "miner_pledge_pay_back")
+		if !ok {
+			return
+		}
+		var citizen *db.CitizenInfoEntity
+		citizen, err = db.FindCitizenInfoByAccountId(accountId)
+		if err != nil || citizen == nil || citizen.LastCitizenFee == int(citizenFee) {
+			return
+		}
+		citizen.LastCitizenFee = int(citizenFee)
+		return db.UpdateCitizenInfo(citizen)
+	}
+	return
+}
+
+// 找到出块的citizen, 第一次出块时从节点查询它的账户, 关联到miner_create_operation创建的记录
+func findOrCreateCitizen(citizenId string) (citizen *db.CitizenInfoEntity, err error) {
+	citizen, err = db.FindCitizenInfoByCitizenId(citizenId)
+	if err != nil || citizen != nil {
+		return
+	}
+	accountId := ""
+	if nodeservice.IsHxNodeConnected() {
+		minerObjects, queryErr := nodeservice.GetMinerObjects([]string{citizenId})
+		if queryErr != nil {
+			logger.Println("query citizen "+citizenId+" error", queryErr)
+		} else if minerObject, ok := minerObjects[citizenId]; ok {
+			accountId = minerObject.MinerAccount
+		}
+	}
+	if len(accountId) > 0 {
+		citizen, err = db.FindCitizenInfoByAccountId(accountId)
+		if err != nil {
+			return
+		}
+		if citizen != nil && len(citizen.CitizenId) < 1 {
+			citizen.CitizenId = citizenId
+			err = db.UpdateCitizenInfo(citizen)
+			return
+		}
+	}
+	err = db.SaveCitizenInfo(&db.CitizenInfoEntity{CitizenId: citizenId, AccountId: accountId,
+		LastCollectMissTime: time.Unix(0, 0)})
+	if err != nil {
+		return
+	}
+	return db.FindCitizenInfoByCitizenId(citizenId)
+}
+
+func (plugin *CitizenPlugin) ApplyBlock(block *types.HxBlock) (err error) {
+	blockNum := uint32(block.BlockNumber)
+	blockTime, err := time.Parse("2006-01-02T15:04:05", block.Timestamp)
+	if err != nil {
+		return
+	}
+	prevBlock, err := db.FindBlock(block.BlockNumber - 1)
+	if err != nil {
+		return
+	}
+	if prevBlock != nil {
+		// 上一个块的id在这个块的previous中
+		var prevCitizen *db.CitizenInfoEntity
+		prevCitizen, err = db.FindCitizenInfoByCitizenId(prevBlock.Miner)
+		if err != nil {
+			return
+		}
+		if prevCitizen != nil && prevCitizen.LastMinedBlockNum == int64(prevBlock.Number) {
+			prevCitizen.LastMinedBlockId = block.Previous
+			err = db.UpdateCitizenInfo(prevCitizen)
+			if err != nil {
+				return
+			}
+		}
+		err = plugin.saveSlotGap(block, blockTime, prevBlock)
+		if err != nil {
+			return
+		}
+	}
+	if len(block.Miner) > 0 {
+		var citizen *db.CitizenInfoEntity
+		citizen, err = findOrCreateCitizen(block.Miner)
+		if err != nil {
+			return
+		}
+		if citizen != nil && citizen.LastMinedBlockNum < int64(blockNum) {
+			citizen.LastMinedBlockNum = int64(blockNum)
+			citizen.LastMinedBlockId = ""
+			err = db.UpdateCitizenInfo(citizen)
+			if err != nil {
+				return
+			}
+		}
+	}
+	if plugin.CollectInterval < 1 || blockNum%plugin.CollectInterval != 0 {
+		return
+	}
+	if !isRecentBlock(block) || !nodeservice.IsHxNodeConnected() {
+		return
+	}
+	return plugin.collectMissedBlocks(blockNum, blockTime)
+}
+
+func (plugin *CitizenPlugin) saveSlotGap(block *types.HxBlock, blockTime time.Time, prevBlock *db.BlockEntity) (err error) {
+	if plugin.BlockInterval < 1 {
+		return
+	}
+	prevBlockTime, err := time.Parse("2006-01-02T15:04:05", prevBlock.Timestamp)
+	if err != nil {
+		return
+	}
+	missedSlots := int64(blockTime.Sub(prevBlockTime)/(time.Duration(plugin.BlockInterval)*time.Second)) - 1
+	if missedSlots < 1 {
+		return
+	}
+	blockNum := uint32(block.BlockNumber)
+	old, err := db.FindCitizenBlockMiss(blockNum, "", db.CitizenMissSourceSlotGap)
+	if err != nil || old != nil {
+		return
+	}
+	return db.SaveCitizenBlockMiss(&db.CitizenBlockMissEntity{
+		MissedCount: missedSlots,
+		Source:      db.CitizenMissSourceSlotGap,
+		BlockNum:    blockNum,
+		BlockTime:   blockTime,
+	})
+}
+
+func (plugin *CitizenPlugin) collectMissedBlocks(blockNum uint32, blockTime time.Time) (err error) {
+	lastCollectedStr, err := db.GetScanConfigOr(citizenCollectedBlockNumConfigKey, "0")
+	if err != nil {
+		return
+	}
+	lastCollected, err := strconv.Atoi(lastCollectedStr)
+	if err != nil {
+		return
+	}
+	citizens, err := db.ListCitizenInfos()
+	if err != nil {
+		return
+	}
+	citizenIds := make([]string, 0, len(citizens))
+	for _, citizen := range citizens {
+		if len(citizen.CitizenId) > 0 {
+			citizenIds = append(citizenIds, citizen.CitizenId)
+		}
+	}
+	if len(citizenIds) < 1 {
+		return
+	}
+	minerObjects, err := nodeservice.GetMinerObjects(citizenIds)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, citizen := range citizens {
+		minerObject, ok := minerObjects[citizen.CitizenId]
+		if len(citizen.CitizenId) < 1 || !ok {
+			continue
+		}
+		// 第一次收集时只记录节点的total_missed. 之后每次收集都记录一条(没有漏块时为0), 表示到这个块为止的漏块已经收集过
+		if citizen.LastCollectMissTime.Unix() > 0 && minerObject.TotalMissed >= int64(citizen.LastCollectMissCount) {
+			var old *db.CitizenBlockMissEntity
+			old, err = db.FindCitizenBlockMiss(blockNum, citizen.CitizenId, db.CitizenMissSourceNode)
+			if err != nil {
+				return
+			}
+			if old == nil {
+				err = db.SaveCitizenBlockMiss(&db.CitizenBlockMissEntity{
+					CitizenId:   citizen.CitizenId,
+					MissedCount: minerObject.TotalMissed - int64(citizen.LastCollectMissCount),
+					Source:      db.CitizenMissSourceNode,
+					BlockNum:    blockNum,
+					BlockTime:   blockTime,
+				})
+				if err != nil {
+					return
+				}
+			}
+		}
+		var producedCount int64
+		producedCount, err = db.CountBlocksOfMiner(citizen.CitizenId, uint32(lastCollected)+1, blockNum)
+		if err != nil {
+			return
+		}
+		if len(citizen.AccountId) < 1 {
+			citizen.AccountId = minerObject.MinerAccount
+		}
+		citizen.LastCollectMissTime = now
+		citizen.LastCollectMissCount = int(minerObject.TotalMissed)
+		citizen.LastCollectProducedCount = int(producedCount)
+		err = db.UpdateCitizenInfo(citizen)
+		if err != nil {
+			return
+		}
+	}
+	return db.SetScanConfig(citizenCollectedBlockNumConfigKey, strconv.Itoa(int(blockNum)))
+}
@@ -0,0 +1,327 @@
+package plugins
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/sink"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const coldhotTransfersBackfillCursorKey = "coldhot_transfers_backfill_cursor"
+
+// 冷热转账operation的状态和关联交易id, guard的属性名, 按顺序取第一个存在的
+type coldhotOpFields struct {
+	state          string
+	linkProps      []string
+	guardIdProps   []string
+	guardAddrProps []string
+}
+
+var coldhotOpFieldsOfOpType = map[string]*coldhotOpFields{
+	"coldhot_transfer_operation": {
+		state:          db.CrosschainStateRequested,
+		guardIdProps:   []string{"guard_id", "guard"},
+		guardAddrProps: []string{"addr", "guard_address"},
+	},
+	"coldhot_transfer_without_sign_operation": {
+		state:          db.CrosschainStateRequested,
+		linkProps:      []string{"coldhot_trx_id"},
+		guardIdProps:   []string{"miner_broadcast"},
+		guardAddrProps: []string{"miner_address"},
+	},
+	"coldhot_transfer_with_sign_operation": {
+		state:          db.CrosschainStateSigned,
+		linkProps:      []string{"coldhot_trx_id"},
+		guardIdProps:   []string{"sign_guard", "guard_id"},
+		guardAddrProps: []string{"guard_address"},
+	},
+	"coldhot_transfer_combine_sign_operation": {
+		state:          db.CrosschainStateCombined,
+		linkProps:      []string{"coldhot_transfer_trx_id", "coldhot_trx_id"},
+		guardIdProps:   []string{"miner_broadcast"},
+		guardAddrProps: []string{"miner_address"},
+	},
+	"eths_coldhot_guard_sign_final_operation": {
+		state:          db.CrosschainStateBroadcast,
+		linkProps:      []string{"combine_trx_id"},
+		guardIdProps:   []string{"guard_to_sign", "guard_id"},
+		guardAddrProps: []string{"guard_address"},
+	},
+	// 按链外交易id关联
+	"coldhot_transfer_result_operation": {
+		state:          db.CrosschainStateConfirmed,
+		guardIdProps:   []string{"miner_broadcast"},
+		guardAddrProps: []string{"miner_address"},
+	},
+	"coldhot_pass_combine_trx_operation": {
+		state:          db.CrosschainStateConfirmed,
+		linkProps:      []string{"pass_transaction_id"},
+		guardIdProps:   []string{"guard_id", "guard"},
+		guardAddrProps: []string{"guard_address"},
+	},
+	"coldhot_cancel_transafer_transaction_operation": {
+		state:          db.CrosschainStateCancelled,
+		linkProps:      []string{"trx_id"},
+		guardIdProps:   []string{"guard_id", "guard"},
+		guardAddrProps: []string{"guard_address"},
+	},
+	"coldhot_cancel_uncombined_trx_operaion": {
+		state:          db.CrosschainStateCancelled,
+		linkProps:      []string{"trx_id"},
+		guardIdProps:   []string{"guard_id", "guard"},
+		guardAddrProps: []string{"guard_address"},
+	},
+	"coldhot_cancel_combined_trx_operaion": {
+		state:          db.CrosschainStateFailed,
+		linkProps:      []string{"fail_trx_id", "trx_id"},
+		guardIdProps:   []string{"guard_id", "guard"},
+		guardAddrProps: []string{"guard_address"},
+	},
+	"eth_cancel_coldhot_fail_trx_operaion": {
+		state:          db.CrosschainStateFailed,
+		linkProps:      []string{"fail_trx_id", "fail_transaction_id"},
+		guardIdProps:   []string{"guard_id", "guard"},
+		guardAddrProps: []string{"guard_address"},
+	},
+}
+
+// 还没有合并签名的状态
+var coldhotUnsignedStates = []string{db.CrosschainStateRequested, db.CrosschainStateSigned}
+
+func coldhotOperationTypeNames() (result []string) {
+	for opTypeName := range coldhotOpFieldsOfOpType {
+		result = append(result, opTypeName)
+	}
+	return
+}
+
+// 把coldhot_transfer_*, coldhot_cancel_*和eths_coldhot的operation关联成coldhot_transfers, 每个operation记录到coldhot_transfer_events.
+// UnsignedAlertBlocks大于0时, 发起后这么多个块还没有合并签名的转账记录一次告警, 并发送coldhot_unsigned_alert记录到sink
+type ColdhotTransferPlugin struct {
+	UnsignedAlertBlocks uint32
+}
+
+func (plugin *ColdhotTransferPlugin) PluginName() string {
+	return "ColdhotTransferPlugin"
+}
+
+func (plugin *ColdhotTransferPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if _, ok := coldhotOpFieldsOfOpType[opTypeName]; !ok {
+		return
+	}
+	blockTime, err := time.Parse("2006-01-02T15:04:05", block.Timestamp)
+	if err != nil {
+		return
+	}
+	return applyColdhotOperation(uint32(block.BlockNumber), blockTime, txid, opNum, opTypeName, opJSON)
+}
+
+// 解析冷热转账operation, crosschainTrxId是合并签名或者eth最终签名中取到的链外交易id
+func coldhotEventOf(blockNum uint32, blockTime time.Time, txid string, opNum int, opTypeName string,
+	opJSON map[string]interface{}) (event *db.ColdhotTransferEventEntity, crosschainTrxId string, ok bool) {
+	fields, ok := coldhotOpFieldsOfOpType[opTypeName]
+	if !ok {
+		return
+	}
+	event = &db.ColdhotTransferEventEntity{
+		OpTypeName: opTypeName,
+		State:      fields.state,
+		GuardId:    firstStringPropOf(opJSON, fields.guardIdProps),
+		GuardAddr:  firstStringPropOf(opJSON, fields.guardAddrProps),
+		BlockNum:   blockNum,
+		BlockTime:  blockTime,
+		Txid:       txid,
+		OpNum:      opNum,
+	}
+	switch opTypeName {
+	case "coldhot_transfer_operation":
+		event.LinkId = txid
+	case "coldhot_transfer_result_operation":
+		event.LinkId = crosschainTrxIdOf(opJSON["coldhot_trx_original_chain"])
+	case "coldhot_transfer_combine_sign_operation":
+		event.LinkId = firstStringPropOf(opJSON, fields.linkProps)
+		// 能从合并后的交易中取到链外交易id时已经广播
+		crosschainTrxId = crosschainTrxIdOf(opJSON["coldhot_trx_original_chain"])
+		if len(crosschainTrxId) > 0 {
+			event.State = db.CrosschainStateBroadcast
+		}
+	case "eths_coldhot_guard_sign_final_operation":
+		event.LinkId = firstStringPropOf(opJSON, fields.linkProps)
+		crosschainTrxId = firstStringPropOf(opJSON, []string{"signed_crosschain_trx_id"})
+	default:
+		event.LinkId = firstStringPropOf(opJSON, fields.linkProps)
+	}
+	ok = len(event.LinkId) > 0
+	return
+}
+
+// 发起的operation没有扫描到(比如在提案中执行)时从without_sign开始记录
+func newColdhotTransferOf(event *db.ColdhotTransferEventEntity, opJSON map[string]interface{}) *db.ColdhotTransferEntity {
+	fromAddr, _ := mapGetString(opJSON, "multi_account_withdraw")
+	toAddr, _ := mapGetString(opJSON, "multi_account_deposit")
+	assetSymbol, _ := mapGetString(opJSON, "asset_symbol")
+	assetId, _ := mapGetString(opJSON, "asset_id")
+	transfer := &db.ColdhotTransferEntity{
+		State:           db.CrosschainStateRequested,
+		RequestTxid:     event.LinkId,
+		FromAddr:        fromAddr,
+		ToAddr:          toAddr,
+		AssetSymbol:     assetSymbol,
+		AssetId:         assetId,
+		Amount:          crosschainStringOf(opJSON["amount"]),
+		RequestBlockNum: event.BlockNum,
+		RequestTime:     event.BlockTime,
+		LastBlockNum:    event.BlockNum,
+		LastBlockTime:   event.BlockTime,
+	}
+	if event.OpTypeName == "coldhot_transfer_without_sign_operation" {
+		transfer.WithoutSignTxid = event.Txid
+	}
+	return transfer
+}
+
+// 把event应用到关联的transfer上, 已经结束的transfer不再修改, 返回是否修改了
+func applyColdhotEventTo(transfer *db.ColdhotTransferEntity, event *db.ColdhotTransferEventEntity, crosschainTrxId string) bool {
+	if isCrosschainStateFinished(transfer.State) {
+		return false
+	}
+	switch event.OpTypeName {
+	case "coldhot_transfer_without_sign_operation":
+		transfer.WithoutSignTxid = event.Txid
+	case "coldhot_transfer_with_sign_operation":
+		transfer.SignatureCount++
+	case "coldhot_transfer_combine_sign_operation":
+		transfer.CombineTxid = event.Txid
+	}
+	if len(crosschainTrxId) > 0 {
+		transfer.CrosschainTrxId = crosschainTrxId
+	}
+	if isCrosschainStateFinished(event.State) {
+		transfer.FinishTxid = event.Txid
+	}
+	if crosschainStateRanks[event.State] > crosschainStateRanks[transfer.State] {
+		transfer.State = event.State
+	}
+	transfer.LastBlockNum = event.BlockNum
+	transfer.LastBlockTime = event.BlockTime
+	return true
+}
+
+func applyColdhotOperation(blockNum uint32, blockTime time.Time, txid string, opNum int, opTypeName string,
+	opJSON map[string]interface{}) (err error) {
+	if _, ok := coldhotOpFieldsOfOpType[opTypeName]; !ok {
+		return
+	}
+	old, err := db.FindColdhotTransferEvent(txid, opNum)
+	if err != nil || old != nil {
+		return
+	}
+	event, crosschainTrxId, ok := coldhotEventOf(blockNum, blockTime, txid, opNum, opTypeName, opJSON)
+	if !ok {
+		logger.Println("can't decode " + opTypeName + " in tx " + txid)
+		return
+	}
+	transfers, err := db.ListColdhotTransfersOfLink(event.LinkId)
+	if err != nil {
+		return
+	}
+	var created *db.ColdhotTransferEntity
+	if len(transfers) < 1 {
+		if opTypeName == "coldhot_transfer_operation" || opTypeName == "coldhot_transfer_without_sign_operation" {
+			created = newColdhotTransferOf(event, opJSON)
+		} else {
+			logger.Println("no coldhot transfer of " + event.LinkId + " found for " + opTypeName + " in tx " + txid)
+		}
+	}
+	// 事件和transfer的修改一起提交, 避免中途失败后重新扫描时因为事件已保存而跳过transfer的修改
+	return db.RunInTx(func(exec db.Executor) (err error) {
+		err = db.SaveColdhotTransferEvent(exec, event)
+		if err != nil {
+			return
+		}
+		if created != nil {
+			return db.SaveColdhotTransfer(exec, created)
+		}
+		for _, transfer := range transfers {
+			if !applyColdhotEventTo(transfer, event, crosschainTrxId) {
+				continue
+			}
+			err = db.UpdateColdhotTransfer(exec, transfer)
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+}
+
+func coldhotUnsignedAlertRecord(blockNum uint32, transfer *db.ColdhotTransferEntity) *sink.Record {
+	return &sink.Record{Kind: sink.RecordKindColdhotUnsignedAlert, BlockNum: blockNum, Txid: transfer.RequestTxid,
+		Data: transfer}
+}
+
+func (plugin *ColdhotTransferPlugin) ApplyBlock(block *types.HxBlock) (err error) {
+	blockNum := uint32(block.BlockNumber)
+	if plugin.UnsignedAlertBlocks < 1 || blockNum <= plugin.UnsignedAlertBlocks {
+		return
+	}
+	transfers, err := db.ListColdhotTransfersToAlert(coldhotUnsignedStates, blockNum-plugin.UnsignedAlertBlocks)
+	if err != nil {
+		return
+	}
+	for _, transfer := range transfers {
+		transfer.UnsignedAlertBlockNum = blockNum
+	}
+	if len(transfers) > 0 {
+		err = db.RunInTx(func(exec db.Executor) (err error) {
+			for _, transfer := range transfers {
+				err = db.UpdateColdhotTransfer(exec, transfer)
+				if err != nil {
+					return
+				}
+			}
+			return
+		})
+		if err != nil {
+			return
+		}
+	}
+	for _, transfer := range transfers {
+		logger.Println("alert: coldhot transfer " + transfer.RequestTxid + " requested at block #" +
+			strconv.Itoa(int(transfer.RequestBlockNum)) + " still unsigned at block #" + strconv.Itoa(int(blockNum)) +
+			" with " + strconv.Itoa(transfer.SignatureCount) + " signatures")
+	}
+	for _, transfer := range transfers {
+		sink.Emit(coldhotUnsignedAlertRecord(blockNum, transfer))
+	}
+	return
+}
+
+// sink落后重放这个块时, 重新发送在这个块告警过的转账
+func (plugin *ColdhotTransferPlugin) ReplayBlockRecords(block *types.HxBlock) (err error) {
+	blockNum := uint32(block.BlockNumber)
+	if plugin.UnsignedAlertBlocks < 1 {
+		return
+	}
+	alerted, err := db.ListColdhotTransfersAlertedAt(blockNum)
+	if err != nil {
+		return
+	}
+	for _, transfer := range alerted {
+		sink.Emit(coldhotUnsignedAlertRecord(blockNum, transfer))
+	}
+	return
+}
+
+// 从operations表中已经保存的冷热转账operation按顺序回填coldhot_transfers, 进度保存在scan_configs中.
+// 回填时不检查未签名告警, 之后扫描新块时检查
+func BackfillColdhotTransfers(batchSize int) (count int, err error) {
+	return backfillOperations(coldhotTransfersBackfillCursorKey, coldhotOperationTypeNames(), batchSize,
+		func(op *backfillOperation) (bool, error) {
+			return true, applyColdhotOperation(uint32(op.BlockNum), op.BlockTime, op.Trxid, op.OpNum, op.OperationTypeName,
+				op.OpJSON)
+		})
+}
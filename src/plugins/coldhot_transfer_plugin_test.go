@@ -0,0 +1,131 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/sink"
+)
+
+func TestColdhotEventOf(t *testing.T) {
+	tests := []struct {
+		opTypeName          string
+		opJSON              string
+		wantOk              bool
+		wantLinkId          string
+		wantState           string
+		wantGuardId         string
+		wantCrosschainTrxId string
+	}{
+		{"coldhot_transfer_operation", `{"guard": "1.2.10", "addr": "` + testAddr1 + `", "amount": "1.5"}`,
+			true, "txid", db.CrosschainStateRequested, "1.2.10", ""},
+		{"coldhot_transfer_with_sign_operation", `{"coldhot_trx_id": "unsigned1", "sign_guard": "1.2.11"}`,
+			true, "unsigned1", db.CrosschainStateSigned, "1.2.11", ""},
+		{"coldhot_transfer_combine_sign_operation", `{"coldhot_transfer_trx_id": "unsigned1", "coldhot_trx_original_chain": {}}`,
+			true, "unsigned1", db.CrosschainStateCombined, "", ""},
+		// 能取到链外交易id时已经广播
+		{"coldhot_transfer_combine_sign_operation",
+			`{"coldhot_transfer_trx_id": "unsigned1", "coldhot_trx_original_chain": {"trx_id": "btctx1"}}`,
+			true, "unsigned1", db.CrosschainStateBroadcast, "", "btctx1"},
+		{"eths_coldhot_guard_sign_final_operation", `{"combine_trx_id": "combine1", "signed_crosschain_trx_id": "0xabc"}`,
+			true, "combine1", db.CrosschainStateBroadcast, "", "0xabc"},
+		{"eths_coldhot_guard_sign_final_operation", `{"combine_trx_id": "combine1", "guard_to_sign": "1.2.13"}`,
+			true, "combine1", db.CrosschainStateBroadcast, "1.2.13", ""},
+		{"coldhot_transfer_result_operation", `{"coldhot_trx_original_chain": {"trx": {"hash": "0xabc"}}}`,
+			true, "0xabc", db.CrosschainStateConfirmed, "", ""},
+		{"coldhot_cancel_combined_trx_operaion", `{"fail_trx_id": "combine1", "guard": "1.2.12"}`,
+			true, "combine1", db.CrosschainStateFailed, "1.2.12", ""},
+		{"coldhot_transfer_with_sign_operation", `{"sign_guard": "1.2.11"}`, false, "", "", "", ""},
+		{"transfer_operation", `{}`, false, "", "", "", ""},
+	}
+	for _, test := range tests {
+		event, crosschainTrxId, ok := coldhotEventOf(100, time.Unix(1560000000, 0), "txid", 0, test.opTypeName,
+			mustDecodeOpJSON(t, test.opJSON))
+		if ok != test.wantOk {
+			t.Errorf("%s %s: ok = %v, want %v", test.opTypeName, test.opJSON, ok, test.wantOk)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if event.LinkId != test.wantLinkId || event.State != test.wantState || event.GuardId != test.wantGuardId ||
+			crosschainTrxId != test.wantCrosschainTrxId {
+			t.Errorf("%s %s: got link %s state %s guard %s trx %s, want %s %s %s %s", test.opTypeName, test.opJSON,
+				event.LinkId, event.State, event.GuardId, crosschainTrxId, test.wantLinkId, test.wantState, test.wantGuardId,
+				test.wantCrosschainTrxId)
+		}
+	}
+}
+
+func TestNewColdhotTransferOf(t *testing.T) {
+	opJSON := mustDecodeOpJSON(t, `{"coldhot_trx_id": "request1", "multi_account_withdraw": "HXCold", "multi_account_deposit": "HXHot",`+
+		` "asset_symbol": "BTC", "asset_id": "1.3.1", "amount": "2.5"}`)
+	event, _, ok := coldhotEventOf(100, time.Unix(1560000000, 0), "txid", 0, "coldhot_transfer_without_sign_operation", opJSON)
+	if !ok {
+		t.Fatalf("can't decode without_sign operation")
+	}
+	transfer := newColdhotTransferOf(event, opJSON)
+	if transfer.State != db.CrosschainStateRequested || transfer.RequestTxid != "request1" || transfer.WithoutSignTxid != "txid" ||
+		transfer.FromAddr != "HXCold" || transfer.ToAddr != "HXHot" || transfer.Amount != "2.5" || transfer.RequestBlockNum != 100 {
+		t.Errorf("unexpected transfer %+v", *transfer)
+	}
+}
+
+func TestApplyColdhotEventTo(t *testing.T) {
+	tests := []struct {
+		name               string
+		transferState      string
+		opTypeName         string
+		opJSON             string
+		wantChanged        bool
+		wantState          string
+		wantSignatureCount int
+		wantCombineTxid    string
+		wantFinishTxid     string
+	}{
+		{"sign", db.CrosschainStateRequested, "coldhot_transfer_with_sign_operation", `{"coldhot_trx_id": "unsigned1"}`,
+			true, db.CrosschainStateSigned, 2, "", ""},
+		{"combine", db.CrosschainStateSigned, "coldhot_transfer_combine_sign_operation",
+			`{"coldhot_transfer_trx_id": "unsigned1"}`, true, db.CrosschainStateCombined, 1, "txid", ""},
+		// 状态不能后退
+		{"late sign", db.CrosschainStateBroadcast, "coldhot_transfer_with_sign_operation", `{"coldhot_trx_id": "unsigned1"}`,
+			true, db.CrosschainStateBroadcast, 2, "", ""},
+		{"pass", db.CrosschainStateBroadcast, "coldhot_pass_combine_trx_operation", `{"pass_transaction_id": "combine1"}`,
+			true, db.CrosschainStateConfirmed, 1, "", "txid"},
+		{"cancel", db.CrosschainStateSigned, "coldhot_cancel_uncombined_trx_operaion", `{"trx_id": "unsigned1"}`,
+			true, db.CrosschainStateCancelled, 1, "", "txid"},
+		// 结束后不再修改
+		{"finished", db.CrosschainStateCancelled, "coldhot_transfer_with_sign_operation", `{"coldhot_trx_id": "unsigned1"}`,
+			false, db.CrosschainStateCancelled, 1, "", ""},
+	}
+	for _, test := range tests {
+		event, crosschainTrxId, ok := coldhotEventOf(100, time.Unix(1560000000, 0), "txid", 0, test.opTypeName,
+			mustDecodeOpJSON(t, test.opJSON))
+		if !ok {
+			t.Errorf("%s: can't decode %s", test.name, test.opJSON)
+			continue
+		}
+		transfer := &db.ColdhotTransferEntity{State: test.transferState, SignatureCount: 1, LastBlockNum: 50}
+		changed := applyColdhotEventTo(transfer, event, crosschainTrxId)
+		if changed != test.wantChanged || transfer.State != test.wantState || transfer.SignatureCount != test.wantSignatureCount ||
+			transfer.CombineTxid != test.wantCombineTxid || transfer.FinishTxid != test.wantFinishTxid {
+			t.Errorf("%s: got changed %v state %s signatures %d combine %q finish %q, want %v %s %d %q %q", test.name, changed,
+				transfer.State, transfer.SignatureCount, transfer.CombineTxid, transfer.FinishTxid, test.wantChanged,
+				test.wantState, test.wantSignatureCount, test.wantCombineTxid, test.wantFinishTxid)
+		}
+		if changed && transfer.LastBlockNum != 100 {
+			t.Errorf("%s: last block %d, want 100", test.name, transfer.LastBlockNum)
+		}
+	}
+}
+
+func TestColdhotUnsignedAlertRecord(t *testing.T) {
+	transfer := &db.ColdhotTransferEntity{Id: 3, State: db.CrosschainStateSigned, RequestTxid: "request1", RequestBlockNum: 100,
+		UnsignedAlertBlockNum: 900}
+	record := coldhotUnsignedAlertRecord(900, transfer)
+	if record.Kind != sink.RecordKindColdhotUnsignedAlert || record.BlockNum != 900 || record.Txid != "request1" ||
+		record.Data != transfer {
+		t.Errorf("unexpected alert record %+v", *record)
+	}
+}
@@ -0,0 +1,188 @@
+package plugins
+
+import (
+	"math/big"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+// 解析receipt中的contract_withdraw, deposit_contract, contract_balances记录到contract_balance_changes, 并更新合约持有的资产contract_balances
+type ContractBalancePlugin struct {
+}
+
+func (plugin *ContractBalancePlugin) PluginName() string {
+	return "ContractBalancePlugin"
+}
+
+type contractAssetAmount struct {
+	ContractId string
+	AssetId    string
+	Amount     *big.Int
+}
+
+// receipt中的map序列化为 [[[contractAddr, assetId], amount], ...]
+func contractAssetAmountsOf(items []interface{}) (result []*contractAssetAmount) {
+	for _, item := range items {
+		changeItem, ok := item.([]interface{})
+		if !ok || len(changeItem) < 2 {
+			continue
+		}
+		contractAssetPair, ok := changeItem[0].([]interface{})
+		if !ok || len(contractAssetPair) < 2 {
+			continue
+		}
+		contractId, _ := contractAssetPair[0].(string)
+		assetId, _ := contractAssetPair[1].(string)
+		amount, ok := objToBigInt(changeItem[1])
+		if !ok || len(contractId) < 1 || len(assetId) < 1 {
+			continue
+		}
+		result = append(result, &contractAssetAmount{ContractId: contractId, AssetId: assetId, Amount: amount})
+	}
+	return
+}
+
+func contractBalanceChangesOf(blockNum uint32, txid string, opNum int, opTypeName string, opJSON map[string]interface{},
+	receipt *types.HxContractOpReceipt) (result []*db.ContractBalanceChangeEntity) {
+	add := func(item *contractAssetAmount, amount *big.Int, changeType string, changeIndex int) {
+		result = append(result, &db.ContractBalanceChangeEntity{
+			ContractId:  item.ContractId,
+			AssetId:     item.AssetId,
+			Amount:      amount,
+			ChangeType:  changeType,
+			BlockNum:    blockNum,
+			Txid:        txid,
+			OpNum:       opNum,
+			ChangeIndex: changeIndex,
+		})
+	}
+	for i, item := range contractAssetAmountsOf(receipt.ContractWithdrawInfo) {
+		add(item, new(big.Int).Neg(item.Amount), db.ContractBalanceChangeWithdraw, i)
+	}
+	deposits := contractAssetAmountsOf(receipt.DepositToContractChanges)
+	for i, item := range deposits {
+		add(item, item.Amount, db.ContractBalanceChangeDeposit, i)
+	}
+	if opTypeName == "transfer_contract_operation" {
+		contractId, _ := mapGetString(opJSON, "contract_id")
+		amount, assetId, ok := amountAndAssetOf(opJSON["amount"])
+		if ok && len(contractId) > 0 && amount.Sign() > 0 {
+			inDeposits := false
+			for _, deposit := range deposits {
+				if deposit.ContractId == contractId && deposit.AssetId == assetId {
+					inDeposits = true
+					break
+				}
+			}
+			if !inDeposits {
+				add(&contractAssetAmount{ContractId: contractId, AssetId: assetId}, amount, db.ContractBalanceChangeTransferIn, 0)
+			}
+		}
+	}
+	for i, item := range contractAssetAmountsOf(receipt.ContractBalanceChanges) {
+		add(item, item.Amount, db.ContractBalanceChangeBalance, i)
+	}
+	return
+}
+
+// contract_balances中有合约执行后的余额时直接使用, 否则在原余额上加上变化量.
+// 返回要保存(Id为0)或更新的余额, 只读取不写入, 以便和变化记录在同一个事务中保存
+func contractBalancesAfterChanges(blockNum uint32, changes []*db.ContractBalanceChangeEntity) (result []*db.ContractBalanceEntity, err error) {
+	type contractAssetKey struct {
+		contractId string
+		assetId    string
+	}
+	keys := make([]contractAssetKey, 0)
+	deltas := make(map[contractAssetKey]*big.Int)
+	balances := make(map[contractAssetKey]*big.Int)
+	for _, change := range changes {
+		key := contractAssetKey{change.ContractId, change.AssetId}
+		if _, ok := deltas[key]; !ok {
+			keys = append(keys, key)
+			deltas[key] = big.NewInt(0)
+		}
+		if change.ChangeType == db.ContractBalanceChangeBalance {
+			balances[key] = change.Amount
+		} else {
+			deltas[key].Add(deltas[key], change.Amount)
+		}
+	}
+	for _, key := range keys {
+		var balance *db.ContractBalanceEntity
+		balance, err = db.FindContractBalance(key.contractId, key.assetId)
+		if err != nil {
+			return
+		}
+		newAmount, ok := balances[key]
+		if !ok {
+			newAmount = new(big.Int).Set(deltas[key])
+			if balance != nil {
+				newAmount.Add(newAmount, balance.Amount)
+			}
+		}
+		if balance == nil {
+			result = append(result, &db.ContractBalanceEntity{
+				ContractId: key.contractId,
+				AssetId:    key.assetId,
+				Amount:     newAmount,
+				BlockNum:   blockNum,
+			})
+		} else if balance.BlockNum <= blockNum {
+			balance.Amount = newAmount
+			balance.BlockNum = blockNum
+			result = append(result, balance)
+		}
+	}
+	return
+}
+
+func (plugin *ContractBalancePlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if receipt == nil || !receipt.ExecSucceed {
+		return
+	}
+	blockNum := uint32(block.BlockNumber)
+	changes := contractBalanceChangesOf(blockNum, txid, opNum, opTypeName, opJSON, receipt)
+	newChanges := make([]*db.ContractBalanceChangeEntity, 0, len(changes))
+	for _, change := range changes {
+		var old *db.ContractBalanceChangeEntity
+		old, err = db.FindContractBalanceChange(txid, opNum, change.ContractId, change.AssetId, change.ChangeType,
+			change.ChangeIndex)
+		if err != nil {
+			return
+		}
+		if old != nil {
+			continue
+		}
+		newChanges = append(newChanges, change)
+	}
+	if len(newChanges) < 1 {
+		return
+	}
+	// 重新扫描已经处理过的operation时不重复计算余额
+	balances, err := contractBalancesAfterChanges(blockNum, newChanges)
+	if err != nil {
+		return
+	}
+	// 变化记录和余额一起提交, 避免中途失败后重新扫描时跳过已保存的变化记录而漏算余额
+	return db.RunInTx(func(exec db.Executor) (err error) {
+		for _, change := range newChanges {
+			err = db.SaveContractBalanceChange(exec, change)
+			if err != nil {
+				return
+			}
+		}
+		for _, balance := range balances {
+			if balance.Id == 0 {
+				err = db.SaveContractBalance(exec, balance)
+			} else {
+				err = db.UpdateContractBalance(exec, balance)
+			}
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+}
@@ -0,0 +1,84 @@
+package plugins
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/blocklink/hxscanner/src/db"
+)
+
+func contractBalanceChangeStrings(changes []*db.ContractBalanceChangeEntity) []string {
+	result := make([]string, 0, len(changes))
+	for _, change := range changes {
+		result = append(result, change.ContractId+" "+change.AssetId+" "+change.Amount.String()+" "+change.ChangeType+" "+
+			strconv.Itoa(change.ChangeIndex))
+	}
+	return result
+}
+
+func TestContractBalanceChangesOf(t *testing.T) {
+	tests := []struct {
+		name       string
+		opTypeName string
+		opJSON     string
+		receipt    string
+		want       []string
+	}{
+		{
+			name:       "withdraw and balances",
+			opTypeName: "contract_invoke_operation",
+			opJSON:     `{"contract_id": "HXCcontract1"}`,
+			receipt: `{"exec_succeed": true, "contract_withdraw": [[["HXCcontract1", "1.3.0"], 300], [["HXCcontract1", "1.3.1"], 2]],` +
+				` "contract_balances": [[["HXCcontract1", "1.3.0"], 700]]}`,
+			want: []string{
+				"HXCcontract1 1.3.0 -300 withdraw 0",
+				"HXCcontract1 1.3.1 -2 withdraw 1",
+				"HXCcontract1 1.3.0 700 balance 0",
+			},
+		},
+		{
+			name:       "transfer to contract already in deposits",
+			opTypeName: "transfer_contract_operation",
+			opJSON:     `{"contract_id": "HXCcontract1", "amount": {"amount": 500, "asset_id": "1.3.0"}}`,
+			receipt:    `{"exec_succeed": true, "deposit_contract": [[["HXCcontract1", "1.3.0"], 500]]}`,
+			want: []string{
+				"HXCcontract1 1.3.0 500 deposit 0",
+			},
+		},
+		{
+			name:       "transfer to contract without deposits",
+			opTypeName: "transfer_contract_operation",
+			opJSON:     `{"contract_id": "HXCcontract1", "amount": {"amount": 123456789012345678901, "asset_id": "1.3.0"}}`,
+			receipt:    `{"exec_succeed": true}`,
+			want: []string{
+				"HXCcontract1 1.3.0 123456789012345678901 transfer_in 0",
+			},
+		},
+		{
+			name:       "zero transfer to contract",
+			opTypeName: "transfer_contract_operation",
+			opJSON:     `{"contract_id": "HXCcontract1", "amount": {"amount": 0, "asset_id": "1.3.0"}}`,
+			receipt:    `{"exec_succeed": true}`,
+			want:       []string{},
+		},
+		{
+			name:       "deposit to other contract",
+			opTypeName: "contract_invoke_operation",
+			opJSON:     `{"contract_id": "HXCcontract1"}`,
+			receipt: `{"exec_succeed": true, "contract_withdraw": [[["HXCcontract1", "1.3.0"], 10]],` +
+				` "deposit_contract": [[["HXCcontract2", "1.3.0"], 10], ["bad item"]]}`,
+			want: []string{
+				"HXCcontract1 1.3.0 -10 withdraw 0",
+				"HXCcontract2 1.3.0 10 deposit 0",
+			},
+		},
+	}
+	for _, test := range tests {
+		changes := contractBalanceChangesOf(100, "txid", 0, test.opTypeName, mustDecodeOpJSON(t, test.opJSON),
+			mustDecodeReceipt(t, test.receipt))
+		if got := contractBalanceChangeStrings(changes); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package plugins
+
+import (
+	"errors"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const contractCallsBackfillCursorKey = "contract_calls_backfill_cursor"
+
+var contractCallOperationTypeNames = []string{"contract_invoke_operation"}
+
+// 把contract_invoke_operation和它的receipt一起记录到contract_calls, 用于按合约统计调用
+type ContractCallPlugin struct {
+}
+
+func (plugin *ContractCallPlugin) PluginName() string {
+	return "ContractCallPlugin"
+}
+
+func contractCallOf(blockNum uint32, blockTimestamp string, txid string, opNum int, opJSON map[string]interface{},
+	receipt *types.HxContractOpReceipt) (result *db.ContractCallEntity, err error) {
+	blockTime, err := time.Parse("2006-01-02T15:04:05", blockTimestamp)
+	if err != nil {
+		return
+	}
+	contractId, _ := mapGetString(opJSON, "contract_id")
+	contractApi, _ := mapGetString(opJSON, "contract_api")
+	if len(contractId) < 1 || len(contractApi) < 1 {
+		err = errors.New("contract_id or contract_api not found in contract invoke operation")
+		return
+	}
+	contractArg, _ := mapGetString(opJSON, "contract_arg")
+	callerAddr, _ := mapGetString(opJSON, "caller_addr")
+	gasLimit, _ := getIntPropFromJSONObj(opJSON, "invoke_cost")
+	gasPrice, _ := getIntPropFromJSONObj(opJSON, "gas_price")
+	return &db.ContractCallEntity{
+		ContractId:  contractId,
+		ContractApi: contractApi,
+		ContractArg: contractArg,
+		CallerAddr:  callerAddr,
+		GasLimit:    gasLimit,
+		GasPrice:    gasPrice,
+		ActualFee:   int64(receipt.ActualFee),
+		ExecSucceed: receipt.ExecSucceed,
+		ApiResult:   receipt.ApiResult,
+		BlockNum:    blockNum,
+		BlockTime:   blockTime,
+		Txid:        txid,
+		OpNum:       opNum,
+	}, nil
+}
+
+func saveContractCallIfNew(call *db.ContractCallEntity) (err error) {
+	old, err := db.FindContractCall(call.Txid, call.OpNum)
+	if err != nil || old != nil {
+		return
+	}
+	return db.SaveContractCall(call)
+}
+
+func (plugin *ContractCallPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if !isStringInArray(opTypeName, contractCallOperationTypeNames) {
+		return
+	}
+	if receipt == nil {
+		logger.Println("receipt of contract invoke operation not found in tx " + txid)
+		return
+	}
+	call, err := contractCallOf(uint32(block.BlockNumber), block.Timestamp, txid, opNum, opJSON, receipt)
+	if err != nil {
+		logger.Println("decode contract invoke operation in tx "+txid+" error", err)
+		return nil
+	}
+	return saveContractCallIfNew(call)
+}
+
+// 从operations和contract_operation_receipt回填contract_calls, 进度保存在scan_configs中
+func BackfillContractCalls(batchSize int) (count int, err error) {
+	return backfillOperations(contractCallsBackfillCursorKey, contractCallOperationTypeNames, batchSize,
+		func(op *backfillOperation) (bool, error) {
+			if op.Receipt == nil {
+				return false, nil
+			}
+			call, decodeErr := contractCallOf(uint32(op.BlockNum), op.BlockTimestamp, op.Trxid, op.OpNum, op.OpJSON, op.Receipt)
+			if decodeErr != nil {
+				logger.Println("decode contract invoke operation in tx "+op.Trxid+" error", decodeErr)
+				return false, nil
+			}
+			return true, saveContractCallIfNew(call)
+		})
+}
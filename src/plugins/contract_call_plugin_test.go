@@ -0,0 +1,86 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+)
+
+func TestContractCallOf(t *testing.T) {
+	tests := []struct {
+		name           string
+		blockTimestamp string
+		opJSON         string
+		receipt        string
+		wantErr        bool
+		want           db.ContractCallEntity
+	}{
+		{
+			name:           "succeed",
+			blockTimestamp: "2019-06-08T13:20:00",
+			opJSON: `{"caller_addr": "` + testAddr1 + `", "contract_id": "HXCcontract", "contract_api": "transfer",` +
+				` "contract_arg": "` + testAddr2 + `,100", "invoke_cost": 5000, "gas_price": 10}`,
+			receipt: `{"exec_succeed": true, "acctual_fee": 3000, "api_result": "ok"}`,
+			want: db.ContractCallEntity{ContractId: "HXCcontract", ContractApi: "transfer", ContractArg: testAddr2 + ",100",
+				CallerAddr: testAddr1, GasLimit: 5000, GasPrice: 10, ActualFee: 3000, ExecSucceed: true, ApiResult: "ok"},
+		},
+		{
+			name:           "failed receipt is still recorded",
+			blockTimestamp: "2019-06-08T13:20:00",
+			opJSON: `{"caller_addr": "` + testAddr1 + `", "contract_id": "HXCcontract", "contract_api": "transfer",` +
+				` "invoke_cost": 5000, "gas_price": 10}`,
+			receipt: `{"exec_succeed": false, "acctual_fee": 5000, "api_result": ""}`,
+			want: db.ContractCallEntity{ContractId: "HXCcontract", ContractApi: "transfer", CallerAddr: testAddr1,
+				GasLimit: 5000, GasPrice: 10, ActualFee: 5000, ExecSucceed: false},
+		},
+		{
+			name:           "missing gas fields",
+			blockTimestamp: "2019-06-08T13:20:00",
+			opJSON:         `{"caller_addr": "` + testAddr1 + `", "contract_id": "HXCcontract", "contract_api": "init"}`,
+			receipt:        `{"exec_succeed": true, "acctual_fee": 100}`,
+			want: db.ContractCallEntity{ContractId: "HXCcontract", ContractApi: "init", CallerAddr: testAddr1, ActualFee: 100,
+				ExecSucceed: true},
+		},
+		{
+			name:           "missing contract_api",
+			blockTimestamp: "2019-06-08T13:20:00",
+			opJSON:         `{"caller_addr": "` + testAddr1 + `", "contract_id": "HXCcontract"}`,
+			receipt:        `{"exec_succeed": true}`,
+			wantErr:        true,
+		},
+		{
+			name:           "missing contract_id",
+			blockTimestamp: "2019-06-08T13:20:00",
+			opJSON:         `{"caller_addr": "` + testAddr1 + `", "contract_api": "transfer"}`,
+			receipt:        `{"exec_succeed": true}`,
+			wantErr:        true,
+		},
+		{
+			name:           "invalid block time",
+			blockTimestamp: "not a time",
+			opJSON:         `{"caller_addr": "` + testAddr1 + `", "contract_id": "HXCcontract", "contract_api": "transfer"}`,
+			receipt:        `{"exec_succeed": true}`,
+			wantErr:        true,
+		},
+	}
+	for _, test := range tests {
+		call, err := contractCallOf(100, test.blockTimestamp, "txid", 1, mustDecodeOpJSON(t, test.opJSON),
+			mustDecodeReceipt(t, test.receipt))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, want error %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		want := test.want
+		if call.ContractId != want.ContractId || call.ContractApi != want.ContractApi || call.ContractArg != want.ContractArg ||
+			call.CallerAddr != want.CallerAddr || call.GasLimit != want.GasLimit || call.GasPrice != want.GasPrice ||
+			call.ActualFee != want.ActualFee || call.ExecSucceed != want.ExecSucceed || call.ApiResult != want.ApiResult ||
+			call.BlockNum != 100 || !call.BlockTime.Equal(time.Date(2019, 6, 8, 13, 20, 0, 0, time.UTC)) ||
+			call.Txid != "txid" || call.OpNum != 1 {
+			t.Errorf("%s: got %+v, want %+v", test.name, *call, want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package plugins
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/blocklink/hxscanner/src/db"
+)
+
+// 管理员整理的token元数据, 为nil的字段不修改
+type CuratedContractMetadata struct {
+	ContractId  string  `json:"contract_id"`
+	Logo        *string `json:"logo"`
+	Url         *string `json:"url"`
+	Description *string `json:"description"`
+}
+
+// 签名的元数据文件. signature是signer(ed25519公钥)对压缩后的metadata json的签名, 都是hex
+type SignedContractMetadataFile struct {
+	Metadata  json.RawMessage `json:"metadata"`
+	Signer    string          `json:"signer"`
+	Signature string          `json:"signature"`
+}
+
+func GenerateMetadataSigningKey() (publicKeyHex string, privateKeyHex string, err error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	return hex.EncodeToString(publicKey), hex.EncodeToString(privateKey), nil
+}
+
+func decodeCuratedContractMetadata(metadataJSON []byte) (items []*CuratedContractMetadata, err error) {
+	err = json.Unmarshal(metadataJSON, &items)
+	if err != nil {
+		return
+	}
+	for _, item := range items {
+		if item == nil || len(item.ContractId) < 1 {
+			err = errors.New("contract_id required in every metadata item")
+			return
+		}
+	}
+	return
+}
+
+// 用hex格式的ed25519私钥签名元数据数组, 返回签名后的文件内容
+func SignContractMetadata(privateKeyHex string, metadataJSON []byte) (signedJSON []byte, err error) {
+	privateKeyBytes, err := hex.DecodeString(strings.TrimSpace(privateKeyHex))
+	if err != nil {
+		return
+	}
+	if len(privateKeyBytes) != ed25519.PrivateKeySize {
+		err = errors.New("invalid ed25519 private key")
+		return
+	}
+	_, err = decodeCuratedContractMetadata(metadataJSON)
+	if err != nil {
+		return
+	}
+	compacted := new(bytes.Buffer)
+	err = json.Compact(compacted, metadataJSON)
+	if err != nil {
+		return
+	}
+	privateKey := ed25519.PrivateKey(privateKeyBytes)
+	signature := ed25519.Sign(privateKey, compacted.Bytes())
+	return json.MarshalIndent(&SignedContractMetadataFile{
+		Metadata:  compacted.Bytes(),
+		Signer:    hex.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+		Signature: hex.EncodeToString(signature),
+	}, "", "  ")
+}
+
+// 检查签名者在trustedSigners中并且签名正确
+func VerifyContractMetadataFile(fileBytes []byte, trustedSigners []string) (items []*CuratedContractMetadata, signer string, err error) {
+	var signedFile SignedContractMetadataFile
+	err = json.Unmarshal(fileBytes, &signedFile)
+	if err != nil {
+		return
+	}
+	signer = strings.ToLower(signedFile.Signer)
+	if !isStringInArray(signer, trustedSigners) {
+		err = errors.New("metadata signer " + signedFile.Signer + " not trusted")
+		return
+	}
+	publicKey, err := hex.DecodeString(signer)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		err = errors.New("invalid metadata signer public key")
+		return
+	}
+	signature, err := hex.DecodeString(signedFile.Signature)
+	if err != nil {
+		return
+	}
+	compacted := new(bytes.Buffer)
+	err = json.Compact(compacted, signedFile.Metadata)
+	if err != nil {
+		return
+	}
+	if !ed25519.Verify(publicKey, compacted.Bytes(), signature) {
+		err = errors.New("invalid metadata signature")
+		return
+	}
+	items, err = decodeCuratedContractMetadata(compacted.Bytes())
+	return
+}
+
+// 验证签名后在一个事务中把元数据写入token_contract, 并记录到contract_metadata_changes. 有合约不存在或写入失败时不修改任何数据
+func ImportContractMetadata(fileBytes []byte, trustedSigners []string) (count int, err error) {
+	items, signer, err := VerifyContractMetadataFile(fileBytes, trustedSigners)
+	if err != nil {
+		return
+	}
+	tokenContracts := make([]*db.TokenContractEntity, 0, len(items))
+	for _, item := range items {
+		var tokenContract *db.TokenContractEntity
+		tokenContract, err = db.FindTokenContractByContractId(item.ContractId)
+		if err != nil {
+			return
+		}
+		if tokenContract == nil {
+			err = errors.New("token contract " + item.ContractId + " not found")
+			return
+		}
+		tokenContracts = append(tokenContracts, tokenContract)
+	}
+	err = db.RunInTx(func(exec db.Executor) error {
+		for i, item := range items {
+			tokenContract := tokenContracts[i]
+			if item.Logo != nil {
+				tokenContract.Logo = item.Logo
+			}
+			if item.Url != nil {
+				tokenContract.Url = item.Url
+			}
+			if item.Description != nil {
+				tokenContract.Description = item.Description
+			}
+			err := db.UpdateTokenContractInTx(exec, tokenContract)
+			if err != nil {
+				return err
+			}
+			err = db.SaveContractMetadataChange(exec, &db.ContractMetadataChangeEntity{
+				ContractId:  item.ContractId,
+				Source:      db.ContractMetadataSourceCurated,
+				Description: item.Description,
+				Logo:        item.Logo,
+				Url:         item.Url,
+				Signer:      signer,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	count = len(items)
+	return
+}
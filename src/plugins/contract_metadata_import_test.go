@@ -0,0 +1,87 @@
+package plugins
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestVerifyContractMetadataFile(t *testing.T) {
+	publicKey, privateKey, err := GenerateMetadataSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublicKey, otherPrivateKey, err := GenerateMetadataSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := `[{"contract_id": "HXCtoken", "logo": "https://example.com/logo.png",  "description": "a token"}]`
+	signed, err := SignContractMetadata(privateKey, []byte(metadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedByOther, err := SignContractMetadata(otherPrivateKey, []byte(metadata))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 签名后修改内容
+	var tamperedFile SignedContractMetadataFile
+	err = json.Unmarshal(signed, &tamperedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedFile.Metadata = json.RawMessage(strings.Replace(string(tamperedFile.Metadata), "a token", "a scam", 1))
+	tampered, err := json.Marshal(&tamperedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只是格式不同, 压缩后相同的metadata签名仍然有效
+	reformatted := []byte(`{"metadata": ` + strings.Replace(metadata, ",", ",\n  ", -1) + `, "signer": "` +
+		tamperedFile.Signer + `", "signature": "` + tamperedFile.Signature + `"}`)
+
+	tests := []struct {
+		name           string
+		file           []byte
+		trustedSigners []string
+		wantErr        bool
+	}{
+		{"signed by trusted signer", signed, []string{publicKey}, false},
+		{"reformatted metadata", reformatted, []string{otherPublicKey, publicKey}, false},
+		{"untrusted signer", signedByOther, []string{publicKey}, true},
+		{"no trusted signers", signed, nil, true},
+		{"tampered metadata", tampered, []string{publicKey}, true},
+		{"not json", []byte("not json"), []string{publicKey}, true},
+	}
+	for _, test := range tests {
+		items, signer, err := VerifyContractMetadataFile(test.file, test.trustedSigners)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%s: should fail", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err.Error())
+			continue
+		}
+		if signer != publicKey || len(items) != 1 || items[0].ContractId != "HXCtoken" || items[0].Url != nil ||
+			items[0].Description == nil || *items[0].Description != "a token" {
+			t.Errorf("%s: unexpected result signer %s items %v", test.name, signer, items)
+		}
+	}
+}
+
+func TestSignContractMetadataRejectsInvalidMetadata(t *testing.T) {
+	_, privateKey, err := GenerateMetadataSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, metadata := range []string{`[{"logo": "x"}]`, `{"contract_id": "HXCtoken"}`, `[null]`} {
+		if _, err := SignContractMetadata(privateKey, []byte(metadata)); err == nil {
+			t.Errorf("SignContractMetadata(%s) should fail", metadata)
+		}
+	}
+	if _, err := SignContractMetadata("abcd", []byte(`[]`)); err == nil {
+		t.Errorf("SignContractMetadata with invalid private key should fail")
+	}
+}
@@ -0,0 +1,112 @@
+package plugins
+
+import (
+	"encoding/json"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const contractsBackfillCursorKey = "contracts_backfill_cursor"
+
+var contractRegisterOperationTypeNames = []string{"contract_register_operation", "native_contract_register_operation"}
+
+// 从注册合约的operation生成contracts表记录, 不是注册合约的operation返回nil
+func contractEntityOf(blockNum uint32, txid string, opTypeName string, opJSON map[string]interface{}) (result *db.ContractEntity, err error) {
+	switch opTypeName {
+	case "contract_register_operation":
+		var contractOp *contractRegisterOperation
+		contractOp, err = decodeContractRegisterOperation(opJSON)
+		if err != nil {
+			return
+		}
+		var storagePropertiesJSON []byte
+		if contractOp.StorageProperties != nil {
+			storagePropertiesJSON, err = json.Marshal(contractOp.StorageProperties)
+			if err != nil {
+				return
+			}
+		}
+		result = &db.ContractEntity{
+			ContractId:        contractOp.ContractId,
+			ContractType:      db.ContractTypeLua,
+			OwnerAddr:         contractOp.OwnerAddr,
+			OwnerPubkey:       contractOp.OwnerPubKey,
+			InheritFrom:       contractOp.InheritFrom,
+			Abi:               contractOp.Abi,
+			OfflineAbi:        contractOp.OfflineAbi,
+			Events:            contractOp.Events,
+			StorageProperties: storagePropertiesJSON,
+			CodeHash:          contractOp.CodeHash,
+			GasPrice:          contractOp.GasPrice,
+			GasLimit:          contractOp.GasLimit,
+			BlockNum:          blockNum,
+			Txid:              txid,
+			RegisterTime:      contractOp.RegisterTime,
+		}
+	case "native_contract_register_operation":
+		var nativeOp *nativeContractRegisterOperation
+		nativeOp, err = decodeNativeContractRegisterOperation(opJSON)
+		if err != nil {
+			return
+		}
+		result = &db.ContractEntity{
+			ContractId:        nativeOp.ContractId,
+			ContractType:      db.ContractTypeNative,
+			NativeContractKey: nativeOp.NativeContractKey,
+			OwnerAddr:         nativeOp.OwnerAddr,
+			OwnerPubkey:       nativeOp.OwnerPubKey,
+			GasPrice:          nativeOp.GasPrice,
+			GasLimit:          nativeOp.GasLimit,
+			BlockNum:          blockNum,
+			Txid:              txid,
+			RegisterTime:      nativeOp.RegisterTime,
+		}
+	}
+	return
+}
+
+func saveContractIfNew(contract *db.ContractEntity) (err error) {
+	old, err := db.FindContract(contract.ContractId)
+	if err != nil || old != nil {
+		return
+	}
+	return db.SaveContract(contract)
+}
+
+// 记录所有注册成功的合约(包括不是token的合约)到contracts
+type ContractRegistryPlugin struct {
+}
+
+func (plugin *ContractRegistryPlugin) PluginName() string {
+	return "ContractRegistryPlugin"
+}
+
+func (plugin *ContractRegistryPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if !isStringInArray(opTypeName, contractRegisterOperationTypeNames) || receipt == nil || !receipt.ExecSucceed {
+		return
+	}
+	contract, err := contractEntityOf(uint32(block.BlockNumber), txid, opTypeName, opJSON)
+	if err != nil {
+		logger.Println("decode contract register operation in tx "+txid+" error", err)
+		return nil
+	}
+	return saveContractIfNew(contract)
+}
+
+// 从operations表中已经保存的注册合约operation回填contracts, 进度保存在scan_configs中
+func BackfillContracts(batchSize int) (count int, err error) {
+	return backfillOperations(contractsBackfillCursorKey, contractRegisterOperationTypeNames, batchSize,
+		func(op *backfillOperation) (bool, error) {
+			if op.Receipt == nil || !op.Receipt.ExecSucceed {
+				return false, nil
+			}
+			contract, decodeErr := contractEntityOf(uint32(op.BlockNum), op.Trxid, op.OperationTypeName, op.OpJSON)
+			if decodeErr != nil {
+				logger.Println("decode contract register operation in tx "+op.Trxid+" error", decodeErr)
+				return false, nil
+			}
+			return true, saveContractIfNew(contract)
+		})
+}
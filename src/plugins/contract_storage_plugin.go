@@ -0,0 +1,171 @@
+package plugins
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+// 把storage_operation中每个合约的storage变化记录到contract_storage_changes, 并更新contract_storages中的最新值
+type ContractStoragePlugin struct {
+}
+
+func (plugin *ContractStoragePlugin) PluginName() string {
+	return "ContractStoragePlugin"
+}
+
+// fc的map序列化为[[key, value], ...], 也兼容{key: value}格式
+func jsonPairsOf(obj interface{}) (keys []string, values []interface{}, ok bool) {
+	switch m := obj.(type) {
+	case map[string]interface{}:
+		for key, value := range m {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		return keys, values, true
+	case []interface{}:
+		for _, pairObj := range m {
+			pair, isPair := pairObj.([]interface{})
+			if !isPair || len(pair) != 2 {
+				return nil, nil, false
+			}
+			key, isString := pair[0].(string)
+			if !isString {
+				return nil, nil, false
+			}
+			keys = append(keys, key)
+			values = append(values, pair[1])
+		}
+		return keys, values, true
+	}
+	return
+}
+
+// storage名称是 属性名 或者 属性名.mapKey
+func splitStorageName(storageName string) (propertyName string, storageKey string) {
+	dotIndex := strings.Index(storageName, ".")
+	if dotIndex < 0 {
+		return storageName, ""
+	}
+	return storageName[:dotIndex], storageName[dotIndex+1:]
+}
+
+// {"storage_data": "hex或者字节数组"}, 内容是json格式的值. 不是json时保存为hex字符串
+func storageDataValueOf(obj interface{}) json.RawMessage {
+	storageData, ok := obj.(map[string]interface{})
+	if !ok || storageData["storage_data"] == nil {
+		return json.RawMessage("null")
+	}
+	var data []byte
+	switch d := storageData["storage_data"].(type) {
+	case string:
+		var err error
+		data, err = hex.DecodeString(d)
+		if err != nil {
+			data = []byte(d)
+		}
+	case []interface{}:
+		for _, item := range d {
+			b, isInt := objToBigInt(item)
+			if !isInt {
+				return json.RawMessage("null")
+			}
+			data = append(data, byte(b.Int64()))
+		}
+	default:
+		return json.RawMessage("null")
+	}
+	// 去掉字符串结尾的\0
+	data = []byte(strings.TrimRight(string(data), "\x00"))
+	if len(data) < 1 {
+		return json.RawMessage("null")
+	}
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	hexValue, _ := json.Marshal(hex.EncodeToString(data))
+	return json.RawMessage(hexValue)
+}
+
+func contractStorageChangesOf(blockNum uint32, txid string, opNum int, opJSON map[string]interface{}) (result []*db.ContractStorageChangeEntity, ok bool) {
+	contractIds, contractChanges, ok := jsonPairsOf(opJSON["contract_change_storages"])
+	if !ok {
+		return
+	}
+	for i, contractId := range contractIds {
+		storageNames, storageChanges, isPairs := jsonPairsOf(contractChanges[i])
+		if !isPairs {
+			return nil, false
+		}
+		for j, storageName := range storageNames {
+			change, isMap := storageChanges[j].(map[string]interface{})
+			if !isMap {
+				return nil, false
+			}
+			propertyName, storageKey := splitStorageName(storageName)
+			result = append(result, &db.ContractStorageChangeEntity{
+				ContractId:   contractId,
+				PropertyName: propertyName,
+				StorageKey:   storageKey,
+				ValueBefore:  storageDataValueOf(change["before"]),
+				ValueAfter:   storageDataValueOf(change["after"]),
+				BlockNum:     blockNum,
+				Txid:         txid,
+				OpNum:        opNum,
+			})
+		}
+	}
+	return
+}
+
+func (plugin *ContractStoragePlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if opTypeName != "storage_operation" {
+		return
+	}
+	changes, ok := contractStorageChangesOf(uint32(block.BlockNumber), txid, opNum, opJSON)
+	if !ok {
+		logger.Println("invalid contract_change_storages in storage operation of tx " + txid)
+		return
+	}
+	for _, change := range changes {
+		var old *db.ContractStorageChangeEntity
+		old, err = db.FindContractStorageChange(txid, opNum, change.ContractId, change.PropertyName, change.StorageKey)
+		if err != nil {
+			return
+		}
+		if old != nil {
+			continue
+		}
+		err = db.SaveContractStorageChange(change)
+		if err != nil {
+			return
+		}
+		var latest *db.ContractStorageEntity
+		latest, err = db.FindContractStorage(change.ContractId, change.PropertyName, change.StorageKey)
+		if err != nil {
+			return
+		}
+		if latest == nil {
+			err = db.SaveContractStorage(&db.ContractStorageEntity{
+				ContractId:   change.ContractId,
+				PropertyName: change.PropertyName,
+				StorageKey:   change.StorageKey,
+				Value:        change.ValueAfter,
+				BlockNum:     change.BlockNum,
+			})
+		} else if latest.BlockNum <= change.BlockNum {
+			// 重新扫描旧块时不覆盖更新的值
+			latest.Value = change.ValueAfter
+			latest.BlockNum = change.BlockNum
+			err = db.UpdateContractStorage(latest)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package plugins
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStorageDataValueOf(t *testing.T) {
+	tests := []struct {
+		obj  interface{}
+		want string
+	}{
+		{nil, "null"},
+		{map[string]interface{}{}, "null"},
+		// hex编码的json
+		{map[string]interface{}{"storage_data": "2261626322"}, `"abc"`},
+		{map[string]interface{}{"storage_data": "3132"}, "12"},
+		// 字节数组, 结尾的\0去掉
+		{map[string]interface{}{"storage_data": []interface{}{float64(49), float64(50), float64(0)}}, "12"},
+		// 不是json时保存为hex字符串
+		{map[string]interface{}{"storage_data": []interface{}{float64(1), float64(2)}}, `"0102"`},
+		{map[string]interface{}{"storage_data": "zz{"}, `"7a7a7b"`},
+		{map[string]interface{}{"storage_data": ""}, "null"},
+		{map[string]interface{}{"storage_data": []interface{}{"a"}}, "null"},
+		{map[string]interface{}{"storage_data": float64(5)}, "null"},
+	}
+	for _, test := range tests {
+		if got := string(storageDataValueOf(test.obj)); got != test.want {
+			t.Errorf("storageDataValueOf(%v) = %s, want %s", test.obj, got, test.want)
+		}
+	}
+}
+
+func TestContractStorageChangesOf(t *testing.T) {
+	tests := []struct {
+		name   string
+		opJSON string
+		want   []string
+		wantOk bool
+	}{
+		{
+			name: "fc pairs",
+			opJSON: `{"contract_change_storages": [["HXCa", [` +
+				`["name", {"before": {"storage_data": "2261626322"}, "after": {"storage_data": "2278797a22"}}],` +
+				`["users.` + testAddr1 + `", {"before": {}, "after": {"storage_data": "3130"}}]]]]}`,
+			want: []string{
+				`HXCa name  "abc" "xyz"`,
+				`HXCa users ` + testAddr1 + ` null 10`,
+			},
+			wantOk: true,
+		},
+		{
+			name:   "map",
+			opJSON: `{"contract_change_storages": {"HXCb": {"supply": {"before": {"storage_data": "31"}, "after": {"storage_data": "32"}}}}}`,
+			want: []string{
+				`HXCb supply  1 2`,
+			},
+			wantOk: true,
+		},
+		{
+			name:   "invalid storage changes",
+			opJSON: `{"contract_change_storages": [["HXCa", "not pairs"]]}`,
+			wantOk: false,
+		},
+		{
+			name:   "invalid storage change",
+			opJSON: `{"contract_change_storages": [["HXCa", [["name", "not a change"]]]]}`,
+			wantOk: false,
+		},
+		{
+			name:   "missing",
+			opJSON: `{}`,
+			wantOk: false,
+		},
+	}
+	for _, test := range tests {
+		changes, ok := contractStorageChangesOf(100, "txid", 1, mustDecodeOpJSON(t, test.opJSON))
+		if ok != test.wantOk {
+			t.Errorf("%s: ok = %v, want %v", test.name, ok, test.wantOk)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		got := make([]string, 0, len(changes))
+		for _, change := range changes {
+			got = append(got, change.ContractId+" "+change.PropertyName+" "+change.StorageKey+" "+string(change.ValueBefore)+" "+
+				string(change.ValueAfter))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package plugins
+
+import (
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+// 合约升级(临时合约升级为有名字的正式合约)后更新contracts和token_contract, 并记录到contract_metadata_changes
+type ContractUpgradePlugin struct {
+}
+
+func (plugin *ContractUpgradePlugin) PluginName() string {
+	return "ContractUpgradePlugin"
+}
+
+func (plugin *ContractUpgradePlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if opTypeName != "contract_upgrade_operation" || receipt == nil || !receipt.ExecSucceed {
+		return
+	}
+	contractId, ok := mapGetString(opJSON, "contract_id")
+	if !ok {
+		logger.Println("contract_id not found in contract upgrade tx " + txid)
+		return
+	}
+	name, _ := mapGetString(opJSON, "contract_name")
+	description, _ := mapGetString(opJSON, "contract_desc")
+	old, err := db.FindContractMetadataChangeByTxid(txid, contractId)
+	if err != nil || old != nil {
+		return
+	}
+	tokenContract, err := db.FindTokenContractByContractId(contractId)
+	if err != nil {
+		return
+	}
+	return db.RunInTx(func(exec db.Executor) error {
+		err := db.UpdateContractNameAndDescription(exec, contractId, name, description)
+		if err != nil {
+			return err
+		}
+		// 管理员导入的描述优先
+		if tokenContract != nil && tokenContract.Description == nil && len(description) > 0 {
+			tokenContract.Description = &description
+			err = db.UpdateTokenContractInTx(exec, tokenContract)
+			if err != nil {
+				return err
+			}
+		}
+		return db.SaveContractMetadataChange(exec, &db.ContractMetadataChangeEntity{
+			ContractId:  contractId,
+			Source:      db.ContractMetadataSourceUpgrade,
+			Name:        &name,
+			Description: &description,
+			BlockNum:    uint32(block.BlockNumber),
+			Txid:        txid,
+		})
+	})
+}
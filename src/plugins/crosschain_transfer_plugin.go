@@ -0,0 +1,293 @@
+package plugins
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const crosschainTransfersBackfillCursorKey = "crosschain_transfers_backfill_cursor"
+
+var crosschainOperationTypeNames = []string{
+	"crosschain_record_operation",
+	"crosschain_withdraw_operation",
+	"crosschain_withdraw_without_sign_operation",
+	"crosschain_withdraw_with_sign_operation",
+	"crosschain_withdraw_combine_sign_operation",
+	"eths_guard_sign_final_operation",
+	"crosschain_withdraw_result_operation",
+	"eth_cancel_fail_crosschain_trx_operation",
+	"guard_refund_crosschain_trx_operation",
+}
+
+// 状态只能向后变化, 最后一级是结束状态
+var crosschainStateRanks = map[string]int{
+	db.CrosschainStateRequested: 0,
+	db.CrosschainStateSigned:    1,
+	db.CrosschainStateCombined:  2,
+	db.CrosschainStateBroadcast: 3,
+	db.CrosschainStateConfirmed: 4,
+	db.CrosschainStateFailed:    4,
+	db.CrosschainStateCancelled: 4,
+}
+
+// 链外交易id在不同链的交易中的属性名不同
+var crosschainTrxIdProps = []string{"trx_id", "hash", "txid"}
+
+// 把跨链充值crosschain_record_operation和提现的各个operation关联成crosschain_transfers, 每个operation记录到crosschain_transfer_events
+type CrosschainTransferPlugin struct {
+}
+
+func (plugin *CrosschainTransferPlugin) PluginName() string {
+	return "CrosschainTransferPlugin"
+}
+
+func crosschainStringOf(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+func crosschainTrxIdOf(trxObj interface{}) string {
+	trx, ok := trxObj.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if trxId := firstStringPropOf(trx, crosschainTrxIdProps); len(trxId) > 0 {
+		return trxId
+	}
+	// 有的链把交易放在trx属性中
+	return crosschainTrxIdOf(trx["trx"])
+}
+
+func isCrosschainStateFinished(state string) bool {
+	return isStringInArray(state, db.CrosschainFinishedStates)
+}
+
+func (plugin *CrosschainTransferPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if !isStringInArray(opTypeName, crosschainOperationTypeNames) {
+		return
+	}
+	blockTime, err := time.Parse("2006-01-02T15:04:05", block.Timestamp)
+	if err != nil {
+		return
+	}
+	return applyCrosschainOperation(uint32(block.BlockNumber), blockTime, txid, opNum, opTypeName, opJSON)
+}
+
+// 从一个跨链operation解析出的记录和对关联的crosschain_transfers的修改
+type crosschainOperation struct {
+	Event        *db.CrosschainTransferEventEntity
+	Created      *db.CrosschainTransferEntity // 充值和提现请求创建新的crosschain_transfers
+	RequestTxids []string                     // without_sign交易包含的提现请求
+	update       func(transfer *db.CrosschainTransferEntity)
+}
+
+func crosschainOperationOf(blockNum uint32, blockTime time.Time, txid string, opNum int, opTypeName string,
+	opJSON map[string]interface{}) (result *crosschainOperation) {
+	event := &db.CrosschainTransferEventEntity{
+		OpTypeName: opTypeName,
+		BlockNum:   blockNum,
+		BlockTime:  blockTime,
+		Txid:       txid,
+		OpNum:      opNum,
+	}
+	result = &crosschainOperation{Event: event}
+	newTransfer := func(direction string, state string) *db.CrosschainTransferEntity {
+		assetSymbol, _ := mapGetString(opJSON, "asset_symbol")
+		assetId, _ := mapGetString(opJSON, "asset_id")
+		return &db.CrosschainTransferEntity{
+			Direction:       direction,
+			State:           state,
+			RequestTxid:     txid,
+			AssetSymbol:     assetSymbol,
+			AssetId:         assetId,
+			RequestBlockNum: blockNum,
+			RequestTime:     blockTime,
+			LastBlockNum:    blockNum,
+			LastBlockTime:   blockTime,
+		}
+	}
+	switch opTypeName {
+	case "crosschain_record_operation":
+		// 充值在链外交易确认后才记录
+		trx, _ := opJSON["cross_chain_trx"].(map[string]interface{})
+		if trx == nil {
+			break
+		}
+		event.LinkId, _ = mapGetString(trx, "trx_id")
+		event.State = db.CrosschainStateConfirmed
+		created := newTransfer(db.CrosschainDirectionDeposit, db.CrosschainStateConfirmed)
+		created.CrosschainAddr, _ = mapGetString(trx, "from_account")
+		created.Amount = crosschainStringOf(trx["amount"])
+		if len(created.AssetSymbol) < 1 {
+			created.AssetSymbol, _ = mapGetString(trx, "asset_symbol")
+		}
+		created.CrosschainTrxId = event.LinkId
+		created.FinishTxid = txid
+		result.Created = created
+	case "crosschain_withdraw_operation":
+		event.LinkId = txid
+		event.State = db.CrosschainStateRequested
+		created := newTransfer(db.CrosschainDirectionWithdraw, db.CrosschainStateRequested)
+		created.HxAddr, _ = mapGetString(opJSON, "withdraw_account")
+		created.CrosschainAddr, _ = mapGetString(opJSON, "crosschain_account")
+		created.Amount = crosschainStringOf(opJSON["amount"])
+		result.Created = created
+	case "crosschain_withdraw_without_sign_operation":
+		// ccw_trx_ids是这个待签名交易包含的提现请求
+		event.LinkId = txid
+		event.State = db.CrosschainStateRequested
+		result.RequestTxids, _ = objToStringArray(opJSON["ccw_trx_ids"])
+		result.update = func(transfer *db.CrosschainTransferEntity) {
+			transfer.WithoutSignTxid = txid
+		}
+	case "crosschain_withdraw_with_sign_operation":
+		event.LinkId, _ = mapGetString(opJSON, "ccw_trx_id")
+		event.State = db.CrosschainStateSigned
+		result.update = func(transfer *db.CrosschainTransferEntity) {
+			transfer.SignatureCount++
+		}
+	case "crosschain_withdraw_combine_sign_operation":
+		event.LinkId = firstStringPropOf(opJSON, []string{"withdraw_trx", "ccw_trx_id"})
+		event.State = db.CrosschainStateCombined
+		// 能从合并后的交易中取到链外交易id时已经广播
+		crosschainTrxId := crosschainTrxIdOf(opJSON["cross_chain_trx"])
+		if len(crosschainTrxId) > 0 {
+			event.State = db.CrosschainStateBroadcast
+		}
+		result.update = func(transfer *db.CrosschainTransferEntity) {
+			transfer.CombineTxid = txid
+			if len(crosschainTrxId) > 0 {
+				transfer.CrosschainTrxId = crosschainTrxId
+			}
+		}
+	case "eths_guard_sign_final_operation":
+		event.LinkId, _ = mapGetString(opJSON, "combine_trx_id")
+		event.State = db.CrosschainStateBroadcast
+		crosschainTrxId := firstStringPropOf(opJSON, []string{"signed_crosschain_trx_id"})
+		result.update = func(transfer *db.CrosschainTransferEntity) {
+			if len(crosschainTrxId) > 0 {
+				transfer.CrosschainTrxId = crosschainTrxId
+			}
+		}
+	case "crosschain_withdraw_result_operation":
+		event.LinkId = crosschainTrxIdOf(opJSON["cross_chain_trx"])
+		event.State = db.CrosschainStateConfirmed
+	case "eth_cancel_fail_crosschain_trx_operation":
+		event.LinkId, _ = mapGetString(opJSON, "fail_transaction_id")
+		event.State = db.CrosschainStateFailed
+	case "guard_refund_crosschain_trx_operation":
+		event.LinkId, _ = mapGetString(opJSON, "not_enough_sign_trx_id")
+		event.State = db.CrosschainStateCancelled
+	}
+	return
+}
+
+// 把operation应用到关联的transfer上, 已经结束的transfer不再修改, 返回是否修改了
+func (op *crosschainOperation) applyTo(transfer *db.CrosschainTransferEntity) bool {
+	if isCrosschainStateFinished(transfer.State) {
+		return false
+	}
+	if op.update != nil {
+		op.update(transfer)
+	}
+	if isCrosschainStateFinished(op.Event.State) {
+		transfer.FinishTxid = op.Event.Txid
+	}
+	if crosschainStateRanks[op.Event.State] > crosschainStateRanks[transfer.State] {
+		transfer.State = op.Event.State
+	}
+	transfer.LastBlockNum = op.Event.BlockNum
+	transfer.LastBlockTime = op.Event.BlockTime
+	return true
+}
+
+func applyCrosschainOperation(blockNum uint32, blockTime time.Time, txid string, opNum int, opTypeName string,
+	opJSON map[string]interface{}) (err error) {
+	old, err := db.FindCrosschainTransferEvent(txid, opNum)
+	if err != nil || old != nil {
+		return
+	}
+	op := crosschainOperationOf(blockNum, blockTime, txid, opNum, opTypeName, opJSON)
+	event := op.Event
+	if len(event.LinkId) < 1 {
+		logger.Println("can't decode " + opTypeName + " in tx " + txid)
+		return
+	}
+	var transfers []*db.CrosschainTransferEntity
+	if opTypeName == "crosschain_withdraw_without_sign_operation" {
+		for _, requestTxid := range op.RequestTxids {
+			var transfer *db.CrosschainTransferEntity
+			transfer, err = db.FindCrosschainTransferByRequestTxid(requestTxid)
+			if err != nil {
+				return
+			}
+			if transfer != nil {
+				transfers = append(transfers, transfer)
+			}
+		}
+	} else if op.Created == nil {
+		transfers, err = listCrosschainTransfersOfLink(opTypeName, event.LinkId)
+		if err != nil {
+			return
+		}
+	}
+	if op.Created == nil && len(transfers) < 1 {
+		logger.Println("no crosschain transfer of " + event.LinkId + " found for " + opTypeName + " in tx " + txid)
+	}
+	// 事件和transfer的修改一起提交, 避免中途失败后重新扫描时因为事件已保存而跳过transfer的修改
+	return db.RunInTx(func(exec db.Executor) (err error) {
+		err = db.SaveCrosschainTransferEvent(exec, event)
+		if err != nil {
+			return
+		}
+		if op.Created != nil {
+			return db.SaveCrosschainTransfer(exec, op.Created)
+		}
+		for _, transfer := range transfers {
+			if !op.applyTo(transfer) {
+				continue
+			}
+			err = db.UpdateCrosschainTransfer(exec, transfer)
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+}
+
+// 签名, 合并和退回关联到without_sign交易, eth的最终签名和失败关联到combine交易, 提现结果关联到链外交易
+func listCrosschainTransfersOfLink(opTypeName string, linkId string) (result []*db.CrosschainTransferEntity, err error) {
+	switch opTypeName {
+	case "eths_guard_sign_final_operation", "eth_cancel_fail_crosschain_trx_operation":
+		result, err = db.ListCrosschainTransfersByCombineTxid(linkId)
+		if err != nil || len(result) > 0 {
+			return
+		}
+		return db.ListCrosschainTransfersByWithoutSignTxid(linkId)
+	case "crosschain_withdraw_result_operation":
+		return db.ListCrosschainTransfersByCrosschainTrxId(linkId)
+	}
+	return db.ListCrosschainTransfersByWithoutSignTxid(linkId)
+}
+
+// 从operations表中已经保存的跨链operation按顺序回填crosschain_transfers, 进度保存在scan_configs中
+func BackfillCrosschainTransfers(batchSize int) (count int, err error) {
+	return backfillOperations(crosschainTransfersBackfillCursorKey, crosschainOperationTypeNames, batchSize,
+		func(op *backfillOperation) (bool, error) {
+			return true, applyCrosschainOperation(uint32(op.BlockNum), op.BlockTime, op.Trxid, op.OpNum, op.OperationTypeName,
+				op.OpJSON)
+		})
+}
@@ -0,0 +1,106 @@
+package plugins
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+)
+
+func TestCrosschainOperationOf(t *testing.T) {
+	tests := []struct {
+		opTypeName       string
+		opJSON           string
+		wantLinkId       string
+		wantState        string
+		wantCreated      string // 新建transfer的direction
+		wantRequestTxids []string
+	}{
+		{"crosschain_record_operation",
+			`{"asset_symbol": "BTC", "cross_chain_trx": {"trx_id": "btctx1", "from_account": "1abc", "amount": "0.5"}}`,
+			"btctx1", db.CrosschainStateConfirmed, db.CrosschainDirectionDeposit, nil},
+		{"crosschain_withdraw_operation",
+			`{"withdraw_account": "` + testAddr1 + `", "crosschain_account": "1abc", "amount": "0.3", "asset_symbol": "BTC"}`,
+			"txid", db.CrosschainStateRequested, db.CrosschainDirectionWithdraw, nil},
+		{"crosschain_withdraw_without_sign_operation", `{"ccw_trx_ids": ["req1", "req2"]}`,
+			"txid", db.CrosschainStateRequested, "", []string{"req1", "req2"}},
+		{"crosschain_withdraw_with_sign_operation", `{"ccw_trx_id": "unsigned1"}`,
+			"unsigned1", db.CrosschainStateSigned, "", nil},
+		{"crosschain_withdraw_combine_sign_operation", `{"withdraw_trx": "unsigned1", "cross_chain_trx": {}}`,
+			"unsigned1", db.CrosschainStateCombined, "", nil},
+		// 链外交易id在trx中时已经广播
+		{"crosschain_withdraw_combine_sign_operation", `{"withdraw_trx": "unsigned1", "cross_chain_trx": {"trx": {"hash": "0xabc"}}}`,
+			"unsigned1", db.CrosschainStateBroadcast, "", nil},
+		{"crosschain_withdraw_result_operation", `{"cross_chain_trx": {"trx_id": "btctx2"}}`,
+			"btctx2", db.CrosschainStateConfirmed, "", nil},
+		{"eth_cancel_fail_crosschain_trx_operation", `{"fail_transaction_id": "combine1"}`,
+			"combine1", db.CrosschainStateFailed, "", nil},
+		{"guard_refund_crosschain_trx_operation", `{"not_enough_sign_trx_id": "unsigned1"}`,
+			"unsigned1", db.CrosschainStateCancelled, "", nil},
+		{"crosschain_record_operation", `{}`, "", "", "", nil},
+	}
+	for _, test := range tests {
+		op := crosschainOperationOf(100, time.Unix(1560000000, 0), "txid", 0, test.opTypeName, mustDecodeOpJSON(t, test.opJSON))
+		if op.Event.LinkId != test.wantLinkId || op.Event.State != test.wantState {
+			t.Errorf("%s %s: got link %s state %s, want %s %s", test.opTypeName, test.opJSON, op.Event.LinkId, op.Event.State,
+				test.wantLinkId, test.wantState)
+		}
+		createdDirection := ""
+		if op.Created != nil {
+			createdDirection = op.Created.Direction
+		}
+		if createdDirection != test.wantCreated {
+			t.Errorf("%s: created %q, want %q", test.opTypeName, createdDirection, test.wantCreated)
+		}
+		if !reflect.DeepEqual(op.RequestTxids, test.wantRequestTxids) {
+			t.Errorf("%s: request txids %v, want %v", test.opTypeName, op.RequestTxids, test.wantRequestTxids)
+		}
+	}
+}
+
+func TestCrosschainOperationApplyTo(t *testing.T) {
+	tests := []struct {
+		name               string
+		transferState      string
+		opTypeName         string
+		opJSON             string
+		wantChanged        bool
+		wantState          string
+		wantFinishTxid     string
+		wantSignatureCount int
+	}{
+		{"sign", db.CrosschainStateRequested, "crosschain_withdraw_with_sign_operation", `{"ccw_trx_id": "unsigned1"}`,
+			true, db.CrosschainStateSigned, "", 2},
+		// 合并后的签名只增加签名数, 状态不能后退
+		{"late sign", db.CrosschainStateCombined, "crosschain_withdraw_with_sign_operation", `{"ccw_trx_id": "unsigned1"}`,
+			true, db.CrosschainStateCombined, "", 2},
+		{"result", db.CrosschainStateBroadcast, "crosschain_withdraw_result_operation", `{"cross_chain_trx": {"trx_id": "btctx2"}}`,
+			true, db.CrosschainStateConfirmed, "txid", 1},
+		{"cancel", db.CrosschainStateSigned, "guard_refund_crosschain_trx_operation", `{"not_enough_sign_trx_id": "unsigned1"}`,
+			true, db.CrosschainStateCancelled, "txid", 1},
+		// 结束后不再修改
+		{"finished", db.CrosschainStateConfirmed, "crosschain_withdraw_with_sign_operation", `{"ccw_trx_id": "unsigned1"}`,
+			false, db.CrosschainStateConfirmed, "", 1},
+		{"failed is finished", db.CrosschainStateFailed, "crosschain_withdraw_result_operation",
+			`{"cross_chain_trx": {"trx_id": "btctx2"}}`, false, db.CrosschainStateFailed, "", 1},
+	}
+	for _, test := range tests {
+		transfer := &db.CrosschainTransferEntity{State: test.transferState, SignatureCount: 1, LastBlockNum: 50}
+		op := crosschainOperationOf(100, time.Unix(1560000000, 0), "txid", 0, test.opTypeName, mustDecodeOpJSON(t, test.opJSON))
+		changed := op.applyTo(transfer)
+		if changed != test.wantChanged || transfer.State != test.wantState || transfer.FinishTxid != test.wantFinishTxid ||
+			transfer.SignatureCount != test.wantSignatureCount {
+			t.Errorf("%s: got changed %v state %s finish %q signatures %d, want %v %s %q %d", test.name, changed, transfer.State,
+				transfer.FinishTxid, transfer.SignatureCount, test.wantChanged, test.wantState, test.wantFinishTxid,
+				test.wantSignatureCount)
+		}
+		wantLastBlockNum := uint32(50)
+		if test.wantChanged {
+			wantLastBlockNum = 100
+		}
+		if transfer.LastBlockNum != wantLastBlockNum {
+			t.Errorf("%s: last block %d, want %d", test.name, transfer.LastBlockNum, wantLastBlockNum)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package plugins
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const watchedAddressesReloadInterval = 30 * time.Second
+
+// 跟踪watched_addresses中地址的充值: transfer_operation, token合约的Transfer事件和合约回执中的deposit_to_address
+type DepositPlugin struct {
+	MaxConfirmations uint32
+
+	mutex           sync.Mutex
+	watchedAddrs    map[string]bool
+	watchedLoadedAt time.Time
+}
+
+func (plugin *DepositPlugin) PluginName() string {
+	return "DepositPlugin"
+}
+
+// watched_addresses可能被命令行修改, 所以定时重新加载
+func (plugin *DepositPlugin) isWatched(addr string) (bool, error) {
+	plugin.mutex.Lock()
+	defer plugin.mutex.Unlock()
+	if plugin.watchedAddrs == nil || time.Since(plugin.watchedLoadedAt) > watchedAddressesReloadInterval {
+		items, err := db.ListWatchedAddresses()
+		if err != nil {
+			return false, err
+		}
+		plugin.watchedAddrs = make(map[string]bool)
+		for _, item := range items {
+			plugin.watchedAddrs[item.Addr] = true
+		}
+		plugin.watchedLoadedAt = time.Now()
+	}
+	return plugin.watchedAddrs[addr], nil
+}
+
+func (plugin *DepositPlugin) saveDepositIfNew(deposit *db.DepositEntity) (err error) {
+	oldDeposit, err := db.FindDeposit(deposit.Txid, deposit.OpNum, deposit.DepositType, deposit.EventIndex)
+	if err != nil {
+		return
+	}
+	if oldDeposit != nil {
+		return
+	}
+	now := time.Now()
+	deposit.Confirmations = 1
+	deposit.CreatedAt = now
+	deposit.UpdatedAt = now
+	err = db.SaveDeposit(deposit)
+	if err != nil {
+		return
+	}
+	logger.Println("found deposit to " + deposit.Addr + " in tx " + deposit.Txid)
+	return
+}
+
+func (plugin *DepositPlugin) nativeDeposit(block *types.HxBlock, txid string, opNum int, depositType string, eventIndex int,
+	toAddr string, fromAddr string, assetId string, amount *big.Int) (deposit *db.DepositEntity, err error) {
+	asset, err := findAssetFromCacheOrDb(assetId)
+	if err != nil {
+		return
+	}
+	var precision uint32 = 0
+	if asset != nil {
+		precision = asset.Precision
+	}
+	deposit = &db.DepositEntity{
+		Addr:         toAddr,
+		DepositType:  depositType,
+		AssetId:      assetId,
+		ContractAddr: "",
+		FromAddr:     fromAddr,
+		Amount:       amount,
+		Precision:    precision,
+		BlockNum:     uint32(block.BlockNumber),
+		BlockTime:    block.Timestamp,
+		Txid:         txid,
+		OpNum:        opNum,
+		EventIndex:   eventIndex}
+	return
+}
+
+func (plugin *DepositPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if opTypeName == "transfer_operation" {
+		toAddr, ok := mapGetString(opJSON, "to_addr")
+		if !ok {
+			return
+		}
+		var watched bool
+		watched, err = plugin.isWatched(toAddr)
+		if err != nil || !watched {
+			return
+		}
+		fromAddr, _ := mapGetString(opJSON, "from_addr")
+		amountMap, ok := opJSON["amount"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		assetId, ok := mapGetString(amountMap, "asset_id")
+		if !ok {
+			return
+		}
+		amount, ok := getBigIntPropFromJSONObj(amountMap, "amount")
+		if !ok {
+			return
+		}
+		var deposit *db.DepositEntity
+		deposit, err = plugin.nativeDeposit(block, txid, opNum, db.DepositTypeTransfer, -1, toAddr, fromAddr, assetId, amount)
+		if err != nil {
+			return
+		}
+		err = plugin.saveDepositIfNew(deposit)
+		if err != nil {
+			return
+		}
+	}
+	if receipt == nil || !receipt.ExecSucceed {
+		return
+	}
+	for eventIndex, event := range receipt.Events {
+		if event.EventName != "Transfer" {
+			continue
+		}
+		eventArg, decodeErr := decodeJSONObjUseNumber(event.EventArg)
+		if decodeErr != nil {
+			continue
+		}
+		toAddr, ok := mapGetString(eventArg, "to")
+		if !ok {
+			continue
+		}
+		var watched bool
+		watched, err = plugin.isWatched(toAddr)
+		if err != nil {
+			return
+		}
+		if !watched {
+			continue
+		}
+		amount, ok := getBigIntPropFromJSONObj(eventArg, "amount")
+		if !ok {
+			continue
+		}
+		var tokenContract *db.TokenContractEntity
+		tokenContract, err = db.FindTokenContractByContractId(event.ContractAddress)
+		if err != nil {
+			return
+		}
+		if tokenContract == nil {
+			continue
+		}
+		var precision uint32 = 0
+		if tokenContract.Precision != nil {
+			precision = uint32(db.TokenPrecisionDecimals(*tokenContract.Precision))
+		}
+		fromAddr, _ := mapGetString(eventArg, "from")
+		deposit := &db.DepositEntity{
+			Addr:         toAddr,
+			DepositType:  db.DepositTypeTokenTransfer,
+			AssetId:      "",
+			ContractAddr: event.ContractAddress,
+			FromAddr:     fromAddr,
+			Amount:       amount,
+			Precision:    precision,
+			BlockNum:     uint32(block.BlockNumber),
+			BlockTime:    block.Timestamp,
+			Txid:         txid,
+			OpNum:        opNum,
+			EventIndex:   eventIndex}
+		err = plugin.saveDepositIfNew(deposit)
+		if err != nil {
+			return
+		}
+	}
+	// deposit_to_address item: [[addr, assetId], amount]
+	for changeIndex, change := range receipt.DepositToAddressChanges {
+		changeItem, ok := change.([]interface{})
+		if !ok || len(changeItem) < 2 {
+			continue
+		}
+		addressAssetPair, ok := changeItem[0].([]interface{})
+		if !ok || len(addressAssetPair) < 2 {
+			continue
+		}
+		addr, ok := addressAssetPair[0].(string)
+		if !ok {
+			continue
+		}
+		assetId, ok := addressAssetPair[1].(string)
+		if !ok {
+			continue
+		}
+		var watched bool
+		watched, err = plugin.isWatched(addr)
+		if err != nil {
+			return
+		}
+		if !watched {
+			continue
+		}
+		amount, ok := objToBigInt(changeItem[1])
+		if !ok {
+			continue
+		}
+		fromAddr, ok := mapGetString(opJSON, "contract_id")
+		if !ok {
+			fromAddr = receipt.Invoker
+		}
+		var deposit *db.DepositEntity
+		deposit, err = plugin.nativeDeposit(block, txid, opNum, db.DepositTypeContractWithdraw, changeIndex, addr,
+			fromAddr, assetId, amount)
+		if err != nil {
+			return
+		}
+		err = plugin.saveDepositIfNew(deposit)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// 每扫描一个块, 更新未达到MaxConfirmations的充值的确认数
+func (plugin *DepositPlugin) ApplyBlock(block *types.HxBlock) (err error) {
+	err = db.UpdateDepositConfirmations(uint32(block.BlockNumber), plugin.MaxConfirmations)
+	return
+}
@@ -0,0 +1,118 @@
+package plugins
+
+import (
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/nodeservice"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+// 块的trxfee对应的手续费类型
+var blockTrxfeeFeeTypes = []string{db.FeeTypeOperation, db.FeeTypeContract}
+
+// 记录每一笔手续费到fee_records, 每个块处理完后和块的trxfee对账, 不一致时记录到fee_reconciliations
+type FeeLedgerPlugin struct {
+}
+
+func (plugin *FeeLedgerPlugin) PluginName() string {
+	return "FeeLedgerPlugin"
+}
+
+func feePayerOf(opJSON map[string]interface{}) string {
+	for _, prop := range feePayerAddrProps {
+		payer, ok := mapGetString(opJSON, prop)
+		if ok && types.IsHxAddress(payer) {
+			return payer
+		}
+	}
+	return ""
+}
+
+func feeRecordsOf(blockNum uint32, blockTime time.Time, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (result []*db.FeeRecordEntity) {
+	add := func(payerAddr string, assetId string, amount *big.Int, feeType string, feeIndex int) {
+		if len(assetId) < 1 || amount == nil || amount.Sign() == 0 {
+			return
+		}
+		result = append(result, &db.FeeRecordEntity{
+			PayerAddr:  payerAddr,
+			AssetId:    assetId,
+			Amount:     amount,
+			FeeType:    feeType,
+			OpType:     opType,
+			OpTypeName: opTypeName,
+			BlockNum:   blockNum,
+			BlockTime:  blockTime,
+			Txid:       txid,
+			OpNum:      opNum,
+			FeeIndex:   feeIndex,
+		})
+	}
+	// 合约操作实际扣的手续费在回执中, 已经包含operation的fee
+	if nodeservice.IsContractOpType(opType) && receipt != nil {
+		add(receipt.Invoker, baseAssetId, new(big.Int).SetUint64(receipt.ActualFee), db.FeeTypeContract, 0)
+		// transfer_fees中由合约支付的手续费, payer记为合约
+		contractId, _ := mapGetString(opJSON, "contract_id")
+		for i, feeObj := range receipt.TransferFees {
+			payerAddr, assetId, amount, ok := transferFeeItemOf(feeObj)
+			if !ok {
+				continue
+			}
+			if len(payerAddr) < 1 {
+				payerAddr = contractId
+			}
+			add(payerAddr, assetId, amount, db.FeeTypeContractTransfer, i)
+		}
+	} else if fee, feeAssetId, ok := amountAndAssetOf(opJSON["fee"]); ok {
+		add(feePayerOf(opJSON), feeAssetId, fee, db.FeeTypeOperation, 0)
+	}
+	return
+}
+
+func (plugin *FeeLedgerPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	blockTime, err := time.Parse("2006-01-02T15:04:05", block.Timestamp)
+	if err != nil {
+		return
+	}
+	for _, record := range feeRecordsOf(uint32(block.BlockNumber), blockTime, txid, opNum, opType, opTypeName, opJSON, receipt) {
+		var old *db.FeeRecordEntity
+		old, err = db.FindFeeRecord(txid, opNum, record.FeeType, record.FeeIndex)
+		if err != nil {
+			return
+		}
+		if old != nil {
+			continue
+		}
+		err = db.SaveFeeRecord(record)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (plugin *FeeLedgerPlugin) ApplyBlock(block *types.HxBlock) (err error) {
+	blockNum := uint32(block.BlockNumber)
+	ledgerFee, err := db.SumBlockFees(blockNum, baseAssetId, blockTrxfeeFeeTypes)
+	if err != nil {
+		return
+	}
+	if ledgerFee.Cmp(big.NewInt(int64(block.Trxfee))) == 0 {
+		return
+	}
+	old, err := db.FindFeeReconciliation(blockNum)
+	if err != nil || old != nil {
+		return
+	}
+	logger.Println("fees of block #" + strconv.Itoa(block.BlockNumber) + " in ledger " + ledgerFee.String() +
+		" but block trxfee is " + strconv.Itoa(block.Trxfee))
+	return db.SaveFeeReconciliation(&db.FeeReconciliationEntity{
+		BlockNum:    blockNum,
+		BlockTrxfee: int64(block.Trxfee),
+		LedgerFee:   ledgerFee,
+	})
+}
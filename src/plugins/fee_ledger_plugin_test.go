@@ -0,0 +1,93 @@
+package plugins
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+func feeRecordStrings(records []*db.FeeRecordEntity) []string {
+	result := make([]string, 0, len(records))
+	for _, record := range records {
+		result = append(result, record.PayerAddr+" "+record.AssetId+" "+record.Amount.String()+" "+record.FeeType+" "+
+			strconv.Itoa(record.FeeIndex))
+	}
+	return result
+}
+
+func TestFeeRecordsOf(t *testing.T) {
+	tests := []struct {
+		name       string
+		opType     int
+		opTypeName string
+		opJSON     string
+		receipt    string
+		want       []string
+	}{
+		{
+			name:       "transfer",
+			opType:     0,
+			opTypeName: "transfer_operation",
+			opJSON: `{"fee": {"amount": 101000, "asset_id": "1.3.0"}, "from_addr": "` + testAddr1 + `", "to_addr": "` + testAddr2 +
+				`", "amount": {"amount": 5, "asset_id": "1.3.1"}}`,
+			want: []string{
+				testAddr1 + " 1.3.0 101000 operation 0",
+			},
+		},
+		{
+			name:       "fee_pay_address takes precedence",
+			opType:     0,
+			opTypeName: "transfer_operation",
+			opJSON: `{"fee": {"amount": 100, "asset_id": "1.3.0"}, "fee_pay_address": "` + testAddr3 +
+				`", "from_addr": "` + testAddr1 + `"}`,
+			want: []string{
+				testAddr3 + " 1.3.0 100 operation 0",
+			},
+		},
+		{
+			name:       "zero fee",
+			opType:     55,
+			opTypeName: "lockbalance_operation",
+			opJSON:     `{"fee": {"amount": 0, "asset_id": "1.3.0"}, "lock_balance_addr": "` + testAddr1 + `"}`,
+			want:       []string{},
+		},
+		{
+			name:       "contract fee and transfer fees",
+			opType:     79,
+			opTypeName: "contract_invoke_operation",
+			opJSON: `{"fee": {"amount": 1, "asset_id": "1.3.0"}, "caller_addr": "` + testAddr1 +
+				`", "contract_id": "HXCcontract"}`,
+			receipt: `{"exec_succeed": true, "acctual_fee": 3000, "invoker": "` + testAddr1 + `",` +
+				` "transfer_fees": [[["` + testAddr2 + `", "1.3.0"], 20], ["1.3.1", 7], ["1.3.0", 0]]}`,
+			want: []string{
+				testAddr1 + " 1.3.0 3000 contract 0",
+				testAddr2 + " 1.3.0 20 contract_transfer 0",
+				"HXCcontract 1.3.1 7 contract_transfer 1",
+			},
+		},
+		{
+			name:       "contract op without receipt uses operation fee",
+			opType:     79,
+			opTypeName: "contract_invoke_operation",
+			opJSON:     `{"fee": {"amount": 10, "asset_id": "1.3.0"}, "caller_addr": "` + testAddr1 + `"}`,
+			want: []string{
+				testAddr1 + " 1.3.0 10 operation 0",
+			},
+		},
+	}
+	blockTime := time.Unix(1560000000, 0)
+	for _, test := range tests {
+		var receipt *types.HxContractOpReceipt
+		if len(test.receipt) > 0 {
+			receipt = mustDecodeReceipt(t, test.receipt)
+		}
+		records := feeRecordsOf(100, blockTime, "txid", 0, test.opType, test.opTypeName, mustDecodeOpJSON(t, test.opJSON), receipt)
+		if got := feeRecordStrings(records); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package plugins
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+const lockBalancesBackfillCursorKey = "lock_balances_backfill_cursor"
+
+// 锁仓operation中各字段可能的属性名, 按顺序取第一个存在的
+type lockBalanceOpFields struct {
+	eventType      string
+	lockType       string
+	assetIdProps   []string
+	amountProps    []string
+	ownerAddrProps []string
+	// 合约锁仓时资金来源的合约地址, 不是合约地址(默认值)时用ownerAddrProps
+	contractAddrProp string
+	ownerAcctProps   []string
+	targetIdProps    []string
+}
+
+var lockBalanceOpFieldsOfOpType = map[string]*lockBalanceOpFields{
+	"lockbalance_operation": {
+		eventType:        db.LockBalanceEventLock,
+		lockType:         db.LockTypeCitizen,
+		assetIdProps:     []string{"lock_asset_id"},
+		amountProps:      []string{"lock_asset_amount"},
+		ownerAddrProps:   []string{"lock_balance_addr"},
+		contractAddrProp: "contract_addr",
+		ownerAcctProps:   []string{"lock_balance_account"},
+		targetIdProps:    []string{"lockto_miner_account"},
+	},
+	"foreclose_balance_operation": {
+		eventType:        db.LockBalanceEventForeclose,
+		lockType:         db.LockTypeCitizen,
+		assetIdProps:     []string{"foreclose_asset_id"},
+		amountProps:      []string{"foreclose_asset_amount"},
+		ownerAddrProps:   []string{"foreclose_addr"},
+		contractAddrProp: "foreclose_contract_addr",
+		ownerAcctProps:   []string{"foreclose_account"},
+		targetIdProps:    []string{"foreclose_miner_account"},
+	},
+	// guard锁仓给自己
+	"guard_lock_balance_operation": {
+		eventType:      db.LockBalanceEventLock,
+		lockType:       db.LockTypeGuard,
+		assetIdProps:   []string{"lock_asset_id"},
+		amountProps:    []string{"lock_asset_amount"},
+		ownerAddrProps: []string{"lock_balance_addr"},
+		ownerAcctProps: []string{"lock_balance_account", "guard_account"},
+		targetIdProps:  []string{"lock_balance_account", "guard_account"},
+	},
+	"guard_foreclose_balance_operation": {
+		eventType:      db.LockBalanceEventForeclose,
+		lockType:       db.LockTypeGuard,
+		assetIdProps:   []string{"foreclose_asset_id"},
+		amountProps:    []string{"foreclose_asset_amount"},
+		ownerAddrProps: []string{"foreclose_balance_addr"},
+		ownerAcctProps: []string{"foreclose_balance_account", "guard_account"},
+		targetIdProps:  []string{"foreclose_balance_account", "guard_account"},
+	},
+}
+
+func lockBalanceOperationTypeNames() (result []string) {
+	for opTypeName := range lockBalanceOpFieldsOfOpType {
+		result = append(result, opTypeName)
+	}
+	return
+}
+
+func firstStringPropOf(opJSON map[string]interface{}, props []string) string {
+	for _, prop := range props {
+		value, ok := mapGetString(opJSON, prop)
+		if ok && len(value) > 0 {
+			return value
+		}
+	}
+	return ""
+}
+
+func lockBalanceEventOf(blockNum uint32, blockTime time.Time, txid string, opNum int, opTypeName string,
+	opJSON map[string]interface{}) (result *db.LockBalanceEventEntity, ok bool) {
+	fields, ok := lockBalanceOpFieldsOfOpType[opTypeName]
+	if !ok {
+		return
+	}
+	var amount *big.Int
+	for _, prop := range fields.amountProps {
+		amount, ok = getBigIntPropFromJSONObj(opJSON, prop)
+		if ok {
+			break
+		}
+	}
+	assetId := firstStringPropOf(opJSON, fields.assetIdProps)
+	ownerAddr := firstStringPropOf(opJSON, fields.ownerAddrProps)
+	if len(fields.contractAddrProp) > 0 {
+		contractAddr, _ := mapGetString(opJSON, fields.contractAddrProp)
+		if types.IsHxContractAddress(contractAddr) {
+			ownerAddr = contractAddr
+		}
+	}
+	targetId := firstStringPropOf(opJSON, fields.targetIdProps)
+	if !ok || amount.Sign() <= 0 || len(assetId) < 1 || len(ownerAddr) < 1 || len(targetId) < 1 {
+		return nil, false
+	}
+	return &db.LockBalanceEventEntity{
+		EventType:    fields.eventType,
+		LockType:     fields.lockType,
+		OwnerAddr:    ownerAddr,
+		OwnerAccount: firstStringPropOf(opJSON, fields.ownerAcctProps),
+		TargetId:     targetId,
+		AssetId:      assetId,
+		Amount:       amount,
+		BlockNum:     blockNum,
+		BlockTime:    blockTime,
+		Txid:         txid,
+		OpNum:        opNum,
+	}, true
+}
+
+// 记录锁仓和赎回到lock_balance_events, 并维护当前锁仓locked_balances
+type LockBalancePlugin struct {
+}
+
+func (plugin *LockBalancePlugin) PluginName() string {
+	return "LockBalancePlugin"
+}
+
+func (plugin *LockBalancePlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	if _, ok := lockBalanceOpFieldsOfOpType[opTypeName]; !ok {
+		return
+	}
+	blockTime, err := time.Parse("2006-01-02T15:04:05", block.Timestamp)
+	if err != nil {
+		return
+	}
+	event, ok := lockBalanceEventOf(uint32(block.BlockNumber), blockTime, txid, opNum, opTypeName, opJSON)
+	if !ok {
+		logger.Println("can't decode " + opTypeName + " in tx " + txid)
+		return
+	}
+	return saveLockBalanceEventIfNew(event)
+}
+
+// 锁仓记录和锁仓位置在同一个事务中保存, 避免中途失败后重新扫描时跳过已保存的记录而漏算锁仓
+func saveLockBalanceEventIfNew(event *db.LockBalanceEventEntity) (err error) {
+	old, err := db.FindLockBalanceEvent(event.Txid, event.OpNum)
+	if err != nil || old != nil {
+		return
+	}
+	position, err := db.FindLockedBalance(event.LockType, event.OwnerAddr, event.TargetId, event.AssetId)
+	if err != nil {
+		return
+	}
+	position = lockedBalanceAfterEvent(position, event)
+	return db.RunInTx(func(exec db.Executor) (err error) {
+		err = db.SaveLockBalanceEvent(exec, event)
+		if err != nil {
+			return
+		}
+		if position.Id == 0 {
+			return db.SaveLockedBalance(exec, position)
+		}
+		return db.UpdateLockedBalance(exec, position)
+	})
+}
+
+// 在原锁仓位置(position为nil时是新的锁仓)上应用event. 赎回多于已知锁仓时(比如锁仓在扫描起点之前)保留负数,
+// 使locked_balances和lock_balance_events的合计一致
+func lockedBalanceAfterEvent(position *db.LockedBalanceEntity, event *db.LockBalanceEventEntity) *db.LockedBalanceEntity {
+	delta := event.Amount
+	if event.EventType == db.LockBalanceEventForeclose {
+		delta = new(big.Int).Neg(event.Amount)
+	}
+	if position == nil {
+		if delta.Sign() < 0 {
+			logger.Println("foreclose without lock of " + event.OwnerAddr + " to " + event.TargetId + " in tx " + event.Txid)
+		}
+		return &db.LockedBalanceEntity{
+			LockType:            event.LockType,
+			OwnerAddr:           event.OwnerAddr,
+			TargetId:            event.TargetId,
+			AssetId:             event.AssetId,
+			Amount:              new(big.Int).Set(delta),
+			FirstLockedBlockNum: event.BlockNum,
+			FirstLockedAt:       event.BlockTime,
+			BlockNum:            event.BlockNum,
+		}
+	}
+	wasEmpty := position.Amount.Sign() <= 0
+	position.Amount = new(big.Int).Add(position.Amount, delta)
+	if position.Amount.Sign() < 0 {
+		logger.Println("foreclose more than locked of " + event.OwnerAddr + " to " + event.TargetId + " in tx " + event.Txid)
+	}
+	// 全部赎回后重新锁仓时是新的锁仓
+	if wasEmpty && delta.Sign() > 0 {
+		position.FirstLockedBlockNum = event.BlockNum
+		position.FirstLockedAt = event.BlockTime
+	}
+	position.BlockNum = event.BlockNum
+	return position
+}
+
+// 从operations表中已经保存的锁仓operation按顺序回填lock_balance_events和locked_balances, 进度保存在scan_configs中
+func BackfillLockBalances(batchSize int) (count int, err error) {
+	return backfillOperations(lockBalancesBackfillCursorKey, lockBalanceOperationTypeNames(), batchSize,
+		func(op *backfillOperation) (bool, error) {
+			event, ok := lockBalanceEventOf(uint32(op.BlockNum), op.BlockTime, op.Trxid, op.OpNum, op.OperationTypeName, op.OpJSON)
+			if !ok {
+				logger.Println("can't decode " + op.OperationTypeName + " in tx " + op.Trxid)
+				return false, nil
+			}
+			return true, saveLockBalanceEventIfNew(event)
+		})
+}
@@ -0,0 +1,162 @@
+package plugins
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+)
+
+const (
+	testContractAddr = "HXCH7KR1mQbNafs33PutUKkWW4rrB5ZzuX6L"
+	// 不是合约锁仓时contract_addr是空地址
+	testDefaultAddr = "HXNKuyBkoGdZZSLyPbJEetheRhMjezkaXk2J"
+)
+
+func mustBigInt(s string) *big.Int {
+	value, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big int " + s)
+	}
+	return value
+}
+
+func TestLockBalanceEventOf(t *testing.T) {
+	tests := []struct {
+		name       string
+		opTypeName string
+		opJSON     string
+		wantOk     bool
+		want       db.LockBalanceEventEntity
+	}{
+		{
+			name:       "lock to citizen",
+			opTypeName: "lockbalance_operation",
+			opJSON: `{"lock_asset_id": "1.3.0", "lock_asset_amount": 123456789012345678901, "lock_balance_addr": "` + testAddr1 +
+				`", "lock_balance_account": "1.2.30", "lockto_miner_account": "1.6.5"}`,
+			wantOk: true,
+			want: db.LockBalanceEventEntity{EventType: db.LockBalanceEventLock, LockType: db.LockTypeCitizen, OwnerAddr: testAddr1,
+				OwnerAccount: "1.2.30", TargetId: "1.6.5", AssetId: "1.3.0", Amount: mustBigInt("123456789012345678901")},
+		},
+		{
+			name:       "contract lock uses contract address",
+			opTypeName: "lockbalance_operation",
+			opJSON: `{"lock_asset_id": "1.3.0", "lock_asset_amount": 100, "contract_addr": "` + testContractAddr +
+				`", "lock_balance_addr": "` + testAddr1 + `", "lock_balance_account": "1.2.30", "lockto_miner_account": "1.6.5"}`,
+			wantOk: true,
+			want: db.LockBalanceEventEntity{EventType: db.LockBalanceEventLock, LockType: db.LockTypeCitizen, OwnerAddr: testContractAddr,
+				OwnerAccount: "1.2.30", TargetId: "1.6.5", AssetId: "1.3.0", Amount: big.NewInt(100)},
+		},
+		{
+			name:       "default contract_addr is not the owner",
+			opTypeName: "lockbalance_operation",
+			opJSON: `{"lock_asset_id": "1.3.0", "lock_asset_amount": 100, "contract_addr": "` + testDefaultAddr +
+				`", "lock_balance_addr": "` + testAddr1 + `", "lock_balance_account": "1.2.30", "lockto_miner_account": "1.6.5"}`,
+			wantOk: true,
+			want: db.LockBalanceEventEntity{EventType: db.LockBalanceEventLock, LockType: db.LockTypeCitizen, OwnerAddr: testAddr1,
+				OwnerAccount: "1.2.30", TargetId: "1.6.5", AssetId: "1.3.0", Amount: big.NewInt(100)},
+		},
+		{
+			name:       "contract foreclose uses contract address",
+			opTypeName: "foreclose_balance_operation",
+			opJSON: `{"foreclose_asset_id": "1.3.0", "foreclose_asset_amount": 20, "foreclose_contract_addr": "` + testContractAddr +
+				`", "foreclose_addr": "` + testAddr2 + `", "foreclose_account": "1.2.31", "foreclose_miner_account": "1.6.5"}`,
+			wantOk: true,
+			want: db.LockBalanceEventEntity{EventType: db.LockBalanceEventForeclose, LockType: db.LockTypeCitizen,
+				OwnerAddr: testContractAddr, OwnerAccount: "1.2.31", TargetId: "1.6.5", AssetId: "1.3.0", Amount: big.NewInt(20)},
+		},
+		{
+			name:       "foreclose from citizen",
+			opTypeName: "foreclose_balance_operation",
+			opJSON: `{"foreclose_asset_id": "1.3.0", "foreclose_asset_amount": "50", "foreclose_contract_addr": "` + testDefaultAddr +
+				`", "foreclose_addr": "` + testAddr2 + `", "foreclose_account": "1.2.31", "foreclose_miner_account": "1.6.5"}`,
+			wantOk: true,
+			want: db.LockBalanceEventEntity{EventType: db.LockBalanceEventForeclose, LockType: db.LockTypeCitizen, OwnerAddr: testAddr2,
+				OwnerAccount: "1.2.31", TargetId: "1.6.5", AssetId: "1.3.0", Amount: big.NewInt(50)},
+		},
+		{
+			name:       "guard lock to itself",
+			opTypeName: "guard_lock_balance_operation",
+			opJSON: `{"lock_asset_id": "1.3.1", "lock_asset_amount": 7, "lock_balance_addr": "` + testAddr3 +
+				`", "lock_balance_account": "1.2.40"}`,
+			wantOk: true,
+			want: db.LockBalanceEventEntity{EventType: db.LockBalanceEventLock, LockType: db.LockTypeGuard, OwnerAddr: testAddr3,
+				OwnerAccount: "1.2.40", TargetId: "1.2.40", AssetId: "1.3.1", Amount: big.NewInt(7)},
+		},
+		{
+			name:       "zero amount",
+			opTypeName: "lockbalance_operation",
+			opJSON: `{"lock_asset_id": "1.3.0", "lock_asset_amount": 0, "lock_balance_addr": "` + testAddr1 +
+				`", "lockto_miner_account": "1.6.5"}`,
+		},
+		{
+			name:       "missing target",
+			opTypeName: "lockbalance_operation",
+			opJSON:     `{"lock_asset_id": "1.3.0", "lock_asset_amount": 100, "lock_balance_addr": "` + testAddr1 + `"}`,
+		},
+		{
+			name:       "not a lock operation",
+			opTypeName: "transfer_operation",
+			opJSON:     `{"from_addr": "` + testAddr1 + `"}`,
+		},
+	}
+	blockTime := time.Unix(1560000000, 0)
+	for _, test := range tests {
+		event, ok := lockBalanceEventOf(100, blockTime, "txid", 1, test.opTypeName, mustDecodeOpJSON(t, test.opJSON))
+		if ok != test.wantOk {
+			t.Errorf("%s: ok = %v, want %v", test.name, ok, test.wantOk)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		want := test.want
+		if event.EventType != want.EventType || event.LockType != want.LockType || event.OwnerAddr != want.OwnerAddr ||
+			event.OwnerAccount != want.OwnerAccount || event.TargetId != want.TargetId || event.AssetId != want.AssetId ||
+			event.Amount.Cmp(want.Amount) != 0 || event.BlockNum != 100 || !event.BlockTime.Equal(blockTime) ||
+			event.Txid != "txid" || event.OpNum != 1 {
+			t.Errorf("%s: got %+v, want %+v", test.name, *event, want)
+		}
+	}
+}
+
+func TestLockedBalanceAfterEvent(t *testing.T) {
+	lockEvent := func(eventType string, amount int64, blockNum uint32) *db.LockBalanceEventEntity {
+		return &db.LockBalanceEventEntity{EventType: eventType, LockType: db.LockTypeCitizen, OwnerAddr: testAddr1,
+			TargetId: "1.6.5", AssetId: "1.3.0", Amount: big.NewInt(amount), BlockNum: blockNum,
+			BlockTime: time.Unix(int64(blockNum), 0)}
+	}
+	tests := []struct {
+		name                    string
+		positionAmount          int64
+		noPosition              bool
+		event                   *db.LockBalanceEventEntity
+		wantAmount              int64
+		wantFirstLockedBlockNum uint32
+	}{
+		{"new lock", 0, true, lockEvent(db.LockBalanceEventLock, 100, 20), 100, 20},
+		{"add to lock", 100, false, lockEvent(db.LockBalanceEventLock, 50, 20), 150, 10},
+		{"partial foreclose", 100, false, lockEvent(db.LockBalanceEventForeclose, 30, 20), 70, 10},
+		{"relock after full foreclose", 0, false, lockEvent(db.LockBalanceEventLock, 30, 20), 30, 20},
+		// 赎回多于已知锁仓时保留负数
+		{"foreclose more than locked", 100, false, lockEvent(db.LockBalanceEventForeclose, 130, 20), -30, 10},
+		{"foreclose without lock", 0, true, lockEvent(db.LockBalanceEventForeclose, 30, 20), -30, 20},
+	}
+	for _, test := range tests {
+		var position *db.LockedBalanceEntity
+		if !test.noPosition {
+			position = &db.LockedBalanceEntity{Id: 1, LockType: db.LockTypeCitizen, OwnerAddr: testAddr1, TargetId: "1.6.5",
+				AssetId: "1.3.0", Amount: big.NewInt(test.positionAmount), FirstLockedBlockNum: 10, BlockNum: 10}
+		}
+		got := lockedBalanceAfterEvent(position, test.event)
+		if got.Amount.Int64() != test.wantAmount || got.FirstLockedBlockNum != test.wantFirstLockedBlockNum ||
+			got.BlockNum != test.event.BlockNum {
+			t.Errorf("%s: got amount %s first locked %d block %d, want %d %d %d", test.name, got.Amount.String(),
+				got.FirstLockedBlockNum, got.BlockNum, test.wantAmount, test.wantFirstLockedBlockNum, test.event.BlockNum)
+		}
+		if test.noPosition && got.Id != 0 {
+			t.Errorf("%s: new position should not have id", test.name)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const scriptApplyFunctionName = "apply_operation"
+const scriptCallTimeout = 5 * time.Second
+
+var sqlIdentifierPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// 用户写的lua脚本插件, 脚本需要定义全局函数 apply_operation(ctx),
+// ctx包含 block_num, block_time, miner, txid, op_num, op_type, op_type_name, op, receipt.
+// 脚本只能通过hx模块访问外部: hx.insert(table, row) 写白名单中的表, hx.emit(name, data) 写script_events表,
+// hx.json_decode(str) 和 hx.log(msg). 每次调用的写入在一个事务中, 脚本出错时全部回滚.
+// 白名单中的表需要有txid和op_num列(有script_name列时也自动填写), 重复扫描时先删除这个operation之前插入的行
+type ScriptPlugin struct {
+	Name          string
+	AllowedTables []string
+
+	state *lua.LState
+	// 白名单表的结构, 加载脚本时查询
+	tableSchemas map[string]*db.PgTableSchema
+
+	// 当前正在处理的operation和它的事务
+	currentBlock *types.HxBlock
+	currentTxid  string
+	currentOpNum int
+	currentExec  db.Executor
+	// hx.insert/hx.emit失败过(即使脚本用pcall忽略了错误), 需要回滚
+	currentWriteErr error
+}
+
+// 加载目录下所有.lua脚本, 每个脚本一个插件
+func LoadScriptPlugins(scriptsDir string, allowedTables []string) (result []*ScriptPlugin, err error) {
+	scriptPaths, err := filepath.Glob(filepath.Join(scriptsDir, "*.lua"))
+	if err != nil {
+		return
+	}
+	sort.Strings(scriptPaths)
+	for _, scriptPath := range scriptPaths {
+		var plugin *ScriptPlugin
+		plugin, err = NewScriptPlugin(scriptPath, allowedTables)
+		if err != nil {
+			err = errors.New("load script " + scriptPath + " error " + err.Error())
+			return
+		}
+		result = append(result, plugin)
+	}
+	return
+}
+
+func NewScriptPlugin(scriptPath string, allowedTables []string) (plugin *ScriptPlugin, err error) {
+	for _, tableName := range allowedTables {
+		if !sqlIdentifierPattern.MatchString(tableName) {
+			err = errors.New("invalid script table name " + tableName)
+			return
+		}
+	}
+	code, err := ioutil.ReadFile(scriptPath)
+	if err != nil {
+		return
+	}
+	tableSchemas := make(map[string]*db.PgTableSchema)
+	for _, tableName := range allowedTables {
+		var tableSchema *db.PgTableSchema
+		tableSchema, err = db.GetTableSchema(tableName)
+		if err != nil {
+			return
+		}
+		if !tableSchema.HasColumn("txid") || !tableSchema.HasColumn("op_num") {
+			err = errors.New("script table " + tableName + " requires txid and op_num columns")
+			return
+		}
+		tableSchemas[tableName] = tableSchema
+	}
+	plugin = &ScriptPlugin{
+		Name:          strings.TrimSuffix(filepath.Base(scriptPath), filepath.Ext(scriptPath)),
+		AllowedTables: allowedTables,
+		tableSchemas:  tableSchemas}
+	plugin.state = newSandboxLuaState()
+	plugin.state.SetGlobal("hx", plugin.newHxModule(plugin.state))
+	err = plugin.state.DoString(string(code))
+	if err != nil {
+		return
+	}
+	if plugin.state.GetGlobal(scriptApplyFunctionName).Type() != lua.LTFunction {
+		err = errors.New("script must define function " + scriptApplyFunctionName)
+		return
+	}
+	return
+}
+
+// 只打开没有文件/系统访问的标准库
+func newSandboxLuaState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+	return L
+}
+
+func (plugin *ScriptPlugin) newHxModule(L *lua.LState) *lua.LTable {
+	return L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
+		"insert":      plugin.luaInsert,
+		"emit":        plugin.luaEmit,
+		"json_decode": luaJSONDecode,
+		"log":         plugin.luaLog,
+	})
+}
+
+func (plugin *ScriptPlugin) PluginName() string {
+	return "ScriptPlugin(" + plugin.Name + ")"
+}
+
+func (plugin *ScriptPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	L := plugin.state
+	ctxTable := L.NewTable()
+	ctxTable.RawSetString("block_num", lua.LNumber(block.BlockNumber))
+	ctxTable.RawSetString("block_time", lua.LString(block.Timestamp))
+	ctxTable.RawSetString("miner", lua.LString(block.Miner))
+	ctxTable.RawSetString("txid", lua.LString(txid))
+	ctxTable.RawSetString("op_num", lua.LNumber(opNum))
+	ctxTable.RawSetString("op_type", lua.LNumber(opType))
+	ctxTable.RawSetString("op_type_name", lua.LString(opTypeName))
+	ctxTable.RawSetString("op", goValueToLua(L, opJSON))
+	if receipt != nil {
+		var receiptObj interface{}
+		receiptBytes, marshalErr := json.Marshal(receipt)
+		if marshalErr != nil {
+			err = marshalErr
+			return
+		}
+		err = json.Unmarshal(receiptBytes, &receiptObj)
+		if err != nil {
+			return
+		}
+		ctxTable.RawSetString("receipt", goValueToLua(L, receiptObj))
+	}
+
+	plugin.currentBlock = block
+	plugin.currentTxid = txid
+	plugin.currentOpNum = opNum
+	var callErr error
+	err = db.RunInTx(func(exec db.Executor) (err error) {
+		// 重复扫描时脚本会再次执行, 先删除这个operation之前的写入
+		err = db.DeleteScriptEventsOfOperation(exec, plugin.Name, txid, opNum)
+		if err != nil {
+			return
+		}
+		for _, tableName := range plugin.AllowedTables {
+			scriptName := ""
+			if plugin.tableSchemas[tableName].HasColumn("script_name") {
+				scriptName = plugin.Name
+			}
+			err = db.DeleteScriptRowsOfOperation(exec, tableName, scriptName, txid, opNum)
+			if err != nil {
+				return
+			}
+		}
+		callErr = plugin.callApply(exec, ctxTable)
+		return callErr
+	})
+	// 脚本出错或者超时时回滚这次调用的写入并记录日志, 不影响扫描
+	if callErr != nil {
+		logger.Println("[script "+plugin.Name+"] apply operation #"+strconv.Itoa(opNum)+" of tx "+txid+" error", callErr)
+		return nil
+	}
+	return
+}
+
+func (plugin *ScriptPlugin) callApply(exec db.Executor, ctxTable *lua.LTable) (err error) {
+	L := plugin.state
+	plugin.currentExec = exec
+	plugin.currentWriteErr = nil
+	defer func() {
+		plugin.currentExec = nil
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), scriptCallTimeout)
+	defer cancel()
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+	err = L.CallByParam(lua.P{
+		Fn:      L.GetGlobal(scriptApplyFunctionName),
+		NRet:    0,
+		Protect: true,
+	}, ctxTable)
+	if err == nil {
+		err = plugin.currentWriteErr
+	}
+	return
+}
+
+func (plugin *ScriptPlugin) luaInsert(L *lua.LState) int {
+	tableName := L.CheckString(1)
+	row := L.CheckTable(2)
+	if !isStringInArray(tableName, plugin.AllowedTables) {
+		L.RaiseError("table %s is not allowed for scripts", tableName)
+		return 0
+	}
+	rowValues, ok := luaValueToGo(row).(map[string]interface{})
+	if !ok {
+		L.RaiseError("row must be a table with string keys")
+		return 0
+	}
+	for colName, colValue := range rowValues {
+		if !sqlIdentifierPattern.MatchString(colName) {
+			L.RaiseError("invalid column name %s", colName)
+			return 0
+		}
+		if _, isFloat := colValue.(float64); !isFloat {
+			continue
+		}
+		// lua的整数在db中按整数保存
+		floatValue := colValue.(float64)
+		if floatValue == math.Trunc(floatValue) && math.Abs(floatValue) < (1<<53) {
+			rowValues[colName] = int64(floatValue)
+		}
+	}
+	// 用来在重复扫描时删除这个operation插入的行, 不能由脚本指定
+	rowValues["txid"] = plugin.currentTxid
+	rowValues["op_num"] = int64(plugin.currentOpNum)
+	tableSchema := plugin.tableSchemas[tableName]
+	if tableSchema.HasColumn("script_name") {
+		rowValues["script_name"] = plugin.Name
+	}
+	err := db.InsertDynamicRow(plugin.currentExec, tableName, tableSchema, rowValues)
+	if err != nil {
+		plugin.currentWriteErr = err
+		L.RaiseError("insert into %s error %s", tableName, err.Error())
+		return 0
+	}
+	return 0
+}
+
+func (plugin *ScriptPlugin) luaEmit(L *lua.LState) int {
+	eventName := L.CheckString(1)
+	data := luaValueToGo(L.Get(2))
+	dataBytes, err := json.Marshal(data)
+	if err != nil {
+		L.RaiseError("encode event data error %s", err.Error())
+		return 0
+	}
+	var blockNum uint32 = 0
+	if plugin.currentBlock != nil {
+		blockNum = uint32(plugin.currentBlock.BlockNumber)
+	}
+	event := &db.ScriptEventEntity{
+		ScriptName: plugin.Name,
+		EventName:  eventName,
+		Data:       string(dataBytes),
+		BlockNum:   blockNum,
+		Txid:       plugin.currentTxid,
+		OpNum:      plugin.currentOpNum}
+	err = db.SaveScriptEvent(plugin.currentExec, event)
+	if err != nil {
+		plugin.currentWriteErr = err
+		L.RaiseError("save script event error %s", err.Error())
+		return 0
+	}
+	return 0
+}
+
+func (plugin *ScriptPlugin) luaLog(L *lua.LState) int {
+	logger.Println("[script " + plugin.Name + "] " + L.CheckString(1))
+	return 0
+}
+
+func luaJSONDecode(L *lua.LState) int {
+	jsonStr := L.CheckString(1)
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(jsonStr))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		L.Push(lua.LNil)
+		L.Push(lua.LString(err.Error()))
+		return 2
+	}
+	L.Push(goValueToLua(L, value))
+	return 1
+}
+
+func goValueToLua(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case nil:
+		return lua.LNil
+	case bool:
+		return lua.LBool(v)
+	case string:
+		return lua.LString(v)
+	case json.Number:
+		// 超出lua number精度的整数保留为字符串
+		if !strings.ContainsAny(v.String(), ".eE") {
+			intValue, err := v.Int64()
+			if err == nil && intValue > -(1<<53) && intValue < (1<<53) {
+				return lua.LNumber(intValue)
+			}
+			return lua.LString(v.String())
+		}
+		if floatValue, err := v.Float64(); err == nil {
+			return lua.LNumber(floatValue)
+		}
+		return lua.LString(v.String())
+	case float64:
+		return lua.LNumber(v)
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case uint32:
+		return lua.LNumber(v)
+	case uint64:
+		return lua.LNumber(v)
+	case map[string]interface{}:
+		table := L.NewTable()
+		for key, item := range v {
+			table.RawSetString(key, goValueToLua(L, item))
+		}
+		return table
+	case []interface{}:
+		table := L.NewTable()
+		for _, item := range v {
+			table.Append(goValueToLua(L, item))
+		}
+		return table
+	default:
+		valueBytes, err := json.Marshal(v)
+		if err != nil {
+			return lua.LNil
+		}
+		var decoded interface{}
+		if json.Unmarshal(valueBytes, &decoded) != nil {
+			return lua.LNil
+		}
+		return goValueToLua(L, decoded)
+	}
+}
+
+// lua table如果key是1..n则转成数组, 否则转成map
+func luaValueToGo(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		return float64(v)
+	case *lua.LTable:
+		arrayLen := v.Len()
+		isArray := arrayLen > 0
+		v.ForEach(func(key lua.LValue, _ lua.LValue) {
+			if _, isNumber := key.(lua.LNumber); !isNumber {
+				isArray = false
+			}
+		})
+		if isArray {
+			result := make([]interface{}, 0, arrayLen)
+			for i := 1; i <= arrayLen; i++ {
+				result = append(result, luaValueToGo(v.RawGetInt(i)))
+			}
+			return result
+		}
+		result := make(map[string]interface{})
+		v.ForEach(func(key lua.LValue, item lua.LValue) {
+			result[key.String()] = luaValueToGo(item)
+		})
+		return result
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,89 @@
+package plugins
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/blocklink/hxscanner/src/config"
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/nodeservice"
+)
+
+// event arg: {from: ownerAddr, spender: spenderAddr, amount: newAllowance}
+func decodeApprovedEventArg(eventArg string) (ownerAddr string, spenderAddr string, amount *big.Int, err error) {
+	argObj, err := decodeJSONObjUseNumber(eventArg)
+	if err != nil {
+		return
+	}
+	ownerAddr, _ = mapGetString(argObj, "from")
+	spenderAddr, _ = mapGetString(argObj, "spender")
+	amount, ok := getBigIntPropFromJSONObj(argObj, "amount")
+	if !ok || len(ownerAddr) < 1 || len(spenderAddr) < 1 {
+		err = errors.New("invalid approved event arg " + eventArg)
+	}
+	return
+}
+
+// approvedBalanceFrom参数是 spenderAddress,authorizerAddress
+func queryTokenAllowance(contractId string, ownerAddr string, spenderAddr string) (*big.Int, error) {
+	return nodeservice.InvokeContractOfflineWithBigIntResult(config.SystemConfig.CallerPubKeyString, contractId,
+		"approvedBalanceFrom", spenderAddr+","+ownerAddr)
+}
+
+// 记录授权变化并刷新token_allowances. 优先用节点approvedBalanceFrom的结果, 查询失败时根据变化计算.
+// 变化记录和额度在同一个事务中写入
+func applyTokenAllowanceChange(change *db.TokenAllowanceChangeEntity) (err error) {
+	old, err := db.FindTokenAllowanceChange(change.Txid, change.OpNum, change.EventIndex)
+	if err != nil || old != nil {
+		return
+	}
+	allowance, err := db.FindTokenAllowance(change.ContractAddr, change.OwnerAddr, change.SpenderAddr)
+	if err != nil {
+		return
+	}
+	newAmount, queryErr := queryTokenAllowance(change.ContractAddr, change.OwnerAddr, change.SpenderAddr)
+	if queryErr != nil {
+		logger.Println("query approvedBalanceFrom of "+change.OwnerAddr+" to "+change.SpenderAddr+" error", queryErr)
+		if change.ChangeType == db.TokenAllowanceChangeApprove {
+			newAmount = change.Amount
+		} else {
+			newAmount = big.NewInt(0)
+			if allowance != nil {
+				newAmount.Add(allowance.Amount, change.Amount)
+			}
+			if newAmount.Sign() < 0 {
+				newAmount.SetInt64(0)
+			}
+		}
+	}
+	return db.RunInTx(func(exec db.Executor) (err error) {
+		err = db.SaveTokenAllowanceChange(exec, change)
+		if err != nil {
+			return
+		}
+		if allowance == nil {
+			return db.SaveTokenAllowance(exec, &db.TokenAllowanceEntity{
+				ContractAddr: change.ContractAddr,
+				OwnerAddr:    change.OwnerAddr,
+				SpenderAddr:  change.SpenderAddr,
+				Amount:       newAmount,
+				BlockNum:     change.BlockNum})
+		}
+		allowance.Amount = newAmount
+		allowance.BlockNum = change.BlockNum
+		return db.UpdateTokenAllowance(exec, allowance)
+	})
+}
+
+// 直接调用token合约transferFrom的operation, 返回调用者地址
+func transferFromSpenderOf(opTypeName string, opJSON map[string]interface{}, contractId string) (spenderAddr string, ok bool) {
+	if opTypeName != "contract_invoke_operation" {
+		return
+	}
+	contractApi, _ := mapGetString(opJSON, "contract_api")
+	invokedContractId, _ := mapGetString(opJSON, "contract_id")
+	if contractApi != "transferFrom" || invokedContractId != contractId {
+		return
+	}
+	return mapGetString(opJSON, "caller_addr")
+}
@@ -29,9 +29,12 @@ type contractRegisterOperation struct {
 	ContractId string
 	GasPrice uint64
 	GasLimit uint64
+	Events []string
+	StorageProperties interface{}
+	CodeHash string
 }
 
-func decodeTokenRegisterOperation(opJSON map[string]interface{}) (result *contractRegisterOperation, err error) {
+func decodeContractRegisterOperation(opJSON map[string]interface{}) (result *contractRegisterOperation, err error) {
 	result = new(contractRegisterOperation)
 	contractCode, ok := opJSON["contract_code"] // json of {abi: Array[string], offline_abi: Array[string], storage_properties: Array[Array[string]], code_hash: "", events: Array[string]}
 	if !ok {
@@ -66,6 +69,11 @@ func decodeTokenRegisterOperation(opJSON map[string]interface{}) (result *contra
 		return
 	}
 	result.OfflineAbi = offlineAbi
+	if eventsObj, ok := contractCodeMap["events"]; ok {
+		result.Events, _ = objToStringArray(eventsObj)
+	}
+	result.StorageProperties = contractCodeMap["storage_properties"]
+	result.CodeHash, _ = getStringPropFromJSONObj(contractCodeMap, "code_hash")
 	ownerPubkey, ok := getStringPropFromJSONObj(opJSON, "owner_pubkey")
 	if !ok {
 		err = errors.New("owner_pubkey not found")
@@ -141,9 +149,9 @@ func queryTokenContractBaseInfo(contractId string) (tokenName string, tokenSymbo
 	return
 }
 
-func queryTokenContractTotalSupply(contractId string) (totalSupply int64, err error) {
+func queryTokenContractTotalSupply(contractId string) (totalSupply *big.Int, err error) {
 	conf := config.SystemConfig
-	totalSupply, err = nodeservice.InvokeContractOfflineWithIntResult(conf.CallerPubKeyString, contractId, "totalSupply", "")
+	totalSupply, err = nodeservice.InvokeContractOfflineWithBigIntResult(conf.CallerPubKeyString, contractId, "totalSupply", "")
 	if err != nil {
 		return
 	}
@@ -160,7 +168,7 @@ func (plugin *TokenContractCreateScanPlugin) ApplyOperation(block *types.HxBlock
 			return
 		}
 		var contractOp *contractRegisterOperation
-		contractOp, err = decodeTokenRegisterOperation(opJSON)
+		contractOp, err = decodeContractRegisterOperation(opJSON)
 		if err != nil {
 			logger.Println("decode token register operation error", err)
 			return
@@ -185,14 +193,10 @@ func (plugin *TokenContractCreateScanPlugin) ApplyOperation(block *types.HxBlock
 			tokenSymbol = nil
 			precision = nil
 		}
-		totalSupply := new(int64)
-		totalSupplyBig := big.NewInt(0)
-		*totalSupply, err = queryTokenContractTotalSupply(contractOp.ContractId)
+		var totalSupplyBig *big.Int
+		totalSupplyBig, err = queryTokenContractTotalSupply(contractOp.ContractId)
 		if err != nil {
-			totalSupply = nil
 			totalSupplyBig = nil
-		} else {
-			totalSupplyBig = big.NewInt(*totalSupply)
 		}
 		// save to db
 		var dbTokenContract *db.TokenContractEntity
@@ -233,9 +237,89 @@ func (plugin *TokenContractCreateScanPlugin) ApplyOperation(block *types.HxBlock
 			logger.Println("receive fail contract tx " + txid)
 			return
 		}
-		// TODO
+		var nativeOp *nativeContractRegisterOperation
+		nativeOp, err = decodeNativeContractRegisterOperation(opJSON)
+		if err != nil {
+			logger.Println("decode native contract register operation error", err)
+			return
+		}
+		// 原生合约本身由ContractRegistryPlugin记录到contracts
+		if nativeOp.NativeContractKey != db.NativeContractKeyToken {
+			return
+		}
+		// 原生token合约和lua token合约写入同样的表, Transfer等事件由TokenContractInvokeScanPlugin处理
+		logger.Println("found a native token contract")
+		var dbTokenContract *db.TokenContractEntity
+		dbTokenContract, err = db.FindTokenContractByContractId(nativeOp.ContractId)
+		if err != nil || dbTokenContract != nil {
+			return
+		}
+		dbTokenContract = &db.TokenContractEntity{
+			BlockNum:     uint32(block.BlockNumber),
+			BlockTime:    block.Timestamp,
+			Txid:         txid,
+			ContractId:   nativeOp.ContractId,
+			ContractType: "native_" + nativeOp.NativeContractKey,
+			OwnerPubkey:  nativeOp.OwnerPubKey,
+			OwnerAddr:    nativeOp.OwnerAddr,
+			RegisterTime: nativeOp.RegisterTime,
+			InheritFrom:  "",
+			GasPrice:     nativeOp.GasPrice,
+			GasLimit:     nativeOp.GasLimit}
+		// 注册时还没有init_token, 查询失败时等Inited事件再更新
+		tokenName, tokenSymbol, precision, queryErr := queryTokenContractBaseInfo(nativeOp.ContractId)
+		if queryErr == nil {
+			dbTokenContract.TokenName = &tokenName
+			dbTokenContract.TokenSymbol = &tokenSymbol
+			dbTokenContract.Precision = &precision
+		}
+		totalSupply, queryErr := queryTokenContractTotalSupply(nativeOp.ContractId)
+		if queryErr == nil {
+			dbTokenContract.TotalSupply = totalSupply
+		}
+		err = db.SaveTokenContract(dbTokenContract)
+		if err != nil {
+			return
+		}
 	} else {
 		return
 	}
 	return
-}
\ No newline at end of file
+}
+
+type nativeContractRegisterOperation struct {
+	ContractId        string
+	NativeContractKey string
+	OwnerPubKey       string
+	OwnerAddr         string
+	RegisterTime      string
+	GasPrice          uint64
+	GasLimit          uint64
+}
+
+func decodeNativeContractRegisterOperation(opJSON map[string]interface{}) (result *nativeContractRegisterOperation, err error) {
+	result = new(nativeContractRegisterOperation)
+	var ok bool
+	result.ContractId, ok = getStringPropFromJSONObj(opJSON, "contract_id")
+	if !ok {
+		err = errors.New("contract_id not found")
+		return
+	}
+	result.NativeContractKey, ok = getStringPropFromJSONObj(opJSON, "native_contract_key")
+	if !ok {
+		err = errors.New("native_contract_key not found")
+		return
+	}
+	result.OwnerAddr, ok = getStringPropFromJSONObj(opJSON, "owner_addr")
+	if !ok {
+		err = errors.New("owner_addr not found")
+		return
+	}
+	result.OwnerPubKey, _ = getStringPropFromJSONObj(opJSON, "owner_pubkey")
+	result.RegisterTime, _ = getStringPropFromJSONObj(opJSON, "register_time")
+	gasPrice, _ := getIntPropFromJSONObj(opJSON, "gas_price")
+	result.GasPrice = uint64(gasPrice)
+	gasLimit, _ := getIntPropFromJSONObj(opJSON, "init_cost")
+	result.GasLimit = uint64(gasLimit)
+	return
+}
@@ -3,15 +3,18 @@ package plugins
 import (
 	"github.com/blocklink/hxscanner/src/types"
 	"github.com/blocklink/hxscanner/src/db"
-	"encoding/json"
+	"errors"
 	"time"
 	"github.com/shopspring/decimal"
-	"fmt"
 	"github.com/blocklink/hxscanner/src/nodeservice"
 	"github.com/blocklink/hxscanner/src/config"
 	"math/big"
+	"github.com/blocklink/hxscanner/src/sink"
+	"strconv"
 )
 
+const tokenBalanceChangesBackfillCursorKey = "token_balance_changes_backfill_cursor"
+
 // 扫描token合约的,init_token后触发事件导致state变化也要扫描. transfer记录，得到合约转账记录历史信息等
 
 type TokenContractInvokeScanPlugin struct {
@@ -21,6 +24,26 @@ func (plugin *TokenContractInvokeScanPlugin) PluginName() string {
 	return "TokenContractInvokeScanPlugin"
 }
 
+func tokenTransferRecord(block *types.HxBlock, txid string, opNum int, contractId string, from string, to string,
+	amount decimal.Decimal, eventName string) *sink.Record {
+	return &sink.Record{Kind: sink.RecordKindTokenTransfer, BlockNum: uint32(block.BlockNumber), Txid: txid, OpNum: opNum,
+		Data: map[string]interface{}{"contract_addr": contractId, "from_addr": from, "to_addr": to,
+			"amount": amount.String(), "event_name": eventName, "tx_time": block.Timestamp}}
+}
+
+// sink落后时从已保存的转账历史重新输出token_transfer记录. balance_change记录是扫描时查询的节点当前余额, 不重放
+func (plugin *TokenContractInvokeScanPlugin) ReplayOperationRecords(block *types.HxBlock, txid string, opNum int) (err error) {
+	transfers, err := db.ListTokenContractTransferHistoryOfOperation(txid, opNum)
+	if err != nil {
+		return
+	}
+	for _, transfer := range transfers {
+		sink.Emit(tokenTransferRecord(block, txid, opNum, transfer.ContractAddr, transfer.FromAddr, transfer.ToAddr,
+			transfer.Amount, transfer.EventName))
+	}
+	return
+}
+
 func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
 	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
 	if receipt == nil || !receipt.ExecSucceed {
@@ -44,7 +67,7 @@ func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock
 		logger.Println("parse block timestamp error", err)
 		return
 	}
-	for _, event := range receipt.Events {
+	for eventIndex, event := range receipt.Events {
 		contractId := event.ContractAddress
 		var isToken bool
 		isToken, err = isTokenContract(contractId)
@@ -56,7 +79,6 @@ func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock
 		}
 		eventName := event.EventName
 		eventArg := event.EventArg
-		eventArgBytes := []byte(eventArg)
 		switch eventName {
 		case "Inited":
 			{
@@ -79,11 +101,10 @@ func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock
 						tokenContract.TokenSymbol = tokenSymbol
 						tokenContract.Precision = precision
 					}
-					totalSupply := new(int64)
-					*totalSupply, err = queryTokenContractTotalSupply(contractId)
+					var totalSupply *big.Int
+					totalSupply, err = queryTokenContractTotalSupply(contractId)
 					if err == nil {
-						totalSupplyBig := big.NewInt(*totalSupply)
-						tokenContract.TotalSupply = totalSupplyBig
+						tokenContract.TotalSupply = totalSupply
 					}
 
 					err = db.UpdateTokenContract(tokenContract)
@@ -95,49 +116,42 @@ func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock
 			}
 		case "Transfer":
 			{
-				// event arg: {from: ..., to: ..., amount}
-				type transferEventArgType struct {
-					From   string `json:"from"`
-					To     string `json:"to"`
-					Amount uint64 `json:"amount"`
-				}
-				transferArg := new(transferEventArgType)
-				err = json.Unmarshal(eventArgBytes, transferArg)
+				// event arg: {from: ..., to: ..., amount}, amount可能超过uint64
+				var transferArg *transferEventArg
+				transferArg, err = decodeTransferEventArg(eventArg)
 				if err != nil {
 					logger.Println("invalid transfer token event arg " + eventArg)
 					continue
 				}
-				var historyItem *db.TokenContractTransferHistoryEntity
-				historyItem, err = db.FindTokenContractTransferHistoryItemByTxIdAndOpNum(txid, opNum)
+				transferAmountDecimal := decimal.NewFromBigInt(transferArg.Amount, 0)
+				err = saveTokenTransferHistoryIfNew(contractId, uint32(block.BlockNumber), txTime, txid, opNum, eventIndex, eventName,
+					transferArg)
 				if err != nil {
-					logger.Println("find token transfer history error", err)
+					logger.Println("save token transfer history error", err)
 					continue
 				}
-				var transferAmountDecimal decimal.Decimal
-				transferAmountDecimal, err = decimal.NewFromString(fmt.Sprintf("%d", transferArg.Amount))
+				sink.Emit(tokenTransferRecord(block, txid, opNum, contractId, transferArg.From, transferArg.To, transferAmountDecimal,
+					eventName))
+				err = saveTokenBalanceChangesOfTransfer(contractId, uint32(block.BlockNumber), txid, opNum, eventIndex, transferArg)
 				if err != nil {
-					logger.Println("decimal from int error", err)
-					continue
+					logger.Println("save token balance changes error", err)
+					return
 				}
-				if historyItem == nil {
-					// save transfer tx to token history table
-					now := time.Now()
-					historyItem = &db.TokenContractTransferHistoryEntity{
+				// transferFrom由调用者(spender)花费from授权的额度
+				if spenderAddr, ok := transferFromSpenderOf(opTypeName, opJSON, contractId); ok && len(transferArg.From) > 0 {
+					err = applyTokenAllowanceChange(&db.TokenAllowanceChangeEntity{
 						ContractAddr: contractId,
-						FromAddr: transferArg.From,
-						ToAddr: transferArg.To,
-						Amount: transferAmountDecimal,
+						OwnerAddr: transferArg.From,
+						SpenderAddr: spenderAddr,
+						ChangeType: db.TokenAllowanceChangeTransferFrom,
+						Amount: new(big.Int).Neg(transferArg.Amount),
 						BlockNum: uint32(block.BlockNumber),
 						Txid: txid,
-						OpNum: uint32(opNum),
-						EventName: eventName,
-						TxTime: txTime,
-						CreatedAt: now,
-						UpdatedAt: now}
-					err = db.SaveTokenContractTransferHistory(historyItem)
+						OpNum: opNum,
+						EventIndex: eventIndex})
 					if err != nil {
-						logger.Println("save token transfer history error", err)
-						continue
+						logger.Println("save token allowance error", err)
+						return
 					}
 				}
 				// query and save from/to users(maybe same or empty) new token balance
@@ -150,8 +164,8 @@ func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock
 				}
 				now := time.Now()
 				for _, userAddr := range usersToUpdate {
-					var userBalance int64
-					userBalance, err = nodeservice.InvokeContractOfflineWithIntResult(config.SystemConfig.CallerPubKeyString, contractId, "balanceOf", userAddr)
+					var userBalance *big.Int
+					userBalance, err = nodeservice.InvokeContractOfflineWithBigIntResult(config.SystemConfig.CallerPubKeyString, contractId, "balanceOf", userAddr)
 					if err != nil {
 						logger.Println("query token balance of " + userAddr + " in contract " + contractId + " error")
 						continue
@@ -162,11 +176,7 @@ func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock
 						logger.Println("FindTokenBalanceByContractAddrAndOwnerAddr error", err)
 						return
 					}
-					var userBalanceDecimal decimal.Decimal
-					userBalanceDecimal, err = decimal.NewFromString(fmt.Sprintf("%d", userBalance))
-					if err != nil {
-						return
-					}
+					userBalanceDecimal := decimal.NewFromBigInt(userBalance, 0)
 					if tokenBalanceItem == nil {
 						tokenBalanceItem = &db.TokenBalanceEntity{
 							ContractAddr: contractId,
@@ -188,17 +198,18 @@ func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock
 							return
 						}
 					}
+					sink.Emit(&sink.Record{Kind: sink.RecordKindBalanceChange, BlockNum: uint32(block.BlockNumber), Txid: txid, OpNum: opNum,
+						Data: map[string]interface{}{"owner_addr": userAddr, "contract_addr": contractId, "amount": userBalanceDecimal.String()}})
 				}
 				// if fromAddr or toAddr is empty, query totalSupply from node
 				if len(transferArg.From) < 1 || len(transferArg.To) < 1 {
 					var tokenContract *db.TokenContractEntity
 					tokenContract, err = db.FindTokenContractByContractId(contractId)
 					if err == nil {
-						totalSupply := new(int64)
-						*totalSupply, err = queryTokenContractTotalSupply(contractId)
+						var totalSupply *big.Int
+						totalSupply, err = queryTokenContractTotalSupply(contractId)
 						if err == nil {
-							totalSupplyBig := big.NewInt(*totalSupply)
-							tokenContract.TotalSupply = totalSupplyBig
+							tokenContract.TotalSupply = totalSupply
 							err = db.UpdateTokenContract(tokenContract)
 							if err != nil {
 								logger.Println("update token contract totalSupply error", err)
@@ -210,47 +221,188 @@ func (plugin *TokenContractInvokeScanPlugin) ApplyOperation(block *types.HxBlock
 			}
 		case "Approved":
 			{
-				// TODO
+				ownerAddr, spenderAddr, amount, decodeErr := decodeApprovedEventArg(eventArg)
+				if decodeErr != nil {
+					logger.Println(decodeErr.Error())
+					continue
+				}
+				err = applyTokenAllowanceChange(&db.TokenAllowanceChangeEntity{
+					ContractAddr: contractId,
+					OwnerAddr: ownerAddr,
+					SpenderAddr: spenderAddr,
+					ChangeType: db.TokenAllowanceChangeApprove,
+					Amount: amount,
+					BlockNum: uint32(block.BlockNumber),
+					Txid: txid,
+					OpNum: opNum,
+					EventIndex: eventIndex})
+				if err != nil {
+					logger.Println("save token allowance error", err)
+					return
+				}
 			}
 		default:
 			continue
 		}
 	}
-	// process contract withdraws
-	for _, change := range receipt.DepositToAddressChanges {
-		var ok bool
-		changeItem, ok := change.([]interface{})
-		if !ok {
-			continue
+	return
+}
+
+// 一个操作可以有多个Transfer事件, 每个事件按(txid, op_num, event_index)保存一条记录
+func saveTokenTransferHistoryIfNew(contractId string, blockNum uint32, txTime time.Time, txid string, opNum int, eventIndex int,
+	eventName string, transferArg *transferEventArg) (err error) {
+	historyItem, err := db.FindTokenContractTransferHistoryItem(txid, opNum, eventIndex)
+	if err != nil || historyItem != nil {
+		return
+	}
+	now := time.Now()
+	return db.SaveTokenContractTransferHistory(&db.TokenContractTransferHistoryEntity{
+		ContractAddr: contractId,
+		FromAddr: transferArg.From,
+		ToAddr: transferArg.To,
+		Amount: decimal.NewFromBigInt(transferArg.Amount, 0),
+		BlockNum: blockNum,
+		Txid: txid,
+		OpNum: uint32(opNum),
+		EventIndex: eventIndex,
+		EventName: eventName,
+		TxTime: txTime,
+		CreatedAt: now,
+		UpdatedAt: now})
+}
+
+type transferEventArg struct {
+	From   string
+	To     string
+	Amount *big.Int
+}
+
+func decodeTransferEventArg(eventArg string) (result *transferEventArg, err error) {
+	argObj, err := decodeJSONObjUseNumber(eventArg)
+	if err != nil {
+		return
+	}
+	amount, ok := getBigIntPropFromJSONObj(argObj, "amount")
+	if !ok {
+		err = errors.New("invalid transfer amount")
+		return
+	}
+	result = &transferEventArg{Amount: amount}
+	result.From, _ = mapGetString(argObj, "from")
+	result.To, _ = mapGetString(argObj, "to")
+	return
+}
+
+// Transfer事件的from/to余额变化写入token_balance_changes, 自己转给自己时不记录
+func saveTokenBalanceChangesOfTransfer(contractId string, blockNum uint32, txid string, opNum int, eventIndex int,
+	transferArg *transferEventArg) (err error) {
+	fromAddr := transferArg.From
+	toAddr := transferArg.To
+	amount := transferArg.Amount
+	if fromAddr == toAddr || amount.Sign() == 0 {
+		return
+	}
+	changes := make([]*db.TokenBalanceChangeEntity, 0)
+	if len(fromAddr) > 0 {
+		changes = append(changes, &db.TokenBalanceChangeEntity{ContractAddr: contractId, OwnerAddr: fromAddr,
+			Amount: new(big.Int).Neg(amount), BlockNum: blockNum, Txid: txid, OpNum: opNum, EventIndex: eventIndex})
+	}
+	if len(toAddr) > 0 {
+		changes = append(changes, &db.TokenBalanceChangeEntity{ContractAddr: contractId, OwnerAddr: toAddr,
+			Amount: amount, BlockNum: blockNum, Txid: txid, OpNum: opNum, EventIndex: eventIndex})
+	}
+	for _, change := range changes {
+		var old *db.TokenBalanceChangeEntity
+		old, err = db.FindTokenBalanceChange(change.Txid, change.OpNum, change.EventIndex, change.OwnerAddr)
+		if err != nil {
+			return
 		}
-		if len(changeItem) < 2 {
+		if old != nil {
 			continue
 		}
-		addressAssetPair, ok := changeItem[0].([]interface{})
-		if !ok {
-			continue
+		err = db.SaveTokenBalanceChange(change)
+		if err != nil {
+			return
 		}
-		if len(addressAssetPair) < 2 {
-			continue
+	}
+	return
+}
+
+// 从contract_operation_receipt_event中已经保存的token合约Transfer事件回填token_balance_changes, 进度保存在scan_configs中.
+// 同时补上旧版本每个操作只保存第一个Transfer事件时漏掉的转账历史
+func BackfillTokenBalanceChanges(batchSize int) (count int, err error) {
+	cursorStr, err := db.GetScanConfigOr(tokenBalanceChangesBackfillCursorKey, "0")
+	if err != nil {
+		return
+	}
+	cursor, err := strconv.ParseInt(cursorStr, 10, 64)
+	if err != nil {
+		return
+	}
+	contractIsTokenCache := make(map[string]bool)
+	for {
+		var events []*db.ContractEventEntity
+		events, err = db.ListContractEventsByNameAfterId("Transfer", cursor, batchSize)
+		if err != nil {
+			return
 		}
-		addr, ok := addressAssetPair[0].(string)
-		if !ok {
-			continue
+		if len(events) < 1 {
+			return
 		}
-		assetId, ok := addressAssetPair[1].(string)
-		if !ok {
-			continue
+		for _, event := range events {
+			cursor = event.Id
+			isToken, ok := contractIsTokenCache[event.ContractAddress]
+			if !ok {
+				var tokenContract *db.TokenContractEntity
+				tokenContract, err = db.FindTokenContractByContractId(event.ContractAddress)
+				if err != nil {
+					return
+				}
+				isToken = tokenContract != nil
+				contractIsTokenCache[event.ContractAddress] = isToken
+			}
+			if !isToken {
+				continue
+			}
+			transferArg, decodeErr := decodeTransferEventArg(event.EventArg)
+			if decodeErr != nil {
+				logger.Println("invalid transfer token event arg " + event.EventArg)
+				continue
+			}
+			// 扫描时的eventIndex是事件在回执中的位置, 事件按回执中的顺序保存
+			var opEvents []*db.ContractEventEntity
+			opEvents, err = db.ListContractEventsOfOperation(event.Trxid, event.OpNum)
+			if err != nil {
+				return
+			}
+			eventIndex := 0
+			for i, opEvent := range opEvents {
+				if opEvent.Id == event.Id {
+					eventIndex = i
+					break
+				}
+			}
+			err = saveTokenBalanceChangesOfTransfer(event.ContractAddress, event.BlockNum, event.Trxid, event.OpNum, eventIndex,
+				transferArg)
+			if err != nil {
+				return
+			}
+			var txTime time.Time
+			txTime, err = blockTimeOf(event.BlockNum)
+			if err != nil {
+				return
+			}
+			err = saveTokenTransferHistoryIfNew(event.ContractAddress, event.BlockNum, txTime, event.Trxid, event.OpNum, eventIndex,
+				event.EventName, transferArg)
+			if err != nil {
+				return
+			}
+			count++
 		}
-		//amount, ok := changeItem[1].(json.Number)
-		//if !ok {
-		//	amountT := reflect.TypeOf(changeItem[1])
-		//	logger.Println("invalid deposit_address type " + amountT.String())
-		//	continue
-		//}
-		err = updateAddressBalance(addr, assetId)
+		err = db.SetScanConfig(tokenBalanceChangesBackfillCursorKey, strconv.FormatInt(cursor, 10))
 		if err != nil {
 			return
 		}
+		logger.Println("backfilled token balance changes to contract event id " + strconv.FormatInt(cursor, 10))
 	}
-	return
 }
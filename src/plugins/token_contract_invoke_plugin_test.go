@@ -0,0 +1,44 @@
+package plugins
+
+import (
+	"testing"
+)
+
+func TestDecodeTransferEventArg(t *testing.T) {
+	tests := []struct {
+		eventArg   string
+		wantFrom   string
+		wantTo     string
+		wantAmount string
+		wantErr    bool
+	}{
+		{`{"from": "` + testAddr1 + `", "to": "` + testAddr2 + `", "amount": 100}`, testAddr1, testAddr2, "100", false},
+		// 超过uint64的金额不能丢失精度
+		{`{"from": "` + testAddr1 + `", "to": "` + testAddr2 + `", "amount": 123456789012345678901234567890}`,
+			testAddr1, testAddr2, "123456789012345678901234567890", false},
+		{`{"from": "` + testAddr1 + `", "to": "` + testAddr2 + `", "amount": "18446744073709551616"}`,
+			testAddr1, testAddr2, "18446744073709551616", false},
+		// mint只有to
+		{`{"to": "` + testAddr2 + `", "amount": 5}`, "", testAddr2, "5", false},
+		{`{"from": "` + testAddr1 + `", "to": "` + testAddr2 + `"}`, "", "", "", true},
+		{`{"from": "` + testAddr1 + `", "to": "` + testAddr2 + `", "amount": 1.5}`, "", "", "", true},
+		{`not json`, "", "", "", true},
+	}
+	for _, test := range tests {
+		arg, err := decodeTransferEventArg(test.eventArg)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("decodeTransferEventArg(%s) should fail", test.eventArg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("decodeTransferEventArg(%s) error: %s", test.eventArg, err.Error())
+			continue
+		}
+		if arg.From != test.wantFrom || arg.To != test.wantTo || arg.Amount.String() != test.wantAmount {
+			t.Errorf("decodeTransferEventArg(%s) = %s %s %s, want %s %s %s", test.eventArg, arg.From, arg.To,
+				arg.Amount.String(), test.wantFrom, test.wantTo, test.wantAmount)
+		}
+	}
+}
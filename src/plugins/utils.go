@@ -1,8 +1,11 @@
 package plugins
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/blocklink/hxscanner/src/log"
+	"math/big"
 )
 
 var logger = log.GetLogger()
@@ -47,6 +50,14 @@ func objToStringArray(src interface{}) (result []string, ok bool) {
 	return
 }
 
+func mapGetString(m map[string]interface{}, key string) (val string, ok bool) {
+	valObj, ok := m[key]
+	if ok {
+		val, ok = valObj.(string)
+	}
+	return
+}
+
 func getStringPropFromJSONObj(jsonObj map[string]interface{}, prop string) (result string, ok bool) {
 	item, ok := jsonObj[prop]
 	if !ok {
@@ -85,3 +96,40 @@ func getIntPropFromJSONObj(jsonObj map[string]interface{}, prop string) (result
 	return
 }
 
+
+// 整数金额可能是json数字也可能是字符串, 统一转成big.Int
+func objToBigInt(itemObj interface{}) (result *big.Int, ok bool) {
+	var itemStr string
+	switch item := itemObj.(type) {
+	case json.Number:
+		itemStr = item.String()
+	case string:
+		itemStr = item
+	case int, int32, int64, uint32, uint64:
+		itemStr = fmt.Sprintf("%d", item)
+	case float64:
+		itemStr = big.NewFloat(item).Text('f', 0)
+	default:
+		ok = false
+		return
+	}
+	result, ok = new(big.Int).SetString(itemStr, 10)
+	return
+}
+
+func getBigIntPropFromJSONObj(jsonObj map[string]interface{}, prop string) (result *big.Int, ok bool) {
+	itemObj, ok := jsonObj[prop]
+	if !ok {
+		return
+	}
+	result, ok = objToBigInt(itemObj)
+	return
+}
+
+// 解析json object, 数字保留为json.Number
+func decodeJSONObjUseNumber(jsonStr string) (result map[string]interface{}, err error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(jsonStr)))
+	decoder.UseNumber()
+	err = decoder.Decode(&result)
+	return
+}
@@ -0,0 +1,121 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+)
+
+const webhookSignatureHeader = "X-Hxscanner-Signature"
+const webhookDeliveryHeader = "X-Hxscanner-Delivery"
+
+var webhookHttpClient = &http.Client{Timeout: 10 * time.Second}
+
+// payload的HMAC-SHA256签名, 接收方用同样的secret校验
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// 第n次失败后的重试间隔, 指数退避, 最多1小时
+func webhookRetryDelay(attempts int) time.Duration {
+	if attempts > 12 {
+		return time.Hour
+	}
+	delay := time.Duration(1<<uint(attempts)) * time.Second
+	if delay > time.Hour {
+		delay = time.Hour
+	}
+	return delay
+}
+
+func postWebhook(endpoint *WebhookEndpoint, item *db.WebhookOutboxEntity) (err error) {
+	payloadBytes := []byte(item.Payload)
+	req, err := http.NewRequest("POST", item.Url, bytes.NewReader(payloadBytes))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatInt(item.Id, 10))
+	if len(endpoint.Secret) > 0 {
+		req.Header.Set(webhookSignatureHeader, SignWebhookPayload(endpoint.Secret, payloadBytes))
+	}
+	resp, err := webhookHttpClient.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = errors.New(fmt.Sprintf("webhook endpoint responded status %d", resp.StatusCode))
+		return
+	}
+	return
+}
+
+func deliverWebhookOutboxItem(endpoints map[string]*WebhookEndpoint, item *db.WebhookOutboxEntity) error {
+	now := time.Now()
+	endpoint, ok := endpoints[item.EndpointName]
+	var deliverErr error
+	if !ok {
+		deliverErr = errors.New("webhook endpoint " + item.EndpointName + " not configured")
+	} else {
+		deliverErr = postWebhook(endpoint, item)
+	}
+	item.Attempts++
+	item.UpdatedAt = now
+	if deliverErr == nil {
+		item.Status = db.WebhookOutboxStatusDelivered
+		item.DeliveredAt = &now
+		item.LastError = nil
+	} else {
+		errStr := deliverErr.Error()
+		item.LastError = &errStr
+		if !ok || item.Attempts >= endpoint.MaxAttempts {
+			item.Status = db.WebhookOutboxStatusFailed
+		} else {
+			item.NextAttemptAt = now.Add(webhookRetryDelay(item.Attempts))
+		}
+		logger.Println("deliver webhook #" + strconv.FormatInt(item.Id, 10) + " to " + item.EndpointName + " error " + errStr)
+	}
+	return db.UpdateWebhookOutboxItemDelivery(item)
+}
+
+// 后台循环投递webhook_outbox中到期的消息, 直到ctx结束
+func StartWebhookDelivery(ctx context.Context, endpoints []*WebhookEndpoint) {
+	endpointsByName := make(map[string]*WebhookEndpoint)
+	for _, endpoint := range endpoints {
+		endpointsByName[endpoint.Name] = endpoint
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+		items, err := db.FindDueWebhookOutboxItems(time.Now(), 100)
+		if err != nil {
+			logger.Println("find due webhook outbox items error " + err.Error())
+			continue
+		}
+		for _, item := range items {
+			err = deliverWebhookOutboxItem(endpointsByName, item)
+			if err != nil {
+				logger.Println("update webhook outbox item error " + err.Error())
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package plugins
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	tests := []struct {
+		secret  string
+		payload string
+		want    string
+	}{
+		// RFC 4231 test case 2
+		{"Jefe", "what do ya want for nothing?", "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{"", "", "sha256=b613679a0814d9ec772f95d778c35fc5ff1697c493715653c6c712144292c5ad"},
+	}
+	for _, test := range tests {
+		if got := SignWebhookPayload(test.secret, []byte(test.payload)); got != test.want {
+			t.Errorf("SignWebhookPayload(%q, %q) = %s, want %s", test.secret, test.payload, got, test.want)
+		}
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{10, 1024 * time.Second},
+		{12, time.Hour},
+		{100, time.Hour},
+	}
+	for _, test := range tests {
+		if got := webhookRetryDelay(test.attempts); got != test.want {
+			t.Errorf("webhookRetryDelay(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
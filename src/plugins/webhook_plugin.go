@@ -0,0 +1,202 @@
+package plugins
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+// webhook的过滤条件, 同一个filter中设置了的字段都要满足.
+// 设置了token_contract或event_name时匹配合约事件, 否则匹配operation
+type WebhookFilter struct {
+	OpTypeName    string   `json:"op_type_name"`
+	ToAddrs       []string `json:"to_addrs"`
+	TokenContract string   `json:"token_contract"`
+	EventName     string   `json:"event_name"`
+}
+
+func (filter *WebhookFilter) isEventFilter() bool {
+	return len(filter.TokenContract) > 0 || len(filter.EventName) > 0
+}
+
+func (filter *WebhookFilter) matchToAddr(toAddr string) bool {
+	if len(filter.ToAddrs) < 1 {
+		return true
+	}
+	return isStringInArray(toAddr, filter.ToAddrs)
+}
+
+func (filter *WebhookFilter) matchOperation(opTypeName string, opJSON map[string]interface{}) bool {
+	if filter.isEventFilter() {
+		return false
+	}
+	if len(filter.OpTypeName) > 0 && filter.OpTypeName != opTypeName {
+		return false
+	}
+	if len(filter.ToAddrs) > 0 {
+		toAddr, _ := mapGetString(opJSON, "to_addr")
+		return filter.matchToAddr(toAddr)
+	}
+	return len(filter.OpTypeName) > 0
+}
+
+func (filter *WebhookFilter) matchEvent(opTypeName string, event *types.HxContractOpReceiptEvent) bool {
+	if !filter.isEventFilter() {
+		return false
+	}
+	if len(filter.OpTypeName) > 0 && filter.OpTypeName != opTypeName {
+		return false
+	}
+	if len(filter.TokenContract) > 0 && filter.TokenContract != event.ContractAddress {
+		return false
+	}
+	eventName := filter.EventName
+	if len(eventName) < 1 {
+		eventName = "Transfer"
+	}
+	if eventName != event.EventName {
+		return false
+	}
+	if len(filter.ToAddrs) > 0 {
+		var eventArg map[string]interface{}
+		if json.Unmarshal([]byte(event.EventArg), &eventArg) != nil {
+			return false
+		}
+		toAddr, _ := mapGetString(eventArg, "to")
+		return filter.matchToAddr(toAddr)
+	}
+	return true
+}
+
+type WebhookEndpoint struct {
+	Name        string           `json:"name"`
+	Url         string           `json:"url"`
+	Secret      string           `json:"secret"`
+	MaxAttempts int              `json:"max_attempts"`
+	Filters     []*WebhookFilter `json:"filters"`
+}
+
+const defaultWebhookMaxAttempts = 10
+
+// 从json配置文件读取webhook endpoints, 格式是 [{name, url, secret, max_attempts, filters: [...]}]
+func LoadWebhookEndpoints(configPath string) (result []*WebhookEndpoint, err error) {
+	configBytes, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(configBytes, &result)
+	if err != nil {
+		return
+	}
+	names := make(map[string]bool)
+	for _, endpoint := range result {
+		if len(endpoint.Name) < 1 || len(endpoint.Url) < 1 {
+			err = errors.New("webhook endpoint requires name and url")
+			return
+		}
+		if names[endpoint.Name] {
+			err = errors.New("duplicate webhook endpoint name " + endpoint.Name)
+			return
+		}
+		names[endpoint.Name] = true
+		if endpoint.MaxAttempts <= 0 {
+			endpoint.MaxAttempts = defaultWebhookMaxAttempts
+		}
+	}
+	return
+}
+
+type webhookPayload struct {
+	Endpoint   string                          `json:"endpoint"`
+	Kind       string                          `json:"kind"`
+	BlockNum   int                             `json:"block_num"`
+	BlockTime  string                          `json:"block_time"`
+	Txid       string                          `json:"txid"`
+	OpNum      int                             `json:"op_num"`
+	OpTypeName string                          `json:"op_type_name"`
+	Operation  map[string]interface{}          `json:"operation,omitempty"`
+	Event      *types.HxContractOpReceiptEvent `json:"event,omitempty"`
+}
+
+// 匹配到过滤条件的operation/合约事件写入webhook_outbox表, 由webhook投递任务异步POST到endpoint
+type WebhookPlugin struct {
+	Endpoints []*WebhookEndpoint
+}
+
+func (plugin *WebhookPlugin) PluginName() string {
+	return "WebhookPlugin"
+}
+
+func (plugin *WebhookPlugin) ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string,
+	opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
+	for _, endpoint := range plugin.Endpoints {
+		for _, filter := range endpoint.Filters {
+			if filter.matchOperation(opTypeName, opJSON) {
+				payload := &webhookPayload{Kind: "operation", OpTypeName: opTypeName, Operation: opJSON}
+				err = plugin.enqueue(endpoint, block, txid, opNum, -1, payload)
+				if err != nil {
+					return
+				}
+				break
+			}
+		}
+		if receipt == nil || !receipt.ExecSucceed {
+			continue
+		}
+		for eventIndex, event := range receipt.Events {
+			for _, filter := range endpoint.Filters {
+				if filter.matchEvent(opTypeName, event) {
+					payload := &webhookPayload{Kind: "contract_event", OpTypeName: opTypeName, Event: event}
+					err = plugin.enqueue(endpoint, block, txid, opNum, eventIndex, payload)
+					if err != nil {
+						return
+					}
+					break
+				}
+			}
+		}
+	}
+	return
+}
+
+func (plugin *WebhookPlugin) enqueue(endpoint *WebhookEndpoint, block *types.HxBlock, txid string, opNum int,
+	eventIndex int, payload *webhookPayload) (err error) {
+	// 重复扫描同一个块时不重复入队
+	oldItem, err := db.FindWebhookOutboxItem(endpoint.Name, txid, opNum, eventIndex)
+	if err != nil {
+		return
+	}
+	if oldItem != nil {
+		return
+	}
+	payload.Endpoint = endpoint.Name
+	payload.BlockNum = block.BlockNumber
+	payload.BlockTime = block.Timestamp
+	payload.Txid = txid
+	payload.OpNum = opNum
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	item := &db.WebhookOutboxEntity{
+		EndpointName:  endpoint.Name,
+		Url:           endpoint.Url,
+		Kind:          payload.Kind,
+		BlockNum:      uint32(block.BlockNumber),
+		Txid:          txid,
+		OpNum:         opNum,
+		EventIndex:    eventIndex,
+		Payload:       string(payloadBytes),
+		Status:        db.WebhookOutboxStatusPending,
+		Attempts:      0,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now}
+	err = db.SaveWebhookOutboxItem(item)
+	return
+}
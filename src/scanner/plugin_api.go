@@ -8,3 +8,19 @@ type OpScannerPlugin interface {
 	PluginName() string
 	ApplyOperation(block *types.HxBlock, txid string, opNum int, opType int, opTypeName string, opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error)
 }
+
+// 需要在每个块的所有operation处理完之后执行的插件, 除了OpScannerPlugin外再实现这个接口
+type BlockScannerPlugin interface {
+	ApplyBlock(block *types.HxBlock) (err error)
+}
+
+// 会调用sink.Emit的插件实现这个接口. sink落后时重放的块不执行插件的ApplyOperation/ApplyBlock,
+// 只调用这个方法从已经保存的数据重新输出这个operation的sink记录, 不能请求节点也不能写数据库
+type SinkReplayPlugin interface {
+	ReplayOperationRecords(block *types.HxBlock, txid string, opNum int) (err error)
+}
+
+// 同SinkReplayPlugin, 在重放的块的所有operation之后重新输出块级别的sink记录
+type SinkReplayBlockPlugin interface {
+	ReplayBlockRecords(block *types.HxBlock) (err error)
+}
@@ -11,6 +11,7 @@ import (
 	"context"
 	"github.com/blocklink/hxscanner/src/types"
 	"github.com/blocklink/hxscanner/src/log"
+	"github.com/blocklink/hxscanner/src/sink"
 )
 
 var logger = log.GetLogger()
@@ -32,12 +33,35 @@ func cachedGetTableSchema(tableName string) (result *db.PgTableSchema, err error
 
 var scanPlugins = make([]OpScannerPlugin, 0)
 
+// 不大于这个块号的块其他插件已经处理过, 只是为了落后的sink重新扫描
+var sinkReplayUntilBlockNum = 0
+
+func SetSinkReplayUntil(blockNum int) {
+	sinkReplayUntilBlockNum = blockNum
+}
+
+func isSinkReplayBlock(blockNum int) bool {
+	return blockNum <= sinkReplayUntilBlockNum
+}
+
 func AddScanPlugin(plugin OpScannerPlugin) {
 	scanPlugins = append(scanPlugins, plugin)
 }
 
 func ApplyPluginsToOperation(block *types.HxBlock, txid string, opIndex int, opType int, opTypeName string, opJSON map[string]interface{}, receipt *types.HxContractOpReceipt) (err error) {
 	for _, plugin := range scanPlugins {
+		if isSinkReplayBlock(block.BlockNumber) {
+			replayPlugin, ok := plugin.(SinkReplayPlugin)
+			if !ok {
+				continue
+			}
+			err = replayPlugin.ReplayOperationRecords(block, txid, opIndex)
+			if err != nil {
+				logger.Println("error with replay plugin " + plugin.PluginName() + " records of optype " + opTypeName + ": " + err.Error())
+				return
+			}
+			continue
+		}
 		err = plugin.ApplyOperation(block, txid, opIndex, opType, opTypeName, opJSON, receipt)
 		if err != nil {
 			logger.Println("error with apply plugin " + plugin.PluginName() + " to optype " + opTypeName + ": " + err.Error())
@@ -47,6 +71,33 @@ func ApplyPluginsToOperation(block *types.HxBlock, txid string, opIndex int, opT
 	return
 }
 
+func ApplyPluginsToBlock(block *types.HxBlock) (err error) {
+	for _, plugin := range scanPlugins {
+		if isSinkReplayBlock(block.BlockNumber) {
+			replayPlugin, ok := plugin.(SinkReplayBlockPlugin)
+			if !ok {
+				continue
+			}
+			err = replayPlugin.ReplayBlockRecords(block)
+			if err != nil {
+				logger.Println("error with replay plugin " + plugin.PluginName() + " records of block #" + strconv.Itoa(block.BlockNumber) + ": " + err.Error())
+				return
+			}
+			continue
+		}
+		blockPlugin, ok := plugin.(BlockScannerPlugin)
+		if !ok {
+			continue
+		}
+		err = blockPlugin.ApplyBlock(block)
+		if err != nil {
+			logger.Println("error with apply plugin " + plugin.PluginName() + " to block #" + strconv.Itoa(block.BlockNumber) + ": " + err.Error())
+			return
+		}
+	}
+	return
+}
+
 func ScanBlocksFrom(ctx context.Context, startBlockNum int) {
 	scannedBlockNum := startBlockNum
 	end := false
@@ -93,6 +144,24 @@ func ScanBlocksFrom(ctx context.Context, startBlockNum int) {
 				break
 			}
 		}
+		if len(block.RawJSON) > 0 {
+			oldRawBlock, err := db.FindRawBlockJSON(uint32(block.BlockNumber))
+			if err != nil {
+				logger.Println("find raw block at #" + strconv.Itoa(scannedBlockNum) + " with error " + err.Error())
+				break
+			}
+			if oldRawBlock == nil {
+				err = db.SaveRawBlockJSON(uint32(block.BlockNumber), string(block.RawJSON))
+				if err != nil {
+					logger.Println("save raw block to db error " + err.Error())
+					break
+				}
+			}
+		}
+		sink.Emit(&sink.Record{Kind: sink.RecordKindBlock, BlockNum: uint32(block.BlockNumber), Data: map[string]interface{}{
+			"number": block.BlockNumber, "previous": block.Previous, "timestamp": block.Timestamp, "miner": block.Miner,
+			"trxfee": block.Trxfee, "transaction_merkle_root": block.TransactionMerkleRoot, "txs_count": len(block.Transactions),
+			"transaction_ids": block.TransactionIds}})
 		// 取到block后，修改它上一个块的block_hash
 		if block.BlockNumber > 1 {
 			prevBlock, err := db.FindBlock(block.BlockNumber-1)
@@ -138,6 +207,8 @@ func ScanBlocksFrom(ctx context.Context, startBlockNum int) {
 				}
 			}
 
+			sink.Emit(&sink.Record{Kind: sink.RecordKindTransaction, BlockNum: uint32(block.BlockNumber), Txid: txInfo.Trxid, Data: txInfo})
+
 			for opIndex := 0;opIndex < len(txInfo.Operations);opIndex++ {
 				opPair := txInfo.Operations[opIndex]
 				if len(opPair) != 2 {
@@ -273,6 +344,8 @@ func ScanBlocksFrom(ctx context.Context, startBlockNum int) {
 						break
 					}
 				}
+				sink.Emit(&sink.Record{Kind: sink.RecordKindOperation, BlockNum: uint32(block.BlockNumber), Txid: txInfo.Trxid, OpNum: opIndex,
+					Data: map[string]interface{}{"operation_type": opTypeInt, "operation_type_name": opTypeName, "operation": opJson}})
 				var receipt *types.HxContractOpReceipt = nil
 				if txReceipts != nil && len(txReceipts.OpReceipts) > opIndex {
 					receipt = txReceipts.OpReceipts[opIndex]
@@ -285,6 +358,7 @@ func ScanBlocksFrom(ctx context.Context, startBlockNum int) {
 			}
 			if txHasContractOp && txReceipts != nil {
 				for _, opReceipt := range txReceipts.OpReceipts {
+					sink.Emit(&sink.Record{Kind: sink.RecordKindReceipt, BlockNum: uint32(block.BlockNumber), Txid: opReceipt.Trxid, OpNum: opReceipt.OpNum, Data: opReceipt})
 					oldDbOpReceipt, err := db.FindContractOpReceipt(opReceipt.Trxid, opReceipt.OpNum)
 					if err != nil {
 						logger.Fatal("FindContractOpReceipt error " + err.Error())
@@ -300,7 +374,18 @@ func ScanBlocksFrom(ctx context.Context, startBlockNum int) {
 				}
 			}
 		}
-		if scannedBlockNum % 100 == 0 {
+		err = ApplyPluginsToBlock(block)
+		if err != nil {
+			logger.Fatal("apply plugin to block error", err)
+			break
+		}
+		err = sink.FlushBlock(uint32(block.BlockNumber), isSinkReplayBlock(block.BlockNumber))
+		if err != nil {
+			logger.Fatal("publish block to sinks error", err)
+			break
+		}
+		// 重放sink时last_scanned_block_number不能后退
+		if scannedBlockNum % 100 == 0 && !isSinkReplayBlock(scannedBlockNum) {
 			logger.Println("scanned block #" + strconv.Itoa(scannedBlockNum))
 			err = db.UpdateLastScannedBlockNumber(scannedBlockNum)
 			if err != nil {
@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultNDJSONMaxFileBytes = 256 * 1024 * 1024
+
+// 每行一条json记录写到目录下的文件, 文件超过maxFileBytes后换新文件
+type NDJSONFileSink struct {
+	dir          string
+	maxFileBytes int64
+	file         *os.File
+	fileBytes    int64
+}
+
+func NewNDJSONFileSink(dir string, maxFileBytes int64) (*NDJSONFileSink, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONFileSink{dir: dir, maxFileBytes: maxFileBytes}, nil
+}
+
+func (s *NDJSONFileSink) SinkName() string {
+	return "ndjson:" + s.dir
+}
+
+func (s *NDJSONFileSink) rotate(blockNum uint32) error {
+	if s.file != nil {
+		err := s.file.Close()
+		if err != nil {
+			return err
+		}
+		s.file = nil
+	}
+	fileName := fmt.Sprintf("hxscanner-%010d-%d.ndjson", blockNum, time.Now().Unix())
+	file, err := os.OpenFile(filepath.Join(s.dir, fileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.file = file
+	s.fileBytes = 0
+	return nil
+}
+
+func (s *NDJSONFileSink) Publish(blockNum uint32, records []*Record) error {
+	if s.file == nil || s.fileBytes >= s.maxFileBytes {
+		err := s.rotate(blockNum)
+		if err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, 0)
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	n, err := s.file.Write(buf)
+	s.fileBytes += int64(n)
+	if err != nil {
+		return err
+	}
+	// 写到磁盘后才算送达
+	return s.file.Sync()
+}
+
+func (s *NDJSONFileSink) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
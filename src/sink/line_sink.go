@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// 每行一条json记录写到stdout或tcp连接
+type LineSink struct {
+	name string
+	// 返回写入目标, tcp断开后重新连接
+	dial   func() (io.WriteCloser, error)
+	writer io.WriteCloser
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+func NewStdoutSink() *LineSink {
+	return &LineSink{name: "stdout", dial: func() (io.WriteCloser, error) {
+		return nopCloser{os.Stdout}, nil
+	}}
+}
+
+func NewTCPSink(addr string) *LineSink {
+	return &LineSink{name: "tcp:" + addr, dial: func() (io.WriteCloser, error) {
+		return net.DialTimeout("tcp", addr, 10*time.Second)
+	}}
+}
+
+func (s *LineSink) SinkName() string {
+	return s.name
+}
+
+func (s *LineSink) Publish(blockNum uint32, records []*Record) (err error) {
+	if s.writer == nil {
+		s.writer, err = s.dial()
+		if err != nil {
+			return
+		}
+	}
+	bufWriter := bufio.NewWriter(s.writer)
+	for _, record := range records {
+		var line []byte
+		line, err = json.Marshal(record)
+		if err != nil {
+			return
+		}
+		line = append(line, '\n')
+		_, err = bufWriter.Write(line)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = bufWriter.Flush()
+	}
+	if err != nil {
+		// 下次发送时重新连接
+		_ = s.writer.Close()
+		s.writer = nil
+	}
+	return
+}
+
+func (s *LineSink) Close() error {
+	if s.writer == nil {
+		return nil
+	}
+	err := s.writer.Close()
+	s.writer = nil
+	return err
+}
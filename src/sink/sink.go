@@ -0,0 +1,197 @@
+package sink
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blocklink/hxscanner/src/db"
+	"github.com/blocklink/hxscanner/src/log"
+)
+
+var logger = log.GetLogger()
+
+const (
+	RecordKindBlock         = "block"
+	RecordKindTransaction   = "transaction"
+	RecordKindOperation     = "operation"
+	RecordKindReceipt       = "receipt"
+	RecordKindTokenTransfer = "token_transfer"
+	RecordKindBalanceChange = "balance_change"
+	// 冷热转账超过配置的块数还没有合并签名
+	RecordKindColdhotUnsignedAlert = "coldhot_unsigned_alert"
+)
+
+// 扫描器和插件发布到sink的标准化记录
+type Record struct {
+	Kind     string      `json:"kind"`
+	BlockNum uint32      `json:"block_num"`
+	Txid     string      `json:"txid,omitempty"`
+	OpNum    int         `json:"op_num"`
+	Data     interface{} `json:"data"`
+}
+
+// 输出到数据库之外的目标. 每个块的记录一起发送, Publish返回nil表示这个块已经送达,
+// 之后才会更新这个sink的cursor, 所以每个sink至少收到一次每条记录(重启后可能重复)
+type Sink interface {
+	SinkName() string
+	Publish(blockNum uint32, records []*Record) error
+	Close() error
+}
+
+var sinks = make([]Sink, 0)
+
+// 进程内的监听者, 每个新扫描的块的记录送达所有sink后调用(为落后的sink重放的块不调用), 不记录cursor, 监听者自己不能阻塞
+type BlockListener func(blockNum uint32, records []*Record)
+
+var blockListeners = make([]BlockListener, 0)
+
+var pendingMutex sync.Mutex
+var pendingRecords = make([]*Record, 0)
+
+const publishMaxAttempts = 5
+
+func AddSink(s Sink) {
+	sinks = append(sinks, s)
+}
+
+func HasSinks() bool {
+	return len(sinks) > 0
+}
+
+func AddBlockListener(listener BlockListener) {
+	blockListeners = append(blockListeners, listener)
+}
+
+func CloseSinks() {
+	for _, s := range sinks {
+		err := s.Close()
+		if err != nil {
+			logger.Println("close sink " + s.SinkName() + " error " + err.Error())
+		}
+	}
+}
+
+// 有sink或者监听者时才需要生成记录
+func Enabled() bool {
+	return HasSinks() || len(blockListeners) > 0
+}
+
+// 缓存当前块的记录, 在FlushBlock时发送
+func Emit(record *Record) {
+	if !Enabled() {
+		return
+	}
+	pendingMutex.Lock()
+	defer pendingMutex.Unlock()
+	pendingRecords = append(pendingRecords, record)
+}
+
+func cursorConfigKey(s Sink) string {
+	return "sink_cursor_" + s.SinkName()
+}
+
+// sink已经送达的最后一个块号
+func GetSinkCursor(s Sink) (cursor uint32, found bool, err error) {
+	cursorStr, err := db.GetScanConfigOr(cursorConfigKey(s), "")
+	if err != nil || len(cursorStr) < 1 {
+		return
+	}
+	cursorInt, err := strconv.Atoi(cursorStr)
+	if err != nil {
+		return
+	}
+	cursor = uint32(cursorInt)
+	found = true
+	return
+}
+
+// 新加的sink从lastScannedBlockNum之后开始输出, 返回所有sink中最小的cursor, 扫描需要从这个块之后开始
+func InitSinkCursors(lastScannedBlockNum uint32) (minCursor uint32, err error) {
+	minCursor = lastScannedBlockNum
+	for _, s := range sinks {
+		cursor, found, cursorErr := GetSinkCursor(s)
+		if cursorErr != nil {
+			err = cursorErr
+			return
+		}
+		if !found {
+			err = db.SetScanConfig(cursorConfigKey(s), strconv.Itoa(int(lastScannedBlockNum)))
+			if err != nil {
+				return
+			}
+			cursor = lastScannedBlockNum
+		}
+		if cursor < minCursor {
+			minCursor = cursor
+		}
+	}
+	return
+}
+
+// 块处理完后把缓存的记录发送到cursor还没有到这个块的sink. replayed表示这个块是为落后的sink重放的, 不再通知监听者
+func FlushBlock(blockNum uint32, replayed bool) (err error) {
+	pendingMutex.Lock()
+	records := pendingRecords
+	pendingRecords = make([]*Record, 0)
+	pendingMutex.Unlock()
+	for _, record := range records {
+		if record.BlockNum == 0 {
+			record.BlockNum = blockNum
+		}
+	}
+	for _, s := range sinks {
+		cursor, found, cursorErr := GetSinkCursor(s)
+		if cursorErr != nil {
+			return cursorErr
+		}
+		if found && blockNum <= cursor {
+			continue
+		}
+		for attempt := 1; ; attempt++ {
+			err = s.Publish(blockNum, records)
+			if err == nil {
+				break
+			}
+			logger.Println("publish block #" + strconv.Itoa(int(blockNum)) + " to sink " + s.SinkName() + " error " + err.Error())
+			if attempt >= publishMaxAttempts {
+				return
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		err = db.SetScanConfig(cursorConfigKey(s), strconv.Itoa(int(blockNum)))
+		if err != nil {
+			return
+		}
+	}
+	if replayed {
+		return
+	}
+	for _, listener := range blockListeners {
+		listener(blockNum, records)
+	}
+	return
+}
+
+// 根据命令行参数创建sink: ndjson:<dir>, stdout, tcp:<host:port>
+func NewSinkFromSpec(spec string) (Sink, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	switch parts[0] {
+	case "ndjson":
+		if len(parts) < 2 || len(parts[1]) < 1 {
+			return nil, errors.New("ndjson sink requires directory, eg. ndjson:/data/hxscanner")
+		}
+		return NewNDJSONFileSink(parts[1], defaultNDJSONMaxFileBytes)
+	case "stdout":
+		return NewStdoutSink(), nil
+	case "tcp":
+		if len(parts) < 2 || len(parts[1]) < 1 {
+			return nil, errors.New("tcp sink requires address, eg. tcp:127.0.0.1:9000")
+		}
+		return NewTCPSink(parts[1]), nil
+	default:
+		return nil, errors.New("unknown sink type " + parts[0])
+	}
+}
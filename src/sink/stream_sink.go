@@ -0,0 +1,51 @@
+package sink
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// kafka/nats等消息队列客户端实现这个接口后可以用StreamSink接入.
+// Flush返回nil时之前Produce的消息都需要已经被服务端确认
+type MessageStreamAdapter interface {
+	Produce(topic string, key []byte, value []byte) error
+	Flush() error
+	Close() error
+}
+
+// 每类记录发到 topicPrefix + kind 的topic, 有txid的记录用txid做key, 否则用块号
+type StreamSink struct {
+	Name        string
+	TopicPrefix string
+	Adapter     MessageStreamAdapter
+}
+
+func NewStreamSink(name string, topicPrefix string, adapter MessageStreamAdapter) *StreamSink {
+	return &StreamSink{Name: name, TopicPrefix: topicPrefix, Adapter: adapter}
+}
+
+func (s *StreamSink) SinkName() string {
+	return s.Name
+}
+
+func (s *StreamSink) Publish(blockNum uint32, records []*Record) error {
+	for _, record := range records {
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		key := record.Txid
+		if len(key) < 1 {
+			key = strconv.Itoa(int(record.BlockNum))
+		}
+		err = s.Adapter.Produce(s.TopicPrefix+record.Kind, []byte(key), value)
+		if err != nil {
+			return err
+		}
+	}
+	return s.Adapter.Flush()
+}
+
+func (s *StreamSink) Close() error {
+	return s.Adapter.Close()
+}
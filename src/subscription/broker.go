@@ -0,0 +1,184 @@
+package subscription
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/blocklink/hxscanner/src/log"
+	"github.com/blocklink/hxscanner/src/sink"
+	"github.com/blocklink/hxscanner/src/types"
+)
+
+var logger = log.GetLogger()
+
+const (
+	TopicNewBlock       = "new_block"
+	TopicNewTransaction = "new_transaction"
+	TopicOperation      = "operation"
+	TopicContractEvent  = "contract_event"
+	TopicBalanceChange  = "balance_change"
+)
+
+// 每个连接最多缓存的推送数, 满了说明客户端读得太慢, 直接断开, 不让扫描等待
+const clientOutboxSize = 1000
+
+// subscribe的参数, 除topic外的字段是可选的过滤条件
+type SubscribeParams struct {
+	Topic           string `json:"topic"`
+	OpTypeName      string `json:"op_type_name"`
+	Addr            string `json:"addr"`
+	ContractAddress string `json:"contract_address"`
+	EventName       string `json:"event_name"`
+}
+
+type Subscription struct {
+	Id     string
+	Params SubscribeParams
+}
+
+type Notification struct {
+	Subscription string      `json:"subscription"`
+	Topic        string      `json:"topic"`
+	BlockNum     uint32      `json:"block_num"`
+	Txid         string      `json:"txid,omitempty"`
+	OpNum        int         `json:"op_num"`
+	Data         interface{} `json:"data"`
+}
+
+func isValidTopic(topic string) bool {
+	switch topic {
+	case TopicNewBlock, TopicNewTransaction, TopicOperation, TopicContractEvent, TopicBalanceChange:
+		return true
+	}
+	return false
+}
+
+// operation json中以addr结尾的字段, 如from_addr, to_addr, caller_addr
+func operationHasAddr(opJson map[string]interface{}, addr string) bool {
+	for key, value := range opJson {
+		if !strings.HasSuffix(key, "addr") {
+			continue
+		}
+		if valueStr, ok := value.(string); ok && valueStr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// 把一条记录转成这个订阅要推送的数据, 不匹配时返回空
+func (sub *Subscription) notificationsOf(record *sink.Record) (result []*Notification) {
+	params := &sub.Params
+	newNotification := func(data interface{}) *Notification {
+		return &Notification{Subscription: sub.Id, Topic: params.Topic, BlockNum: record.BlockNum,
+			Txid: record.Txid, OpNum: record.OpNum, Data: data}
+	}
+	switch params.Topic {
+	case TopicNewBlock:
+		if record.Kind == sink.RecordKindBlock {
+			result = append(result, newNotification(record.Data))
+		}
+	case TopicNewTransaction:
+		if record.Kind == sink.RecordKindTransaction {
+			result = append(result, newNotification(record.Data))
+		}
+	case TopicOperation:
+		if record.Kind != sink.RecordKindOperation {
+			return
+		}
+		data, ok := record.Data.(map[string]interface{})
+		if !ok {
+			return
+		}
+		if len(params.OpTypeName) > 0 && data["operation_type_name"] != params.OpTypeName {
+			return
+		}
+		if len(params.Addr) > 0 {
+			opJson, ok := data["operation"].(map[string]interface{})
+			if !ok || !operationHasAddr(opJson, params.Addr) {
+				return
+			}
+		}
+		result = append(result, newNotification(data))
+	case TopicContractEvent:
+		if record.Kind != sink.RecordKindReceipt {
+			return
+		}
+		receipt, ok := record.Data.(*types.HxContractOpReceipt)
+		if !ok {
+			return
+		}
+		for _, event := range receipt.Events {
+			if len(params.ContractAddress) > 0 && event.ContractAddress != params.ContractAddress {
+				continue
+			}
+			if len(params.EventName) > 0 && event.EventName != params.EventName {
+				continue
+			}
+			result = append(result, newNotification(event))
+		}
+	case TopicBalanceChange:
+		if record.Kind != sink.RecordKindBalanceChange {
+			return
+		}
+		data, ok := record.Data.(map[string]interface{})
+		if !ok {
+			return
+		}
+		if len(params.Addr) > 0 && data["owner_addr"] != params.Addr {
+			return
+		}
+		result = append(result, newNotification(data))
+	}
+	return
+}
+
+// 进程内的订阅分发, 扫描器每处理完一个块调用PublishBlock
+type Broker struct {
+	mutex   sync.RWMutex
+	clients map[*client]bool
+	lastId  uint64
+}
+
+func NewBroker() *Broker {
+	return &Broker{clients: make(map[*client]bool)}
+}
+
+func (broker *Broker) nextSubscriptionId() string {
+	return strconv.FormatUint(atomic.AddUint64(&broker.lastId, 1), 10)
+}
+
+func (broker *Broker) addClient(c *client) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	broker.clients[c] = true
+}
+
+func (broker *Broker) removeClient(c *client) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+	delete(broker.clients, c)
+}
+
+// 作为sink.BlockListener使用. 不会阻塞, 推送队列满的客户端会被断开
+func (broker *Broker) PublishBlock(blockNum uint32, records []*sink.Record) {
+	broker.mutex.RLock()
+	defer broker.mutex.RUnlock()
+	for c := range broker.clients {
+		notifications := make([]*Notification, 0)
+		for _, sub := range c.subscriptionsSnapshot() {
+			for _, record := range records {
+				notifications = append(notifications, sub.notificationsOf(record)...)
+			}
+		}
+		for _, notification := range notifications {
+			if !c.trySend(notification) {
+				logger.Println("subscription client " + c.remoteAddr + " too slow, disconnecting")
+				go c.close()
+				break
+			}
+		}
+	}
+}
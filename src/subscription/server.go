@@ -0,0 +1,171 @@
+package subscription
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/rpc"
+	"sync"
+
+	"github.com/blocklink/hxscanner/wsjsonrpc/jsonrpc"
+	"golang.org/x/net/websocket"
+)
+
+// 推送给客户端的通知, 格式和json-rpc 1.0的notification一样(id为null)
+type notificationMessage struct {
+	Id     interface{}     `json:"id"`
+	Method string          `json:"method"`
+	Params []*Notification `json:"params"`
+}
+
+// 一个websocket连接. 请求的响应和推送都通过writeMutex串行写到连接上
+type client struct {
+	broker     *Broker
+	conn       *websocket.Conn
+	codec      rpc.ServerCodec
+	remoteAddr string
+	writeMutex sync.Mutex
+	outbox     chan *Notification
+	subsMutex  sync.Mutex
+	subs       map[string]*Subscription
+	closeOnce  sync.Once
+	done       chan struct{}
+}
+
+func (c *client) subscriptionsSnapshot() []*Subscription {
+	c.subsMutex.Lock()
+	defer c.subsMutex.Unlock()
+	result := make([]*Subscription, 0, len(c.subs))
+	for _, sub := range c.subs {
+		result = append(result, sub)
+	}
+	return result
+}
+
+func (c *client) trySend(notification *Notification) bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+	}
+	select {
+	case c.outbox <- notification:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err := c.codec.Close()
+		if err != nil {
+			logger.Println("close subscription client " + c.remoteAddr + " error " + err.Error())
+		}
+	})
+}
+
+func (c *client) writeNotifications() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case notification := <-c.outbox:
+			c.writeMutex.Lock()
+			err := json.NewEncoder(c.conn).Encode(&notificationMessage{Method: "notify", Params: []*Notification{notification}})
+			c.writeMutex.Unlock()
+			if err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+func (c *client) writeResponse(req *rpc.Request, result interface{}, err error) error {
+	resp := &rpc.Response{ServiceMethod: req.ServiceMethod, Seq: req.Seq}
+	if err != nil {
+		resp.Error = err.Error()
+		result = nil
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.codec.WriteResponse(resp, result)
+}
+
+// subscribe [{"topic": ..., 过滤条件}] 返回订阅id, unsubscribe ["订阅id"] 返回true
+func (c *client) handleRequest(req *rpc.Request) (result interface{}, err error) {
+	switch req.ServiceMethod {
+	case "subscribe":
+		params := new(SubscribeParams)
+		err = c.codec.ReadRequestBody(params)
+		if err != nil {
+			return
+		}
+		if !isValidTopic(params.Topic) {
+			err = errors.New("unknown topic " + params.Topic)
+			return
+		}
+		sub := &Subscription{Id: c.broker.nextSubscriptionId(), Params: *params}
+		c.subsMutex.Lock()
+		c.subs[sub.Id] = sub
+		c.subsMutex.Unlock()
+		result = sub.Id
+	case "unsubscribe":
+		var subId string
+		err = c.codec.ReadRequestBody(&subId)
+		if err != nil {
+			return
+		}
+		c.subsMutex.Lock()
+		_, found := c.subs[subId]
+		delete(c.subs, subId)
+		c.subsMutex.Unlock()
+		result = found
+	default:
+		err = c.codec.ReadRequestBody(nil)
+		if err != nil {
+			return
+		}
+		err = errors.New("unknown method " + req.ServiceMethod)
+	}
+	return
+}
+
+func (broker *Broker) serveConn(conn *websocket.Conn) {
+	c := &client{
+		broker:     broker,
+		conn:       conn,
+		codec:      jsonrpc.NewServerCodec(conn),
+		remoteAddr: conn.Request().RemoteAddr,
+		outbox:     make(chan *Notification, clientOutboxSize),
+		subs:       make(map[string]*Subscription),
+		done:       make(chan struct{}),
+	}
+	broker.addClient(c)
+	defer broker.removeClient(c)
+	defer c.close()
+	go c.writeNotifications()
+	for {
+		req := new(rpc.Request)
+		err := c.codec.ReadRequestHeader(req)
+		if err != nil {
+			return
+		}
+		result, err := c.handleRequest(req)
+		err = c.writeResponse(req, result, err)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// 启动websocket订阅服务, 客户端连接ws://<listenAddr>/ws, 阻塞直到出错
+func Serve(listenAddr string, broker *Broker) error {
+	mux := http.NewServeMux()
+	// 不检查Origin, 方便非浏览器客户端连接
+	mux.Handle("/ws", websocket.Server{Handler: broker.serveConn})
+	logger.Println("hxscanner subscription server listening on " + listenAddr)
+	return http.ListenAndServe(listenAddr, mux)
+}
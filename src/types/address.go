@@ -0,0 +1,62 @@
+package types
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+)
+
+const HxAddressPrefix = "HX"
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// 地址和公钥去掉HX前缀后base58解码的长度
+const (
+	hxAddressBytesLength = 25 // version(1) + ripemd160(20) + checksum(4)
+	hxPubKeyBytesLength  = 37 // compressed pubkey(33) + checksum(4)
+)
+
+func base58Decode(s string) (result []byte, ok bool) {
+	value := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		index := strings.IndexRune(base58Alphabet, c)
+		if index < 0 {
+			return
+		}
+		value.Mul(value, radix)
+		value.Add(value, big.NewInt(int64(index)))
+	}
+	leadingZeros := 0
+	for leadingZeros < len(s) && s[leadingZeros] == base58Alphabet[0] {
+		leadingZeros++
+	}
+	result = append(make([]byte, leadingZeros), value.Bytes()...)
+	ok = true
+	return
+}
+
+// 去掉HX前缀后base58解码, 长度是length并且最后4字节是前面内容的ripemd160的前4字节时有效
+func isValidHxString(s string, length int) bool {
+	if !strings.HasPrefix(s, HxAddressPrefix) || len(s) <= len(HxAddressPrefix) {
+		return false
+	}
+	decoded, ok := base58Decode(s[len(HxAddressPrefix):])
+	if !ok || len(decoded) != length {
+		return false
+	}
+	checksum := ripemd160Sum(decoded[:length-4])
+	return bytes.Equal(decoded[length-4:], checksum[:4])
+}
+
+func IsHxAddress(s string) bool {
+	return isValidHxString(s, hxAddressBytesLength)
+}
+
+func IsHxContractAddress(s string) bool {
+	return strings.HasPrefix(s, "HXC") && IsHxAddress(s)
+}
+
+func IsHxPubKey(s string) bool {
+	return isValidHxString(s, hxPubKeyBytesLength)
+}
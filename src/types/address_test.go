@@ -0,0 +1,94 @@
+package types
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func base58EncodeForTest(data []byte) string {
+	value := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	result := make([]byte, 0)
+	for value.Sign() > 0 {
+		value.DivMod(value, radix, mod)
+		result = append([]byte{base58Alphabet[mod.Int64()]}, result...)
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		result = append([]byte{base58Alphabet[0]}, result...)
+	}
+	return string(result)
+}
+
+// 内容加上ripemd160 checksum后编码成HX开头的字符串
+func hxStringForTest(content []byte) string {
+	checksum := ripemd160Sum(content)
+	return HxAddressPrefix + base58EncodeForTest(append(append([]byte{}, content...), checksum[:4]...))
+}
+
+func TestRipemd160Sum(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", "9c1185a5c5e9fc54612808977ee8f548b2258d31"},
+		{"abc", "8eb208f7e05d987a9b044a8e98c6b087f15a0bfc"},
+		{"message digest", "5d0689ef49d2fae572b881b123a85ffa21595f36"},
+		{"12345678901234567890123456789012345678901234567890123456789012345678901234567890",
+			"9b752e45573d4b39f4dbd3323cab82bf63326bfb"},
+	}
+	for _, test := range tests {
+		sum := ripemd160Sum([]byte(test.input))
+		if got := hex.EncodeToString(sum[:]); got != test.want {
+			t.Errorf("ripemd160(%q) = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestIsHxAddress(t *testing.T) {
+	addrContent := make([]byte, hxAddressBytesLength-4)
+	addrContent[0] = 0x35
+	for i := 1; i < len(addrContent); i++ {
+		addrContent[i] = byte(i * 7)
+	}
+	addr := hxStringForTest(addrContent)
+	// 改掉最后一个字符, checksum就不对了
+	lastChar := addr[len(addr)-1]
+	badChecksumChar := byte('2')
+	if lastChar == badChecksumChar {
+		badChecksumChar = '3'
+	}
+	badChecksumAddr := addr[:len(addr)-1] + string(badChecksumChar)
+	pubKeyContent := make([]byte, hxPubKeyBytesLength-4)
+	pubKeyContent[0] = 0x02
+	for i := 1; i < len(pubKeyContent); i++ {
+		pubKeyContent[i] = byte(i * 11)
+	}
+	pubKey := hxStringForTest(pubKeyContent)
+
+	tests := []struct {
+		s          string
+		wantAddr   bool
+		wantPubKey bool
+	}{
+		{addr, true, false},
+		{badChecksumAddr, false, false},
+		{addr[len(HxAddressPrefix):], false, false},
+		{"HX", false, false},
+		{"HX0OIl", false, false},
+		{pubKey, false, true},
+		{pubKey[:len(pubKey)-1], false, false},
+	}
+	for _, test := range tests {
+		if got := IsHxAddress(test.s); got != test.wantAddr {
+			t.Errorf("IsHxAddress(%q) = %v, want %v", test.s, got, test.wantAddr)
+		}
+		if got := IsHxPubKey(test.s); got != test.wantPubKey {
+			t.Errorf("IsHxPubKey(%q) = %v, want %v", test.s, got, test.wantPubKey)
+		}
+	}
+}
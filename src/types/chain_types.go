@@ -1,5 +1,6 @@
 package types
 
+import "encoding/json"
 
 type TxidArgs struct {
 	Txid string `json:"txid"`
@@ -38,6 +39,15 @@ type HxBlock struct {
 	Transactions          []*HxTransaction `json:"transactions"`
 	TransactionIds        []string         `json:"transaction_ids"`
 	Trxfee                int              `json:"trxfee"`
+	RawJSON               json.RawMessage  `json:"-"` // get_block返回的原始json
 }
 
 
+
+// get_objects返回的citizen(miner)对象, id是1.6.x
+type HxMinerObject struct {
+	Id                    string `json:"id"`
+	MinerAccount          string `json:"miner_account"`
+	TotalMissed           int64  `json:"total_missed"`
+	LastConfirmedBlockNum int64  `json:"last_confirmed_block_num"`
+}